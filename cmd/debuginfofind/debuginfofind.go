@@ -230,9 +230,9 @@ func checkSum(path string, crc uint32) (bool, error) {
 	}
 	defer file.Close()
 
-	d, err := io.ReadAll(file)
-	if err != nil {
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, file); err != nil {
 		return false, err
 	}
-	return crc == crc32.ChecksumIEEE(d), nil
+	return crc == h.Sum32(), nil
 }
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/parca-dev/runtime-data/pkg/datamap"
+)
+
+// explore runs the explore subcommand, which prints the layout of a type, like pahole does,
+// or the differences between its layouts in two binaries.
+func explore(logger *slog.Logger, args []string) {
+	fSet := flag.NewFlagSet("structlayout explore", flag.ExitOnError)
+	var (
+		src    sourceFlags
+		format string
+		depth  int
+	)
+	src.register(fSet)
+	fSet.StringVar(&format, "format", "text", "output format, e.g. text, yaml, json")
+	fSet.IntVar(&depth, "depth", -1, "number of levels of nested structs to expand, -1 expands all of them")
+
+	fSet.Usage = func() {
+		fmt.Printf("usage: structlayout explore [flags] <path-to-elf> <type-or-route>\n")
+		fmt.Printf("       structlayout explore [flags] <path-to-old-elf> <path-to-new-elf> <type-or-route>\n")
+		fmt.Printf("e.g: structlayout explore /usr/bin/python3.11 PyThreadState\n")
+		fmt.Printf("     structlayout explore libruby.so.3.2 libruby.so.3.3 'rb_vm_struct.ractor.main_thread*'\n")
+		fmt.Printf("     structlayout explore -source headers -I Include -D Py_GIL_DISABLED Include/Python.h PyObject\n\n")
+		fmt.Println("flags:")
+		fSet.PrintDefaults()
+	}
+	if err := fSet.Parse(args); err != nil {
+		logger.Error("failed to parse flags", "err", err)
+		os.Exit(1)
+	}
+	if fSet.NArg() != 2 && fSet.NArg() != 3 {
+		fSet.Usage()
+		os.Exit(1)
+	}
+	inputs, route := fSet.Args()[:fSet.NArg()-1], fSet.Arg(fSet.NArg()-1)
+	if format != "text" && format != "yaml" && format != "json" {
+		logger.Error("invalid format", "format", format)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// The whole layouts are compared.
+	if len(inputs) == 2 {
+		depth = -1
+	}
+	layouts := make([]*datamap.TypeLayout, 0, len(inputs))
+	for _, input := range inputs {
+		l, err := describeType(ctx, logger, &src, input, route, depth)
+		if err != nil {
+			logger.Error("failed to describe type", "file", input, "route", route, "err", err)
+			os.Exit(1)
+		}
+		layouts = append(layouts, l)
+	}
+
+	var err error
+	if len(layouts) == 1 {
+		err = writeTypeLayout(os.Stdout, layouts[0], format)
+	} else {
+		err = writeLayoutChanges(os.Stdout, datamap.DiffLayouts(layouts[0], layouts[1]), format)
+	}
+	if err != nil {
+		logger.Error("failed to write layout", "err", err)
+		os.Exit(1)
+	}
+}
+
+// describeType reads the layout of the struct at the end of the given route in the given input.
+func describeType(ctx context.Context, logger *slog.Logger, src *sourceFlags, input, route string, depth int) (*datamap.TypeLayout, error) {
+	idx, closeIndex, err := src.open(ctx, logger, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index type information: %w", err)
+	}
+	defer closeIndex()
+
+	return datamap.Describe(idx, route, depth)
+}
+
+func writeTypeLayout(w io.Writer, l *datamap.TypeLayout, format string) error {
+	switch format {
+	case "yaml":
+		return encodeYAML(w, l)
+	case "json":
+		return encodeJSON(w, l)
+	}
+	var lines []layoutLine
+	lines = appendLayoutLines(lines, l, 0, 0)
+	// The comments are aligned past the longest declaration, the tabs are expanded to do so.
+	width := 0
+	for i := range lines {
+		lines[i].decl = strings.ReplaceAll(lines[i].decl, "\t", "        ")
+		width = max(width, len(lines[i].decl))
+	}
+	for _, line := range lines {
+		if line.comment == "" {
+			fmt.Fprintln(w, line.decl)
+			continue
+		}
+		fmt.Fprintf(w, "%-*s %s\n", width, line.decl, line.comment)
+	}
+	return nil
+}
+
+// layoutLine is a line of the text format, a declaration followed by the offset and the size of the member.
+type layoutLine struct {
+	decl    string
+	comment string
+}
+
+// appendLayoutLines appends the lines of the given layout, which starts at the given offset,
+// in the format of pahole: the offsets are relative to the start of the outermost type,
+// the bitfields have their bit offset in the byte they start in, e.g. "12: 1".
+func appendLayoutLines(lines []layoutLine, l *datamap.TypeLayout, offset int64, depth int) []layoutLine {
+	indent := strings.Repeat("\t", depth)
+	if depth == 0 {
+		lines = append(lines, layoutLine{decl: strings.TrimSpace(l.Kind+" "+l.Name) + " {"})
+	}
+	for _, m := range l.Members {
+		off := offset + m.Offset
+		pos := fmt.Sprintf("/* %5d %5d */", off, m.Size)
+		if m.BitSize != 0 {
+			bits := offset*8 + m.BitOffset
+			pos = fmt.Sprintf("/* %5d:%2d %3d */", bits/8, bits%8, m.Size)
+		}
+		name := declarator(m)
+		if m.Base {
+			name = "<ancestor>"
+		}
+		switch {
+		case m.Layout != nil:
+			lines = append(lines, layoutLine{decl: indent + "\t" + strings.TrimSpace(m.Layout.Kind+" "+m.Layout.Name) + " {"})
+			lines = appendLayoutLines(lines, m.Layout, off, depth+1)
+			if m.Layout.Padding > 0 {
+				lines = append(lines, layoutLine{decl: fmt.Sprintf("%s\t\t/* XXX %d bytes padding */", indent, m.Layout.Padding)})
+			}
+			lines = append(lines, layoutLine{decl: strings.TrimSuffix(indent+"\t} "+name, " ") + ";", comment: pos})
+		case m.Base:
+			lines = append(lines, layoutLine{decl: indent + "\t" + m.Type + " " + name + ";", comment: pos})
+		default:
+			decl := indent + "\t" + elementType(m) + " " + name
+			if m.BitSize != 0 {
+				decl += fmt.Sprintf(":%d", m.BitSize)
+			}
+			comment := pos
+			if m.Pointee != "" {
+				comment += " /* -> " + m.Pointee + " */"
+			}
+			lines = append(lines, layoutLine{decl: decl + ";", comment: comment})
+		}
+		if m.Hole > 0 {
+			lines = append(lines, layoutLine{}, layoutLine{decl: fmt.Sprintf("%s\t/* XXX %d bytes hole */", indent, m.Hole)}, layoutLine{})
+		}
+	}
+	if depth == 0 {
+		summary := fmt.Sprintf("\t/* size: %d", l.Size)
+		if l.Padding > 0 {
+			summary += fmt.Sprintf(", padding: %d", l.Padding)
+		}
+		lines = append(lines, layoutLine{}, layoutLine{decl: summary + " */"}, layoutLine{decl: "};"})
+	}
+	return lines
+}
+
+// declarator returns the name of the member followed by the dimensions of the array it is, if any,
+// e.g. "padding[2]" for a member of type "long int[2]", "name[]" for a flexible array member.
+func declarator(m datamap.MemberLayout) string {
+	_, dims := splitDims(m)
+	return m.Name + strings.ReplaceAll(dims, "[-1]", "[]")
+}
+
+// elementType returns the type of the member, of its elements if it is an array.
+func elementType(m datamap.MemberLayout) string {
+	typ, _ := splitDims(m)
+	return typ
+}
+
+func splitDims(m datamap.MemberLayout) (string, string) {
+	if len(m.Count) > 0 && strings.HasSuffix(m.Type, "]") {
+		if i := strings.Index(m.Type, "["); i >= 0 {
+			return m.Type[:i], m.Type[i:]
+		}
+	}
+	return m.Type, ""
+}
+
+// writeLayoutChanges writes the differences between two layouts of a type,
+// the text format has one line per member: removed (-), added (+) or changed (~).
+func writeLayoutChanges(w io.Writer, changes []datamap.LayoutChange, format string) error {
+	switch format {
+	case "yaml":
+		return encodeYAML(w, changes)
+	case "json":
+		return encodeJSON(w, changes)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "no differences")
+		return nil
+	}
+	for _, c := range changes {
+		member := c.Member
+		if member == "" {
+			member = "(type)"
+		}
+		switch {
+		case c.New == nil:
+			fmt.Fprintf(w, "- %s %s\n", member, position(c.Old))
+		case c.Old == nil:
+			fmt.Fprintf(w, "+ %s %s\n", member, position(c.New))
+		default:
+			fmt.Fprintf(w, "~ %s %s -> %s\n", member, position(c.Old), position(c.New))
+		}
+	}
+	return nil
+}
+
+func position(p *datamap.MemberPosition) string {
+	if p.BitSize != 0 {
+		return fmt.Sprintf("%s:%d (bit offset %d, size %d)", p.Type, p.BitSize, p.BitOffset, p.Size)
+	}
+	return fmt.Sprintf("%s (offset %d, size %d)", p.Type, p.Offset, p.Size)
+}
+
+func encodeYAML(w io.Writer, v any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	return enc.Encode(v)
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/parca-dev/runtime-data/pkg/datamap"
+)
+
+// fieldAt runs the fieldat subcommand, which prints the member of a struct that contains a byte offset.
+func fieldAt(logger *slog.Logger, args []string) {
+	fSet := flag.NewFlagSet("structlayout fieldat", flag.ExitOnError)
+	var (
+		src    sourceFlags
+		format string
+	)
+	src.register(fSet)
+	fSet.StringVar(&format, "format", "text", "output format, e.g. text, yaml, json")
+
+	fSet.Usage = func() {
+		fmt.Printf("usage: structlayout fieldat [flags] <path-to-elf> <type-or-route> <offset>\n")
+		fmt.Printf("e.g: structlayout fieldat /usr/bin/python3.9 PyThreadState 0x58\n")
+		fmt.Printf("     structlayout fieldat libruby.so 'rb_vm_struct.ractor.main_thread*' 16\n")
+		fmt.Printf("     structlayout fieldat -source headers -abi aarch64 -I Include Include/Python.h PyThreadState 0x58\n\n")
+		fmt.Println("flags:")
+		fSet.PrintDefaults()
+	}
+	if err := fSet.Parse(args); err != nil {
+		logger.Error("failed to parse flags", "err", err)
+		os.Exit(1)
+	}
+	if fSet.NArg() != 3 {
+		fSet.Usage()
+		os.Exit(1)
+	}
+	input, route := fSet.Arg(0), fSet.Arg(1)
+	// Offsets are usually copied from hex dumps, e.g. 0x58.
+	offset, err := strconv.ParseInt(fSet.Arg(2), 0, 64)
+	if err != nil {
+		logger.Error("invalid offset", "offset", fSet.Arg(2), "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	idx, closeIndex, err := src.open(ctx, logger, input)
+	if err != nil {
+		logger.Error("failed to index type information", "source", src.source, "err", err)
+		os.Exit(1)
+	}
+	defer closeIndex()
+
+	loc, err := datamap.FieldAt(idx, route, offset)
+	if err != nil {
+		logger.Error("failed to find field", "route", route, "offset", offset, "err", err)
+		os.Exit(1)
+	}
+	if err := writeFieldLocation(os.Stdout, loc, format); err != nil {
+		logger.Error("failed to write field", "err", err)
+		os.Exit(1)
+	}
+}
+
+// writeFieldLocation writes the given location in the given format.
+// The text format is the route to the member, followed by the members on the path to it.
+func writeFieldLocation(w io.Writer, loc *datamap.FieldLocation, format string) error {
+	switch format {
+	case "yaml":
+		return encodeYAML(w, loc)
+	case "json":
+		return encodeJSON(w, loc)
+	case "text":
+	default:
+		return fmt.Errorf("invalid format %s", format)
+	}
+
+	fmt.Fprintln(w, loc)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\toffset 0\tsize %d\t\n", loc.Route, loc.Size)
+	for depth, s := range loc.Path {
+		name := s.Name
+		switch {
+		case s.Base:
+			name = "(base) " + name
+		case s.Anonymous():
+			name = "(anonymous)"
+		}
+		for _, i := range s.Index {
+			name += fmt.Sprintf("[%d]", i)
+		}
+		name = strings.Repeat("  ", depth+1) + name
+		if s.BitSize != 0 {
+			fmt.Fprintf(tw, "%s\toffset %d\tsize %d\t%s : %d (bit offset %d)\n", name, s.Offset, s.Size, s.Type, s.BitSize, s.BitOffset)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\toffset %d\tsize %d\t%s\n", name, s.Offset, s.Size, s.Type)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/parca-dev/runtime-data/pkg/datamap"
+)
+
+// sourceFlags are the flags that select the type information the layouts are read from,
+// shared by the commands.
+type sourceFlags struct {
+	source        string
+	debugDir      string
+	splitDWARFDir string
+	includeDirs   listFlag
+	defines       listFlag
+	abi           string
+}
+
+func (f *sourceFlags) register(fSet *flag.FlagSet) {
+	fSet.StringVar(&f.source, "source", "dwarf", "type information to read the layout from, e.g. dwarf, btf, headers")
+	fSet.StringVar(&f.debugDir, "debug-dir", "", "directory to look up the dwz supplementary file in, in addition to the parents of the ELF file")
+	fSet.StringVar(&f.splitDWARFDir, "split-dwarf-dir", "", "directory to look up the .dwo files or the .dwp package in, in addition to the directory of the ELF file")
+	fSet.Var(&f.includeDirs, "include-dir", "directory to look up the included headers in, with -source headers, can be repeated")
+	fSet.Var(&f.includeDirs, "I", "directory to look up the included headers in, with -source headers, can be repeated (shorthand)")
+	fSet.Var(&f.defines, "define", "macro to define as NAME or NAME=VALUE, with -source headers, can be repeated, e.g. Py_GIL_DISABLED")
+	fSet.Var(&f.defines, "D", "macro to define as NAME or NAME=VALUE, with -source headers, can be repeated (shorthand)")
+	fSet.StringVar(&f.abi, "abi", "x86_64", "ABI to lay out the types of the headers for, with -source headers, e.g. x86_64, aarch64")
+}
+
+// open indexes the type information of the given input, read from the source set by the flags.
+// The input is an ELF file, or C headers separated by commas with -source headers.
+// The returned function releases the files opened by the index.
+func (f *sourceFlags) open(ctx context.Context, logger *slog.Logger, input string, opts ...datamap.Option) (datamap.Source, func(), error) {
+	if f.source == "headers" {
+		idx, err := datamap.NewHeaderIndex(strings.Split(input, ","), append(opts,
+			datamap.WithIncludeDirs(f.includeDirs...),
+			datamap.WithDefines(f.defines...),
+			datamap.WithABI(f.abi))...)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The layouts of the types that do not depend on what was skipped are still computed.
+		for _, w := range idx.Warnings() {
+			logger.Warn("incomplete headers", "err", w)
+		}
+		return idx, func() {}, nil
+	}
+
+	ef, err := elf.Open(input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read ELF file: %w", err)
+	}
+	idx, closeIndex, err := openIndex(ctx, ef, input, f.source, f.debugDir, f.splitDWARFDir, opts...)
+	if err != nil {
+		ef.Close()
+		return nil, nil, err
+	}
+	return idx, func() {
+		closeIndex()
+		ef.Close()
+	}, nil
+}
+
+// openIndex indexes the debug information of the given ELF file, read from the given source.
+// The returned function releases the files opened by the index.
+func openIndex(ctx context.Context, ef *elf.File, input, source, debugDir, splitDWARFDir string, opts ...datamap.Option) (datamap.Source, func(), error) {
+	switch source {
+	case "dwarf":
+		// Debug packages extracted by debdownload keep the absolute path of the supplementary file
+		// relative to the extraction directory, which is one of the parents of the ELF file.
+		dirs := parentDirs(input)
+		if debugDir != "" {
+			dirs = append([]string{debugDir}, dirs...)
+		}
+		// Programs built with split DWARF are usually next to their .dwo files or their .dwp package.
+		splitDirs := []string{filepath.Dir(input)}
+		if splitDWARFDir != "" {
+			splitDirs = append([]string{splitDWARFDir}, splitDirs...)
+		}
+		idx, err := datamap.NewTypeIndexContext(ctx, ef,
+			append(opts, datamap.WithELFPath(input), datamap.WithDebugDirs(dirs...), datamap.WithSplitDWARFDirs(splitDirs...))...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return idx, func() { idx.Close() }, nil
+	case "btf":
+		idx, err := datamap.NewBTFIndex(ef, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return idx, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid source %s", source)
+	}
+}
+
+// listFlag is a flag that can be repeated, e.g. -I include -I include/internal.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -1,17 +1,24 @@
 package main
 
 import (
-	"debug/elf"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"gopkg.in/yaml.v3"
 
+	"github.com/parca-dev/runtime-data/pkg/buildid"
 	"github.com/parca-dev/runtime-data/pkg/datamap"
 	"github.com/parca-dev/runtime-data/pkg/java/openjdk"
 	"github.com/parca-dev/runtime-data/pkg/libc/glibc"
@@ -28,11 +35,27 @@ type Mapper interface {
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fieldat":
+			fieldAt(logger, os.Args[2:])
+			return
+		case "explore":
+			explore(logger, os.Args[2:])
+			return
+		}
+	}
+
 	fSet := flag.NewFlagSet("structlayout", flag.ExitOnError)
 	var (
 		runtime        string
 		version        string
 		givenOutputDir string
+		allowGaps      bool
+		src            sourceFlags
+		maxEntries     int64
+		maxBytes       int64
+		timeout        time.Duration
 	)
 	fSet.StringVar(&runtime, "runtime", "", "name of the pre-defined runtime, e.g. python, ruby, libc, musl")
 	fSet.StringVar(&runtime, "r", "", "name of the pre-defined runtime, e.g. python, ruby, libc, musl (shorthand)")
@@ -40,10 +63,19 @@ func main() {
 	fSet.StringVar(&version, "v", "", "version of the runtime that the layout to generate, e.g. 3.9.5 (shorthand)")
 	fSet.StringVar(&givenOutputDir, "output", "", "output directory to write the layout file")
 	fSet.StringVar(&givenOutputDir, "o", "", "output directory to write the layout file (shorthand)")
+	src.register(fSet)
+	fSet.Int64Var(&maxEntries, "max-entries", 0, "maximum number of DWARF entries and ELF symbols to read, 0 means no limit")
+	fSet.Int64Var(&maxBytes, "max-bytes", 0, "maximum number of bytes of debug information to read into memory, 0 means no limit")
+	fSet.DurationVar(&timeout, "timeout", 0, "maximum time to read the debug information and extract the layout, 0 means no limit")
+	fSet.BoolVar(&allowGaps, "allow-gaps", false, "write the layout even if some fields could not be resolved")
 
 	fSet.Usage = func() {
 		fmt.Printf("usage: structlayout [flags] <path-to-elf>\n")
-		fmt.Printf("e.g: structlayout -r python -v 3.9.5 /usr/bin/python3.9\n\n")
+		fmt.Printf("       structlayout -source headers [flags] <header>[,<header>...]\n")
+		fmt.Printf("       structlayout fieldat [flags] <path-to-elf> <type-or-route> <offset>\n")
+		fmt.Printf("       structlayout explore [flags] <path-to-elf> [<path-to-other-elf>] <type-or-route>\n")
+		fmt.Printf("e.g: structlayout -r python -v 3.9.5 /usr/bin/python3.9\n")
+		fmt.Printf("     structlayout -r python -v 3.13.0 -source headers -I Include -D Py_GIL_DISABLED Include/Python.h\n\n")
 		fmt.Println("flags:")
 		fSet.PrintDefaults()
 	}
@@ -98,110 +130,282 @@ func main() {
 		os.Exit(1)
 	}
 
-	input := fSet.Arg(0)
-	ef, err := elf.Open(input)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	limits := []datamap.Option{datamap.WithMaxEntries(maxEntries), datamap.WithMaxBytes(maxBytes)}
+
+	// The index is shared by the layout and the initial state maps,
+	// so the type information is only read once.
+	idx, closeIndex, err := src.open(ctx, logger, fSet.Arg(0), limits...)
 	if err != nil {
-		logger.Error("failed to read DWARF data", "err", err)
+		logger.Error("failed to index type information", "source", src.source, "err", err)
 		os.Exit(1)
 	}
-	defer ef.Close()
+	defer closeIndex()
+
+	var opts []datamap.Option
+	if !allowGaps {
+		opts = append(opts, datamap.WithStrict())
+	}
 
+	var reports []*datamap.ExtractionReport
 	if !isNil(layoutMap) {
 		output := filepath.Join(outputDir, "layout", fmt.Sprintf("%s_%s.yaml", runtime, sanitizeIdentifier(version)))
-		if err := processAndWriteLayout(ef, output, version, layoutMap); err != nil {
+		report, err := processAndWriteLayout(ctx, idx, output, version, layoutMap, opts...)
+		if err != nil {
 			logger.Error("failed to write layout", "err", err)
 			os.Exit(1)
 		}
+		reports = append(reports, report)
 		logger.Info("layout file written", "file", output)
 	} else {
 		logger.Info("no layout map found, skipping layout generation")
 	}
 
-	if isNil(initialStateMap) {
+	if !isNil(initialStateMap) {
+		output := filepath.Join(outputDir, "initialstate", fmt.Sprintf("%s_%s.yaml", runtime, sanitizeIdentifier(version)))
+		report, err := processAndWriteInitialState(ctx, idx, output, version, initialStateMap, opts...)
+		if err != nil {
+			logger.Error("failed to write initial state", "err", err)
+			os.Exit(1)
+		}
+		reports = append(reports, report)
+		logger.Info("initial state file written", "file", output)
+	} else {
 		logger.Info("no initial state map found, skipping initial state generation")
-		os.Exit(0)
 	}
 
-	output := filepath.Join(outputDir, "initialstate", fmt.Sprintf("%s_%s.yaml", runtime, sanitizeIdentifier(version)))
-	if err := processAndWriteInitialState(ef, output, version, initialStateMap); err != nil {
-		logger.Error("failed to write initial state", "err", err)
+	// The addresses and the locations differ between the builds of a version,
+	// so they are written per build ID rather than into the layouts mergelayout merges across versions.
+	symbols, locations := symbolAddresses(reports...), variableLocations(reports...)
+	if symbols == nil && locations == nil {
+		return
+	}
+	output, err := writeBuildData(fSet.Arg(0), filepath.Join(outputDir, "symbols"), runtime, version, symbols, locations)
+	if err != nil {
+		logger.Error("failed to write symbols", "err", err)
 		os.Exit(1)
 	}
-	logger.Info("initial state file written", "file", output)
+	logger.Info("symbols file written", "file", output)
 }
 
-// processAndWriteLayout processes the given ELF file and writes the layout to the given output file.
-func processAndWriteLayout(ef *elf.File, output string, version string, layoutMap runtimedata.LayoutMap) error {
-	dm, err := datamap.New(layoutMap)
+// processAndWriteLayout processes the given debug information and writes the layout to the given output file.
+// The extraction report is returned, the addresses and the locations it holds are written by writeBuildData.
+func processAndWriteLayout(ctx context.Context, idx datamap.Source, output string, version string, layoutMap runtimedata.LayoutMap, opts ...datamap.Option) (*datamap.ExtractionReport, error) {
+	dm, err := datamap.New(layoutMap, datamap.WithVersion(version))
 	if err != nil {
-		return fmt.Errorf("failed to create data map: %w", err)
+		return nil, fmt.Errorf("failed to create data map: %w", err)
 	}
 
-	if err := dm.ReadFromDWARF(ef); err != nil {
-		return fmt.Errorf("failed to extract struct layout from DWARF data: %w", err)
+	report, err := dm.ExtractContext(ctx, idx, opts...)
+	if report != nil {
+		printReport(os.Stdout, report)
 	}
-
-	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract struct layout: %w", err)
 	}
 
-	file, err := os.Create(output)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
 	// Extremely in-efficient and hacky but it should work for now.
 	withVersion, err := runtimedata.WithVersion(version, convertToMapOfAny(layoutMap.Layout()))
 	if err != nil {
-		return fmt.Errorf("failed to wrap layout with version: %w", err)
+		return nil, fmt.Errorf("failed to wrap layout with version: %w", err)
 	}
 
-	encoder := yaml.NewEncoder(file)
-	if err := encoder.Encode(withVersion); err != nil {
-		return fmt.Errorf("failed to encode layout: %w", err)
+	var buf bytes.Buffer
+	if err := encode(&buf, withVersion, dm.Matches(), dm.Expressions()); err != nil {
+		return nil, fmt.Errorf("failed to encode layout: %w", err)
 	}
-	if err := encoder.Close(); err != nil {
-		return fmt.Errorf("failed to close encoder: %w", err)
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	return nil
+	return report, nil
 }
 
-// processAndWriteInitialState processes the given ELF file and writes the initial state to the given output file.
-func processAndWriteInitialState(ef *elf.File, output string, version string, initialStateMap runtimedata.InitialStateMap) error {
-	dm, err := datamap.New(initialStateMap)
+// processAndWriteInitialState processes the given debug information and writes the initial state to the given output file.
+func processAndWriteInitialState(ctx context.Context, idx datamap.Source, output string, version string, initialStateMap runtimedata.InitialStateMap, opts ...datamap.Option) (*datamap.ExtractionReport, error) {
+	dm, err := datamap.New(initialStateMap, datamap.WithVersion(version))
 	if err != nil {
-		return fmt.Errorf("failed to create data map: %w", err)
+		return nil, fmt.Errorf("failed to create data map: %w", err)
 	}
 
-	if err := dm.ReadFromDWARF(ef); err != nil {
-		return fmt.Errorf("failed to extract struct layout from DWARF data: %w", err)
+	report, err := dm.ExtractContext(ctx, idx, opts...)
+	if report != nil {
+		printReport(os.Stdout, report)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract struct layout: %w", err)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	file, err := os.Create(output)
+	// Extremely in-efficient and hacky but it should work for now.
+	withVersion, err := runtimedata.WithVersion(version, convertToMapOfAny(initialStateMap.InitialState()))
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return nil, fmt.Errorf("failed to wrap layout with version: %w", err)
 	}
 
-	// Extremely in-efficient and hacky but it should work for now.
-	withVersion, err := runtimedata.WithVersion(version, convertToMapOfAny(initialStateMap.InitialState()))
+	var buf bytes.Buffer
+	if err := encode(&buf, withVersion, dm.Matches(), dm.Expressions()); err != nil {
+		return nil, fmt.Errorf("failed to encode layout: %w", err)
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return report, nil
+}
+
+// printReport prints the outcome of the extraction of every field.
+func printReport(w io.Writer, report *datamap.ExtractionReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tSTATUS\tVALUE\tROUTE\tUNIT\tENTRY\tERROR")
+	for _, f := range report.Fields {
+		var reason string
+		if f.Err != nil {
+			reason = strings.ReplaceAll(f.Err.Error(), "\n", "; ")
+		}
+		var value any = f.Value
+		if f.Op == datamap.OpLocationOf {
+			value = fmt.Sprintf("%d ranges", len(f.Locations))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%#x\t%#x\t%s\n", f.Field, f.Status, value, f.Route, f.Unit, f.Entry, reason)
+	}
+	tw.Flush()
+	for _, f := range report.Conflicts() {
+		for _, c := range f.Conflicts {
+			fmt.Fprintf(w, "conflict: %s: %s\n", f.Field, c)
+		}
+	}
+}
+
+// symbolAddresses returns the addresses of the global variables read with the addressof tag.
+func symbolAddresses(reports ...*datamap.ExtractionReport) map[string]uint64 {
+	var addrs map[string]uint64
+	for _, report := range reports {
+		for _, f := range report.Fields {
+			if f.Op != datamap.OpAddressOf || f.Status != datamap.StatusResolved {
+				continue
+			}
+			if addrs == nil {
+				addrs = map[string]uint64{}
+			}
+			addrs[f.Route] = uint64(f.Value[0])
+		}
+	}
+	return addrs
+}
+
+// variableLocations returns the locations of the variables of functions read with the locationof tag.
+func variableLocations(reports ...*datamap.ExtractionReport) map[string]any {
+	var locs map[string]any
+	for _, report := range reports {
+		for _, f := range report.Fields {
+			if f.Op != datamap.OpLocationOf || f.Status != datamap.StatusResolved {
+				continue
+			}
+			if locs == nil {
+				locs = map[string]any{}
+			}
+			locs[f.Route] = f.Locations
+		}
+	}
+	return locs
+}
+
+// writeBuildData writes the given addresses and locations, read from the given binary,
+// to a file of the given directory named after the build ID of the binary, and returns its path.
+func writeBuildData(binary, outputDir, runtime, version string, symbols map[string]uint64, locations map[string]any) (string, error) {
+	f, err := os.Open(binary)
 	if err != nil {
-		return fmt.Errorf("failed to wrap layout with version: %w", err)
+		return "", fmt.Errorf("failed to open binary: %w", err)
+	}
+	defer f.Close()
+	id, err := buildid.FromFile(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read build ID: %w", err)
 	}
 
-	encoder := yaml.NewEncoder(file)
-	if err := encoder.Encode(withVersion); err != nil {
-		return fmt.Errorf("failed to encode layout: %w", err)
+	sm, err := semver.NewVersion(version)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse version (%s): %w", version, err)
+	}
+	data := runtimedata.DataWithBuildID{
+		Version:   runtimedata.Version{Major: sm.Major(), Minor: sm.Minor(), Patch: sm.Patch()},
+		BuildID:   id,
+		Symbols:   symbols,
+		Locations: locations,
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	output := filepath.Join(outputDir, fmt.Sprintf("%s_%s_%s.yaml", runtime, sanitizeIdentifier(version), id))
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	if err := encoder.Encode(data); err != nil {
+		return "", fmt.Errorf("failed to encode symbols: %w", err)
 	}
 	if err := encoder.Close(); err != nil {
-		return fmt.Errorf("failed to close encoder: %w", err)
+		return "", fmt.Errorf("failed to encode symbols: %w", err)
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write output file: %w", err)
 	}
+	return output, nil
+}
 
-	return nil
+// encode writes the given value as YAML.
+// The routes that were picked among the alternatives of a field, and the expressions fields are computed with,
+// are recorded as a comment, so they show up in the review of the generated files.
+func encode(w io.Writer, v any, matches []datamap.Match, exprs []datamap.Expression) error {
+	var doc yaml.Node
+	if err := doc.Encode(v); err != nil {
+		return err
+	}
+	var comment []string
+	for _, m := range matches {
+		route := m.Route
+		if route == "" {
+			route = "none of " + strings.Join(m.Alternatives, ", ")
+		}
+		comment = append(comment, fmt.Sprintf("%s: %s", m.Field, route))
+	}
+	for _, e := range exprs {
+		comment = append(comment, fmt.Sprintf("%s = %s", e.Field, e.Source))
+	}
+	doc.HeadComment = strings.Join(comment, "\n")
+
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// parentDirs returns the directories that contain the given path, innermost first.
+func parentDirs(path string) []string {
+	dirs := []string{}
+	dir := filepath.Dir(path)
+	for {
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
 }
 
 // sanitizeIdentifier sanitizes the identifier to be used as a filename.
@@ -0,0 +1,207 @@
+package cheader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ABI describes the sizes and the alignments of the C types on a target,
+// and the macros the compiler predefines for it.
+type ABI struct {
+	// Name is the name of the ABI, e.g. x86_64.
+	Name string
+	// PointerSize is the size of pointers, long and size_t.
+	PointerSize int64
+	// LongDoubleSize and LongDoubleAlign are the size and the alignment of long double.
+	LongDoubleSize  int64
+	LongDoubleAlign int64
+	// CharSigned reports whether plain char is signed.
+	CharSigned bool
+	// Macros are the macros predefined for the target, in addition to the ones common to all targets.
+	Macros map[string]string
+	// Prelude declares the types built into the compiler, e.g. __builtin_va_list.
+	Prelude string
+}
+
+// X86_64 is the System V ABI of x86-64, as implemented by GCC on Linux.
+var X86_64 = &ABI{
+	Name:            "x86_64",
+	PointerSize:     8,
+	LongDoubleSize:  16,
+	LongDoubleAlign: 16,
+	CharSigned:      true,
+	Macros: map[string]string{
+		"__x86_64__":     "1",
+		"__x86_64":       "1",
+		"__amd64__":      "1",
+		"__amd64":        "1",
+		"__SSE__":        "1",
+		"__SSE2__":       "1",
+		"__WCHAR_TYPE__": "int",
+		"__WCHAR_MAX__":  "0x7fffffff",
+		"__WCHAR_MIN__":  "(-__WCHAR_MAX__ - 1)",
+	},
+	Prelude: `
+typedef struct __va_list_tag {
+	unsigned int gp_offset;
+	unsigned int fp_offset;
+	void *overflow_arg_area;
+	void *reg_save_area;
+} __builtin_va_list[1];
+`,
+}
+
+// AArch64 is the AAPCS64 ABI of 64-bit Arm, as implemented by GCC on Linux.
+var AArch64 = &ABI{
+	Name:            "aarch64",
+	PointerSize:     8,
+	LongDoubleSize:  16,
+	LongDoubleAlign: 16,
+	CharSigned:      false,
+	Macros: map[string]string{
+		"__aarch64__":        "1",
+		"__AARCH64EL__":      "1",
+		"__ARM_64BIT_STATE":  "1",
+		"__ARM_ARCH":         "8",
+		"__ARM_PCS_AAPCS64":  "1",
+		"__CHAR_UNSIGNED__":  "1",
+		"__WCHAR_TYPE__":     "unsigned int",
+		"__WCHAR_MAX__":      "0xffffffffU",
+		"__WCHAR_MIN__":      "0U",
+		"__WCHAR_UNSIGNED__": "1",
+	},
+	Prelude: `
+typedef struct __va_list {
+	void *__stack;
+	void *__gr_top;
+	void *__vr_top;
+	int __gr_offs;
+	int __vr_offs;
+} __builtin_va_list;
+`,
+}
+
+// LookupABI returns the ABI with the given name, or with the name of its architecture
+// in Go or in the Linux distributions, e.g. amd64 or arm64.
+func LookupABI(name string) (*ABI, error) {
+	switch strings.ToLower(name) {
+	case "x86_64", "x86-64", "amd64":
+		return X86_64, nil
+	case "aarch64", "arm64":
+		return AArch64, nil
+	default:
+		return nil, fmt.Errorf("unsupported ABI %s, supported: x86_64, aarch64", name)
+	}
+}
+
+// commonMacros are the macros GCC predefines for every 64-bit Linux target.
+var commonMacros = map[string]string{
+	"__STDC__":                "1",
+	"__STDC_VERSION__":        "201710L",
+	"__STDC_HOSTED__":         "1",
+	"__GNUC__":                "12",
+	"__GNUC_MINOR__":          "2",
+	"__GNUC_PATCHLEVEL__":     "0",
+	"__linux__":               "1",
+	"__linux":                 "1",
+	"__gnu_linux__":           "1",
+	"__unix__":                "1",
+	"__unix":                  "1",
+	"__ELF__":                 "1",
+	"__LP64__":                "1",
+	"_LP64":                   "1",
+	"__CHAR_BIT__":            "8",
+	"__SIZEOF_SHORT__":        "2",
+	"__SIZEOF_INT__":          "4",
+	"__SIZEOF_LONG__":         "8",
+	"__SIZEOF_LONG_LONG__":    "8",
+	"__SIZEOF_POINTER__":      "8",
+	"__SIZEOF_SIZE_T__":       "8",
+	"__SIZEOF_PTRDIFF_T__":    "8",
+	"__SIZEOF_FLOAT__":        "4",
+	"__SIZEOF_DOUBLE__":       "8",
+	"__SIZEOF_LONG_DOUBLE__":  "16",
+	"__SIZEOF_WCHAR_T__":      "4",
+	"__SIZEOF_INT128__":       "16",
+	"__BIGGEST_ALIGNMENT__":   "16",
+	"__ORDER_LITTLE_ENDIAN__": "1234",
+	"__ORDER_BIG_ENDIAN__":    "4321",
+	"__ORDER_PDP_ENDIAN__":    "3412",
+	"__BYTE_ORDER__":          "__ORDER_LITTLE_ENDIAN__",
+	"__SCHAR_MAX__":           "0x7f",
+	"__SHRT_MAX__":            "0x7fff",
+	"__INT_MAX__":             "0x7fffffff",
+	"__LONG_MAX__":            "0x7fffffffffffffffL",
+	"__LONG_LONG_MAX__":       "0x7fffffffffffffffLL",
+	"__SIZE_MAX__":            "0xffffffffffffffffUL",
+	"__PTRDIFF_MAX__":         "0x7fffffffffffffffL",
+	"__INTPTR_MAX__":          "0x7fffffffffffffffL",
+	"__UINTPTR_MAX__":         "0xffffffffffffffffUL",
+	"__SIZE_TYPE__":           "long unsigned int",
+	"__PTRDIFF_TYPE__":        "long int",
+	"__INTPTR_TYPE__":         "long int",
+	"__UINTPTR_TYPE__":        "long unsigned int",
+	"__INTMAX_TYPE__":         "long int",
+	"__UINTMAX_TYPE__":        "long unsigned int",
+	"__ATOMIC_ACQUIRE":        "2",
+	"__ATOMIC_ACQ_REL":        "4",
+	"__ATOMIC_CONSUME":        "1",
+	"__ATOMIC_RELAXED":        "0",
+	"__ATOMIC_RELEASE":        "3",
+	"__ATOMIC_SEQ_CST":        "5",
+	"__CHAR16_TYPE__":         "short unsigned int",
+	"__CHAR32_TYPE__":         "unsigned int",
+	"__INT16_MAX__":           "0x7fff",
+	"__INT16_TYPE__":          "short int",
+	"__INT32_MAX__":           "0x7fffffff",
+	"__INT32_TYPE__":          "int",
+	"__INT64_MAX__":           "0x7fffffffffffffffL",
+	"__INT64_TYPE__":          "long int",
+	"__INT8_MAX__":            "0x7f",
+	"__INT8_TYPE__":           "signed char",
+	"__INTMAX_WIDTH__":        "64",
+	"__INTPTR_WIDTH__":        "64",
+	"__INT_FAST16_TYPE__":     "long int",
+	"__INT_FAST16_WIDTH__":    "64",
+	"__INT_FAST32_TYPE__":     "long int",
+	"__INT_FAST32_WIDTH__":    "64",
+	"__INT_FAST64_TYPE__":     "long int",
+	"__INT_FAST64_WIDTH__":    "64",
+	"__INT_FAST8_TYPE__":      "signed char",
+	"__INT_FAST8_WIDTH__":     "8",
+	"__INT_LEAST16_TYPE__":    "short int",
+	"__INT_LEAST16_WIDTH__":   "16",
+	"__INT_LEAST32_TYPE__":    "int",
+	"__INT_LEAST32_WIDTH__":   "32",
+	"__INT_LEAST64_TYPE__":    "long int",
+	"__INT_LEAST64_WIDTH__":   "64",
+	"__INT_LEAST8_TYPE__":     "signed char",
+	"__INT_LEAST8_WIDTH__":    "8",
+	"__INT_WIDTH__":           "32",
+	"__LONG_LONG_WIDTH__":     "64",
+	"__LONG_WIDTH__":          "64",
+	"__PTRDIFF_WIDTH__":       "64",
+	"__SCHAR_WIDTH__":         "8",
+	"__SHRT_WIDTH__":          "16",
+	"__SIG_ATOMIC_TYPE__":     "int",
+	"__SIG_ATOMIC_WIDTH__":    "32",
+	"__SIZE_WIDTH__":          "64",
+	"__UINT16_MAX__":          "0xffff",
+	"__UINT16_TYPE__":         "short unsigned int",
+	"__UINT32_MAX__":          "0xffffffffU",
+	"__UINT32_TYPE__":         "unsigned int",
+	"__UINT64_MAX__":          "0xffffffffffffffffUL",
+	"__UINT64_TYPE__":         "long unsigned int",
+	"__UINT8_MAX__":           "0xff",
+	"__UINT8_TYPE__":          "unsigned char",
+	"__UINT_FAST16_TYPE__":    "long unsigned int",
+	"__UINT_FAST32_TYPE__":    "long unsigned int",
+	"__UINT_FAST64_TYPE__":    "long unsigned int",
+	"__UINT_FAST8_TYPE__":     "unsigned char",
+	"__UINT_LEAST16_TYPE__":   "short unsigned int",
+	"__UINT_LEAST32_TYPE__":   "unsigned int",
+	"__UINT_LEAST64_TYPE__":   "long unsigned int",
+	"__UINT_LEAST8_TYPE__":    "unsigned char",
+	"__WINT_TYPE__":           "unsigned int",
+	"__WINT_WIDTH__":          "32",
+}
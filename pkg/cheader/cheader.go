@@ -0,0 +1,225 @@
+package cheader
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// Config configures how headers are preprocessed and which ABI their types are laid out for.
+type Config struct {
+	// IncludeDirs are the directories the included headers are looked up in, like the -I flags of a compiler.
+	// The headers of the C library and of the compiler that are not found in them are replaced
+	// by built-in ones that declare their types, the other ones are skipped.
+	IncludeDirs []string
+	// Defines are the macros to define, as NAME or NAME=VALUE, like the -D flags of a compiler,
+	// e.g. Py_GIL_DISABLED or Py_BUILD_CORE=1.
+	Defines []string
+	// ABI is the ABI to lay out the types for, X86_64 if it is nil.
+	ABI *ABI
+}
+
+// Types are the types declared by a set of headers, laid out for an ABI.
+type Types struct {
+	// Names maps the tags of the structs, unions and enums, and the names of the typedefs,
+	// to their types, in the order they are defined.
+	Names map[string][]dwarf.Type
+	// Errors maps the names of the types whose layout could not be computed to the reason,
+	// e.g. a member whose type is declared by a header that was not found.
+	Errors map[string]error
+	// Warnings lists the problems that did not stop the parse:
+	// the system headers that were not found and the declarations that were skipped.
+	Warnings []error
+}
+
+// prelude declares the types built into GCC on every supported ABI.
+const prelude = `
+typedef __int128 __int128_t;
+typedef unsigned __int128 __uint128_t;
+`
+
+// Parse preprocesses the given headers, in order, parses the declarations they make
+// and lays out the types they declare.
+// The types are converted to their debug/dwarf counterparts, as if they were read from DWARF.
+func Parse(headers []string, cfg Config) (*Types, error) {
+	if cfg.ABI == nil {
+		cfg.ABI = X86_64
+	}
+	pp, err := newPreprocessor(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to define macros: %w", err)
+	}
+	toks, err := pp.preprocess("<prelude>", prelude+cfg.ABI.Prelude)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		t, err := pp.include(h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preprocess %s: %w", h, err)
+		}
+		toks = append(toks, t...)
+	}
+
+	p := newParser(toks, cfg.ABI)
+	p.parse()
+
+	types := &Types{
+		Names:  map[string][]dwarf.Type{},
+		Errors: map[string]error{},
+	}
+	for _, name := range pp.skipped {
+		types.Warnings = append(types.Warnings, fmt.Errorf("header <%s> not found, skipped", name))
+	}
+	types.Warnings = append(types.Warnings, p.skipped...)
+	c := &converter{types: map[*ctype]dwarf.Type{}}
+	for _, t := range p.declared {
+		if err := typeErr(t); err != nil {
+			types.Errors[t.name] = err
+			continue
+		}
+		types.Names[t.name] = append(types.Names[t.name], c.convert(t))
+	}
+	return types, nil
+}
+
+// typeErr returns the reason the layout of the given type cannot be computed, if any.
+// The types pointed to do not matter.
+func typeErr(t *ctype) error {
+	for {
+		switch t.kind {
+		case kindTypedef, kindQual, kindArray:
+			t = t.base
+			continue
+		case kindUnknown, kindStruct, kindUnion:
+			return t.err
+		}
+		return nil
+	}
+}
+
+type converter struct {
+	types map[*ctype]dwarf.Type
+}
+
+// convert converts the given type to its debug/dwarf counterpart, as GCC describes it:
+// the types are named like in DWARF, the members have their byte and bit offsets,
+// and the bitfields the size and the offset of their storage unit.
+func (c *converter) convert(t *ctype) dwarf.Type {
+	if typ, ok := c.types[t]; ok {
+		return typ
+	}
+	common := dwarf.CommonType{Name: t.name, ByteSize: t.size}
+	basic := dwarf.BasicType{CommonType: common}
+	var typ dwarf.Type
+	switch t.kind {
+	case kindVoid:
+		typ = &dwarf.VoidType{}
+	case kindBool:
+		typ = &dwarf.BoolType{BasicType: basic}
+	case kindInt:
+		switch {
+		case t.char && t.unsigned:
+			typ = &dwarf.UcharType{BasicType: basic}
+		case t.char:
+			typ = &dwarf.CharType{BasicType: basic}
+		case t.unsigned:
+			typ = &dwarf.UintType{BasicType: basic}
+		default:
+			typ = &dwarf.IntType{BasicType: basic}
+		}
+	case kindFloat:
+		typ = &dwarf.FloatType{BasicType: basic}
+	case kindComplex:
+		typ = &dwarf.ComplexType{BasicType: basic}
+	case kindPointer:
+		ptr := &dwarf.PtrType{CommonType: common}
+		c.types[t] = ptr
+		ptr.Type = c.convert(t.base)
+		typ = ptr
+	case kindArray:
+		// GCC describes flexible array members as arrays of no elements,
+		// and the arrays of arrays named by a typedef as arrays of several dimensions.
+		arr := &dwarf.ArrayType{CommonType: common, Count: max(t.count, 0)}
+		c.types[t] = arr
+		elem := t.base
+		for elem.kind == kindTypedef && elem.resolved().kind == kindArray {
+			elem = elem.base
+		}
+		arr.Type = c.convert(elem)
+		if size, err := sizeOf(t); err == nil {
+			arr.ByteSize = size
+		} else {
+			arr.ByteSize = -1
+		}
+		typ = arr
+	case kindFunc:
+		fn := &dwarf.FuncType{CommonType: common}
+		c.types[t] = fn
+		fn.ReturnType = c.convert(t.base)
+		typ = fn
+	case kindStruct, kindUnion:
+		typ = c.record(t)
+	case kindEnum:
+		enum := &dwarf.EnumType{CommonType: dwarf.CommonType{ByteSize: t.size}, EnumName: t.name}
+		for _, e := range t.enumerators {
+			enum.Val = append(enum.Val, &dwarf.EnumValue{Name: e.name, Val: e.value})
+		}
+		typ = enum
+	case kindTypedef:
+		td := &dwarf.TypedefType{CommonType: common}
+		c.types[t] = td
+		td.Type = c.convert(t.base)
+		if size, err := sizeOf(t); err == nil {
+			td.ByteSize = size
+		}
+		typ = td
+	case kindQual:
+		q := &dwarf.QualType{CommonType: common, Qual: t.qual}
+		c.types[t] = q
+		q.Type = c.convert(t.base)
+		typ = q
+	default:
+		typ = &dwarf.UnspecifiedType{BasicType: basic}
+	}
+	c.types[t] = typ
+	return typ
+}
+
+func (c *converter) record(t *ctype) dwarf.Type {
+	kind := "struct"
+	if t.kind == kindUnion {
+		kind = "union"
+	}
+	st := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: t.size},
+		StructName: t.name,
+		Kind:       kind,
+		Incomplete: !t.complete || t.err != nil,
+	}
+	c.types[t] = st
+	if st.Incomplete {
+		st.ByteSize = 0
+		return st
+	}
+	for _, m := range t.members {
+		// GCC does not describe the unnamed bitfields, they only pad the struct.
+		if m.bitfield && m.name == "" {
+			continue
+		}
+		field := &dwarf.StructField{
+			Name:          m.name,
+			Type:          c.convert(m.typ),
+			ByteOffset:    m.offset,
+			DataBitOffset: m.bitOffset,
+		}
+		if m.bitfield {
+			// The storage unit of the bitfield.
+			size, _ := sizeOf(m.typ)
+			field.ByteSize = size
+			field.BitSize = m.bitSize
+			field.ByteOffset = m.bitOffset / 8 / size * size
+		}
+		st.Field = append(st.Field, field)
+	}
+	return st
+}
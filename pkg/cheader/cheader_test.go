@@ -0,0 +1,341 @@
+package cheader
+
+import (
+	"debug/dwarf"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseSource parses the given source as a header.
+func parseSource(t *testing.T, src string, cfg Config) (*Types, error) {
+	t.Helper()
+	header := filepath.Join(t.TempDir(), "test.h")
+	if err := os.WriteFile(header, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Parse([]string{header}, cfg)
+}
+
+func lookup(t *testing.T, types *Types, name string) dwarf.Type {
+	t.Helper()
+	if err, ok := types.Errors[name]; ok {
+		t.Fatalf("layout of %s error = %v", name, err)
+	}
+	typs := types.Names[name]
+	if len(typs) == 0 {
+		t.Fatalf("type %s not found", name)
+	}
+	return typs[0]
+}
+
+func field(t *testing.T, typ dwarf.Type, name string) *dwarf.StructField {
+	t.Helper()
+	for typ != nil {
+		td, ok := typ.(*dwarf.TypedefType)
+		if !ok {
+			break
+		}
+		typ = td.Type
+	}
+	st, ok := typ.(*dwarf.StructType)
+	if !ok {
+		t.Fatalf("%s is not a struct", typ)
+	}
+	for _, f := range st.Field {
+		if f.Name == name {
+			return f
+		}
+	}
+	t.Fatalf("field %s not found in %s", name, st.StructName)
+	return nil
+}
+
+// The sizes and the offsets are those computed by GCC 12 for x86-64.
+const layoutSource = `
+#include <stddef.h>
+
+#define CAT(a, b) a##b
+#define STR(x) #x
+#define ALIGNED(n) __attribute__((aligned(n)))
+
+struct bits {
+	char a : 3;
+	int b : 30;
+	unsigned c : 2;
+};
+
+struct __attribute__((packed)) packed {
+	char c;
+	int i;
+};
+
+struct aligned {
+	char c;
+} ALIGNED(16);
+
+struct member_aligned {
+	char c;
+	int i ALIGNED(8);
+};
+
+#pragma pack(push, 2)
+struct pragma_packed {
+	char c;
+	long l;
+};
+#pragma pack(pop)
+
+struct unpacked {
+	char c;
+	long l;
+};
+
+enum __attribute__((packed)) small { S1 = 1, S2 = 200 };
+enum negative { NEG = -1, POS = 1 };
+enum big { BIG = 0x100000000 };
+
+struct CAT(py_, obj) {
+	long refcnt;
+	struct bits b[3];
+	char tail[sizeof(struct bits) * 2 + offsetof(struct packed, i)];
+};
+
+struct zero_width {
+	char a : 4;
+	int : 0;
+	char b : 4;
+};
+
+struct unnamed {
+	char a;
+	int : 24;
+	char b;
+};
+
+union u {
+	char c[5];
+	int i;
+};
+
+_Static_assert(sizeof(struct CAT(py_, obj)) == 56, STR(py_obj));
+`
+
+func TestParseLayout(t *testing.T) {
+	types, err := parseSource(t, layoutSource, Config{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(types.Warnings) != 0 {
+		t.Errorf("Parse() warnings = %v, want none", types.Warnings)
+	}
+
+	for _, tt := range []struct {
+		name string
+		size int64
+	}{
+		{name: "bits", size: 8},
+		{name: "packed", size: 5},
+		{name: "aligned", size: 16},
+		{name: "member_aligned", size: 16},
+		{name: "pragma_packed", size: 10},
+		{name: "unpacked", size: 16},
+		{name: "small", size: 1},
+		{name: "negative", size: 4},
+		{name: "big", size: 8},
+		{name: "py_obj", size: 56},
+		{name: "zero_width", size: 5},
+		{name: "unnamed", size: 5},
+		{name: "u", size: 8},
+	} {
+		if got := lookup(t, types, tt.name).Size(); got != tt.size {
+			t.Errorf("size of %s = %d, want %d", tt.name, got, tt.size)
+		}
+	}
+
+	for _, tt := range []struct {
+		typ, field string
+		offset     int64
+		bitOffset  int64
+	}{
+		{typ: "bits", field: "b", offset: 4, bitOffset: 32},
+		{typ: "bits", field: "c", offset: 4, bitOffset: 62},
+		{typ: "packed", field: "i", offset: 1, bitOffset: 8},
+		{typ: "member_aligned", field: "i", offset: 8, bitOffset: 64},
+		{typ: "pragma_packed", field: "l", offset: 2, bitOffset: 16},
+		{typ: "unpacked", field: "l", offset: 8, bitOffset: 64},
+		{typ: "py_obj", field: "tail", offset: 32, bitOffset: 256},
+		{typ: "zero_width", field: "b", offset: 4, bitOffset: 32},
+		{typ: "unnamed", field: "b", offset: 4, bitOffset: 32},
+	} {
+		f := field(t, lookup(t, types, tt.typ), tt.field)
+		if f.ByteOffset != tt.offset || f.DataBitOffset != tt.bitOffset {
+			t.Errorf("offset of %s.%s = %d (bit %d), want %d (bit %d)",
+				tt.typ, tt.field, f.ByteOffset, f.DataBitOffset, tt.offset, tt.bitOffset)
+		}
+	}
+}
+
+func TestParseDefines(t *testing.T) {
+	src := `
+#ifndef Py_BUILD_CORE
+#error "Py_BUILD_CORE must be defined"
+#endif
+
+#if defined(Py_GIL_DISABLED) && Py_BUILD_CORE >= 2
+#define Py_OBJECT_HEAD uintptr_t ob_tid; uint16_t ob_flags; uint8_t ob_mutex; uint8_t ob_gc_bits; uint32_t ob_ref_local; Py_ssize_t ob_ref_shared;
+#else
+#define Py_OBJECT_HEAD Py_ssize_t ob_refcnt;
+#endif
+
+#include <stdint.h>
+#include <sys/types.h>
+typedef ssize_t Py_ssize_t;
+
+typedef struct _object {
+	Py_OBJECT_HEAD
+	struct _typeobject *ob_type;
+} PyObject;
+`
+	if _, err := parseSource(t, src, Config{}); err == nil || !strings.Contains(err.Error(), "must be defined") {
+		t.Errorf("Parse() error = %v, want #error", err)
+	}
+
+	for _, tt := range []struct {
+		defines []string
+		size    int64
+		offset  int64
+	}{
+		{defines: []string{"Py_BUILD_CORE"}, size: 16, offset: 8},
+		{defines: []string{"Py_BUILD_CORE=2", "Py_GIL_DISABLED"}, size: 32, offset: 24},
+	} {
+		types, err := parseSource(t, src, Config{Defines: tt.defines})
+		if err != nil {
+			t.Fatalf("Parse(%v) error = %v", tt.defines, err)
+		}
+		obj := lookup(t, types, "PyObject")
+		if got := obj.Size(); got != tt.size {
+			t.Errorf("Parse(%v) size of PyObject = %d, want %d", tt.defines, got, tt.size)
+		}
+		if got := field(t, obj, "ob_type").ByteOffset; got != tt.offset {
+			t.Errorf("Parse(%v) offset of PyObject.ob_type = %d, want %d", tt.defines, got, tt.offset)
+		}
+	}
+}
+
+func TestParseABI(t *testing.T) {
+	src := `
+#include <stdarg.h>
+#include <pthread.h>
+
+struct s {
+	char c;
+	va_list args;
+	pthread_mutex_t mutex;
+	long double d;
+};
+`
+	for _, tt := range []struct {
+		abi        *ABI
+		charSigned bool
+		size       int64
+		mutex      int64
+	}{
+		{abi: X86_64, charSigned: true, size: 96, mutex: 32},
+		{abi: AArch64, charSigned: false, size: 112, mutex: 40},
+	} {
+		types, err := parseSource(t, src, Config{ABI: tt.abi})
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.abi.Name, err)
+		}
+		s := lookup(t, types, "s")
+		if got := s.Size(); got != tt.size {
+			t.Errorf("Parse(%s) size of s = %d, want %d", tt.abi.Name, got, tt.size)
+		}
+		if got := field(t, s, "mutex").ByteOffset; got != tt.mutex {
+			t.Errorf("Parse(%s) offset of s.mutex = %d, want %d", tt.abi.Name, got, tt.mutex)
+		}
+		_, signed := field(t, s, "c").Type.(*dwarf.CharType)
+		if signed != tt.charSigned {
+			t.Errorf("Parse(%s) char is signed = %v, want %v", tt.abi.Name, signed, tt.charSigned)
+		}
+	}
+
+	if _, err := LookupABI("arm64"); err != nil {
+		t.Errorf("LookupABI(arm64) error = %v", err)
+	}
+	if _, err := LookupABI("sparc"); err == nil {
+		t.Error("LookupABI(sparc) error = nil, want unsupported")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	src := `
+#include <vendor/missing.h>
+
+struct incomplete;
+
+struct a {
+	long n;
+	vendor_t v;
+};
+
+typedef struct a a_t;
+
+struct b {
+	struct a *a;
+	struct incomplete *i;
+	long n;
+};
+
+struct c {
+	struct incomplete i;
+};
+`
+	types, err := parseSource(t, src, Config{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(types.Warnings) != 1 || !strings.Contains(types.Warnings[0].Error(), "vendor/missing.h") {
+		t.Errorf("Parse() warnings = %v, want the missing header", types.Warnings)
+	}
+	for name, want := range map[string]string{
+		"a":   "unknown type vendor_t",
+		"a_t": "unknown type vendor_t",
+		"c":   "incomplete type struct incomplete",
+	} {
+		if err := types.Errors[name]; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("layout of %s error = %v, want %s", name, err, want)
+		}
+	}
+	if got := lookup(t, types, "b").Size(); got != 24 {
+		t.Errorf("size of b = %d, want 24", got)
+	}
+
+	if _, err := parseSource(t, `#include "missing.h"`, Config{}); err == nil {
+		t.Error(`Parse() of #include "missing.h" error = nil, want not found`)
+	}
+}
+
+// FuzzParse checks that malformed headers are reported, rather than making Parse panic or hang.
+func FuzzParse(f *testing.F) {
+	f.Add(layoutSource)
+	f.Add("#define F(x, ...) x ## __VA_ARGS__ #x\nstruct F(a, b) { int F(c, d) : 3; };\n")
+	f.Add("#if __has_include(<stddef.h>) && defined X\n#elif 1 ? 2 : 3\n#endif\n")
+	f.Fuzz(func(t *testing.T, src string) {
+		header := filepath.Join(t.TempDir(), "fuzz.h")
+		if err := os.WriteFile(header, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		types, err := Parse([]string{header}, Config{})
+		if err != nil {
+			return
+		}
+		for _, typs := range types.Names {
+			for _, typ := range typs {
+				_ = typ.String()
+			}
+		}
+	})
+}
@@ -0,0 +1,432 @@
+package cheader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// binaryOperators are the binary operators of constant expressions, by precedence, lowest first.
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// constExpr evaluates a constant expression, e.g. the size of an array or the condition of an #if directive.
+// In the latter, the identifiers that are left after the macros are expanded are 0.
+func (p *parser) constExpr() (int64, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	a, err := p.constExpr()
+	if err != nil {
+		return 0, err
+	}
+	if err := p.expect(":"); err != nil {
+		return 0, err
+	}
+	b, err := p.constExpr()
+	if err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (p *parser) binary(level int) (int64, error) {
+	if level == len(binaryOperators) {
+		return p.unary()
+	}
+	lhs, err := p.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := ""
+		for _, o := range binaryOperators[level] {
+			if p.peek().is(o) {
+				op = o
+			}
+		}
+		if op == "" {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		if lhs, err = apply(op, lhs, rhs); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func apply(op string, a, b int64) (int64, error) {
+	bool2int := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "||":
+		return bool2int(a != 0 || b != 0), nil
+	case "&&":
+		return bool2int(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return bool2int(a == b), nil
+	case "!=":
+		return bool2int(a != b), nil
+	case "<":
+		return bool2int(a < b), nil
+	case ">":
+		return bool2int(a > b), nil
+	case "<=":
+		return bool2int(a <= b), nil
+	case ">=":
+		return bool2int(a >= b), nil
+	case "<<", ">>":
+		if b < 0 || b > 63 {
+			return 0, fmt.Errorf("invalid shift count %d", b)
+		}
+		if op == "<<" {
+			return a << b, nil
+		}
+		return a >> b, nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+	return 0, fmt.Errorf("invalid operator %s", op)
+}
+
+func (p *parser) unary() (int64, error) {
+	tok := p.peek()
+	switch {
+	case tok.is("+"), tok.is("-"), tok.is("~"), tok.is("!"):
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch tok.text {
+		case "-":
+			return -v, nil
+		case "~":
+			return ^v, nil
+		case "!":
+			if v == 0 {
+				return 1, nil
+			}
+			return 0, nil
+		}
+		return v, nil
+	case p.pp == nil && (tok.is("sizeof") || isAlignof(tok)):
+		p.next()
+		if !p.peek().is("(") || !p.isTypeName(p.peekAt(1)) {
+			return 0, fmt.Errorf("%s of an expression is not supported", tok.text)
+		}
+		p.next()
+		t, err := p.typeName()
+		if err != nil {
+			return 0, err
+		}
+		if err := p.expect(")"); err != nil {
+			return 0, err
+		}
+		if tok.is("sizeof") {
+			return sizeOf(t)
+		}
+		return alignOf(t)
+	case p.pp == nil && tok.is("(") && p.isTypeName(p.peekAt(1)):
+		// A cast.
+		p.next()
+		t, err := p.typeName()
+		if err != nil {
+			return 0, err
+		}
+		if err := p.expect(")"); err != nil {
+			return 0, err
+		}
+		v, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return convert(v, t)
+	}
+	return p.primary()
+}
+
+func isAlignof(tok token) bool {
+	return tok.is("_Alignof") || tok.is("alignof") || tok.is("__alignof__") || tok.is("__alignof")
+}
+
+// convert converts the given value to the given integer type.
+func convert(v int64, t *ctype) (int64, error) {
+	r := t.resolved()
+	switch r.kind {
+	case kindBool:
+		if v != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	case kindInt, kindEnum, kindPointer:
+		bits := r.size * 8
+		if bits <= 0 || bits >= 64 {
+			return v, nil
+		}
+		v &= 1<<bits - 1
+		if !r.unsigned && r.kind != kindPointer && v>>(bits-1) == 1 {
+			v -= 1 << bits
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("cast to %s in a constant expression", t)
+}
+
+func (p *parser) primary() (int64, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return parseInteger(tok.text)
+	case tokChar:
+		return parseChar(tok.text)
+	case tokIdent:
+		if p.pp != nil {
+			return p.ppIdent(tok)
+		}
+		switch tok.text {
+		case "__builtin_offsetof", "offsetof":
+			return p.offsetof()
+		}
+		if v, ok := p.consts[tok.text]; ok {
+			return v, nil
+		}
+		return 0, fmt.Errorf("%s is not a constant", tok.text)
+	case tokPunct:
+		if tok.is("(") {
+			v, err := p.constExpr()
+			if err != nil {
+				return 0, err
+			}
+			return v, p.expect(")")
+		}
+	}
+	if tok.text == "" {
+		return 0, errors.New("unexpected end of expression")
+	}
+	return 0, fmt.Errorf("unexpected %s", tok.text)
+}
+
+// ppIdent evaluates an identifier in an #if expression.
+func (p *parser) ppIdent(tok token) (int64, error) {
+	if !hasOperators[tok.text] && !tok.is("defined") {
+		// true and false are identifiers before C23, like in GCC's C17 mode.
+		return 0, nil
+	}
+	if tok.is("defined") {
+		// defined produced by a macro expansion.
+		paren := p.accept("(")
+		name := p.next()
+		if paren {
+			if err := p.expect(")"); err != nil {
+				return 0, err
+			}
+		}
+		if p.pp.isDefined(name.text) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if err := p.expect("("); err != nil {
+		return 0, err
+	}
+	var args []token
+	for depth := 0; ; {
+		t := p.next()
+		switch {
+		case t.text == "":
+			return 0, fmt.Errorf("missing ) after %s", tok.text)
+		case t.is("("):
+			depth++
+		case t.is(")") && depth == 0:
+			return p.pp.has(tok, args)
+		case t.is(")"):
+			depth--
+		}
+		args = append(args, t)
+	}
+}
+
+// has evaluates the __has_include and __has_attribute like operators.
+// The attributes are all supported, since the ones that do not change the layout are skipped,
+// and the builtins and features of the compiler are not.
+func (pp *preprocessor) has(op token, args []token) (int64, error) {
+	switch op.text {
+	case "__has_include", "__has_include_next":
+		name, quoted, err := includeName(args)
+		if err != nil {
+			return 0, err
+		}
+		if _, _, ok := pp.lookup(name, quoted, op.pos.file, 0); ok {
+			return 1, nil
+		}
+		return 0, nil
+	case "__has_attribute", "__has_c_attribute":
+		return 1, nil
+	case "__has_builtin":
+		if len(args) == 1 && args[0].text == "__builtin_offsetof" {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// offsetof evaluates __builtin_offsetof(type, member), the member can be nested or an element of an array.
+func (p *parser) offsetof() (int64, error) {
+	if err := p.expect("("); err != nil {
+		return 0, err
+	}
+	t, err := p.typeName()
+	if err != nil {
+		return 0, err
+	}
+	if err := p.expect(","); err != nil {
+		return 0, err
+	}
+	var off int64
+	for first := true; !p.accept(")"); first = false {
+		switch {
+		case p.accept("["):
+			r := t.resolved()
+			if r.kind != kindArray {
+				return 0, fmt.Errorf("%s is not an array", t)
+			}
+			i, err := p.constExpr()
+			if err != nil {
+				return 0, err
+			}
+			if err := p.expect("]"); err != nil {
+				return 0, err
+			}
+			size, err := sizeOf(r.base)
+			if err != nil {
+				return 0, err
+			}
+			off += i * size
+			t = r.base
+		case first || p.accept("."):
+			name := p.next()
+			m, moff, ok := lookupMember(t.resolved(), name.text)
+			if !ok {
+				return 0, fmt.Errorf("no member %s in %s", name.text, t)
+			}
+			off += moff
+			t = m.typ
+		default:
+			return 0, fmt.Errorf("unexpected %s in offsetof", p.peek().text)
+		}
+	}
+	return off, nil
+}
+
+// lookupMember looks up a member by name, in the anonymous members too, and returns its offset.
+func lookupMember(st *ctype, name string) (*member, int64, bool) {
+	if !st.isRecord() || !st.complete || st.err != nil {
+		return nil, 0, false
+	}
+	for _, m := range st.members {
+		if m.name == name {
+			return m, m.offset, true
+		}
+	}
+	for _, m := range st.members {
+		if m.name != "" {
+			continue
+		}
+		if found, off, ok := lookupMember(m.typ.resolved(), name); ok {
+			return found, m.offset + off, true
+		}
+	}
+	return nil, 0, false
+}
+
+// parseInteger parses an integer constant, e.g. 0x1fUL, the value of unsigned 64-bit constants wraps around.
+func parseInteger(text string) (int64, error) {
+	s := strings.TrimRight(text, "uUlL")
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		s, base = s[2:], 2
+	case len(s) > 1 && s[0] == '0':
+		s, base = s[1:], 8
+	}
+	v, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer constant %s", text)
+	}
+	return int64(v), nil
+}
+
+// parseChar parses a character constant, e.g. 'a' or '\n', as an int.
+func parseChar(text string) (int64, error) {
+	text = text[strings.IndexByte(text, '\''):]
+	if len(text) < 3 || text[len(text)-1] != '\'' {
+		return 0, fmt.Errorf("invalid character constant %s", text)
+	}
+	s := text[1 : len(text)-1]
+	if s[0] != '\\' {
+		return int64(int8(s[0])), nil
+	}
+	if len(s) > 1 && (s[1] == 'x' || (s[1] >= '0' && s[1] <= '7')) {
+		base, digits := 8, s[1:]
+		if s[1] == 'x' {
+			base, digits = 16, s[2:]
+		}
+		v, err := strconv.ParseUint(digits, base, 8)
+		if err != nil {
+			return 0, fmt.Errorf("invalid character constant %s", text)
+		}
+		return int64(int8(v)), nil
+	}
+	v, _, _, err := strconv.UnquoteChar(s, '\'')
+	if err != nil {
+		return 0, fmt.Errorf("invalid character constant %s", text)
+	}
+	return int64(v), nil
+}
@@ -0,0 +1,7 @@
+/* Only the types of glibc's inttypes.h, the format macros are not needed to lay out structs. */
+#ifndef _INTTYPES_H
+#define _INTTYPES_H
+
+#include <stdint.h>
+
+#endif
@@ -0,0 +1,7 @@
+#ifndef _PTHREAD_H
+#define _PTHREAD_H
+
+#include <sys/types.h>
+#include <time.h>
+
+#endif
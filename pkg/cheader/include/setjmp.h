@@ -0,0 +1,22 @@
+/* The jmp_buf of glibc, with the registers of bits/setjmp.h. */
+#ifndef _SETJMP_H
+#define _SETJMP_H
+
+#include <signal.h>
+
+#ifdef __aarch64__
+typedef unsigned long long __jmp_buf[22];
+#else
+typedef long int __jmp_buf[8];
+#endif
+
+struct __jmp_buf_tag {
+  __jmp_buf __jmpbuf;
+  int __mask_was_saved;
+  __sigset_t __saved_mask;
+};
+
+typedef struct __jmp_buf_tag jmp_buf[1];
+typedef struct __jmp_buf_tag sigjmp_buf[1];
+
+#endif
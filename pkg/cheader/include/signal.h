@@ -0,0 +1,13 @@
+#ifndef _SIGNAL_H
+#define _SIGNAL_H
+
+#include <sys/types.h>
+
+typedef int sig_atomic_t;
+
+typedef struct {
+  unsigned long int __val[1024 / (8 * sizeof(unsigned long int))];
+} __sigset_t;
+typedef __sigset_t sigset_t;
+
+#endif
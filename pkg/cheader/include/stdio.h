@@ -0,0 +1,14 @@
+/* FILE is opaque, the structs that point to it only need its name. */
+#ifndef _STDIO_H
+#define _STDIO_H
+
+#include <stddef.h>
+#include <stdarg.h>
+#include <sys/types.h>
+
+typedef struct _IO_FILE FILE;
+
+#define EOF (-1)
+#define BUFSIZ 8192
+
+#endif
@@ -0,0 +1,38 @@
+/* The definitions glibc's sys/types.h makes for the 64-bit Linux targets. */
+#ifndef _SYS_TYPES_H
+#define _SYS_TYPES_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <bits/pthreadtypes.h>
+
+typedef long int ssize_t;
+typedef long int off_t;
+typedef long int off64_t;
+typedef int pid_t;
+typedef unsigned int uid_t;
+typedef unsigned int gid_t;
+typedef unsigned int mode_t;
+typedef unsigned long int ino_t;
+typedef unsigned long int dev_t;
+#ifdef __aarch64__
+typedef unsigned int nlink_t;
+typedef int blksize_t;
+#else
+typedef unsigned long int nlink_t;
+typedef long int blksize_t;
+#endif
+typedef long int blkcnt_t;
+typedef long int time_t;
+typedef long int clock_t;
+typedef int clockid_t;
+typedef void *timer_t;
+typedef unsigned int useconds_t;
+typedef long int suseconds_t;
+typedef int key_t;
+typedef unsigned char u_char;
+typedef unsigned short int u_short;
+typedef unsigned int u_int;
+typedef unsigned long int u_long;
+
+#endif
@@ -0,0 +1,25 @@
+#ifndef _TIME_H
+#define _TIME_H
+
+#include <sys/types.h>
+
+struct timespec {
+  time_t tv_sec;
+  long int tv_nsec;
+};
+
+struct tm {
+  int tm_sec;
+  int tm_min;
+  int tm_hour;
+  int tm_mday;
+  int tm_mon;
+  int tm_year;
+  int tm_wday;
+  int tm_yday;
+  int tm_isdst;
+  long int tm_gmtoff;
+  const char *tm_zone;
+};
+
+#endif
@@ -0,0 +1,18 @@
+#ifndef _WCHAR_H
+#define _WCHAR_H
+
+#include <stddef.h>
+
+typedef unsigned int wint_t;
+
+typedef struct {
+  int __count;
+  union {
+    unsigned int __wch;
+    char __wchb[4];
+  } __value;
+} mbstate_t;
+
+#define WEOF (0xffffffffu)
+
+#endif
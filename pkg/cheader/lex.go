@@ -0,0 +1,229 @@
+package cheader
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota + 1
+	tokNumber
+	tokChar
+	tokString
+	tokPunct
+)
+
+// position is the location of a token, for error messages.
+type position struct {
+	file string
+	line int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  position
+	// bol reports whether the token is the first one of its line, directives start with one.
+	bol bool
+	// space reports whether the token is preceded by whitespace, stringified arguments keep it.
+	space bool
+	// hide lists the macros the token comes from, they are not expanded again.
+	hide *hideset
+}
+
+func (t token) is(text string) bool {
+	return (t.kind == tokPunct || t.kind == tokIdent) && t.text == text
+}
+
+// hideset is a list of macro names, shared between the tokens of an expansion.
+type hideset struct {
+	name string
+	next *hideset
+}
+
+func (h *hideset) contains(name string) bool {
+	for ; h != nil; h = h.next {
+		if h.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hideset) add(name string) *hideset {
+	if h.contains(name) {
+		return h
+	}
+	return &hideset{name: name, next: h}
+}
+
+func (h *hideset) intersect(other *hideset) *hideset {
+	var out *hideset
+	for ; h != nil; h = h.next {
+		if other.contains(h.name) {
+			out = &hideset{name: h.name, next: out}
+		}
+	}
+	return out
+}
+
+// punctuators are the multi-character punctuators, longest first.
+var punctuators = []string{
+	"...", "<<=", ">>=",
+	"->", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"*=", "/=", "%=", "+=", "-=", "&=", "^=", "|=", "##",
+}
+
+// lex splits the given source into tokens.
+// Comments are dropped, and lines continued with a backslash are joined,
+// the newlines they remove are kept at the end of the joined line so the lines of the tokens stay right.
+func lex(file, src string) ([]token, error) {
+	src = joinLines(src)
+	var (
+		toks  []token
+		line  = 1
+		bol   = true
+		space = false
+	)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+			bol, space = true, false
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			space = true
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%s:%d: unterminated comment", file, line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+			space = true
+			continue
+		}
+
+		tok := token{pos: position{file: file, line: line}, bol: bol, space: space}
+		bol, space = false, false
+		n, kind := scan(src[i:])
+		tok.kind, tok.text = kind, src[i:i+n]
+		toks = append(toks, tok)
+		i += n
+	}
+	return toks, nil
+}
+
+// scan returns the length and the kind of the token at the start of the given source.
+func scan(src string) (int, tokenKind) {
+	c := src[0]
+	switch {
+	case isDigit(c) || (c == '.' && len(src) > 1 && isDigit(src[1])):
+		// A preprocessing number, e.g. 0x1fUL or 1e-3.
+		n := 1
+		for n < len(src) {
+			if (src[n] == '+' || src[n] == '-') && strings.ContainsRune("eEpP", rune(src[n-1])) {
+				n++
+				continue
+			}
+			if !isIdent(src[n]) && src[n] != '.' {
+				break
+			}
+			n++
+		}
+		return n, tokNumber
+	case isIdentStart(c):
+		n := 1
+		for n < len(src) && isIdent(src[n]) {
+			n++
+		}
+		// Literals with an encoding prefix, e.g. L"x" or u8'x'.
+		if n < len(src) && (src[n] == '"' || src[n] == '\'') {
+			switch src[:n] {
+			case "L", "u", "U", "u8":
+				m, kind := scan(src[n:])
+				return n + m, kind
+			}
+		}
+		return n, tokIdent
+	case c == '"' || c == '\'':
+		// Unterminated literals end at the end of the line, like the apostrophes of the
+		// messages of #error, they are only an error if the parser gets to see them.
+		n := 1
+		for n < len(src) && src[n] != c && src[n] != '\n' {
+			if src[n] == '\\' {
+				n++
+			}
+			n++
+		}
+		if n < len(src) && src[n] == c {
+			n++
+		}
+		if c == '"' {
+			return n, tokString
+		}
+		return n, tokChar
+	}
+	for _, p := range punctuators {
+		if strings.HasPrefix(src, p) {
+			return len(p), tokPunct
+		}
+	}
+	// Stray characters, e.g. in the messages of #error, are only an error if the parser gets to see them.
+	return 1, tokPunct
+}
+
+// joinLines removes the backslash-newline sequences of the given source.
+func joinLines(src string) string {
+	if !strings.Contains(src, "\\\n") && !strings.Contains(src, "\\\r\n") {
+		return src
+	}
+	var (
+		b       strings.Builder
+		pending int
+	)
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '\\' && strings.HasPrefix(src[i+1:], "\n"):
+			i++
+			pending++
+		case src[i] == '\\' && strings.HasPrefix(src[i+1:], "\r\n"):
+			i += 2
+			pending++
+		case src[i] == '\n':
+			b.WriteString(strings.Repeat("\n", pending+1))
+			pending = 0
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
@@ -0,0 +1,1034 @@
+package cheader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// parser parses the declarations of the preprocessed tokens, and lays out the types they declare.
+// Only what the layout of the types depends on is kept, the bodies of the functions are skipped,
+// and the declarations that cannot be parsed are skipped and reported.
+type parser struct {
+	toks []token
+	pos  int
+	// pp is set when the parser evaluates the expression of an #if directive.
+	pp  *preprocessor
+	abi *ABI
+
+	typedefs map[string]*ctype
+	tags     map[string]*ctype
+	consts   map[string]int64
+	// pack is the limit #pragma pack sets on the alignment of the members, 0 if there is none.
+	pack  int64
+	packs []int64
+	// declared lists the named structs, unions and enums, and the typedefs, in the order they are defined.
+	declared []*ctype
+	// skipped lists the declarations that could not be parsed.
+	skipped []error
+}
+
+func newParser(toks []token, abi *ABI) *parser {
+	return &parser{
+		toks:     toks,
+		abi:      abi,
+		typedefs: map[string]*ctype{},
+		tags:     map[string]*ctype{},
+		consts:   map[string]int64{},
+	}
+}
+
+var (
+	storageKeywords = map[string]bool{
+		"extern": true, "static": true, "auto": true, "register": true,
+		"inline": true, "__inline": true, "__inline__": true, "_Noreturn": true,
+		"__thread": true, "_Thread_local": true, "thread_local": true, "constexpr": true,
+	}
+	basicKeywords = map[string]string{
+		"void": "void", "char": "char", "short": "short", "int": "int", "long": "long",
+		"float": "float", "double": "double", "_Bool": "_Bool", "__int128": "__int128",
+		"signed": "signed", "__signed": "signed", "__signed__": "signed", "unsigned": "unsigned",
+		"_Complex": "_Complex", "__complex__": "_Complex",
+	}
+	qualifierKeywords = map[string]string{
+		"const": "const", "__const": "const", "__const__": "const",
+		"volatile": "volatile", "__volatile": "volatile", "__volatile__": "volatile",
+		// restrict and _Atomic do not change the layout on the supported ABIs.
+		"restrict": "", "__restrict": "", "__restrict__": "", "_Atomic": "",
+	}
+	otherTypeKeywords = map[string]bool{
+		"struct": true, "union": true, "enum": true, "typeof": true, "__typeof__": true, "__typeof": true,
+		"__attribute__": true, "__attribute": true, "__extension__": true, "_Alignas": true, "alignas": true,
+	}
+	asmKeywords = map[string]bool{"asm": true, "__asm": true, "__asm__": true}
+)
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+// peekAt returns the token at the given distance from the current one, a token with no text past the end.
+func (p *parser) peekAt(n int) token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return token{}
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) atEOF() bool {
+	return p.pos >= len(p.toks)
+}
+
+func (p *parser) accept(text string) bool {
+	if p.peek().is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if p.accept(text) {
+		return nil
+	}
+	if p.atEOF() {
+		return fmt.Errorf("expected %s, got end of input", text)
+	}
+	return fmt.Errorf("expected %s, got %s", text, p.peek().text)
+}
+
+// errPos returns the position of the current token, or of the last one at the end of the tokens.
+func (p *parser) errPos() position {
+	switch {
+	case p.pos < len(p.toks):
+		return p.toks[p.pos].pos
+	case len(p.toks) > 0:
+		return p.toks[len(p.toks)-1].pos
+	}
+	return position{}
+}
+
+// skipBalanced skips the tokens up to the bracket that closes the one just read.
+func (p *parser) skipBalanced() error {
+	for depth := 1; depth > 0; {
+		if p.atEOF() {
+			return errors.New("unbalanced brackets")
+		}
+		tok := p.next()
+		switch {
+		case tok.is("("), tok.is("["), tok.is("{"):
+			depth++
+		case tok.is(")"), tok.is("]"), tok.is("}"):
+			depth--
+		}
+	}
+	return nil
+}
+
+// skipDeclaration skips the tokens up to the end of the declaration that could not be parsed:
+// the next ; or the } that closes the body of a function or a struct.
+func (p *parser) skipDeclaration(inRecord bool) {
+	depth := 0
+	for !p.atEOF() {
+		tok := p.peek()
+		switch {
+		case tok.is("("), tok.is("["), tok.is("{"):
+			depth++
+		case tok.is(")"), tok.is("]"), tok.is("}"):
+			if depth == 0 && inRecord {
+				// The end of the struct the member is in.
+				return
+			}
+			depth--
+			if depth <= 0 && tok.is("}") && !inRecord {
+				p.next()
+				p.accept(";")
+				return
+			}
+		case tok.is(";") && depth <= 0:
+			p.next()
+			return
+		}
+		p.next()
+	}
+}
+
+// parse parses the declarations up to the end of the tokens.
+func (p *parser) parse() {
+	for !p.atEOF() {
+		start := p.pos
+		if err := p.declaration(); err != nil {
+			p.skipped = append(p.skipped, fmt.Errorf("%s: %w", p.errPos(), err))
+			p.pos = start
+			p.skipDeclaration(false)
+			if p.pos == start {
+				p.next()
+			}
+		}
+	}
+}
+
+// declaration parses a declaration at file scope.
+func (p *parser) declaration() error {
+	tok := p.peek()
+	switch {
+	case p.accept(";"):
+		return nil
+	case tok.is("_Static_assert") || tok.is("static_assert"):
+		return p.staticAssert()
+	case tok.is(pragmaPack):
+		return p.pragmaPack()
+	case asmKeywords[tok.text]:
+		// A top-level asm statement.
+		p.next()
+		for qualifierKeywords[p.peek().text] != "" {
+			p.next()
+		}
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		if err := p.skipBalanced(); err != nil {
+			return err
+		}
+		return p.expect(";")
+	}
+
+	spec, err := p.declSpecs()
+	if err != nil {
+		return err
+	}
+	if p.accept(";") {
+		return nil
+	}
+	for {
+		name, typ, a, err := p.declarator(spec.typ, false)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return fmt.Errorf("expected a name, got %s", p.peek().text)
+		}
+		if typ.kind == kindFunc && p.accept("{") {
+			// The body of a function, e.g. of a static inline function.
+			return p.skipBalanced()
+		}
+		if spec.typedef {
+			p.typedef(name, typ, max(spec.align, a.align))
+		}
+		if p.accept("=") {
+			if err := p.skipInitializer(); err != nil {
+				return err
+			}
+		}
+		if p.accept(",") {
+			continue
+		}
+		return p.expect(";")
+	}
+}
+
+func (p *parser) typedef(name string, typ *ctype, align int64) {
+	if old, ok := p.typedefs[name]; ok && old.base == typ && old.align == align {
+		// A typedef can be repeated.
+		return
+	}
+	t := &ctype{kind: kindTypedef, name: name, base: typ, align: align}
+	p.typedefs[name] = t
+	p.declared = append(p.declared, t)
+}
+
+// skipInitializer skips the initializer of a variable, up to the , or the ; that ends it.
+func (p *parser) skipInitializer() error {
+	for !p.atEOF() {
+		tok := p.peek()
+		switch {
+		case tok.is(",") || tok.is(";"):
+			return nil
+		case tok.is("(") || tok.is("[") || tok.is("{"):
+			p.next()
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+			continue
+		}
+		p.next()
+	}
+	return errors.New("unterminated initializer")
+}
+
+func (p *parser) staticAssert() error {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	v, err := p.constExpr()
+	if err != nil {
+		return fmt.Errorf("static assertion: %w", err)
+	}
+	if p.accept(",") {
+		for !p.atEOF() && !p.peek().is(")") {
+			p.next()
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return err
+	}
+	p.accept(";")
+	if v == 0 {
+		return errors.New("static assertion failed")
+	}
+	return nil
+}
+
+// pragmaPack is the token #pragma pack directives are replaced with, followed by their operands.
+const pragmaPack = "__pragma_pack"
+
+// pragmaPack processes #pragma pack(n), pack(push[, n]), pack(pop) and pack().
+func (p *parser) pragmaPack() error {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	if p.accept(")") {
+		// pack() restores the default.
+		p.pack = 0
+		return nil
+	}
+	for !p.accept(")") {
+		tok := p.next()
+		switch {
+		case tok.is(","):
+		case tok.is("push"):
+			p.packs = append(p.packs, p.pack)
+		case tok.is("pop"):
+			if n := len(p.packs); n > 0 {
+				p.pack, p.packs = p.packs[n-1], p.packs[:n-1]
+			}
+		case tok.text == "":
+			return errors.New("unterminated #pragma pack")
+		case tok.kind == tokNumber:
+			n, err := parseInteger(tok.text)
+			if err != nil {
+				return err
+			}
+			p.pack = n
+		default:
+			return fmt.Errorf("invalid #pragma pack operand %s", tok.text)
+		}
+	}
+	return nil
+}
+
+// attrs are the attributes that change the layout of a type or of a member.
+type attrs struct {
+	align  int64
+	packed bool
+}
+
+func (a *attrs) merge(other attrs) {
+	a.align = max(a.align, other.align)
+	a.packed = a.packed || other.packed
+}
+
+// attributes parses the attributes at the current token, if any, and the asm labels of the declarations.
+func (p *parser) attributes(a *attrs) error {
+	for {
+		tok := p.peek()
+		switch {
+		case tok.is("__attribute__") || tok.is("__attribute"):
+			p.next()
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			for !p.accept(")") {
+				if p.atEOF() {
+					return errors.New("unterminated attribute")
+				}
+				if p.accept(",") {
+					continue
+				}
+				switch strings.Trim(p.next().text, "_") {
+				case "aligned":
+					if !p.accept("(") {
+						// The largest alignment of the target.
+						a.align = max(a.align, 16)
+						continue
+					}
+					v, err := p.constExpr()
+					if err != nil {
+						return fmt.Errorf("aligned attribute: %w", err)
+					}
+					if err := p.expect(")"); err != nil {
+						return err
+					}
+					a.align = max(a.align, v)
+				case "packed":
+					a.packed = true
+				default:
+					if p.accept("(") {
+						if err := p.skipBalanced(); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+		case tok.is("__declspec") || asmKeywords[tok.text]:
+			p.next()
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+		case tok.is("[") && p.peekAt(1).is("["):
+			// A C23 attribute, e.g. [[deprecated]].
+			p.next()
+			p.next()
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+			if err := p.expect("]"); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// isTypeName reports whether the given token starts a type name.
+func (p *parser) isTypeName(tok token) bool {
+	if tok.kind != tokIdent {
+		return false
+	}
+	_, basic := basicKeywords[tok.text]
+	_, qual := qualifierKeywords[tok.text]
+	_, typedef := p.typedefs[tok.text]
+	return basic || qual || typedef || otherTypeKeywords[tok.text] || tok.is("bool")
+}
+
+type declSpec struct {
+	attrs
+	typ     *ctype
+	typedef bool
+}
+
+// declSpecs parses the specifiers of a declaration: its storage class, its type and its qualifiers.
+// A name that is not declared is taken for the name of an unknown type when a declarator follows it,
+// e.g. pthread_t tid, so the types that use it are reported rather than the declaration skipped.
+func (p *parser) declSpecs() (*declSpec, error) {
+	var (
+		spec   = &declSpec{}
+		basics = map[string]int{}
+		quals  []string
+		typ    *ctype
+	)
+	setType := func(t *ctype) error {
+		if typ != nil || len(basics) > 0 {
+			return fmt.Errorf("two types in a declaration: %s and %s", typ, t)
+		}
+		typ = t
+		return nil
+	}
+loop:
+	for {
+		tok := p.peek()
+		if tok.kind != tokIdent {
+			break
+		}
+		switch {
+		case tok.is("typedef"):
+			p.next()
+			spec.typedef = true
+		case storageKeywords[tok.text], tok.is("__extension__"):
+			p.next()
+		case tok.is("_Atomic") && p.peekAt(1).is("("):
+			p.next()
+			p.next()
+			t, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			if err := setType(t); err != nil {
+				return nil, err
+			}
+		case qualifierKeywords[tok.text] != "":
+			p.next()
+			quals = append(quals, qualifierKeywords[tok.text])
+		case hasKey(qualifierKeywords, tok.text):
+			p.next()
+		case tok.is("__attribute__"), tok.is("__attribute"), tok.is("__declspec"):
+			if err := p.attributes(&spec.attrs); err != nil {
+				return nil, err
+			}
+		case tok.is("_Alignas"), tok.is("alignas"):
+			p.next()
+			a, err := p.alignas()
+			if err != nil {
+				return nil, err
+			}
+			spec.align = max(spec.align, a)
+		case tok.is("typeof"), tok.is("__typeof__"), tok.is("__typeof"):
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			if !p.isTypeName(p.peek()) {
+				return nil, errors.New("typeof of an expression is not supported")
+			}
+			t, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			if err := setType(t); err != nil {
+				return nil, err
+			}
+		case tok.is("struct"), tok.is("union"):
+			t, err := p.recordSpec()
+			if err != nil {
+				return nil, err
+			}
+			if err := setType(t); err != nil {
+				return nil, err
+			}
+		case tok.is("enum"):
+			t, err := p.enumSpec()
+			if err != nil {
+				return nil, err
+			}
+			if err := setType(t); err != nil {
+				return nil, err
+			}
+		case hasKey(basicKeywords, tok.text):
+			if typ != nil {
+				return nil, fmt.Errorf("two types in a declaration: %s and %s", typ, tok.text)
+			}
+			p.next()
+			basics[basicKeywords[tok.text]]++
+		default:
+			if typ != nil || len(basics) > 0 {
+				break loop
+			}
+			if t, ok := p.typedefs[tok.text]; ok {
+				p.next()
+				typ = t
+				continue
+			}
+			if tok.is("bool") {
+				p.next()
+				basics["_Bool"]++
+				continue
+			}
+			if next := p.peekAt(1); next.is("*") || (next.kind == tokIdent && !asmKeywords[next.text] && !next.is("__attribute__")) {
+				p.next()
+				typ = unknownType(tok.text)
+				continue
+			}
+			break loop
+		}
+	}
+	switch {
+	case len(basics) > 0:
+		typ = p.basicType(basics)
+	case typ == nil && len(quals) == 0 && !spec.typedef:
+		return nil, fmt.Errorf("expected a declaration, got %s", p.peek().text)
+	case typ == nil:
+		// Implicit int, e.g. const x.
+		typ = p.basicType(map[string]int{"int": 1})
+	}
+	spec.typ = qualified(typ, quals)
+	return spec, nil
+}
+
+func hasKey[V any](m map[string]V, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// alignas parses the operand of _Alignas, a type or a constant expression.
+func (p *parser) alignas() (int64, error) {
+	if err := p.expect("("); err != nil {
+		return 0, err
+	}
+	var (
+		a   int64
+		err error
+	)
+	if p.isTypeName(p.peek()) {
+		var t *ctype
+		if t, err = p.typeName(); err == nil {
+			a, err = alignOf(t)
+		}
+	} else {
+		a, err = p.constExpr()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return a, p.expect(")")
+}
+
+// basicType returns the basic type of the given keywords, named like GCC names them in DWARF.
+func (p *parser) basicType(kw map[string]int) *ctype {
+	var (
+		unsigned = kw["unsigned"] > 0
+		complex  = kw["_Complex"] > 0
+		t        = &ctype{kind: kindInt, unsigned: unsigned}
+	)
+	sized := func(name string, size int64) *ctype {
+		t.name, t.size, t.align = name, size, size
+		return t
+	}
+	integer := func(name string, size int64) *ctype {
+		if unsigned {
+			// e.g. long unsigned int.
+			name = strings.TrimSuffix(name, "int") + "unsigned int"
+		}
+		return sized(name, size)
+	}
+	switch {
+	case kw["void"] > 0:
+		return &ctype{kind: kindVoid, name: "void"}
+	case kw["_Bool"] > 0:
+		t.kind, t.unsigned = kindBool, true
+		return sized("_Bool", 1)
+	case kw["char"] > 0:
+		t.char = true
+		switch {
+		case unsigned:
+			return sized("unsigned char", 1)
+		case kw["signed"] > 0:
+			return sized("signed char", 1)
+		}
+		t.unsigned = !p.abi.CharSigned
+		return sized("char", 1)
+	case kw["float"] > 0 || kw["double"] > 0:
+		t.kind = kindFloat
+		name, size, align := "float", int64(4), int64(4)
+		switch {
+		case kw["double"] > 0 && kw["long"] > 0:
+			name, size, align = "long double", p.abi.LongDoubleSize, p.abi.LongDoubleAlign
+		case kw["double"] > 0:
+			name, size, align = "double", 8, 8
+		}
+		if complex {
+			t.kind = kindComplex
+			name, size = "complex "+name, size*2
+		}
+		t.name, t.size, t.align = name, size, align
+		return t
+	case kw["__int128"] > 0:
+		if unsigned {
+			return sized("__int128 unsigned", 16)
+		}
+		return sized("__int128", 16)
+	case kw["short"] > 0:
+		return integer("short int", 2)
+	case kw["long"] > 1:
+		return integer("long long int", 8)
+	case kw["long"] == 1:
+		return integer("long int", p.abi.PointerSize)
+	}
+	return integer("int", 4)
+}
+
+// typeName parses the name of a type, e.g. the operand of sizeof.
+func (p *parser) typeName() (*ctype, error) {
+	spec, err := p.declSpecs()
+	if err != nil {
+		return nil, err
+	}
+	_, t, _, err := p.declarator(spec.typ, true)
+	return t, err
+}
+
+// declarator parses a declarator, and returns the name it declares and its type.
+// Abstract declarators, e.g. those of type names, have no name.
+func (p *parser) declarator(base *ctype, abstract bool) (string, *ctype, attrs, error) {
+	var a attrs
+	if err := p.attributes(&a); err != nil {
+		return "", nil, a, err
+	}
+	for p.accept("*") || p.accept("^") {
+		base = pointerTo(base, p.abi)
+		var quals []string
+		for {
+			tok := p.peek()
+			if q, ok := qualifierKeywords[tok.text]; ok && tok.kind == tokIdent {
+				p.next()
+				if q != "" {
+					quals = append(quals, q)
+				}
+				continue
+			}
+			if tok.is("__attribute__") || tok.is("__attribute") {
+				if err := p.attributes(&a); err != nil {
+					return "", nil, a, err
+				}
+				continue
+			}
+			break
+		}
+		base = qualified(base, quals)
+	}
+
+	if p.peek().is("(") && p.isGrouping(abstract) {
+		// The declarator in parentheses applies to the type its suffixes make,
+		// e.g. int (*handlers[2])(void) is an array of pointers to functions.
+		p.next()
+		start := p.pos
+		if err := p.skipBalanced(); err != nil {
+			return "", nil, a, err
+		}
+		typ, err := p.suffixes(base)
+		if err != nil {
+			return "", nil, a, err
+		}
+		end := p.pos
+		p.pos = start
+		name, typ, inner, err := p.declarator(typ, abstract)
+		if err != nil {
+			return "", nil, a, err
+		}
+		a.merge(inner)
+		if err := p.expect(")"); err != nil {
+			return "", nil, a, err
+		}
+		p.pos = end
+		return name, typ, a, p.attributes(&a)
+	}
+
+	var name string
+	if tok := p.peek(); !abstract && tok.kind == tokIdent && !tok.is("__attribute__") && !tok.is("__attribute") && !asmKeywords[tok.text] {
+		name = p.next().text
+	}
+	if err := p.attributes(&a); err != nil {
+		return "", nil, a, err
+	}
+	typ, err := p.suffixes(base)
+	if err != nil {
+		return "", nil, a, err
+	}
+	return name, typ, a, p.attributes(&a)
+}
+
+// isGrouping reports whether the parenthesis at the current token groups a declarator,
+// rather than starting the parameters of a function.
+func (p *parser) isGrouping(abstract bool) bool {
+	next := p.peekAt(1)
+	switch {
+	case next.is("*"), next.is("^"), next.is("("), next.is("__attribute__"), next.is("__attribute"):
+		return true
+	case next.is("[") && abstract:
+		return true
+	case next.kind == tokIdent:
+		return !abstract && !p.isTypeName(next)
+	}
+	return false
+}
+
+// suffixes parses the array dimensions and the parameters that follow a declarator.
+func (p *parser) suffixes(base *ctype) (*ctype, error) {
+	switch {
+	case p.accept("["):
+		for p.accept("static") || hasKey(qualifierKeywords, p.peek().text) && p.peek().kind == tokIdent {
+			p.next()
+		}
+		count := int64(-1)
+		if !p.peek().is("]") {
+			n, err := p.constExpr()
+			if err != nil {
+				return nil, fmt.Errorf("array size: %w", err)
+			}
+			if n < 0 {
+				return nil, fmt.Errorf("negative array size %d", n)
+			}
+			count = n
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		elem, err := p.suffixes(base)
+		if err != nil {
+			return nil, err
+		}
+		return arrayOf(elem, count), nil
+	case p.accept("("):
+		// The parameters do not change the layout of the pointers to the function.
+		if err := p.skipBalanced(); err != nil {
+			return nil, err
+		}
+		return &ctype{kind: kindFunc, base: base}, nil
+	}
+	return base, nil
+}
+
+// tagType returns the struct, union or enum with the given tag, declaring it if it is not.
+func (p *parser) tagType(k kind, tag string) *ctype {
+	if t, ok := p.tags[tag]; ok && t.kind == k {
+		return t
+	}
+	t := &ctype{kind: k, name: tag}
+	p.tags[tag] = t
+	return t
+}
+
+// definedType returns the struct, union or enum with the given tag to define,
+// the one that is declared if it is not defined yet.
+func (p *parser) definedType(k kind, tag string) *ctype {
+	if tag == "" {
+		return &ctype{kind: k}
+	}
+	if t, ok := p.tags[tag]; ok && t.kind == k && !t.complete {
+		return t
+	}
+	t := &ctype{kind: k, name: tag}
+	p.tags[tag] = t
+	return t
+}
+
+// recordSpec parses a struct or a union specifier, and lays out the struct when it is defined.
+func (p *parser) recordSpec() (*ctype, error) {
+	k := kindStruct
+	if p.next().is("union") {
+		k = kindUnion
+	}
+	var a attrs
+	if err := p.attributes(&a); err != nil {
+		return nil, err
+	}
+	var tag string
+	if tok := p.peek(); tok.kind == tokIdent {
+		tag = p.next().text
+	}
+	if err := p.attributes(&a); err != nil {
+		return nil, err
+	}
+	if !p.accept("{") {
+		if tag == "" {
+			return nil, fmt.Errorf("expected a tag or {, got %s", p.peek().text)
+		}
+		return p.tagType(k, tag), nil
+	}
+
+	st := p.definedType(k, tag)
+	err := p.members(st)
+	if attrErr := p.attributes(&a); err == nil {
+		err = attrErr
+	}
+	if err == nil {
+		err = layout(st, a.packed, a.align, p.pack)
+	}
+	if err != nil {
+		st.err = fmt.Errorf("%s: %w", st, err)
+	}
+	st.complete = true
+	if tag != "" {
+		p.declared = append(p.declared, st)
+	}
+	return st, nil
+}
+
+// members parses the members of a struct or a union, up to the closing brace.
+// A member that cannot be parsed makes the layout of the struct fail, the other members are still parsed.
+func (p *parser) members(st *ctype) error {
+	var firstErr error
+	for !p.accept("}") {
+		if p.atEOF() {
+			return errors.New("expected }, got end of input")
+		}
+		start := p.pos
+		if err := p.member(st); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", p.errPos(), err)
+			}
+			p.pos = start
+			p.skipDeclaration(true)
+			if p.pos == start {
+				p.next()
+			}
+		}
+	}
+	return firstErr
+}
+
+func (p *parser) member(st *ctype) error {
+	tok := p.peek()
+	switch {
+	case p.accept(";"):
+		return nil
+	case tok.is("_Static_assert") || tok.is("static_assert"):
+		return p.staticAssert()
+	case tok.is(pragmaPack):
+		return p.pragmaPack()
+	}
+
+	spec, err := p.declSpecs()
+	if err != nil {
+		return err
+	}
+	if p.accept(";") {
+		// An anonymous struct or union.
+		if t := spec.typ; t.isRecord() && t.name == "" {
+			st.members = append(st.members, &member{typ: spec.typ, align: spec.align, packed: spec.packed})
+		}
+		return nil
+	}
+	for {
+		m := &member{typ: spec.typ, align: spec.align, packed: spec.packed}
+		if !p.peek().is(":") {
+			name, typ, a, err := p.declarator(spec.typ, false)
+			if err != nil {
+				return err
+			}
+			m.name, m.typ = name, typ
+			m.align, m.packed = max(m.align, a.align), m.packed || a.packed
+		}
+		if p.accept(":") {
+			width, err := p.constExpr()
+			if err != nil {
+				return fmt.Errorf("bitfield width: %w", err)
+			}
+			m.bitfield, m.bitSize = true, width
+			var a attrs
+			if err := p.attributes(&a); err != nil {
+				return err
+			}
+			m.align, m.packed = max(m.align, a.align), m.packed || a.packed
+		}
+		st.members = append(st.members, m)
+		if p.accept(",") {
+			continue
+		}
+		return p.expect(";")
+	}
+}
+
+// enumSpec parses an enum specifier, and computes the type of the enum when it is defined:
+// unsigned int when its values fit, then int, then 64-bit integers, like GCC does,
+// the smallest integer its values fit in when it is packed, or the type it is declared with.
+func (p *parser) enumSpec() (*ctype, error) {
+	p.next()
+	var a attrs
+	if err := p.attributes(&a); err != nil {
+		return nil, err
+	}
+	var tag string
+	if tok := p.peek(); tok.kind == tokIdent {
+		tag = p.next().text
+	}
+	if err := p.attributes(&a); err != nil {
+		return nil, err
+	}
+	var fixed *ctype
+	if p.accept(":") {
+		var err error
+		if fixed, err = p.typeName(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.accept("{") {
+		if tag == "" {
+			return nil, fmt.Errorf("expected a tag or {, got %s", p.peek().text)
+		}
+		t := p.tagType(kindEnum, tag)
+		if fixed != nil && !t.complete {
+			// An enum with a fixed type is complete before its enumerators are listed.
+			t.size, t.align, t.unsigned, t.complete = fixed.resolved().size, fixed.resolved().align, fixed.resolved().unsigned, true
+		}
+		return t, nil
+	}
+
+	et := p.definedType(kindEnum, tag)
+	var (
+		v      int64
+		lo, hi int64 = math.MaxInt64, math.MinInt64
+	)
+	for !p.accept("}") {
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, fmt.Errorf("expected an enumerator, got %s", name.text)
+		}
+		var ea attrs
+		if err := p.attributes(&ea); err != nil {
+			return nil, err
+		}
+		if p.accept("=") {
+			var err error
+			if v, err = p.constExpr(); err != nil {
+				return nil, fmt.Errorf("enumerator %s: %w", name.text, err)
+			}
+		}
+		et.enumerators = append(et.enumerators, enumerator{name: name.text, value: v})
+		p.consts[name.text] = v
+		lo, hi = min(lo, v), max(hi, v)
+		v++
+		if !p.accept(",") {
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if err := p.attributes(&a); err != nil {
+		return nil, err
+	}
+	if len(et.enumerators) == 0 {
+		lo, hi = 0, 0
+	}
+	switch {
+	case fixed != nil:
+		r := fixed.resolved()
+		et.size, et.unsigned = r.size, r.unsigned
+	case a.packed:
+		et.size, et.unsigned = 8, lo >= 0
+		for _, size := range []int64{1, 2, 4} {
+			if fits(lo, hi, size) {
+				et.size = size
+				break
+			}
+		}
+	case lo >= 0 && hi <= math.MaxUint32:
+		et.size, et.unsigned = 4, true
+	case lo >= math.MinInt32 && hi <= math.MaxInt32:
+		et.size = 4
+	default:
+		et.size, et.unsigned = 8, lo >= 0
+	}
+	et.align = et.size
+	et.complete = true
+	if tag != "" {
+		p.declared = append(p.declared, et)
+	}
+	return et, nil
+}
+
+// fits reports whether the given range of values fits in an integer of the given size.
+func fits(lo, hi, size int64) bool {
+	bits := size * 8
+	if lo >= 0 {
+		return hi < 1<<bits
+	}
+	return lo >= -(1<<(bits-1)) && hi < 1<<(bits-1)
+}
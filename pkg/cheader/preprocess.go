@@ -0,0 +1,798 @@
+package cheader
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// builtinHeaders stand in for the headers of the C library and of the compiler
+// when they are not found in the include directories.
+//
+//go:embed include
+var builtinHeaders embed.FS
+
+const (
+	builtinDir = "<builtin>"
+	// maxIncludeDepth bounds the nesting of includes, headers that include themselves without a guard
+	// would include each other forever.
+	maxIncludeDepth = 200
+	// maxExpansions bounds the number of macros expanded for a file, to stop macros that expand each other forever.
+	maxExpansions = 10_000_000
+)
+
+type macro struct {
+	name     string
+	funcLike bool
+	params   []string
+	// variadic reports whether the last parameter collects the remaining arguments,
+	// it is named __VA_ARGS__ unless it is a named variadic parameter, e.g. args...
+	variadic bool
+	body     []token
+	// builtin computes the expansion of the predefined macros that depend on where they are used, e.g. __LINE__.
+	builtin func(tok token) []token
+}
+
+// file is a file being preprocessed.
+type file struct {
+	path string
+	// dir is the index of the include directory the file was found in, -1 if none,
+	// #include_next looks up the directories after it.
+	dir   int
+	toks  []token
+	pos   int
+	conds []cond
+}
+
+// cond is a conditional directive the tokens are in.
+type cond struct {
+	pos position
+	// taken reports whether one of the branches of the conditional has been included.
+	taken   bool
+	sawElse bool
+}
+
+// stream yields the tokens to preprocess: the results of the expansions to rescan first,
+// then the tokens of the files being included, or of a list.
+type stream struct {
+	pending []token // in reverse order, the next token is the last one.
+	files   []*file
+}
+
+func (s *stream) push(toks []token) {
+	for i := len(toks) - 1; i >= 0; i-- {
+		s.pending = append(s.pending, toks[i])
+	}
+}
+
+// next returns the next token, and whether it is read from a file rather than from an expansion,
+// only the tokens of the files can start directives.
+func (s *stream) next() (token, bool, bool) {
+	if n := len(s.pending); n > 0 {
+		tok := s.pending[n-1]
+		s.pending = s.pending[:n-1]
+		return tok, false, true
+	}
+	if len(s.files) == 0 {
+		return token{}, false, false
+	}
+	f := s.files[len(s.files)-1]
+	if f.pos >= len(f.toks) {
+		return token{}, false, false
+	}
+	f.pos++
+	return f.toks[f.pos-1], true, true
+}
+
+// peek returns the next token without consuming it, it does not look past the end of the current file.
+func (s *stream) peek() (token, bool, bool) {
+	if n := len(s.pending); n > 0 {
+		return s.pending[n-1], false, true
+	}
+	if len(s.files) == 0 {
+		return token{}, false, false
+	}
+	f := s.files[len(s.files)-1]
+	if f.pos >= len(f.toks) {
+		return token{}, false, false
+	}
+	return f.toks[f.pos], true, true
+}
+
+// line returns the remaining tokens of the line of the current file, those of a directive.
+func (s *stream) line() []token {
+	f := s.files[len(s.files)-1]
+	start := f.pos
+	for f.pos < len(f.toks) && !f.toks[f.pos].bol {
+		f.pos++
+	}
+	return f.toks[start:f.pos]
+}
+
+type preprocessor struct {
+	cfg        *Config
+	macros     map[string]*macro
+	once       map[string]bool
+	expansions int
+	// skipped lists the system headers that were not found.
+	skipped []string
+}
+
+func newPreprocessor(cfg *Config) (*preprocessor, error) {
+	pp := &preprocessor{
+		cfg:    cfg,
+		macros: map[string]*macro{},
+		once:   map[string]bool{},
+	}
+	var defs strings.Builder
+	for _, macros := range []map[string]string{commonMacros, cfg.ABI.Macros} {
+		for name, value := range macros {
+			fmt.Fprintf(&defs, "#define %s %s\n", name, value)
+		}
+	}
+	for _, d := range cfg.Defines {
+		name, value, ok := strings.Cut(d, "=")
+		if !ok {
+			value = "1"
+		}
+		fmt.Fprintf(&defs, "#define %s %s\n", name, value)
+	}
+	if _, err := pp.preprocess("<command-line>", defs.String()); err != nil {
+		return nil, err
+	}
+	pp.macros["__FILE__"] = &macro{name: "__FILE__", builtin: func(tok token) []token {
+		tok.kind, tok.text = tokString, strconv.Quote(tok.pos.file)
+		return []token{tok}
+	}}
+	pp.macros["__LINE__"] = &macro{name: "__LINE__", builtin: func(tok token) []token {
+		tok.kind, tok.text = tokNumber, strconv.Itoa(tok.pos.line)
+		return []token{tok}
+	}}
+	return pp, nil
+}
+
+// preprocess preprocesses the given source and returns its tokens.
+func (pp *preprocessor) preprocess(name, src string) ([]token, error) {
+	toks, err := lex(name, src)
+	if err != nil {
+		return nil, err
+	}
+	s := &stream{files: []*file{{path: name, dir: -1, toks: toks}}}
+	return pp.run(s)
+}
+
+// include preprocesses the given file and returns its tokens.
+func (pp *preprocessor) include(path string) ([]token, error) {
+	s := &stream{}
+	if err := pp.open(s, path, -1); err != nil {
+		return nil, err
+	}
+	return pp.run(s)
+}
+
+func (pp *preprocessor) open(s *stream, path string, dir int) error {
+	if len(s.files) >= maxIncludeDepth {
+		return fmt.Errorf("%s: too many nested includes", path)
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if rest, ok := strings.CutPrefix(path, builtinDir+"/"); ok {
+		data, err = builtinHeaders.ReadFile("include/" + rest)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	toks, err := lex(path, string(data))
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, &file{path: path, dir: dir, toks: toks})
+	return nil
+}
+
+// run preprocesses the tokens of the given stream.
+func (pp *preprocessor) run(s *stream) ([]token, error) {
+	var out []token
+	for {
+		tok, fromFile, ok := s.next()
+		if !ok {
+			if len(s.files) == 0 {
+				return out, nil
+			}
+			f := s.files[len(s.files)-1]
+			if len(f.conds) > 0 {
+				return nil, fmt.Errorf("%s: unterminated conditional directive", f.conds[len(f.conds)-1].pos)
+			}
+			s.files = s.files[:len(s.files)-1]
+			continue
+		}
+		if fromFile && tok.bol && tok.is("#") {
+			if err := pp.directive(s, tok); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		expanded, err := pp.expand(s, tok)
+		if err != nil {
+			return nil, err
+		}
+		if !expanded {
+			out = append(out, tok)
+		}
+	}
+}
+
+// expandList expands the macros of the given tokens, without reading past them.
+func (pp *preprocessor) expandList(toks []token) ([]token, error) {
+	s := &stream{}
+	s.push(toks)
+	return pp.run(s)
+}
+
+// expand expands the given token if it names a macro, and pushes the expansion back to be rescanned.
+// It reports whether the token was expanded.
+func (pp *preprocessor) expand(s *stream, tok token) (bool, error) {
+	if tok.kind != tokIdent || tok.hide.contains(tok.text) {
+		return false, nil
+	}
+	m, ok := pp.macros[tok.text]
+	if !ok {
+		return false, nil
+	}
+	if pp.expansions++; pp.expansions > maxExpansions {
+		return false, fmt.Errorf("%s: too many macro expansions", tok.pos)
+	}
+	if m.builtin != nil {
+		s.push(m.builtin(tok))
+		return true, nil
+	}
+	if !m.funcLike {
+		toks, err := pp.substArgs(m, nil, tok, tok.hide.add(m.name))
+		if err != nil {
+			return false, err
+		}
+		s.push(toks)
+		return true, nil
+	}
+
+	// A function-like macro is only expanded when it is called.
+	next, fromFile, ok := s.peek()
+	if !ok || !next.is("(") || (fromFile && next.bol && next.is("#")) {
+		return false, nil
+	}
+	s.next()
+	args, rparen, err := pp.readArgs(s, m, tok)
+	if err != nil {
+		return false, err
+	}
+	hide := tok.hide.intersect(rparen.hide).add(m.name)
+	toks, err := pp.substArgs(m, args, tok, hide)
+	if err != nil {
+		return false, err
+	}
+	s.push(toks)
+	return true, nil
+}
+
+// readArgs reads the arguments of a call of the given macro, up to the closing parenthesis.
+// Directives in the arguments are processed, as GCC does.
+func (pp *preprocessor) readArgs(s *stream, m *macro, call token) ([][]token, token, error) {
+	var (
+		args  [][]token
+		arg   = []token{}
+		depth = 0
+	)
+	for {
+		tok, fromFile, ok := s.next()
+		if !ok {
+			return nil, token{}, fmt.Errorf("%s: unterminated call of macro %s", call.pos, m.name)
+		}
+		if fromFile && tok.bol && tok.is("#") {
+			if err := pp.directive(s, tok); err != nil {
+				return nil, token{}, err
+			}
+			continue
+		}
+		switch {
+		case tok.is("(") || tok.is("[") || tok.is("{"):
+			depth++
+		case (tok.is(")") || tok.is("]") || tok.is("}")) && depth > 0:
+			depth--
+		case tok.is(")"):
+			args = append(args, arg)
+			if len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0 {
+				args = nil
+			}
+			if m.variadic && len(args) == len(m.params)-1 {
+				// The variadic arguments can be left out altogether.
+				args = append(args, []token{})
+			}
+			if len(args) != len(m.params) {
+				return nil, token{}, fmt.Errorf("%s: macro %s takes %d arguments, got %d", call.pos, m.name, len(m.params), len(args))
+			}
+			return args, tok, nil
+		case tok.is(",") && depth == 0 && !(m.variadic && len(args) == len(m.params)-1):
+			args = append(args, arg)
+			arg = []token{}
+			continue
+		}
+		arg = append(arg, tok)
+	}
+}
+
+// substArgs returns the body of the given macro with its parameters replaced by the given arguments:
+// stringified after #, pasted around ##, and expanded otherwise.
+func (pp *preprocessor) substArgs(m *macro, args [][]token, at token, hide *hideset) ([]token, error) {
+	param := func(tok token) int {
+		if tok.kind != tokIdent {
+			return -1
+		}
+		for i, p := range m.params {
+			if p == tok.text {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// The body is split into items, the tokens they expand to are pasted together around ##.
+	var (
+		out []token
+		// lastLen is the number of tokens the previous item expanded to,
+		// pasting with an empty item leaves the other operand alone.
+		lastLen = 0
+		paste   = false
+	)
+	emit := func(toks []token) error {
+		switch {
+		case paste && lastLen > 0 && len(toks) > 0:
+			pasted, err := pasteTokens(out[len(out)-1], toks[0])
+			if err != nil {
+				return err
+			}
+			out = append(out[:len(out)-1], pasted)
+			out = append(out, toks[1:]...)
+			lastLen += len(toks) - 1
+		case paste:
+			out = append(out, toks...)
+			lastLen += len(toks)
+		default:
+			out = append(out, toks...)
+			lastLen = len(toks)
+		}
+		paste = false
+		return nil
+	}
+
+	body := m.body
+	for i := 0; i < len(body); i++ {
+		tok := body[i]
+		pastedAfter := i+1 < len(body) && body[i+1].is("##")
+		switch {
+		case tok.is("#") && m.funcLike && i+1 < len(body) && param(body[i+1]) >= 0:
+			if err := emit([]token{stringify(args[param(body[i+1])], at)}); err != nil {
+				return nil, err
+			}
+			i++
+		case tok.is("##") && i > 0 && i+1 < len(body):
+			paste = true
+		case tok.is(",") && pastedAfter && i+2 < len(body) && m.variadic && param(body[i+2]) == len(m.params)-1:
+			// GNU comma elision: , ## __VA_ARGS__ drops the comma when there are no variadic arguments.
+			va := args[len(args)-1]
+			if len(va) == 0 {
+				lastLen = 0
+			} else {
+				comma := tok
+				comma.pos = at.pos
+				if err := emit([]token{comma}); err != nil {
+					return nil, err
+				}
+				if err := emit(retarget(va, at, hide)); err != nil {
+					return nil, err
+				}
+			}
+			i += 2
+		case param(tok) >= 0:
+			arg := args[param(tok)]
+			if !paste && !pastedAfter {
+				var err error
+				if arg, err = pp.expandList(arg); err != nil {
+					return nil, err
+				}
+			}
+			if err := emit(retarget(arg, at, hide)); err != nil {
+				return nil, err
+			}
+		default:
+			if err := emit(retarget([]token{tok}, at, hide)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := range out {
+		out[i].bol = false
+	}
+	if len(out) > 0 {
+		out[0].space = at.space
+	}
+	return out, nil
+}
+
+// retarget returns copies of the given tokens as expanded at the given token, with the given macros hidden.
+func retarget(toks []token, at token, hide *hideset) []token {
+	out := make([]token, len(toks))
+	for i, tok := range toks {
+		tok.pos = at.pos
+		for h := hide; h != nil; h = h.next {
+			tok.hide = tok.hide.add(h.name)
+		}
+		out[i] = tok
+	}
+	return out
+}
+
+func stringify(toks []token, at token) token {
+	var b strings.Builder
+	for i, tok := range toks {
+		if i > 0 && tok.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok.text)
+	}
+	return token{kind: tokString, text: strconv.Quote(b.String()), pos: at.pos}
+}
+
+func pasteTokens(lhs, rhs token) (token, error) {
+	text := lhs.text + rhs.text
+	n, kind := scan(text)
+	if n != len(text) {
+		return token{}, fmt.Errorf("%s: pasting %s and %s does not give a valid token", lhs.pos, lhs.text, rhs.text)
+	}
+	lhs.kind, lhs.text = kind, text
+	return lhs, nil
+}
+
+// directive processes the directive that starts with the given # token.
+func (pp *preprocessor) directive(s *stream, hash token) error {
+	line := s.line()
+	if len(line) == 0 {
+		// The null directive.
+		return nil
+	}
+	f := s.files[len(s.files)-1]
+	name, args := line[0], line[1:]
+	switch name.text {
+	case "define":
+		return pp.define(args, hash)
+	case "undef":
+		if len(args) == 0 || args[0].kind != tokIdent {
+			return fmt.Errorf("%s: invalid #undef", hash.pos)
+		}
+		delete(pp.macros, args[0].text)
+	case "include", "include_next":
+		return pp.includeDirective(s, f, args, hash, name.text == "include_next")
+	case "if", "ifdef", "ifndef":
+		var (
+			ok  bool
+			err error
+		)
+		switch name.text {
+		case "if":
+			ok, err = pp.condition(args, hash)
+		case "ifdef":
+			ok, err = pp.defined(args, hash)
+		case "ifndef":
+			ok, err = pp.defined(args, hash)
+			ok = !ok
+		}
+		if err != nil {
+			return err
+		}
+		f.conds = append(f.conds, cond{pos: hash.pos, taken: ok})
+		if !ok {
+			return pp.skip(s, f)
+		}
+	case "elif", "elifdef", "elifndef", "else":
+		if len(f.conds) == 0 {
+			return fmt.Errorf("%s: #%s without #if", hash.pos, name.text)
+		}
+		c := &f.conds[len(f.conds)-1]
+		if c.sawElse {
+			return fmt.Errorf("%s: #%s after #else", hash.pos, name.text)
+		}
+		c.sawElse = name.text == "else"
+		// The branch that was included ends here, the remaining ones are skipped.
+		return pp.skip(s, f)
+	case "endif":
+		if len(f.conds) == 0 {
+			return fmt.Errorf("%s: #endif without #if", hash.pos)
+		}
+		f.conds = f.conds[:len(f.conds)-1]
+	case "error":
+		return fmt.Errorf("%s: #error%s", hash.pos, directiveText(args))
+	case "pragma":
+		switch {
+		case len(args) > 0 && args[0].is("once"):
+			pp.once[f.path] = true
+		case len(args) > 0 && args[0].is("pack"):
+			// The parser applies #pragma pack to the structs that follow it.
+			pack := token{kind: tokIdent, text: pragmaPack, pos: hash.pos}
+			s.push(append([]token{pack}, args[1:]...))
+		}
+	case "warning", "line", "ident", "sccs", "assert", "unassert":
+		// Nothing to lay out.
+	default:
+		if name.kind != tokNumber {
+			return fmt.Errorf("%s: invalid directive #%s", hash.pos, name.text)
+		}
+		// A line marker, e.g. # 1 "file.h".
+	}
+	return nil
+}
+
+func directiveText(toks []token) string {
+	var b strings.Builder
+	for _, tok := range toks {
+		b.WriteByte(' ')
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// skip skips the lines of the current conditional up to the next branch to include, or to its end.
+func (pp *preprocessor) skip(s *stream, f *file) error {
+	c := &f.conds[len(f.conds)-1]
+	depth := 0
+	for f.pos < len(f.toks) {
+		tok := f.toks[f.pos]
+		f.pos++
+		if !tok.bol || !tok.is("#") {
+			continue
+		}
+		line := s.line()
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0].text {
+		case "if", "ifdef", "ifndef":
+			depth++
+		case "endif":
+			if depth == 0 {
+				f.conds = f.conds[:len(f.conds)-1]
+				return nil
+			}
+			depth--
+		case "elif", "elifdef", "elifndef", "else":
+			if depth > 0 || c.taken {
+				continue
+			}
+			var (
+				ok  bool
+				err error
+			)
+			switch line[0].text {
+			case "elif":
+				ok, err = pp.condition(line[1:], tok)
+			case "elifdef":
+				ok, err = pp.defined(line[1:], tok)
+			case "elifndef":
+				ok, err = pp.defined(line[1:], tok)
+				ok = !ok
+			case "else":
+				ok = true
+				c.sawElse = true
+			}
+			if err != nil {
+				return err
+			}
+			if ok {
+				c.taken = true
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: unterminated conditional directive", c.pos)
+}
+
+func (pp *preprocessor) define(args []token, hash token) error {
+	if len(args) == 0 || args[0].kind != tokIdent {
+		return fmt.Errorf("%s: invalid #define", hash.pos)
+	}
+	m := &macro{name: args[0].text}
+	body := args[1:]
+	// A function-like macro has its parameters right after its name.
+	if len(body) > 0 && body[0].is("(") && !body[0].space {
+		m.funcLike = true
+		i := 1
+		for ; i < len(body) && !body[i].is(")"); i++ {
+			tok := body[i]
+			switch {
+			case tok.is(","):
+				continue
+			case tok.is("..."):
+				m.params = append(m.params, "__VA_ARGS__")
+				m.variadic = true
+			case tok.kind == tokIdent && i+1 < len(body) && body[i+1].is("..."):
+				m.params = append(m.params, tok.text)
+				m.variadic = true
+				i++
+			case tok.kind == tokIdent:
+				m.params = append(m.params, tok.text)
+			default:
+				return fmt.Errorf("%s: invalid parameter %s of macro %s", tok.pos, tok.text, m.name)
+			}
+		}
+		if i == len(body) {
+			return fmt.Errorf("%s: missing ) in the parameters of macro %s", hash.pos, m.name)
+		}
+		body = body[i+1:]
+	}
+	m.body = body
+	pp.macros[m.name] = m
+	return nil
+}
+
+func (pp *preprocessor) defined(args []token, hash token) (bool, error) {
+	if len(args) == 0 || args[0].kind != tokIdent {
+		return false, fmt.Errorf("%s: missing macro name", hash.pos)
+	}
+	return pp.isDefined(args[0].text), nil
+}
+
+// hasOperators are the operators of #if expressions that headers check the presence of with #ifdef.
+var hasOperators = map[string]bool{
+	"__has_include":       true,
+	"__has_include_next":  true,
+	"__has_attribute":     true,
+	"__has_c_attribute":   true,
+	"__has_cpp_attribute": true,
+	"__has_builtin":       true,
+	"__has_feature":       true,
+	"__has_extension":     true,
+	"__has_warning":       true,
+}
+
+func (pp *preprocessor) isDefined(name string) bool {
+	_, ok := pp.macros[name]
+	return ok || hasOperators[name]
+}
+
+// condition evaluates the expression of an #if or #elif directive.
+func (pp *preprocessor) condition(args []token, hash token) (bool, error) {
+	// defined is evaluated before the macros are expanded.
+	var toks []token
+	for i := 0; i < len(args); i++ {
+		if !args[i].is("defined") {
+			toks = append(toks, args[i])
+			continue
+		}
+		var name token
+		switch {
+		case i+3 < len(args) && args[i+1].is("(") && args[i+3].is(")"):
+			name = args[i+2]
+			i += 3
+		case i+1 < len(args):
+			name = args[i+1]
+			i++
+		default:
+			return false, fmt.Errorf("%s: missing macro name after defined", hash.pos)
+		}
+		v := "0"
+		if pp.isDefined(name.text) {
+			v = "1"
+		}
+		toks = append(toks, token{kind: tokNumber, text: v, pos: name.pos})
+	}
+	toks, err := pp.expandList(toks)
+	if err != nil {
+		return false, err
+	}
+	p := &parser{toks: toks, pp: pp}
+	v, err := p.constExpr()
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid #if expression: %w", hash.pos, err)
+	}
+	if !p.atEOF() {
+		return false, fmt.Errorf("%s: invalid #if expression: unexpected %s", hash.pos, p.peek().text)
+	}
+	return v != 0, nil
+}
+
+// includeDirective processes an #include or an #include_next directive.
+func (pp *preprocessor) includeDirective(s *stream, f *file, args []token, hash token, next bool) error {
+	if len(args) > 0 && args[0].kind != tokString && !args[0].is("<") {
+		var err error
+		if args, err = pp.expandList(args); err != nil {
+			return err
+		}
+	}
+	name, quoted, err := includeName(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", hash.pos, err)
+	}
+	start := 0
+	if next {
+		start = f.dir + 1
+	}
+	path, dir, ok := pp.lookup(name, quoted && !next, f.path, start)
+	if !ok {
+		if quoted {
+			return fmt.Errorf("%s: %s not found", hash.pos, name)
+		}
+		// The missing system headers are skipped, the types they declare are reported as unknown when they are used.
+		pp.skipped = append(pp.skipped, name)
+		return nil
+	}
+	if pp.once[path] {
+		return nil
+	}
+	return pp.open(s, path, dir)
+}
+
+// includeName returns the name of the header in the operand of an #include directive,
+// and whether it is quoted rather than bracketed.
+func includeName(args []token) (string, bool, error) {
+	if len(args) == 0 {
+		return "", false, errors.New("missing header name")
+	}
+	if args[0].kind == tokString {
+		name, err := strconv.Unquote(args[0].text)
+		if err != nil {
+			// Header names have no escape sequences, e.g. "dir\file.h".
+			name = strings.Trim(args[0].text, `"`)
+		}
+		return name, true, nil
+	}
+	if !args[0].is("<") {
+		return "", false, fmt.Errorf("invalid header name %s", args[0].text)
+	}
+	var b strings.Builder
+	for i, tok := range args[1:] {
+		if tok.is(">") {
+			return b.String(), false, nil
+		}
+		if i > 0 && tok.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok.text)
+	}
+	return "", false, errors.New("missing > in header name")
+}
+
+// lookup returns the path of the given header, and the index of the include directory it is found in.
+// Quoted headers are looked up in the directory of the file that includes them first,
+// then all of them in the include directories from the given index, then in the built-in headers.
+func (pp *preprocessor) lookup(name string, quoted bool, from string, start int) (string, int, bool) {
+	if filepath.IsAbs(name) {
+		return name, -1, fileExists(name)
+	}
+	if quoted && !strings.HasPrefix(from, builtinDir) {
+		if p := filepath.Join(filepath.Dir(from), name); fileExists(p) {
+			return p, -1, true
+		}
+	}
+	for i := start; i < len(pp.cfg.IncludeDirs); i++ {
+		if p := filepath.Join(pp.cfg.IncludeDirs[i], name); fileExists(p) {
+			return p, i, true
+		}
+	}
+	if _, err := fs.Stat(builtinHeaders, path.Join("include", name)); err == nil {
+		return builtinDir + "/" + name, len(pp.cfg.IncludeDirs), true
+	}
+	return "", 0, false
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,286 @@
+package cheader
+
+import (
+	"errors"
+	"fmt"
+)
+
+type kind int
+
+const (
+	kindVoid kind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindComplex
+	kindPointer
+	kindArray
+	kindFunc
+	kindStruct
+	kindUnion
+	kindEnum
+	kindTypedef
+	kindQual
+	// kindUnknown is a name used as a type that is not declared, e.g. in a header that was not found.
+	kindUnknown
+)
+
+// ctype is a C type, laid out for the ABI of the parser.
+type ctype struct {
+	kind kind
+	// name is the tag of a struct, a union or an enum, the name of a typedef or the name of a basic type,
+	// e.g. "long unsigned int" as GCC names it in DWARF.
+	name string
+	// size and align are those of basic types, structs, unions and enums,
+	// and of typedefs declared with an aligned attribute.
+	size     int64
+	align    int64
+	unsigned bool
+	char     bool
+	// base is the type pointed to, the type of the elements, the type a typedef names,
+	// the type that is qualified or the type a function returns.
+	base  *ctype
+	count int64 // the number of elements of an array, -1 if it is unknown.
+	qual  string
+	// members, enumerators and complete are set when a struct, a union or an enum is defined.
+	members     []*member
+	enumerators []enumerator
+	complete    bool
+	// err is set when the layout of a struct or a union cannot be computed, e.g. when it has a member of an unknown type.
+	err error
+}
+
+type member struct {
+	name string
+	typ  *ctype
+	// offset is the offset in bytes, bitOffset the offset in bits of a bitfield.
+	offset    int64
+	bitOffset int64
+	bitfield  bool
+	bitSize   int64
+	// align and packed are set by the attributes of the member.
+	align  int64
+	packed bool
+}
+
+type enumerator struct {
+	name  string
+	value int64
+}
+
+func pointerTo(t *ctype, abi *ABI) *ctype {
+	return &ctype{kind: kindPointer, base: t, size: abi.PointerSize, align: abi.PointerSize, unsigned: true}
+}
+
+func arrayOf(t *ctype, count int64) *ctype {
+	return &ctype{kind: kindArray, base: t, count: count}
+}
+
+func qualified(t *ctype, quals []string) *ctype {
+	for _, q := range quals {
+		t = &ctype{kind: kindQual, base: t, qual: q}
+	}
+	return t
+}
+
+func unknownType(name string) *ctype {
+	return &ctype{kind: kindUnknown, name: name, err: fmt.Errorf("unknown type %s", name)}
+}
+
+// resolved returns the type the given typedefs and qualifiers are for.
+func (t *ctype) resolved() *ctype {
+	for t.kind == kindTypedef || t.kind == kindQual {
+		t = t.base
+	}
+	return t
+}
+
+func (t *ctype) isRecord() bool {
+	return t.kind == kindStruct || t.kind == kindUnion
+}
+
+func (t *ctype) isInteger() bool {
+	switch t.resolved().kind {
+	case kindBool, kindInt, kindEnum:
+		return true
+	}
+	return false
+}
+
+// String describes the type in error messages.
+func (t *ctype) String() string {
+	switch t.kind {
+	case kindStruct, kindUnion, kindEnum:
+		kw := map[kind]string{kindStruct: "struct", kindUnion: "union", kindEnum: "enum"}[t.kind]
+		if t.name == "" {
+			return kw + " {...}"
+		}
+		return kw + " " + t.name
+	case kindPointer:
+		return t.base.String() + " *"
+	case kindArray:
+		return fmt.Sprintf("%s[%d]", t.base, t.count)
+	case kindFunc:
+		return "function"
+	case kindQual:
+		return t.qual + " " + t.base.String()
+	case kindVoid:
+		return "void"
+	}
+	return t.name
+}
+
+// sizeOf returns the size of the given type in bytes.
+func sizeOf(t *ctype) (int64, error) {
+	count := int64(1)
+	for {
+		switch t.kind {
+		case kindTypedef, kindQual:
+			t = t.base
+			continue
+		case kindArray:
+			if t.count < 0 {
+				return 0, nil
+			}
+			count *= t.count
+			t = t.base
+			continue
+		case kindUnknown:
+			return 0, t.err
+		case kindFunc:
+			return 0, errors.New("size of a function")
+		case kindVoid:
+			// GCC gives void the size of a byte.
+			return count, nil
+		case kindStruct, kindUnion, kindEnum:
+			if t.err != nil {
+				return 0, t.err
+			}
+			if !t.complete {
+				return 0, fmt.Errorf("incomplete type %s", t)
+			}
+		}
+		return count * t.size, nil
+	}
+}
+
+// alignOf returns the alignment of the given type in bytes.
+func alignOf(t *ctype) (int64, error) {
+	for {
+		switch t.kind {
+		case kindTypedef:
+			if t.align > 0 {
+				return t.align, nil
+			}
+			t = t.base
+			continue
+		case kindQual, kindArray:
+			t = t.base
+			continue
+		case kindUnknown:
+			return 0, t.err
+		case kindFunc, kindVoid:
+			return 1, nil
+		case kindStruct, kindUnion, kindEnum:
+			if t.err != nil {
+				return 0, t.err
+			}
+			if !t.complete {
+				return 0, fmt.Errorf("incomplete type %s", t)
+			}
+		}
+		return t.align, nil
+	}
+}
+
+// layout computes the offsets of the members of the given struct or union, and its size and alignment,
+// with the rules of GCC for the System V and AAPCS64 ABIs, which agree on them:
+// members are aligned to their alignment, unless the struct is packed or a #pragma pack limits it,
+// a bitfield starts at the next unit of its type when it would straddle one otherwise,
+// and an unnamed bitfield does not change the alignment of the struct.
+// The given alignment is the one set by the attributes of the struct, the given pack is the limit of
+// #pragma pack, 0 if there is none.
+func layout(st *ctype, packed bool, align, pack int64) error {
+	var (
+		bit      int64
+		size     int64
+		maxAlign int64 = 1
+	)
+	for _, m := range st.members {
+		msize, err := sizeOf(m.typ)
+		if err != nil {
+			return fmt.Errorf("member %s: %w", memberName(m), err)
+		}
+		if m.typ.resolved().kind == kindArray && m.typ.resolved().count < 0 && st.kind == kindStruct && m != st.members[len(st.members)-1] {
+			return fmt.Errorf("member %s: flexible array member is not the last member", memberName(m))
+		}
+		natural, err := alignOf(m.typ)
+		if err != nil {
+			return fmt.Errorf("member %s: %w", memberName(m), err)
+		}
+		a := natural
+		if packed || m.packed {
+			a = 1
+		}
+		if pack > 0 && a > pack {
+			a = pack
+		}
+		if m.align > a {
+			a = m.align
+		}
+		if st.kind == kindUnion {
+			bit = 0
+		}
+
+		if m.bitfield {
+			if !m.typ.isInteger() {
+				return fmt.Errorf("member %s: bitfield of type %s", memberName(m), m.typ)
+			}
+			if m.bitSize < 0 || m.bitSize > msize*8 {
+				return fmt.Errorf("member %s: invalid width %d", memberName(m), m.bitSize)
+			}
+			unit := natural
+			if pack > 0 && unit > pack {
+				unit = pack
+			}
+			switch {
+			case m.bitSize == 0:
+				// A zero-width bitfield moves the next one to the next unit of its type.
+				bit = alignUp(bit, unit*8)
+			case !(packed || m.packed) && bit%(unit*8)+m.bitSize > msize*8:
+				bit = alignUp(bit, unit*8)
+			}
+			m.bitOffset = bit
+			m.offset = bit / 8
+			bit += m.bitSize
+			if m.name != "" {
+				maxAlign = max(maxAlign, a)
+			}
+		} else {
+			bit = alignUp(bit, a*8)
+			m.offset = bit / 8
+			m.bitOffset = bit
+			bit += msize * 8
+			maxAlign = max(maxAlign, a)
+		}
+		size = max(size, alignUp(bit, 8)/8)
+	}
+	maxAlign = max(maxAlign, align)
+	st.size = alignUp(size, maxAlign)
+	st.align = maxAlign
+	return nil
+}
+
+func memberName(m *member) string {
+	if m.name == "" {
+		return "(anonymous)"
+	}
+	return m.name
+}
+
+func alignUp(n, align int64) int64 {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
@@ -0,0 +1,445 @@
+package datamap
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Accelerator tables are parsed by hand, since debug/dwarf does not expose them.
+
+// DWARF 5 name index attributes (DWARF 5 §6.1.1.4.7).
+const (
+	idxCompileUnit = 0x01
+	idxTypeUnit    = 0x02
+	idxDIEOffset   = 0x03
+)
+
+// Forms that can be used by the name index attributes.
+const (
+	formData2       = 0x05
+	formData4       = 0x06
+	formData8       = 0x07
+	formData1       = 0x0b
+	formFlag        = 0x0c
+	formSdata       = 0x0d
+	formUdata       = 0x0f
+	formRef1        = 0x11
+	formRef2        = 0x12
+	formRef4        = 0x13
+	formRef8        = 0x14
+	formRefUdata    = 0x15
+	formFlagPresent = 0x19
+	formRefSig8     = 0x20
+)
+
+// ErrMalformed is returned when the debug information of a file cannot be parsed,
+// e.g. truncated DWARF sections, a BTF section with an invalid header or an inconsistent accelerator table.
+var ErrMalformed = errors.New("malformed debug information")
+
+var errShortBuffer = fmt.Errorf("%w: unexpected end of section", ErrMalformed)
+
+// malformed marks the errors debug/dwarf and debug/elf return for the contents of a file with ErrMalformed,
+// and the ones of reading past the end of a section.
+func malformed(err error) error {
+	var (
+		decodeErr dwarf.DecodeError
+		formatErr *elf.FormatError
+	)
+	if errors.As(err, &decodeErr) || errors.As(err, &formatErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return err
+}
+
+// buf is a minimal cursor over the raw contents of a section.
+type buf struct {
+	data  []byte
+	off   int
+	order binary.ByteOrder
+	err   error
+}
+
+func (b *buf) bytes(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || b.off < 0 || b.off > len(b.data) || len(b.data)-b.off < n {
+		b.err = errShortBuffer
+		return nil
+	}
+	v := b.data[b.off : b.off+n]
+	b.off += n
+	return v
+}
+
+func (b *buf) uint8() uint8 {
+	v := b.bytes(1)
+	if v == nil {
+		return 0
+	}
+	return v[0]
+}
+
+func (b *buf) uint16() uint16 {
+	v := b.bytes(2)
+	if v == nil {
+		return 0
+	}
+	return b.order.Uint16(v)
+}
+
+func (b *buf) uint32() uint32 {
+	v := b.bytes(4)
+	if v == nil {
+		return 0
+	}
+	return b.order.Uint32(v)
+}
+
+func (b *buf) uint64() uint64 {
+	v := b.bytes(8)
+	if v == nil {
+		return 0
+	}
+	return b.order.Uint64(v)
+}
+
+func (b *buf) uleb() uint64 {
+	var (
+		v     uint64
+		shift uint
+	)
+	for {
+		c := b.uint8()
+		if b.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= uint64(c&0x7f) << shift
+		}
+		shift += 7
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (b *buf) sleb() int64 {
+	var (
+		v     int64
+		shift uint
+		c     uint8
+	)
+	for {
+		c = b.uint8()
+		if b.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= int64(c&0x7f) << shift
+		}
+		shift += 7
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	if shift < 64 && c&0x40 != 0 {
+		v |= -1 << shift
+	}
+	return v
+}
+
+// offset reads a section offset of the given DWARF format size.
+func (b *buf) offset(size int) uint64 {
+	if size == 8 {
+		return b.uint64()
+	}
+	return uint64(b.uint32())
+}
+
+// cstring reads a null-terminated string at the given position of data.
+func cstring(data []byte, off uint64) (string, error) {
+	if off >= uint64(len(data)) {
+		return "", fmt.Errorf("%w: string offset %#x out of bounds", ErrMalformed, off)
+	}
+	end := bytes.IndexByte(data[off:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("%w: string at %#x is not terminated", ErrMalformed, off)
+	}
+	return string(data[off : off+uint64(end)]), nil
+}
+
+type namedEntry struct {
+	name   string
+	tag    dwarf.Tag
+	offset dwarf.Offset
+}
+
+type nameAbbrev struct {
+	tag   dwarf.Tag
+	attrs [][2]uint64 // pairs of index attribute and form.
+}
+
+// parseDebugNames parses all the name indexes in the given .debug_names section
+// and returns the entries that refer to compilation units, and the offsets of the compilation units they cover.
+func parseDebugNames(data, str []byte, order binary.ByteOrder) ([]namedEntry, []dwarf.Offset, error) {
+	var (
+		entries = []namedEntry{}
+		units   = []dwarf.Offset{}
+		b       = &buf{data: data, order: order}
+	)
+	for b.off < len(data) {
+		offSize := 4
+		unitLength := uint64(b.uint32())
+		if unitLength == 0xffffffff {
+			offSize = 8
+			unitLength = b.uint64()
+		}
+		if b.err != nil || unitLength > uint64(len(data)-b.off) {
+			return nil, nil, fmt.Errorf("%w: invalid name index length at %#x", ErrMalformed, b.off)
+		}
+		unitEnd := b.off + int(unitLength)
+
+		unitEntries, cus, err := parseNameIndex(&buf{data: data[:unitEnd], off: b.off, order: order}, str, offSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, unitEntries...)
+		for _, cu := range cus {
+			units = append(units, dwarf.Offset(cu))
+		}
+		b.off = unitEnd
+	}
+	return entries, units, nil
+}
+
+// parseNameIndex parses a single name index and returns its entries that refer to compilation units,
+// and its list of compilation units.
+func parseNameIndex(b *buf, str []byte, offSize int) ([]namedEntry, []uint64, error) {
+	if version := b.uint16(); version != 5 {
+		return nil, nil, fmt.Errorf("%w: name index version %d", errors.ErrUnsupported, version)
+	}
+	b.uint16() // padding.
+	var (
+		cuCount         = int(b.uint32())
+		localTUCount    = int(b.uint32())
+		foreignTUCount  = int(b.uint32())
+		bucketCount     = int(b.uint32())
+		nameCount       = int(b.uint32())
+		abbrevTableSize = int(b.uint32())
+		augmentation    = int(b.uint32())
+	)
+	b.bytes(augmentation)
+	if b.err != nil || cuCount < 0 || cuCount > (len(b.data)-b.off)/offSize {
+		return nil, nil, fmt.Errorf("%w: invalid name index header", ErrMalformed)
+	}
+
+	cus := make([]uint64, cuCount)
+	for i := range cus {
+		cus[i] = b.offset(offSize)
+	}
+	b.bytes(localTUCount * offSize)
+	b.bytes(foreignTUCount * 8)
+	b.bytes(bucketCount * 4)
+	if bucketCount > 0 {
+		b.bytes(nameCount * 4) // hashes.
+	}
+	strOffsets := b.bytes(nameCount * offSize)
+	entryOffsets := b.bytes(nameCount * offSize)
+	abbrevTable := b.bytes(abbrevTableSize)
+	if b.err != nil {
+		return nil, nil, fmt.Errorf("failed to read name index header: %w", b.err)
+	}
+	pool := b.data[b.off:]
+
+	abbrevs := map[uint64]nameAbbrev{}
+	ab := &buf{data: abbrevTable, order: b.order}
+	for {
+		code := ab.uleb()
+		if ab.err != nil {
+			return nil, nil, fmt.Errorf("failed to read name index abbreviations: %w", ab.err)
+		}
+		if code == 0 {
+			break
+		}
+		abbrev := nameAbbrev{tag: dwarf.Tag(ab.uleb())}
+		for {
+			attr, form := ab.uleb(), ab.uleb()
+			if ab.err != nil {
+				return nil, nil, fmt.Errorf("failed to read name index abbreviations: %w", ab.err)
+			}
+			if attr == 0 && form == 0 {
+				break
+			}
+			abbrev.attrs = append(abbrev.attrs, [2]uint64{attr, form})
+		}
+		abbrevs[code] = abbrev
+	}
+
+	var (
+		entries = []namedEntry{}
+		so      = &buf{data: strOffsets, order: b.order}
+		eo      = &buf{data: entryOffsets, order: b.order}
+	)
+	for i := 0; i < nameCount; i++ {
+		name, err := cstring(str, so.offset(offSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read name: %w", err)
+		}
+
+		eb := &buf{data: pool, off: int(eo.offset(offSize)), order: b.order}
+		for {
+			code := eb.uleb()
+			if eb.err != nil {
+				return nil, nil, fmt.Errorf("failed to read entries of %s: %w", name, eb.err)
+			}
+			if code == 0 {
+				break
+			}
+			abbrev, ok := abbrevs[code]
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: unknown name index abbreviation: %d", ErrMalformed, code)
+			}
+
+			var (
+				cu        uint64
+				dieOffset uint64
+				typeUnit  bool
+			)
+			for _, a := range abbrev.attrs {
+				v, err := readNameIndexForm(eb, a[1], offSize)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to read entries of %s: %w", name, err)
+				}
+				switch a[0] {
+				case idxCompileUnit:
+					cu = v
+				case idxTypeUnit:
+					typeUnit = true
+				case idxDIEOffset:
+					dieOffset = v
+				}
+			}
+			// The entries of the type units are skipped, the type units are read whole instead:
+			// the ones in .debug_info, listed by the local type unit list, are not in the compilation unit list,
+			// and the ones in split units, listed by the foreign type unit list, are indexed with their split units.
+			if typeUnit || cu >= uint64(len(cus)) {
+				continue
+			}
+			entries = append(entries, namedEntry{
+				name:   name,
+				tag:    abbrev.tag,
+				offset: dwarf.Offset(cus[cu] + dieOffset),
+			})
+		}
+	}
+	return entries, cus, nil
+}
+
+func readNameIndexForm(b *buf, form uint64, offSize int) (uint64, error) {
+	var v uint64
+	switch form {
+	case formData1, formRef1, formFlag:
+		v = uint64(b.uint8())
+	case formData2, formRef2:
+		v = uint64(b.uint16())
+	case formData4, formRef4:
+		v = uint64(b.uint32())
+	case formData8, formRef8, formRefSig8:
+		v = b.uint64()
+	case formUdata, formRefUdata:
+		v = b.uleb()
+	case formSdata:
+		v = uint64(b.sleb())
+	case formFlagPresent:
+		v = 1
+	default:
+		return 0, fmt.Errorf("%w: name index form %#x", errors.ErrUnsupported, form)
+	}
+	return v, b.err
+}
+
+type indexedSymbol struct {
+	name  string
+	units []dwarf.Offset
+}
+
+// parseGDBIndex parses the symbol table of a .gdb_index section (versions 7 and 8).
+// Unlike .debug_names, it only points at compilation units, not at the entries themselves.
+func parseGDBIndex(data []byte) ([]indexedSymbol, error) {
+	// The index is always little-endian.
+	b := &buf{data: data, order: binary.LittleEndian}
+	version := b.uint32()
+	if version != 7 && version != 8 {
+		return nil, fmt.Errorf("%w: .gdb_index version %d", errors.ErrUnsupported, version)
+	}
+	var (
+		cuListOffset      = b.uint32()
+		typesCUListOffset = b.uint32()
+		_                 = b.uint32() // address area offset.
+		symbolTableOffset = b.uint32()
+		constantPool      = b.uint32()
+	)
+	if b.err != nil {
+		return nil, fmt.Errorf("failed to read .gdb_index header: %w", b.err)
+	}
+	if cuListOffset > typesCUListOffset || uint64(typesCUListOffset) > uint64(len(data)) ||
+		symbolTableOffset > constantPool || uint64(constantPool) > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: invalid .gdb_index header", ErrMalformed)
+	}
+
+	// Each compilation unit is described by its offset and length.
+	cuList := &buf{data: data[cuListOffset:typesCUListOffset], order: b.order}
+	cus := make([]dwarf.Offset, 0, len(cuList.data)/16)
+	for cuList.off < len(cuList.data) && cuList.err == nil {
+		off := cuList.uint64()
+		cuList.uint64()
+		cus = append(cus, dwarf.Offset(off))
+	}
+	if cuList.err != nil {
+		return nil, fmt.Errorf("failed to read .gdb_index CU list: %w", cuList.err)
+	}
+
+	var (
+		symbols = []indexedSymbol{}
+		pool    = data[constantPool:]
+		table   = &buf{data: data[symbolTableOffset:constantPool], order: b.order}
+	)
+	for table.off < len(table.data) {
+		nameOffset, vectorOffset := table.uint32(), table.uint32()
+		if table.err != nil {
+			return nil, fmt.Errorf("failed to read .gdb_index symbol table: %w", table.err)
+		}
+		if nameOffset == 0 && vectorOffset == 0 {
+			// Empty slot.
+			continue
+		}
+		name, err := cstring(pool, uint64(nameOffset))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .gdb_index symbol name: %w", err)
+		}
+
+		vector := &buf{data: pool, off: int(vectorOffset), order: b.order}
+		n := vector.uint32()
+		sym := indexedSymbol{name: name}
+		for i := uint32(0); i < n && vector.err == nil; i++ {
+			// The lower 24 bits are the CU index, the rest describe the symbol kind.
+			cu := int(vector.uint32() & 0x00ffffff)
+			if cu >= len(cus) {
+				// Type units are not indexed.
+				continue
+			}
+			sym.units = append(sym.units, cus[cu])
+		}
+		if vector.err != nil {
+			return nil, fmt.Errorf("failed to read .gdb_index CU vector of %s: %w", name, vector.err)
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, nil
+}
@@ -0,0 +1,389 @@
+package datamap
+
+import (
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// BTF is parsed by hand, the types are converted to their debug/dwarf counterparts,
+// so routes are resolved with the same rules as for DWARF.
+
+const btfMagic = 0xeb9f
+
+// BTF kinds (include/uapi/linux/btf.h).
+const (
+	btfKindInt       = 1
+	btfKindPtr       = 2
+	btfKindArray     = 3
+	btfKindStruct    = 4
+	btfKindUnion     = 5
+	btfKindEnum      = 6
+	btfKindFwd       = 7
+	btfKindTypedef   = 8
+	btfKindVolatile  = 9
+	btfKindConst     = 10
+	btfKindRestrict  = 11
+	btfKindFunc      = 12
+	btfKindFuncProto = 13
+	btfKindVar       = 14
+	btfKindDatasec   = 15
+	btfKindFloat     = 16
+	btfKindDeclTag   = 17
+	btfKindTypeTag   = 18
+	btfKindEnum64    = 19
+)
+
+// btfIndexedKinds are the kinds that can be the root of a route.
+var btfIndexedKinds = map[uint8]bool{
+	btfKindStruct:  true,
+	btfKindUnion:   true,
+	btfKindTypedef: true,
+	btfKindEnum:    true,
+	btfKindEnum64:  true,
+}
+
+// BTFIndex maps names to the types described by the .BTF section of an ELF file.
+// It is the BTF counterpart of TypeIndex.
+type BTFIndex struct {
+	ef *elf.File
+	typeSet
+	// budget bounds the reads of the symbol tables, for the routes of variables.
+	budget *budget
+}
+
+// NewBTFIndex builds a BTFIndex from the .BTF section of the given ELF file.
+// The size of the section is limited by WithMaxBytes.
+func NewBTFIndex(ef *elf.File, opts ...Option) (*BTFIndex, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	sec := ef.Section(".BTF")
+	if sec == nil {
+		return nil, errors.New("no .BTF section")
+	}
+	b := newBudget(context.Background(), o)
+	data, err := b.data(sec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .BTF: %w", err)
+	}
+
+	// BTF does not record the size of pointers.
+	ptrSize := int64(8)
+	if ef.Class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+
+	idx := &BTFIndex{ef: ef, typeSet: newTypeSet("BTF"), budget: b}
+	// The linker concatenates the .BTF sections of the objects,
+	// every blob has its own header and type IDs.
+	for off := 0; off < len(data); {
+		n, err := idx.read(data[off:], ptrSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read BTF at %#x: %w", off, err)
+		}
+		off += n
+	}
+	return idx, nil
+}
+
+type btfMember struct {
+	name   string
+	typ    uint32
+	offset uint32
+	value  int64
+}
+
+type btfRawType struct {
+	name     string
+	kind     uint8
+	kindFlag bool
+	size     uint32    // size or type, depending on the kind.
+	bits     uint32    // size of integers in bits.
+	array    [3]uint32 // element type, index type and number of elements.
+	members  []btfMember
+}
+
+// read parses a single BTF blob and returns its length.
+func (idx *BTFIndex) read(data []byte, ptrSize int64) (int, error) {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if len(data) < 4 {
+		return 0, errShortBuffer
+	}
+	if order.Uint16(data) != btfMagic {
+		order = binary.BigEndian
+		if order.Uint16(data) != btfMagic {
+			return 0, fmt.Errorf("%w: invalid BTF magic", ErrMalformed)
+		}
+	}
+
+	b := &buf{data: data, order: order}
+	b.uint16() // magic.
+	b.uint8()  // version.
+	b.uint8()  // flags.
+	var (
+		hdrLen  = b.uint32()
+		typeOff = b.uint32()
+		typeLen = b.uint32()
+		strOff  = b.uint32()
+		strLen  = b.uint32()
+	)
+	if b.err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", b.err)
+	}
+	if hdrLen < uint32(b.off) {
+		return 0, fmt.Errorf("%w: invalid BTF header length: %d", ErrMalformed, hdrLen)
+	}
+	end := uint64(hdrLen) + uint64(strOff) + uint64(strLen)
+	if typeEnd := uint64(hdrLen) + uint64(typeOff) + uint64(typeLen); typeEnd > end {
+		end = typeEnd
+	}
+	if end > uint64(len(data)) {
+		return 0, errShortBuffer
+	}
+	var (
+		types = data[uint64(hdrLen)+uint64(typeOff) : uint64(hdrLen)+uint64(typeOff)+uint64(typeLen)]
+		str   = data[uint64(hdrLen)+uint64(strOff) : uint64(hdrLen)+uint64(strOff)+uint64(strLen)]
+	)
+
+	raw, err := parseBTFTypes(types, str, order)
+	if err != nil {
+		return 0, err
+	}
+	converted := convertBTFTypes(raw, ptrSize)
+	for i, t := range raw {
+		if t.name == "" || !btfIndexedKinds[t.kind] {
+			continue
+		}
+		// Type IDs start at 1, 0 is void.
+		idx.names[t.name] = append(idx.names[t.name], typeEntry{
+			id:  dwarf.Offset(i + 1),
+			typ: converted[i+1],
+		})
+	}
+	return int(end), nil
+}
+
+func parseBTFTypes(data, str []byte, order binary.ByteOrder) ([]*btfRawType, error) {
+	var (
+		types = []*btfRawType{}
+		b     = &buf{data: data, order: order}
+	)
+	name := func(off uint32) (string, error) {
+		if off == 0 {
+			return "", nil
+		}
+		return cstring(str, uint64(off))
+	}
+	for b.off < len(data) {
+		var (
+			nameOff = b.uint32()
+			info    = b.uint32()
+			size    = b.uint32()
+			err     error
+		)
+		t := &btfRawType{
+			kind:     uint8((info >> 24) & 0x1f),
+			kindFlag: info>>31 == 1,
+			size:     size,
+		}
+		if t.name, err = name(nameOff); err != nil {
+			return nil, fmt.Errorf("failed to read type name: %w", err)
+		}
+		vlen := int(info & 0xffff)
+
+		switch t.kind {
+		case btfKindInt:
+			t.bits = b.uint32() & 0xff
+		case btfKindArray:
+			t.array = [3]uint32{b.uint32(), b.uint32(), b.uint32()}
+		case btfKindStruct, btfKindUnion, btfKindFuncProto, btfKindEnum, btfKindEnum64:
+			for i := 0; i < vlen && b.err == nil; i++ {
+				m := btfMember{}
+				if m.name, err = name(b.uint32()); err != nil {
+					return nil, fmt.Errorf("failed to read member name: %w", err)
+				}
+				switch t.kind {
+				case btfKindStruct, btfKindUnion:
+					m.typ, m.offset = b.uint32(), b.uint32()
+				case btfKindFuncProto:
+					m.typ = b.uint32()
+				case btfKindEnum:
+					// The kind flag is set on the enums whose values are signed.
+					v := b.uint32()
+					if t.kindFlag {
+						m.value = int64(int32(v))
+					} else {
+						m.value = int64(v)
+					}
+				case btfKindEnum64:
+					// 64-bit values need no sign extension, whatever the kind flag says.
+					// The enumerators hold an int64: like debug/dwarf does for DWARF,
+					// the unsigned values above math.MaxInt64 keep their bits.
+					lo, hi := b.uint32(), b.uint32()
+					m.value = int64(uint64(hi)<<32 | uint64(lo))
+				}
+				t.members = append(t.members, m)
+			}
+		case btfKindVar, btfKindDeclTag:
+			b.uint32()
+		case btfKindDatasec:
+			b.bytes(vlen * 12)
+		case btfKindPtr, btfKindFwd, btfKindTypedef, btfKindVolatile, btfKindConst,
+			btfKindRestrict, btfKindFunc, btfKindFloat, btfKindTypeTag:
+			// No extra data.
+		default:
+			return nil, fmt.Errorf("%w: unknown BTF kind: %d", ErrMalformed, t.kind)
+		}
+		if b.err != nil {
+			return nil, fmt.Errorf("failed to read types: %w", b.err)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// convertBTFTypes converts the raw types to debug/dwarf types, indexed by their type ID.
+// The types are allocated first and linked afterwards, since they can refer to each other.
+func convertBTFTypes(raw []*btfRawType, ptrSize int64) []dwarf.Type {
+	types := make([]dwarf.Type, len(raw)+1)
+	types[0] = &dwarf.VoidType{}
+	for i, t := range raw {
+		common := dwarf.CommonType{Name: t.name}
+		switch t.kind {
+		case btfKindInt:
+			common.ByteSize = int64(t.size)
+			types[i+1] = &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: common, BitSize: int64(t.bits)}}
+		case btfKindFloat:
+			common.ByteSize = int64(t.size)
+			types[i+1] = &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: common}}
+		case btfKindPtr:
+			common.ByteSize = ptrSize
+			types[i+1] = &dwarf.PtrType{CommonType: common}
+		case btfKindArray:
+			types[i+1] = &dwarf.ArrayType{CommonType: common, Count: int64(t.array[2])}
+		case btfKindStruct, btfKindUnion:
+			common.ByteSize = int64(t.size)
+			kind := "struct"
+			if t.kind == btfKindUnion {
+				kind = "union"
+			}
+			types[i+1] = &dwarf.StructType{CommonType: common, StructName: t.name, Kind: kind}
+		case btfKindFwd:
+			kind := "struct"
+			if t.kindFlag {
+				kind = "union"
+			}
+			types[i+1] = &dwarf.StructType{CommonType: common, StructName: t.name, Kind: kind, Incomplete: true}
+		case btfKindEnum, btfKindEnum64:
+			common.ByteSize = int64(t.size)
+			enum := &dwarf.EnumType{CommonType: common, EnumName: t.name}
+			for _, m := range t.members {
+				enum.Val = append(enum.Val, &dwarf.EnumValue{Name: m.name, Val: m.value})
+			}
+			types[i+1] = enum
+		case btfKindTypedef:
+			types[i+1] = &dwarf.TypedefType{CommonType: common}
+		case btfKindVolatile, btfKindConst, btfKindRestrict, btfKindTypeTag:
+			types[i+1] = &dwarf.QualType{CommonType: common, Qual: btfQualifier(t.kind)}
+		case btfKindFuncProto:
+			types[i+1] = &dwarf.FuncType{CommonType: common}
+		default:
+			// Functions, variables and sections are not types.
+			types[i+1] = &dwarf.UnspecifiedType{BasicType: dwarf.BasicType{CommonType: common}}
+		}
+	}
+
+	typeOf := func(id uint32) dwarf.Type {
+		if int(id) >= len(types) {
+			return &dwarf.VoidType{}
+		}
+		return types[id]
+	}
+	for i, t := range raw {
+		switch typ := types[i+1].(type) {
+		case *dwarf.PtrType:
+			typ.Type = typeOf(t.size)
+		case *dwarf.ArrayType:
+			typ.Type = typeOf(t.array[0])
+		case *dwarf.TypedefType:
+			typ.Type = typeOf(t.size)
+		case *dwarf.QualType:
+			typ.Type = typeOf(t.size)
+		case *dwarf.FuncType:
+			typ.ReturnType = typeOf(t.size)
+			for _, m := range t.members {
+				typ.ParamType = append(typ.ParamType, typeOf(m.typ))
+			}
+		}
+	}
+	// The members are added last, the size of bitfields depends on the linked types.
+	for i, t := range raw {
+		if typ, ok := types[i+1].(*dwarf.StructType); ok {
+			for _, m := range t.members {
+				// The offsets are in bits, bitfields have their size in the upper 8 bits
+				// when the kind flag is set.
+				bitOffset, bitSize := int64(m.offset), int64(0)
+				if t.kindFlag {
+					bitOffset, bitSize = int64(m.offset&0xffffff), int64(m.offset>>24)
+				}
+				field := &dwarf.StructField{
+					Name:          m.name,
+					Type:          typeOf(m.typ),
+					ByteOffset:    bitOffset / 8,
+					BitSize:       bitSize,
+					DataBitOffset: bitOffset,
+				}
+				if size := sizeOf(field.Type); bitSize > 0 && size > 0 {
+					// The storage unit of the bitfield.
+					field.ByteSize = size
+					field.ByteOffset = bitOffset / 8 / size * size
+				}
+				typ.Field = append(typ.Field, field)
+			}
+		}
+	}
+	return types
+}
+
+func btfQualifier(kind uint8) string {
+	switch kind {
+	case btfKindVolatile:
+		return "volatile"
+	case btfKindConst:
+		return "const"
+	case btfKindRestrict:
+		return "restrict"
+	default:
+		return ""
+	}
+}
+
+// ReadFromBTF reads the BTF data of the given ELF file and sets the values of the map struct.
+func (dataMap *DataMap) ReadFromBTF(ef *elf.File, opts ...Option) error {
+	idx, err := NewBTFIndex(ef, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = dataMap.Extract(idx, opts...)
+	return err
+}
+
+// BTF has no compilation units.
+func (idx *BTFIndex) unitOf(dwarf.Offset) dwarf.Offset {
+	return 0
+}
+
+// route resolves the given route and sets the values of its extractors.
+// The entries of the report are the BTF type IDs.
+func (idx *BTFIndex) route(rn *RouteNode) error {
+	if isSymbolRoute(rn) {
+		// BTF only records the offsets of the variables in their sections.
+		return symbolResolver{budget: idx.budget, ef: idx.ef}.extract(rn)
+	}
+	return idx.typeSet.route(rn)
+}
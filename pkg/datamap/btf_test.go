@@ -0,0 +1,208 @@
+package datamap
+
+import (
+	"debug/elf"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// GCC 12 emits the dimensions of multi-dimensional arrays in reverse order,
+// so they are only covered by the DWARF tests.
+type btfArrayMap struct {
+	SpecificData   int64   `offsetof:"runtime.specific_1stblock[2].data"`
+	SpecificLength int64   `lengthof:"runtime.specific_1stblock"`
+	SpecificStride int64   `strideof:"runtime.specific_1stblock"`
+	FramePrev      []int64 `offsetof:"runtime.frames[1]*.prev"`
+	ContextCFP     int64   `offsetof:"runtime.contexts[1].cfp"`
+	NameLength     int64   `lengthof:"runtime.name"`
+}
+
+func TestDataMap_ReadFromBTF(t *testing.T) {
+	tests := []struct {
+		name    string
+		lm      any
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "pointer dereference",
+			lm:   &chainMap{},
+			want: &chainMap{
+				MainThreadCFP: []int64{8, 16, 16},
+				ThreadState:   [2]int{24, 8},
+				ThreadEC:      16,
+				ECSize:        8,
+			},
+		},
+		{
+			name: "bitfields",
+			lm:   &bitfieldMap{},
+			want: wantBitfieldMap,
+		},
+		{
+			name: "enumerators",
+			lm:   &enumMap{},
+			want: &enumMap{
+				OwnedByThread: 0,
+				OwnedByCStack: 3,
+				MagicBlock:    0x22220001,
+			},
+		},
+		{
+			name: "signed and unsigned enumerators",
+			lm:   &signedEnumMap{},
+			want: wantSignedEnumMap,
+		},
+		{
+			name: "thread-local variables",
+			lm:   &tlsMap{},
+			// Read from the symbol table.
+			want: &tlsMap{
+				CounterOffset: 0,
+				ECOffset:      8,
+				ECAlign:       8,
+				ECSize:        16,
+			},
+		},
+		{
+			name: "arrays",
+			lm:   &btfArrayMap{},
+			want: &btfArrayMap{
+				SpecificData:   48,
+				SpecificLength: 32,
+				SpecificStride: 16,
+				FramePrev:      []int64{656, 8},
+				ContextCFP:     712,
+				NameLength:     0,
+			},
+		},
+		{
+			name: "nested structs and arrays of structs",
+			lm:   &nestedMap{},
+			want: wantNestedMap,
+		},
+		{
+			name: "anonymous members",
+			lm:   &anonymousMap{},
+			want: wantAnonymousMap,
+		},
+		{
+			name: "alternatives",
+			lm:   &alternativeMap{},
+			want: &alternativeMap{
+				Count:       16,
+				ID:          0,
+				MainEC:      []int64{8, 16},
+				ThreadsHead: 24,
+			},
+		},
+		{
+			name: "missing type",
+			lm: &struct {
+				A int64 `offsetof:"pthread.specific"`
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := New(tt.lm)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+
+			ef, err := elf.Open("testdata/x86_64/routes-btf")
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+
+			err = dm.ReadFromBTF(ef)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFromBTF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, tt.lm); diff != "" {
+				t.Errorf("ReadFromBTF() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewBTFIndex(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	if _, err := NewBTFIndex(ef); err == nil {
+		t.Error("NewBTFIndex() of a file without .BTF, want error")
+	}
+
+	btf, err := elf.Open("testdata/x86_64/routes-btf")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer btf.Close()
+	dm, err := New(&enumMap{})
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromBTF(btf, WithMaxBytes(16)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ReadFromBTF() with a .BTF section over the limit error = %v, want %v", err, ErrLimitExceeded)
+	}
+	// The symbol tables searched for the addresses of the variables are accounted for as well.
+	dm, err = New(&struct {
+		VM int64 `addressof:"the_vm"`
+	}{})
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromBTF(btf, WithMaxBytes(int64(btf.Section(".BTF").Size))); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ReadFromBTF() with a symbol table over the limit error = %v, want %v", err, ErrLimitExceeded)
+	}
+	if err := dm.ReadFromBTF(btf, WithMaxEntries(4)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ReadFromBTF() with more symbols than the limit error = %v, want %v", err, ErrLimitExceeded)
+	}
+
+	idx := &BTFIndex{typeSet: newTypeSet("BTF")}
+	if _, err := idx.read([]byte{0x9f, 0xeb, 1, 0, 24, 0, 0, 0}, 8); !errors.Is(err, ErrMalformed) {
+		t.Errorf("read() of a truncated header error = %v, want %v", err, ErrMalformed)
+	}
+}
+
+func TestFieldAtBTF(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes-btf")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+	idx, err := NewBTFIndex(ef)
+	if err != nil {
+		t.Fatalf("NewBTFIndex() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		route  string
+		offset int64
+		want   string
+	}{
+		{route: "interpreter", offset: 12, want: "interpreter.finalizing"},
+		{route: "runtime", offset: 700, want: "runtime.contexts[1].stack+4"},
+		{route: "vm.threads*.ec*", offset: 16, want: "vm.threads*.ec*.cfp"},
+	} {
+		loc, err := FieldAt(idx, tt.route, tt.offset)
+		if err != nil {
+			t.Fatalf("FieldAt(%s, %d) error = %v", tt.route, tt.offset, err)
+		}
+		if got := loc.String(); got != tt.want {
+			t.Errorf("FieldAt(%s, %d) = %s, want %s", tt.route, tt.offset, got, tt.want)
+		}
+	}
+}
@@ -1,20 +1,56 @@
 package datamap
 
 import (
+	"debug/dwarf"
 	"errors"
 	"fmt"
+	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"golang.org/x/exp/maps"
 )
 
 const (
-	tagOffsetOf = "offsetof"
-	tagSizeOf   = "sizeof"
-	tagStatic   = "static"
+	tagOffsetOf    = "offsetof"
+	tagSizeOf      = "sizeof"
+	tagBitOffsetOf = "bitoffsetof"
+	tagBitSizeOf   = "bitsizeof"
+	tagEnumVal     = "enumval"
+	tagLengthOf    = "lengthof"
+	tagStrideOf    = "strideof"
+	tagAddressOf   = "addressof"
+	tagTLSOffsetOf = "tlsoffsetof"
+	tagTLSAlignOf  = "tlsalignof"
+	tagTLSSizeOf   = "tlssizeof"
+	tagLocationOf  = "locationof"
+	tagStatic      = "static"
+	tagUnit        = "cu"
+	tagExpr        = "expr"
 )
 
+// opTags maps the struct tags to their operations, in the order they are looked up.
+var opTags = []struct {
+	tag string
+	op  Operation
+}{
+	{tagOffsetOf, OpOffsetOf},
+	{tagSizeOf, OpSizeOf},
+	{tagBitOffsetOf, OpBitOffsetOf},
+	{tagBitSizeOf, OpBitSizeOf},
+	{tagEnumVal, OpEnumValue},
+	{tagLengthOf, OpLengthOf},
+	{tagStrideOf, OpStrideOf},
+	{tagAddressOf, OpAddressOf},
+	{tagTLSOffsetOf, OpTLSOffsetOf},
+	{tagTLSAlignOf, OpTLSAlignOf},
+	{tagTLSSizeOf, OpTLSSizeOf},
+	{tagLocationOf, OpLocationOf},
+}
+
 type Operation int
 
 func (o Operation) String() string {
@@ -23,6 +59,28 @@ func (o Operation) String() string {
 		return "OffsetOf"
 	case OpSizeOf:
 		return "SizeOf"
+	case OpBitOffsetOf:
+		return "BitOffsetOf"
+	case OpBitSizeOf:
+		return "BitSizeOf"
+	case OpEnumValue:
+		return "EnumValue"
+	case OpLengthOf:
+		return "LengthOf"
+	case OpStrideOf:
+		return "StrideOf"
+	case OpAddressOf:
+		return "AddressOf"
+	case OpTLSOffsetOf:
+		return "TLSOffsetOf"
+	case OpTLSAlignOf:
+		return "TLSAlignOf"
+	case OpTLSSizeOf:
+		return "TLSSizeOf"
+	case OpLocationOf:
+		return "LocationOf"
+	case OpExpr:
+		return "Expr"
 	default:
 		return "Unknown"
 	}
@@ -30,33 +88,237 @@ func (o Operation) String() string {
 
 func (o Operation) minimumRequiredRouteLength() int {
 	switch o {
-	case OpOffsetOf:
+	case OpOffsetOf, OpBitOffsetOf, OpBitSizeOf, OpEnumValue, OpLengthOf, OpStrideOf, OpLocationOf:
 		return 2
-	case OpSizeOf:
+	case OpSizeOf, OpAddressOf, OpTLSOffsetOf, OpTLSAlignOf, OpTLSSizeOf:
 		return 1
 	default:
 		return -1
 	}
 }
 
+func (o Operation) isOffset() bool {
+	return o == OpOffsetOf || o == OpBitOffsetOf
+}
+
+// isSymbol reports whether the operation reads a symbol rather than a route.
+func (o Operation) isSymbol() bool {
+	switch o {
+	case OpAddressOf, OpTLSOffsetOf, OpTLSAlignOf, OpTLSSizeOf:
+		return true
+	default:
+		return false
+	}
+}
+
+// isFunction reports whether the operation reads a variable of a function rather than a route.
+func (o Operation) isFunction() bool {
+	return o == OpLocationOf
+}
+
 const (
 	OpOffsetOf Operation = iota
 	OpSizeOf
+	// OpBitOffsetOf is the offset of a member in bits, bitfields included.
+	OpBitOffsetOf
+	// OpBitSizeOf is the size of a member in bits, bitfields included.
+	OpBitSizeOf
+	// OpEnumValue is the value of an enumerator.
+	OpEnumValue
+	// OpLengthOf is the number of elements of an array.
+	OpLengthOf
+	// OpStrideOf is the distance between two elements of an array in bytes.
+	OpStrideOf
+	// OpAddressOf is the address of a global variable, as assigned by the linker.
+	// The load bias of the object has to be added to it at run time.
+	OpAddressOf
+	// OpTLSOffsetOf is the offset of a thread-local variable in the TLS block of its module.
+	OpTLSOffsetOf
+	// OpTLSAlignOf is the alignment of the TLS block of the module that defines a thread-local variable.
+	OpTLSAlignOf
+	// OpTLSSizeOf is the size of the TLS block of the module that defines a thread-local variable.
+	OpTLSSizeOf
+	// OpLocationOf is where a parameter or a local variable of a function is, per range of program counters.
+	OpLocationOf
+	// OpExpr is the value of an expression of constants and of the other operations.
+	OpExpr
 )
 
 type DataMap struct {
 	Routes []*RouteNode
+
+	expressions []*expression
+	// skipped are the fields that do not apply to the version, they are only reported.
+	skipped []skippedField
+}
+
+// Matches returns the resolved route of every field that lists alternative routes,
+// in the order the fields are declared.
+func (dm *DataMap) Matches() []Match {
+	matches := []Match{}
+	for _, f := range dm.targets() {
+		if len(f.routes) < 2 {
+			continue
+		}
+		matches = append(matches, Match{
+			Field:        f.name,
+			Alternatives: f.routes,
+			Route:        f.route(),
+		})
+	}
+	return matches
+}
+
+// targets returns the fields targeted by the extractors of the routes,
+// in the order they are declared.
+func (dm *DataMap) targets() []*target {
+	var (
+		targets = []*target{}
+		seen    = map[*target]bool{}
+	)
+	for _, rn := range dm.Routes {
+		for _, ex := range rn.Leaf().Extractors {
+			if ex.field == nil || seen[ex.field] {
+				continue
+			}
+			seen[ex.field] = true
+			targets = append(targets, ex.field)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].order < targets[j].order
+	})
+	return targets
 }
 
 type Extractor struct {
 	Source string
 	Op     Operation
 	Static bool
+	// Index is the list of array indexes applied to the source member, if any.
+	Index []int
+	// Alternative is the position of the route in the list of alternatives of the field.
+	Alternative int
 
+	field       *target
 	targetValue *reflect.Value
+	// inspect is set in place of an operation by FieldAt and Describe,
+	// it is applied to the struct at the end of the route.
+	inspect func(*composite) error
+}
+
+// optional reports whether the extractor is one of several alternative routes,
+// in which case failing to resolve it is not an error on its own.
+func (d *Extractor) optional() bool {
+	return d.field != nil && (len(d.field.routes) > 1 || d.field.optional)
 }
 
+// fail records the reason why the extractor could not be resolved.
+func (d *Extractor) fail(err error) {
+	if d.field == nil {
+		return
+	}
+	if d.optional() {
+		err = fmt.Errorf("%s: %w", d.field.routes[d.Alternative], err)
+	}
+	d.field.errs = append(d.field.errs, err)
+}
+
+// conflict records a type of the route of the extractor that has different definitions.
+func (d *Extractor) conflict(c Conflict) {
+	if d.field == nil {
+		return
+	}
+	for _, existing := range d.field.conflicts {
+		if existing.Type == c.Type {
+			return
+		}
+	}
+	d.field.conflicts = append(d.field.conflicts, c)
+}
+
+// resolvedAt records the DWARF entry the value of the extractor was read from.
+func (d *Extractor) resolvedAt(off dwarf.Offset) {
+	if d.field != nil && d.field.matched == d.Alternative {
+		d.field.entry = off
+	}
+}
+
+// target is shared by the extractors of a field of the map struct,
+// one per route when the tag lists alternatives, e.g. `offsetof:"A.x|A.y.x"`.
+// The first route that resolves wins.
+type target struct {
+	name   string
+	order  int
+	op     Operation
+	routes []string
+	// matched is the position of the resolved route, -1 if none was resolved yet.
+	matched int
+	// entry is the offset of the DWARF entry the value was read from.
+	entry dwarf.Offset
+	errs  []error
+	// conflicts are the types of the routes that have different definitions.
+	conflicts []Conflict
+	value     reflect.Value
+	// term reports whether the target is a term of an expression, rather than a field.
+	term bool
+	// optional reports whether all the routes are allowed to fail,
+	// the target has a default or is a term of an expression with alternatives.
+	optional bool
+	// def is the value of the target when none of its routes resolve, if hasDefault.
+	def        int64
+	hasDefault bool
+}
+
+// claim reports whether the value of the given alternative should be set.
+// Routes are not processed in order, so a route with a higher priority
+// overrides the value set by a route with a lower one.
+func (t *target) claim(alt int) bool {
+	if t.matched != -1 && t.matched < alt {
+		return false
+	}
+	t.matched = alt
+	return true
+}
+
+// reset clears the outcome of a previous extraction.
+func (t *target) reset() {
+	t.matched = -1
+	t.entry = 0
+	t.errs = nil
+	t.conflicts = nil
+	if t.hasDefault {
+		// Checked by New.
+		_ = setInt(t.value, t.def)
+		return
+	}
+	// The value read by a previous extraction must not pass for this one's.
+	if t.value.CanSet() {
+		t.value.Set(reflect.Zero(t.value.Type()))
+	}
+}
+
+// route returns the resolved route, empty if none was resolved.
+func (t *target) route() string {
+	if t.matched == -1 {
+		return ""
+	}
+	return t.routes[t.matched]
+}
+
+// Match records which of the alternative routes of a field was resolved.
+type Match struct {
+	Field        string
+	Alternatives []string
+	// Route is the resolved route, empty if none of the alternatives were found.
+	Route string
+}
+
+// Set sets the given value to the target field.
 func (d *Extractor) Set(value int64) error {
+	if d.field != nil && !d.field.claim(d.Alternative) {
+		return nil
+	}
 	if !d.targetValue.CanSet() {
 		return fmt.Errorf("field from struct %s is not settable", d.targetValue.Type().Name())
 	}
@@ -71,11 +333,73 @@ func (d *Extractor) Set(value int64) error {
 	return nil
 }
 
+// SetChain sets the given chain of dereference steps to the target field.
+// Every step but the last one is the offset of a pointer to follow,
+// the last one is the offset of the field in the final struct.
+// A chain with a single step can be set to an int or uint field,
+// longer chains require a slice or an array of int or uint.
+func (d *Extractor) SetChain(chain []int64) error {
+	if d.field != nil && !d.field.claim(d.Alternative) {
+		return nil
+	}
+	if !d.targetValue.CanSet() {
+		return fmt.Errorf("field from struct %s is not settable", d.targetValue.Type().Name())
+	}
+	switch d.targetValue.Kind() {
+	case reflect.Slice:
+		d.targetValue.Set(reflect.MakeSlice(d.targetValue.Type(), len(chain), len(chain)))
+	case reflect.Array:
+		if d.targetValue.Len() != len(chain) {
+			return fmt.Errorf("field from struct %s has %d elements, chain has %d steps", d.targetValue.Type().Name(), d.targetValue.Len(), len(chain))
+		}
+	default:
+		if len(chain) != 1 {
+			return fmt.Errorf("field from struct %s is not a slice or an array, chain has %d steps", d.targetValue.Type().Name(), len(chain))
+		}
+		return d.Set(chain[0])
+	}
+	for i, step := range chain {
+		elem := &Extractor{targetValue: ptrTo(d.targetValue.Index(i))}
+		if err := elem.Set(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLocations sets the given locations of a variable to the target field, which must be a slice of Location.
+func (d *Extractor) SetLocations(locs []Location) error {
+	if d.field != nil && !d.field.claim(d.Alternative) {
+		return nil
+	}
+	if !d.targetValue.CanSet() {
+		return fmt.Errorf("field from struct %s is not settable", d.targetValue.Type().Name())
+	}
+	if d.targetValue.Type() != locationsType {
+		return fmt.Errorf("field from struct %s is not a slice of locations, type: %s", d.targetValue.Type().Name(), d.targetValue.Type())
+	}
+	d.targetValue.Set(reflect.ValueOf(locs))
+	return nil
+}
+
+func ptrTo(v reflect.Value) *reflect.Value {
+	return &v
+}
+
 type RouteNode struct {
 	prev *RouteNode
 	Next *RouteNode
 
-	Type       string
+	Type string
+	// Deref is set when the member has to be dereferenced to reach the next node,
+	// e.g. "ractor*" in "rb_vm_struct.ractor*.main_thread".
+	Deref bool
+	// Index is the list of array indexes applied to the member to reach the next node,
+	// e.g. "[2]" in "rb_vm_struct.frames[2].pc".
+	Index []int
+	// Unit is the pattern the compilation unit or the source file of the definitions
+	// of the types of the route must match, set on the first node, e.g. "nptl/*".
+	Unit       string
 	Extractors []*Extractor
 }
 
@@ -109,29 +433,213 @@ func (rn *RouteNode) Key() string {
 		key   = ""
 	)
 	for _, p := range parts {
-		key += p.Type + "."
+		key += p.Type
+		for _, i := range p.Index {
+			key += fmt.Sprintf("[%d]", i)
+		}
+		if p.Deref {
+			key += derefSuffix
+		}
+		key += "."
 	}
 	return key
 }
 
-func newRouteFromTagValue(path string) *RouteNode {
-	parts := strings.Split(path, ".")
+// IsChained reports whether the route dereferences any pointers.
+func (rn *RouteNode) IsChained() bool {
+	for _, p := range rn.path() {
+		if p.Deref {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	derefSuffix = "*"
+	// alternativeSeparator separates the routes of a field in the order they are tried.
+	alternativeSeparator = "|"
+	// routeSeparator separates the type and the members of a route.
+	routeSeparator = "."
+	// quote encloses the names that contain any of the separators, e.g. "'Table<Entry*, 2>'.size".
+	quote = "'"
+	// elementIndex stands for the index of the array element in the routes of the fields of arrays of structs.
+	elementIndex = "#"
+)
+
+// splitRoute splits s around sep, outside of quotes and of template and function argument lists,
+// so "GrowableArray<CodeHeap*>._len" is split into "GrowableArray<CodeHeap*>" and "_len".
+func splitRoute(s string, sep string) ([]string, error) {
 	var (
-		head = &RouteNode{Type: parts[0]}
+		parts  []string
+		depth  int
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == quote[0]:
+			quoted = !quoted
+		case quoted:
+		case c == '<' || c == '(':
+			depth++
+		case c == '>' || c == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("invalid route %s: unbalanced %q", s, c)
+			}
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("invalid route %s: unterminated quote", s)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid route %s: unterminated argument list", s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+func newRouteFromTagValue(path string) (*RouteNode, error) {
+	parts, err := splitRoute(path, routeSeparator)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := parseTypeName(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var (
+		head = &RouteNode{Type: typ}
 		curr = head
 	)
 	for _, p := range parts[1:] {
-		curr.Next = &RouteNode{Type: p, prev: curr}
+		name, index, deref, err := parseSegment(p)
+		if err != nil {
+			return nil, err
+		}
+		curr.Next = &RouteNode{
+			Type:  name,
+			Deref: deref,
+			Index: index,
+			prev:  curr,
+		}
 		curr = curr.Next
 	}
-	return head
+	return head, nil
+}
+
+// isChainedRoute reports whether any of the intermediate members of the given route is dereferenced.
+func isChainedRoute(route string) bool {
+	parts, err := splitRoute(route, routeSeparator)
+	if err != nil {
+		return false
+	}
+	for _, p := range parts[:len(parts)-1] {
+		if strings.HasSuffix(p, derefSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTypeName parses the first segment of a route, the name of the type it starts from,
+// which can be qualified, e.g. "hotspot::CodeCache", or quoted, e.g. "'Array<u1*>'".
+func parseTypeName(s string) (string, error) {
+	name, index, deref, err := parseSegment(s)
+	if err != nil {
+		return "", err
+	}
+	if deref {
+		return "", fmt.Errorf("only intermediate members can be dereferenced: %s", s)
+	}
+	if len(index) > 0 {
+		return "", fmt.Errorf("only members can be indexed: %s", s)
+	}
+	return name, nil
+}
+
+// parseSegment splits a route segment into the member name,
+// the array indexes and whether it is dereferenced, e.g. "frames[1][2]*".
+// The name can be quoted, e.g. "'Array<u1*>'".
+func parseSegment(s string) (string, []int, bool, error) {
+	deref := strings.HasSuffix(s, derefSuffix)
+	s = strings.TrimSuffix(s, derefSuffix)
+
+	var name, rest string
+	if strings.HasPrefix(s, quote) {
+		end := strings.Index(s[len(quote):], quote)
+		if end < 0 {
+			return "", nil, false, fmt.Errorf("invalid segment %s: unterminated quote", s)
+		}
+		name, rest = s[len(quote):len(quote)+end], s[2*len(quote)+end:]
+		if name == "" {
+			return "", nil, false, fmt.Errorf("invalid segment %s: empty name", s)
+		}
+		if rest != "" && !strings.HasPrefix(rest, "[") {
+			return "", nil, false, fmt.Errorf("invalid segment %s: unexpected %q", s, rest)
+		}
+	} else {
+		name, rest = splitIndex(s)
+	}
+	if rest == "" {
+		return name, nil, deref, nil
+	}
+	if name == "" {
+		return "", nil, false, fmt.Errorf("invalid segment %s: missing member name", s)
+	}
+	rest = rest[1:]
+	var index []int
+	for {
+		n, tail, ok := strings.Cut(rest, "]")
+		if !ok {
+			return "", nil, false, fmt.Errorf("invalid segment %s: unterminated index", s)
+		}
+		i, err := strconv.Atoi(n)
+		if err != nil || i < 0 {
+			return "", nil, false, fmt.Errorf("invalid segment %s: invalid index %q", s, n)
+		}
+		index = append(index, i)
+		if tail == "" {
+			break
+		}
+		if !strings.HasPrefix(tail, "[") {
+			return "", nil, false, fmt.Errorf("invalid segment %s: unexpected %q", s, tail)
+		}
+		rest = tail[1:]
+	}
+	return name, index, deref, nil
+}
+
+// splitIndex splits an unquoted segment before its first array index,
+// outside of template arguments.
+func splitIndex(s string) (string, string) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case '[':
+			if depth == 0 {
+				return s[:i], s[i:]
+			}
+		}
+	}
+	return s, ""
 }
 
 // New generates a DataMap from the given struct.
 // Given argument must be a pointer to a struct.
-// The struct fields must be tagged with `offsetof` or `sizeof` tags.
+// The struct fields must be tagged with `offsetof` or `sizeof` tags,
+// or be structs or arrays of structs whose fields are.
 // The pointer is needed to be able to set the fields.
-func New(layoutMap any) (*DataMap, error) {
+// The version the fields are selected for is set with WithVersion.
+func New(layoutMap any, opts ...Option) (*DataMap, error) {
 	if layoutMap == nil {
 		return nil, errors.New("layoutMap must not be nil")
 	}
@@ -146,106 +654,393 @@ func New(layoutMap any) (*DataMap, error) {
 		return nil, fmt.Errorf("layoutMap must be a struct %s, got %s", st.Name(), st.Kind())
 	}
 
-	routes, err := readRoutesFromMapStruct(st, sv.Elem())
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	m := &mapStruct{groupBy: make(map[string]*RouteNode)}
+	if o.version != "" {
+		v, err := parseVersion(o.version)
+		if err != nil {
+			return nil, err
+		}
+		m.version = v
+	}
+	routes, exprs, err := m.readRoutesFromMapStruct(st, sv.Elem())
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query from struct type: %w", err)
 	}
 	dm := DataMap{
-		Routes: routes,
+		Routes:      routes,
+		expressions: exprs,
+		skipped:     m.skipped,
 	}
 	return &dm, nil
 }
 
-// readRoutesFromMapStruct reads the routes from the given struct.
-// Op(Offset|Size) tags are used to determine the operation.
-// The struct fields must be tagged with `offsetof` or `sizeof` tags.
+// readRoutesFromMapStruct reads the routes from the tags of the fields of the given struct,
+// recursing into the untagged fields that are structs or fixed-size arrays of structs.
 // The pointer is needed to be able to set the fields.
-// e.g.:
+// See the "Map structs" section of README.md for the tags and the route syntax, e.g.:
 //
-//	sizeof(Type)
-//	sizeof(StructType.(StructType)*.Field)
-//	offsetof(StructType.Field)
-//	offsetof(StructType.(StructType)*.Field)
-func readRoutesFromMapStruct(st reflect.Type, sv reflect.Value) ([]*RouteNode, error) {
-	var (
-		groupBy = make(map[string]*RouteNode)
-		add     = func(path string, name string, op Operation, fieldValue reflect.Value, static bool) {
-			if r, exists := groupBy[path]; exists {
-				r.Leaf().Extractors = append(r.Leaf().Extractors, &Extractor{
-					Source:      name,
-					Op:          op,
-					Static:      static,
-					targetValue: &fieldValue,
-				},
-				)
-				return
-			}
-			route := newRouteFromTagValue(path)
-			route.Leaf().Extractors = []*Extractor{
-				{
-					Source:      name,
-					Op:          op,
-					Static:      static,
-					targetValue: &fieldValue,
-				},
-			}
-			groupBy[path] = route
-		}
-	)
+//	offsetof(StructType.PointerField*.Field|StructType.Field) since(3.11) default(-1)
+func (m *mapStruct) readRoutesFromMapStruct(st reflect.Type, sv reflect.Value) ([]*RouteNode, []*expression, error) {
+	if err := m.read("", "", st, sv); err != nil {
+		return nil, nil, err
+	}
+	if len(m.groupBy) == 0 && len(m.expressions) == 0 {
+		return nil, nil, errors.New("no fields found with offsetof, sizeof, bitoffsetof, bitsizeof, enumval, lengthof, strideof, addressof, tlsoffsetof, tlsalignof, tlssizeof, locationof or expr tag")
+	}
+	return maps.Values(m.groupBy), m.expressions, nil
+}
+
+// mapStruct collects the routes of the fields of a map struct, and of the structs nested in it.
+type mapStruct struct {
+	groupBy     map[string]*RouteNode
+	expressions []*expression
+	skipped     []skippedField
+	// version is the version of the runtime, nil if unknown.
+	version *semver.Version
+	// order is the number of fields read so far, nested fields included.
+	order int
+}
+
+// read reads the routes of the fields of the given struct.
+// Untagged struct fields and arrays of structs are read recursively,
+// the names of their fields are prefixed with the path to them, e.g. "PyThreadState.Next" or "Frames[1].Prev".
+// element is the index of the innermost array element the struct is in, empty if none.
+func (m *mapStruct) read(prefix, element string, st reflect.Type, sv reflect.Value) error {
 	for i := 0; i < st.NumField(); i++ {
 		field := st.Field(i)
 		fieldValue := sv.Field(i)
+		name := prefix + field.Name
 
 		if !fieldValue.CanSet() && !sv.CanSet() {
-			return nil, fmt.Errorf("field %s is not settable", field.Name)
+			return fmt.Errorf("field %s is not settable", name)
+		}
+		if _, tagValue := lookupOpTag(field); tagValue == "" && field.Tag.Get(tagExpr) == "" {
+			switch {
+			case field.Type.Kind() == reflect.Struct:
+				if err := m.read(name+".", element, field.Type, fieldValue); err != nil {
+					return err
+				}
+				continue
+			case field.Type.Kind() == reflect.Array && field.Type.Elem().Kind() == reflect.Struct:
+				for j := 0; j < field.Type.Len(); j++ {
+					if err := m.read(fmt.Sprintf("%s[%d].", name, j), strconv.Itoa(j), field.Type.Elem(), fieldValue.Index(j)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
 		}
-		if !isIntType(field.Type) {
-			return nil, fmt.Errorf("field %s is not of type int or uint, type: %s", field.Name, field.Type.Kind())
+		if err := m.readField(name, element, field, fieldValue); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		var (
-			tagValue string
-			ok       bool
-			op       Operation
-		)
-		tagValue, ok = field.Tag.Lookup(tagOffsetOf)
-		if ok {
-			op = OpOffsetOf
-		}
-		if tagValue == "" {
-			tagValue, ok = field.Tag.Lookup(tagSizeOf)
-			if ok {
-				op = OpSizeOf
+// lookupOpTag returns the operation the given field is tagged with, and its tag value.
+func lookupOpTag(field reflect.StructField) (Operation, string) {
+	for _, ot := range opTags {
+		if tagValue, ok := field.Tag.Lookup(ot.tag); ok && tagValue != "" {
+			return ot.op, tagValue
+		}
+	}
+	return 0, ""
+}
+
+// readField reads the routes of the given int or uint field.
+func (m *mapStruct) readField(name, element string, field reflect.StructField, fieldValue reflect.Value) error {
+	if !isIntType(field.Type) && !isIntSequenceType(field.Type) && field.Type != locationsType {
+		return fmt.Errorf("field %s is not of type int or uint, type: %s", name, field.Type.Kind())
+	}
+	defer func() { m.order++ }()
+
+	cond, err := m.condition(name, field)
+	if err != nil {
+		return err
+	}
+	if cond.hasDefault {
+		if err := setInt(fieldValue, cond.def); err != nil {
+			return fmt.Errorf("field %s: invalid default: %w", name, err)
+		}
+	}
+
+	op, tagValue := lookupOpTag(field)
+	if source := field.Tag.Get(tagExpr); source != "" {
+		if tagValue != "" {
+			return fmt.Errorf("field %s: expr cannot be combined with other tags", name)
+		}
+		if !cond.applies {
+			m.skip(name, OpExpr, source, cond, fieldValue)
+			return nil
+		}
+		return m.readExpression(name, element, source, cond, field, fieldValue)
+	}
+	if !cond.applies {
+		if tagValue != "" && tagValue != "-" {
+			m.skip(name, op, tagValue, cond, fieldValue)
+		}
+		return nil
+	}
+	if tagValue == "" || tagValue == "-" {
+		return nil
+	}
+	t, err := m.addTarget(name, element, op, tagValue, field, fieldValue)
+	if err != nil {
+		return err
+	}
+	t.def, t.hasDefault, t.optional = cond.def, cond.hasDefault, cond.hasDefault
+	return nil
+}
+
+// skippedField is a field that does not apply to the version of the runtime.
+type skippedField struct {
+	name  string
+	op    Operation
+	route string
+	order int
+	value reflect.Value
+	// reason is why the field does not apply.
+	reason error
+}
+
+// skip records the given field, which does not apply to the version.
+func (m *mapStruct) skip(name string, op Operation, route string, cond condition, fieldValue reflect.Value) {
+	m.skipped = append(m.skipped, skippedField{
+		name:   name,
+		op:     op,
+		route:  route,
+		order:  m.order,
+		value:  fieldValue,
+		reason: cond.skip,
+	})
+}
+
+// readExpression reads the routes of the terms of the given field tagged with `expr`.
+func (m *mapStruct) readExpression(name, element, source string, cond condition, field reflect.StructField, fieldValue reflect.Value) error {
+	if !isIntType(field.Type) {
+		return fmt.Errorf("field %s is not of type int or uint, type: %s", name, field.Type.Kind())
+	}
+	sources, err := splitRoute(source, alternativeSeparator)
+	if err != nil {
+		return fmt.Errorf("field %s: %w", name, err)
+	}
+	e := &expression{
+		name:       name,
+		order:      m.order,
+		source:     source,
+		value:      fieldValue,
+		def:        cond.def,
+		hasDefault: cond.hasDefault,
+	}
+	for _, s := range sources {
+		terms, err := parseExpression(s)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+		for i, t := range terms {
+			if t.route == "" {
+				continue
+			}
+			// The value of each term is read into a target of its own.
+			v := reflect.New(reflect.TypeOf(int64(0))).Elem()
+			tt, err := m.addTarget(name, element, t.op, t.route, field, v)
+			if err != nil {
+				return err
 			}
+			tt.term = true
+			tt.optional = len(sources) > 1 || cond.hasDefault
+			terms[i].target = tt
 		}
-		if tagValue == "" || tagValue == "-" {
-			continue
+		e.alternatives = append(e.alternatives, terms)
+	}
+	m.expressions = append(m.expressions, e)
+	return nil
+}
+
+// addTarget adds the routes of a target, given as the value of the tag of the given operation.
+// The `cu` and `static` tags are read from the given field.
+func (m *mapStruct) addTarget(name, element string, op Operation, tagValue string, field reflect.StructField, fieldValue reflect.Value) (*target, error) {
+	if element != "" && !op.isSymbol() {
+		tagValue = strings.ReplaceAll(tagValue, elementIndex, element)
+	}
+
+	routes, err := splitRoute(tagValue, alternativeSeparator)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", name, err)
+	}
+	unit := field.Tag.Get(tagUnit)
+	if _, err := path.Match(unit, ""); err != nil {
+		return nil, fmt.Errorf("field %s: invalid cu pattern %q: %w", name, unit, err)
+	}
+	if op.isFunction() {
+		return m.addFunctionTarget(name, op, tagValue, routes, unit, fieldValue)
+	}
+	if fieldValue.Type() == locationsType {
+		return nil, fmt.Errorf("field %s: only the locationof tag reads locations", name)
+	}
+	// Only offsets are chained, sizes are read from the final struct.
+	chained := false
+	for _, route := range routes {
+		if op.isOffset() && isChainedRoute(route) {
+			chained = true
 		}
+	}
+	if chained && !isIntSequenceType(fieldValue.Type()) {
+		return nil, fmt.Errorf("field %s: route %s dereferences a pointer, field must be a slice or an array of int or uint", name, tagValue)
+	}
+	if !chained && !isIntType(fieldValue.Type()) {
+		return nil, fmt.Errorf("field %s is not of type int or uint, type: %s", name, fieldValue.Type().Kind())
+	}
 
-		parts := strings.Split(tagValue, ".")
+	f := &target{
+		name:    name,
+		order:   m.order,
+		op:      op,
+		routes:  routes,
+		matched: -1,
+		value:   fieldValue,
+	}
+	for j, route := range routes {
+		if op.isSymbol() {
+			if route == "" {
+				return nil, fmt.Errorf("field %s: invalid tag value: %s", name, tagValue)
+			}
+			if err := m.add(route, "", &Extractor{
+				Source:      route,
+				Op:          op,
+				Alternative: j,
+				field:       f,
+				targetValue: ptrTo(fieldValue),
+			}); err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			continue
+		}
+		parts, err := splitRoute(route, routeSeparator)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
 		if len(parts) < op.minimumRequiredRouteLength() {
-			return nil, fmt.Errorf("field %s: invalid tag value: %s", field.Name, tagValue)
+			return nil, fmt.Errorf("field %s: invalid tag value: %s", name, tagValue)
+		}
+		typeName, err := parseTypeName(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		if len(parts) > 1 && strings.HasSuffix(parts[len(parts)-1], derefSuffix) {
+			return nil, fmt.Errorf("field %s: only intermediate members can be dereferenced: %s", name, route)
 		}
 
 		// Separate the field name from the path.
 		var (
 			path      string
 			fieldName string
+			index     []int
 		)
 		if len(parts) == 1 {
-			path = tagValue
-			fieldName = tagValue
+			path = route
+			fieldName = typeName
 		} else {
-			path = strings.Join(parts[:len(parts)-1], ".")
-			fieldName = parts[len(parts)-1]
+			path = strings.Join(parts[:len(parts)-1], routeSeparator)
+			fieldName, index, _, err = parseSegment(parts[len(parts)-1])
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+		if err := m.add(path, unit, &Extractor{
+			Source:      fieldName,
+			Op:          op,
+			Static:      field.Tag.Get(tagStatic) == "true",
+			Index:       index,
+			Alternative: j,
+			field:       f,
+			targetValue: ptrTo(fieldValue),
+		}); err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
 		}
-		add(path, fieldName, op, fieldValue, field.Tag.Get(tagStatic) == "true")
 	}
+	return f, nil
+}
 
-	if len(groupBy) == 0 {
-		return nil, errors.New("no fields found with offsetof or sizeof tag")
+// addFunctionTarget adds the routes of a target tagged with `locationof`,
+// each route is the name of a function followed by the name of one of its variables.
+func (m *mapStruct) addFunctionTarget(name string, op Operation, tagValue string, routes []string, unit string, fieldValue reflect.Value) (*target, error) {
+	if fieldValue.Type() != locationsType {
+		return nil, fmt.Errorf("field %s is not of type []datamap.Location, type: %s", name, fieldValue.Type())
 	}
-	return maps.Values(groupBy), nil
+	f := &target{
+		name:    name,
+		order:   m.order,
+		op:      op,
+		routes:  routes,
+		matched: -1,
+		value:   fieldValue,
+	}
+	for j, route := range routes {
+		parts, err := splitRoute(route, routeSeparator)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("field %s: invalid tag value: %s", name, tagValue)
+		}
+		function, err := parseTypeName(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		variable, index, deref, err := parseSegment(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		if len(index) > 0 || deref || variable == "" {
+			return nil, fmt.Errorf("field %s: invalid variable name: %s", name, parts[1])
+		}
+		if err := m.add(function, unit, &Extractor{
+			Source:      variable,
+			Op:          op,
+			Alternative: j,
+			field:       f,
+			targetValue: ptrTo(fieldValue),
+		}); err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return f, nil
+}
+
+// add groups the extractor with the others of the same route.
+func (m *mapStruct) add(path, unit string, ex *Extractor) error {
+	key := path
+	switch {
+	case ex.Op.isSymbol():
+		// Symbols are not routes, they can contain dots and share names with types.
+		key = "symbol:" + path
+	case ex.Op.isFunction():
+		// Neither are functions, which can be pinned to units like types.
+		key = "function:" + unit + ":" + path
+	case unit != "":
+		// The same route pinned to different units can lead to different definitions.
+		key = "cu:" + unit + ":" + path
+	}
+	if r, exists := m.groupBy[key]; exists {
+		r.Leaf().Extractors = append(r.Leaf().Extractors, ex)
+		return nil
+	}
+	route := &RouteNode{Type: path, Unit: unit}
+	if !ex.Op.isSymbol() && !ex.Op.isFunction() {
+		var err error
+		if route, err = newRouteFromTagValue(path); err != nil {
+			return err
+		}
+		route.Unit = unit
+	}
+	route.Leaf().Extractors = []*Extractor{ex}
+	m.groupBy[key] = route
+	return nil
 }
 
 func isIntType(t reflect.Type) bool {
@@ -258,3 +1053,12 @@ func isIntType(t reflect.Type) bool {
 		return false
 	}
 }
+
+func isIntSequenceType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return isIntType(t.Elem())
+	default:
+		return false
+	}
+}
@@ -173,6 +173,448 @@ func TestGenerateQuery(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "pointer dereference",
+			mapStruct: &struct {
+				a []int64 `offsetof:"rb_vm_struct.ractor*.main_thread"`
+				b int64   `sizeof:"rb_vm_struct.ractor*.main_thread"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "rb_vm_struct",
+					Next: &RouteNode{
+						Type:  "ractor",
+						Deref: true,
+						Extractors: []*Extractor{
+							{
+								Source: "main_thread",
+								Op:     OpOffsetOf,
+							},
+							{
+								Source: "main_thread",
+								Op:     OpSizeOf,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "bitfields",
+			mapStruct: &struct {
+				a int `bitoffsetof:"PyASCIIObject.state.kind"`
+				b int `bitsizeof:"PyASCIIObject.state.kind"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "PyASCIIObject",
+					Next: &RouteNode{
+						Type: "state",
+						Extractors: []*Extractor{
+							{
+								Source: "kind",
+								Op:     OpBitOffsetOf,
+							},
+							{
+								Source: "kind",
+								Op:     OpBitSizeOf,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "enumerators",
+			mapStruct: &struct {
+				a int `enumval:"_frameowner.FRAME_OWNED_BY_THREAD"`
+				b int `enumval:"_frameowner.FRAME_OWNED_BY_CSTACK"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "_frameowner",
+					Extractors: []*Extractor{
+						{
+							Source: "FRAME_OWNED_BY_THREAD",
+							Op:     OpEnumValue,
+						},
+						{
+							Source: "FRAME_OWNED_BY_CSTACK",
+							Op:     OpEnumValue,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "arrays",
+			mapStruct: &struct {
+				a int `offsetof:"_PyRuntimeState.interpreters[1][2].id"`
+				b int `strideof:"pthread.specific_1stblock"`
+				c int `lengthof:"pthread.specific_1stblock"`
+				d int `offsetof:"pthread.specific_1stblock[3]"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "_PyRuntimeState",
+					Next: &RouteNode{
+						Type:  "interpreters",
+						Index: []int{1, 2},
+						Extractors: []*Extractor{
+							{
+								Source: "id",
+								Op:     OpOffsetOf,
+							},
+						},
+					},
+				},
+				{
+					Type: "pthread",
+					Extractors: []*Extractor{
+						{
+							Source: "specific_1stblock",
+							Op:     OpStrideOf,
+						},
+						{
+							Source: "specific_1stblock",
+							Op:     OpLengthOf,
+						},
+						{
+							Source: "specific_1stblock",
+							Op:     OpOffsetOf,
+							Index:  []int{3},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "alternatives",
+			mapStruct: &struct {
+				a int `offsetof:"_PyRuntimeState.gilstate.autoTSSkey|_PyRuntimeState.autoTSSkey"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "_PyRuntimeState",
+					Extractors: []*Extractor{
+						{
+							Source:      "autoTSSkey",
+							Op:          OpOffsetOf,
+							Alternative: 1,
+						},
+					},
+				},
+				{
+					Type: "_PyRuntimeState",
+					Next: &RouteNode{
+						Type: "gilstate",
+						Extractors: []*Extractor{
+							{
+								Source: "autoTSSkey",
+								Op:     OpOffsetOf,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "addresses",
+			mapStruct: &struct {
+				a int `addressof:"_ZN9CodeCache7_heapsE"`
+				b int `addressof:"completed.0"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "_ZN9CodeCache7_heapsE",
+					Extractors: []*Extractor{
+						{
+							Source: "_ZN9CodeCache7_heapsE",
+							Op:     OpAddressOf,
+						},
+					},
+				},
+				{
+					Type: "completed.0",
+					Extractors: []*Extractor{
+						{
+							Source: "completed.0",
+							Op:     OpAddressOf,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "qualified and templated names",
+			mapStruct: &struct {
+				a int     `offsetof:"v8::internal::Isolate._heap"`
+				b int     `sizeof:"'Array<u1*>'"`
+				c []int64 `offsetof:"'Table<Entry*, 2>'.entries[1]*._next"`
+				d int     `offsetof:"GrowableArray<CodeHeap*>._len"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "v8::internal::Isolate",
+					Extractors: []*Extractor{
+						{
+							Source: "_heap",
+							Op:     OpOffsetOf,
+						},
+					},
+				},
+				{
+					Type: "Array<u1*>",
+					Extractors: []*Extractor{
+						{
+							Source: "Array<u1*>",
+							Op:     OpSizeOf,
+						},
+					},
+				},
+				{
+					Type: "Table<Entry*, 2>",
+					Next: &RouteNode{
+						Type:  "entries",
+						Index: []int{1},
+						Deref: true,
+						Extractors: []*Extractor{
+							{
+								Source: "_next",
+								Op:     OpOffsetOf,
+							},
+						},
+					},
+				},
+				{
+					Type: "GrowableArray<CodeHeap*>",
+					Extractors: []*Extractor{
+						{
+							Source: "_len",
+							Op:     OpOffsetOf,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unterminated quote",
+			mapStruct: &struct {
+				a int `offsetof:"'Array<u1*>._len"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unterminated template arguments",
+			mapStruct: &struct {
+				a int `offsetof:"Array<u1*._len"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "nested structs and arrays of structs",
+			mapStruct: &struct {
+				PyThreadState struct {
+					Next  int `offsetof:"PyThreadState.next"`
+					Unset int
+				}
+				Contexts [2]struct {
+					CFP int `offsetof:"runtime.contexts[#].cfp"`
+				}
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "PyThreadState",
+					Extractors: []*Extractor{
+						{
+							Source: "next",
+							Op:     OpOffsetOf,
+						},
+					},
+				},
+				{
+					Type: "runtime",
+					Next: &RouteNode{
+						Type:  "contexts",
+						Index: []int{0},
+						Extractors: []*Extractor{
+							{
+								Source: "cfp",
+								Op:     OpOffsetOf,
+							},
+						},
+					},
+				},
+				{
+					Type: "runtime",
+					Next: &RouteNode{
+						Type:  "contexts",
+						Index: []int{1},
+						Extractors: []*Extractor{
+							{
+								Source: "cfp",
+								Op:     OpOffsetOf,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "tagged struct",
+			mapStruct: &struct {
+				PyThreadState struct {
+					Next int
+				} `sizeof:"PyThreadState"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "expressions",
+			mapStruct: &struct {
+				a int `expr:"offsetof(rb_iseq_constant_body.insns_info) + offsetof(iseq_insn_info.size)"`
+				b int `expr:"sizeof('Table<int, (1 + 2)>') - 8"`
+				c int `expr:"8"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "Table<int, (1 + 2)>",
+					Extractors: []*Extractor{
+						{
+							Source: "Table<int, (1 + 2)>",
+							Op:     OpSizeOf,
+						},
+					},
+				},
+				{
+					Type: "iseq_insn_info",
+					Extractors: []*Extractor{
+						{
+							Source: "size",
+							Op:     OpOffsetOf,
+						},
+					},
+				},
+				{
+					Type: "rb_iseq_constant_body",
+					Extractors: []*Extractor{
+						{
+							Source: "insns_info",
+							Op:     OpOffsetOf,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "unknown operation in expression",
+			mapStruct: &struct {
+				a int `expr:"alignof(pthread) + 8"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "missing operator in expression",
+			mapStruct: &struct {
+				a int `expr:"offsetof(pthread.tid) 8"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unterminated expression",
+			mapStruct: &struct {
+				a int `expr:"offsetof(pthread.tid + 8"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "expression combined with another tag",
+			mapStruct: &struct {
+				a int `offsetof:"pthread.tid" expr:"8"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "invalid array index",
+			mapStruct: &struct {
+				a int `offsetof:"pthread.specific_1stblock[-1]"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "indexed root",
+			mapStruct: &struct {
+				a int `offsetof:"pthread[1].specific"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "pointer dereference into a scalar",
+			mapStruct: &struct {
+				a int64 `offsetof:"rb_vm_struct.ractor*.main_thread"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "pointer dereference of the last member",
+			mapStruct: &struct {
+				a []int64 `offsetof:"rb_vm_struct.ractor*"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "locations",
+			mapStruct: &struct {
+				a []Location `locationof:"_PyEval_EvalFrameDefault.frame|PyEval_EvalFrameEx.f"`
+				b []Location `locationof:"_PyEval_EvalFrameDefault.tstate"`
+			}{},
+			want: []*RouteNode{
+				{
+					Type: "_PyEval_EvalFrameDefault",
+					Extractors: []*Extractor{
+						{
+							Source: "frame",
+							Op:     OpLocationOf,
+						},
+						{
+							Source: "tstate",
+							Op:     OpLocationOf,
+						},
+					},
+				},
+				{
+					Type: "PyEval_EvalFrameEx",
+					Extractors: []*Extractor{
+						{
+							Source:      "f",
+							Op:          OpLocationOf,
+							Alternative: 1,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "locations in an int field",
+			mapStruct: &struct {
+				a int64 `locationof:"vm_exec_core.ec"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "offset in a locations field",
+			mapStruct: &struct {
+				a []Location `offsetof:"rb_vm_struct.ractor"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "location of a member",
+			mapStruct: &struct {
+				a []Location `locationof:"vm_exec_core.ec.cfp"`
+			}{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -185,10 +627,10 @@ func TestGenerateQuery(t *testing.T) {
 			}
 
 			sort.Slice(got.Routes, func(i, j int) bool {
-				return got.Routes[i].Type < got.Routes[j].Type
+				return got.Routes[i].Key() < got.Routes[j].Key()
 			})
 			sort.Slice(tt.want, func(i, j int) bool {
-				return tt.want[i].Type < tt.want[j].Type
+				return tt.want[i].Key() < tt.want[j].Key()
 			})
 			diff := cmp.Diff(
 				tt.want, got.Routes,
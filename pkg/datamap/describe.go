@@ -0,0 +1,284 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TypeLayout is the layout of a struct, a class or a union, as described by Describe.
+type TypeLayout struct {
+	Name string `yaml:"name" json:"name"`
+	// Kind is either struct, class or union.
+	Kind string `yaml:"kind" json:"kind"`
+	Size int64  `yaml:"size" json:"size"`
+	// Members lists the base classes and the members in the order of their offsets.
+	Members []MemberLayout `yaml:"members,omitempty" json:"members,omitempty"`
+	// Padding is the number of bytes after the end of the last member.
+	Padding int64 `yaml:"padding,omitempty" json:"padding,omitempty"`
+}
+
+// MemberLayout is a member, or a base class, of a TypeLayout.
+type MemberLayout struct {
+	// Name is the name of the member, empty for an anonymous struct or union,
+	// the name of the class for a base class.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Base reports whether the member is a base class.
+	Base bool `yaml:"base,omitempty" json:"base,omitempty"`
+	// Offset is the offset of the member in the type, of its storage unit for a bitfield.
+	Offset int64  `yaml:"offset" json:"offset"`
+	Size   int64  `yaml:"size" json:"size"`
+	Type   string `yaml:"type" json:"type"`
+	// BitOffset and BitSize locate a bitfield in bits, from the start of the type.
+	// BitSize is 0 when the member is not a bitfield.
+	BitOffset int64 `yaml:"bit_offset,omitempty" json:"bit_offset,omitempty"`
+	BitSize   int64 `yaml:"bit_size,omitempty" json:"bit_size,omitempty"`
+	// Count lists the number of elements of each dimension of an array, -1 for a flexible array member.
+	Count []int64 `yaml:"count,omitempty" json:"count,omitempty"`
+	// Pointee is the type the member points to, if it is a pointer or an array of pointers.
+	Pointee string `yaml:"pointee,omitempty" json:"pointee,omitempty"`
+	// Hole is the number of unused bytes between the end of the member and the start of the next one.
+	Hole int64 `yaml:"hole,omitempty" json:"hole,omitempty"`
+	// Layout is the layout of the struct the member is, or is an array of, when it is expanded.
+	Layout *TypeLayout `yaml:"layout,omitempty" json:"layout,omitempty"`
+}
+
+// Describe returns the layout of the struct at the end of the given route, as FieldAt looks it up.
+// The structs the members and the base classes are, or are arrays of, are expanded up to the given depth,
+// a negative depth expands all of them.
+// Anonymous structs and unions are always expanded, the targets of pointers never are,
+// they can be described with a route that dereferences the pointer, e.g. "vm.threads*".
+func Describe(src Source, route string, depth int) (*TypeLayout, error) {
+	var l *TypeLayout
+	err := inspect(src, route, func(c *composite) error {
+		var err error
+		l, err = describe(c, depth, 0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, fmt.Errorf("failed to find %s", route)
+	}
+	return l, nil
+}
+
+// describe returns the layout of the given struct.
+// The level is the number of structs expanded to reach the given one,
+// malformed DWARF data can describe a struct that contains itself.
+func describe(c *composite, depth, level int) (*TypeLayout, error) {
+	if level > maxTypeDepth {
+		return nil, fmt.Errorf("too many nested members in %s", c.st.StructName)
+	}
+	st := c.st
+	l := &TypeLayout{Name: st.StructName, Kind: st.Kind, Size: st.ByteSize}
+
+	if c.bases != nil {
+		bases, err := c.bases()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bases {
+			m := MemberLayout{Name: b.c.st.StructName, Base: true, Offset: b.offset, Size: b.c.st.ByteSize, Type: typeString(b.c.st)}
+			if depth != 0 {
+				if m.Layout, err = describe(b.c, depth-1, level+1); err != nil {
+					return nil, err
+				}
+			}
+			l.Members = append(l.Members, m)
+		}
+	}
+
+	for i, f := range st.Field {
+		m := MemberLayout{Name: f.Name, Offset: f.ByteOffset, Size: sizeOf(f.Type), Type: typeString(f.Type)}
+		if f.BitSize != 0 {
+			bits, err := c.bitOffset(i)
+			if err != nil {
+				return nil, err
+			}
+			m.BitOffset, m.BitSize = bits, f.BitSize
+			// The storage unit the bitfield is in, which is not recorded by DWARF 4 and later.
+			if m.Size > 0 {
+				m.Offset = bits / 8 / m.Size * m.Size
+			}
+		}
+		typ := underlyingType(f.Type)
+		for j := 0; j < maxTypeDepth; j++ {
+			at, ok := typ.(*dwarf.ArrayType)
+			if !ok {
+				break
+			}
+			m.Count = append(m.Count, at.Count)
+			typ = underlyingType(at.Type)
+		}
+		switch t := typ.(type) {
+		case *dwarf.PtrType:
+			m.Pointee = typeString(t.Type)
+		case *dwarf.StructType:
+			// The members of anonymous structs and unions are the members of the type, like in C.
+			next := depth
+			if f.Name != "" {
+				if depth == 0 {
+					break
+				}
+				next = depth - 1
+			}
+			inner, err := c.member(i)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the type of %s: %w", f.Name, err)
+			}
+			if inner == nil {
+				break
+			}
+			if m.Layout, err = describe(inner, next, level+1); err != nil {
+				return nil, err
+			}
+		}
+		l.Members = append(l.Members, m)
+	}
+
+	// Base classes come first, and stay first when a member shares their offset.
+	sort.SliceStable(l.Members, func(i, j int) bool {
+		return l.Members[i].start() < l.Members[j].start()
+	})
+	var end int64
+	for i := range l.Members {
+		m := &l.Members[i]
+		if i > 0 && m.start() > end {
+			l.Members[i-1].Hole = m.start() - end
+		}
+		if e := m.end(); e > end {
+			end = e
+		}
+	}
+	if st.ByteSize > end {
+		l.Padding = st.ByteSize - end
+	}
+	return l, nil
+}
+
+// start returns the offset of the first byte used by the member.
+func (m *MemberLayout) start() int64 {
+	if m.BitSize != 0 {
+		return m.BitOffset / 8
+	}
+	return m.Offset
+}
+
+// end returns the offset of the byte after the last one used by the member.
+func (m *MemberLayout) end() int64 {
+	if m.BitSize != 0 {
+		return (m.BitOffset + m.BitSize + 7) / 8
+	}
+	return m.Offset + m.Size
+}
+
+// LayoutChange is a member whose layout differs between two layouts of a type, as returned by DiffLayouts.
+type LayoutChange struct {
+	// Member is the route to the member from the type, e.g. "ceval.stack",
+	// or "contexts[0].stack" for the members of the elements of an array,
+	// empty for the type itself.
+	Member string `yaml:"member" json:"member"`
+	// Old and New are the member in each layout, nil when it is missing from one of them.
+	Old *MemberPosition `yaml:"old,omitempty" json:"old,omitempty"`
+	New *MemberPosition `yaml:"new,omitempty" json:"new,omitempty"`
+}
+
+// MemberPosition is where a member is in a type, compared by DiffLayouts.
+type MemberPosition struct {
+	// Offset is the offset of the member from the start of the type.
+	Offset int64  `yaml:"offset" json:"offset"`
+	Size   int64  `yaml:"size" json:"size"`
+	Type   string `yaml:"type" json:"type"`
+	// BitOffset and BitSize locate a bitfield in bits, from the start of the type.
+	BitOffset int64 `yaml:"bit_offset,omitempty" json:"bit_offset,omitempty"`
+	BitSize   int64 `yaml:"bit_size,omitempty" json:"bit_size,omitempty"`
+}
+
+// DiffLayouts returns the members whose offset, size or type differ between two layouts of a type,
+// e.g. read from two versions of a program, in the order of the members before, followed by the added ones.
+// The members of base classes and of anonymous members are compared as members of the type, as in routes,
+// only the expanded members are compared.
+func DiffLayouts(before, after *TypeLayout) []LayoutChange {
+	var changes []LayoutChange
+	if before.Size != after.Size || before.Name != after.Name || before.Kind != after.Kind {
+		changes = append(changes, LayoutChange{
+			Old: &MemberPosition{Size: before.Size, Type: strings.TrimSpace(before.Kind + " " + before.Name)},
+			New: &MemberPosition{Size: after.Size, Type: strings.TrimSpace(after.Kind + " " + after.Name)},
+		})
+	}
+
+	oldMembers, newMembers := flatten(before), flatten(after)
+	byRoute := make(map[string]*MemberPosition, len(newMembers))
+	for _, m := range newMembers {
+		byRoute[m.route] = m.pos
+	}
+	for _, m := range oldMembers {
+		pos, ok := byRoute[m.route]
+		if !ok {
+			changes = append(changes, LayoutChange{Member: m.route, Old: m.pos})
+			continue
+		}
+		delete(byRoute, m.route)
+		if *pos != *m.pos {
+			changes = append(changes, LayoutChange{Member: m.route, Old: m.pos, New: pos})
+		}
+	}
+	for _, m := range newMembers {
+		if pos, ok := byRoute[m.route]; ok {
+			changes = append(changes, LayoutChange{Member: m.route, New: pos})
+		}
+	}
+	return changes
+}
+
+type flatMember struct {
+	route string
+	pos   *MemberPosition
+}
+
+// flatten lists the named members of the given layout and of its expanded members,
+// with their offsets from the start of the layout.
+// Only the first of the members with the same route is listed, as it is the one routes resolve to.
+func flatten(l *TypeLayout) []flatMember {
+	var (
+		members []flatMember
+		seen    = map[string]bool{}
+		walk    func(l *TypeLayout, prefix string, offset int64)
+	)
+	walk = func(l *TypeLayout, prefix string, offset int64) {
+		for _, m := range l.Members {
+			route := prefix
+			if m.Name != "" && !m.Base {
+				if route != "" {
+					route += routeSeparator
+				}
+				route += memberName(m.Name)
+				if !seen[route] {
+					seen[route] = true
+					pos := &MemberPosition{Offset: offset + m.Offset, Size: m.Size, Type: m.Type}
+					if m.BitSize != 0 {
+						pos.BitOffset, pos.BitSize = offset*8+m.BitOffset, m.BitSize
+					}
+					members = append(members, flatMember{route: route, pos: pos})
+				}
+			}
+			if m.Layout != nil {
+				walk(m.Layout, route+strings.Repeat("[0]", len(m.Count)), offset+m.Offset)
+			}
+		}
+	}
+	walk(l, "", 0)
+	return members
+}
+
+// memberName returns the name of a member as written in a route,
+// quoted if it contains a separator, e.g. "'_vptr.Relocatable'".
+func memberName(name string) string {
+	if strings.Contains(name, routeSeparator) {
+		return quote + name + quote
+	}
+	return name
+}
@@ -1,137 +1,713 @@
 package datamap
 
 import (
+	"context"
 	"debug/dwarf"
 	"debug/elf"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/parca-dev/runtime-data/pkg/symbols"
 )
 
-func (dataMap *DataMap) ReadFromDWARF(ef *elf.File) error {
-	dwarfData, err := ef.DWARF()
+// Option configures how the values of a DataMap are read.
+type Option func(*options)
+
+type options struct {
+	strict        bool
+	supplementary *elf.File
+	elfPath       string
+	debugDirs     []string
+	splitDirs     []string
+	version       string
+	maxEntries    int64
+	maxBytes      int64
+	timeout       time.Duration
+	includeDirs   []string
+	defines       []string
+	abi           string
+}
+
+// WithStrict makes the read fail when any field of the map struct cannot be resolved,
+// instead of leaving it unset, or when it is read from a type that has conflicting definitions.
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithSupplementaryFile sets the supplementary file the DWARF data refers to,
+// instead of looking up the one named in .gnu_debugaltlink.
+// The file is not closed by the index.
+func WithSupplementaryFile(alt *elf.File) Option {
+	return func(o *options) {
+		o.supplementary = alt
+	}
+}
+
+// WithELFPath sets the path the ELF file has been opened from,
+// the relative path of the supplementary file named in .gnu_debugaltlink is resolved against its directory.
+func WithELFPath(path string) Option {
+	return func(o *options) {
+		o.elfPath = path
+	}
+}
+
+// WithDebugDirs sets the directories the supplementary file named in .gnu_debugaltlink is looked up in.
+// Absolute paths are looked up in them too, which allows them to be sysroots,
+// e.g. / or the directory a debug package has been extracted to.
+func WithDebugDirs(dirs ...string) Option {
+	return func(o *options) {
+		o.debugDirs = append(o.debugDirs, dirs...)
+	}
+}
+
+// ReadFromDWARF reads the DWARF data of the given ELF file and sets the values of the map struct.
+func (dataMap *DataMap) ReadFromDWARF(ef *elf.File, opts ...Option) error {
+	return dataMap.ReadFromDWARFContext(context.Background(), ef, opts...)
+}
+
+// ReadFromDWARFContext is like ReadFromDWARF, the given context cancels the read.
+// The timeout set with WithTimeout applies to the whole read.
+func (dataMap *DataMap) ReadFromDWARFContext(ctx context.Context, ef *elf.File, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ctx, cancel := o.withTimeout(ctx)
+	defer cancel()
+
+	// The timeout is already set.
+	opts = append(opts, WithTimeout(0))
+	idx, err := NewTypeIndexContext(ctx, ef, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to read DWARF info: %w", err)
+		return err
 	}
+	defer idx.Close()
+	_, err = dataMap.ExtractContext(ctx, idx, opts...)
+	return err
+}
 
-	p := processor{
-		ef:        ef,
-		dwarfData: dwarfData,
+// ReadFromIndex sets the values of the map struct using the given TypeIndex.
+// The same index can be used to read several DataMaps from the same ELF file.
+func (dataMap *DataMap) ReadFromIndex(idx *TypeIndex, opts ...Option) error {
+	_, err := dataMap.Extract(idx, opts...)
+	return err
+}
+
+// Extract sets the values of the map struct using the given source of type information,
+// and reports how each field was resolved.
+// The report is returned along with the error, if any, to help diagnose it.
+func (dataMap *DataMap) Extract(src Source, opts ...Option) (*ExtractionReport, error) {
+	return dataMap.ExtractContext(context.Background(), src, opts...)
+}
+
+// ExtractContext is like Extract, the given context cancels the extraction between two routes.
+// The reads of the source are only cancelled by the context the source has been built with.
+func (dataMap *DataMap) ExtractContext(ctx context.Context, src Source, opts ...Option) (*ExtractionReport, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ctx, cancel := o.withTimeout(ctx)
+	defer cancel()
+
+	targets := dataMap.targets()
+	for _, t := range targets {
+		t.reset()
+	}
+	for _, e := range dataMap.expressions {
+		e.reset()
 	}
-	// TODO(kakkoyun): This is a very naive implementation.
-	// We should optimize this for performance.
 	for _, rn := range dataMap.Routes {
-		entries, err := p.findCompositeTypeEntries(rn.Type)
-		if err != nil {
-			continue
+		if err := ctx.Err(); err != nil {
+			return dataMap.report(src.unitOf), err
+		}
+		if err := src.route(rn); err != nil {
+			for _, ex := range rn.Leaf().Extractors {
+				ex.fail(err)
+			}
+			// A route that only leads to alternatives is allowed to fail,
+			// as long as another alternative of the same fields resolves.
+			if !hasOnlyOptionalExtractors(rn.Leaf()) || isStopped(err) {
+				return dataMap.report(src.unitOf), err
+			}
 		}
+	}
 
-		entry, err := p.findActionableEntry(entries)
-		if err != nil {
-			return fmt.Errorf("failed to find composite type (%s): %w", rn.Type, err)
+	for _, e := range dataMap.expressions {
+		if err := e.evaluate(); err != nil {
+			return dataMap.report(src.unitOf), err
 		}
+	}
 
-		typ, err := dwarfData.Type(entry.Offset)
-		if err != nil {
-			return fmt.Errorf("failed to get type: %w", err)
+	report := dataMap.report(src.unitOf)
+	for _, t := range targets {
+		if len(t.routes) > 1 && !t.optional && t.matched == -1 && len(t.errs) > 0 {
+			return report, fmt.Errorf("failed to resolve any route of field %s: %w", t.name, errors.Join(t.errs...))
 		}
+	}
+	if gaps := report.Gaps(); o.strict && len(gaps) > 0 {
+		names := make([]string, 0, len(gaps))
+		for _, g := range gaps {
+			names = append(names, g.Field)
+		}
+		return report, fmt.Errorf("failed to resolve fields: %s", strings.Join(names, ", "))
+	}
+	if conflicts := report.Conflicts(); o.strict && len(conflicts) > 0 {
+		// The definition the value was read from is arbitrary, the route has to be pinned.
+		reasons := make([]string, 0, len(conflicts))
+		for _, f := range conflicts {
+			for _, c := range f.Conflicts {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", f.Field, c))
+			}
+		}
+		return report, fmt.Errorf("conflicting definitions, pin them with the cu tag: %s", strings.Join(reasons, "; "))
+	}
+	return report, nil
+}
+
+func (idx *TypeIndex) route(rn *RouteNode) error {
+	p := processor{
+		ef:        idx.ef,
+		dwarfData: idx.dwarfData,
+		index:     idx,
+		pin:       rn.Unit,
+		conflict: func(c Conflict) {
+			for _, ex := range rn.Leaf().Extractors {
+				ex.conflict(c)
+			}
+		},
+	}
+	err := p.route(rn)
+	// Lookups that fail are not fatal to the route, unless the reads of the index are stopped.
+	if stopped := idx.budget.err(); stopped != nil {
+		return stopped
+	}
+	return err
+}
+
+// route resolves the given route and sets the values of its extractors.
+func (p *processor) route(rn *RouteNode) error {
+	if isSymbolRoute(rn) {
+		return symbolResolver{budget: p.index.budget, ef: p.ef, variables: p.index.lookupVariable}.extract(rn)
+	}
+	if isFunctionRoute(rn) {
+		return p.extractLocations(rn)
+	}
+	if len(p.index.split) > 0 {
+		// The skeleton units have no types.
+		return p.routeSplit(rn)
+	}
+
+	entries, err := p.index.lookup(rn.Type)
+	if err == nil {
+		entries, err = p.inSources(entries, p.pin)
+	}
+	if err != nil {
+		// Not fatal, the fields are reported as missing.
+		for _, ex := range rn.Leaf().Extractors {
+			ex.fail(fmt.Errorf("failed to look up %s: %w", rn.Type, err))
+		}
+		return nil
+	}
+
+	if rn.IsLeaf() && hasOnlyEnumExtractors(rn) {
+		if entry, enum, ok := p.findEnumType(entries); ok {
+			if err := p.extractEnumerators(rn, entry, enum); err != nil {
+				return fmt.Errorf("failed to extract: %w", err)
+			}
+			return nil
+		}
+	}
 
-		if err := p.process(rn, entry, typ, 0); err != nil {
-			return fmt.Errorf("failed to process: %w", err)
+	entry, q, err := p.pick(rn.Type, entries)
+	if err != nil {
+		if alt := p.supplementary(); alt != nil {
+			// Only declared in the program, the definition has been moved to the supplementary file.
+			return alt.route(rn)
 		}
+		return fmt.Errorf("failed to find composite type (%s): %w", rn.Type, err)
+	}
+
+	typ, err := q.index.typeAt(entry.Offset)
+	if err != nil {
+		return fmt.Errorf("failed to get type: %w", err)
+	}
+
+	if err := q.process(rn, entry, typ, []int64{0}); err != nil {
+		return fmt.Errorf("failed to process: %w", err)
 	}
 	return nil
 }
 
-func (p *processor) process(rn *RouteNode, entry *dwarf.Entry, typ dwarf.Type, offset int64) error {
+// process walks the route starting from the given struct.
+// The chain holds the offsets of the pointers dereferenced so far,
+// its last element is the offset of the current struct in the last dereferenced one.
+func (p *processor) process(rn *RouteNode, entry *dwarf.Entry, typ dwarf.Type, chain []int64) error {
 	if rn == nil {
 		return nil
 	}
 
-	st := typ.(*dwarf.StructType)
+	// Intermediate members can be typedefs or qualified.
+	st, ok := underlyingType(typ).(*dwarf.StructType)
+	if !ok {
+		return fmt.Errorf("%s is not a struct, type: %s", rn.Type, typeString(typ))
+	}
 	if rn.IsLeaf() {
-		if err := p.extract(rn, entry, st, offset); err != nil {
+		if err := p.extract(rn, entry, st, chain); err != nil {
 			return fmt.Errorf("failed to extract: %w", err)
 		}
 		return nil
 	}
 
-	fields := map[string]*dwarf.StructField{}
-	for _, f := range st.Field {
-		fields[f.Name] = f
+	m, err := p.findMember(entry, st, rn.Next.Type, 0)
+	if err != nil {
+		return fmt.Errorf("failed to look up field %s in %s: %w", rn.Next.Type, rn.Type, err)
 	}
-
-	field, ok := fields[rn.Next.Type]
-	if !ok {
+	if m == nil {
 		return fmt.Errorf("field %s not found in %s", rn.Next.Type, rn.Type)
 	}
+	field := m.field
 
-	fieldEntry, err := p.findFieldEntry(entry, field.Name)
+	fieldEntry, err := m.entry()
 	if err != nil {
-		return fmt.Errorf("failed to find field (%s) entry: %w", field.Name, err)
+		return err
 	}
 
-	return p.process(rn.Next, fieldEntry, field.Type, offset+field.ByteOffset)
-}
+	// The type of the field can be in the supplementary file, q reads the file it is in.
+	typeEntry, q, err := m.p.underlyingTypeEntry(fieldEntry)
+	if err != nil {
+		return fmt.Errorf("failed to find type of field (%s): %w", field.Name, err)
+	}
 
-func (p *processor) extract(rn *RouteNode, entry *dwarf.Entry, st *dwarf.StructType, offset int64) error {
-	fields := map[string]*dwarf.StructField{}
-	for _, f := range st.Field {
-		fields[f.Name] = f
+	next := withOffset(chain, m.offset())
+	fieldType := field.Type
+	if len(rn.Next.Index) > 0 {
+		var indexOffset int64
+		fieldType, indexOffset, err = indexArray(fieldType, rn.Next.Index)
+		if err != nil {
+			return fmt.Errorf("failed to index field (%s): %w", field.Name, err)
+		}
+		next = withOffset(next, indexOffset)
+		// The dimensions of an array share the same element type entry,
+		// unless the element is itself a typedef of an array.
+		for i := 0; typeEntry.Tag == dwarf.TagArrayType; i++ {
+			if i == maxTypeDepth {
+				return fmt.Errorf("too many dimensions in the type of field (%s)", field.Name)
+			}
+			typeEntry, q, err = q.underlyingTypeEntry(typeEntry)
+			if err != nil {
+				return fmt.Errorf("failed to find element type of field (%s): %w", field.Name, err)
+			}
+		}
 	}
+	if rn.Next.Deref {
+		typeEntry, fieldType, q, err = q.pointee(typeEntry)
+		if err != nil {
+			return fmt.Errorf("failed to dereference field (%s): %w", field.Name, err)
+		}
+		next = append(next, 0)
+	}
+	return q.process(rn.Next, typeEntry, fieldType, next)
+}
+
+func (p *processor) extract(rn *RouteNode, entry *dwarf.Entry, st *dwarf.StructType, chain []int64) error {
 	for _, ex := range rn.Extractors {
-		if ex.Op == OpSizeOf {
-			if ex.Source == rn.Type {
-				if err := ex.Set(int64(st.Size())); err != nil {
-					return fmt.Errorf("failed to set size: %w", err)
-				}
+		if err := p.extractOne(rn, entry, st, ex, chain); err != nil {
+			if ex.optional() {
+				ex.fail(err)
 				continue
 			}
+			return err
+		}
+		ex.resolvedAt(entry.Offset)
+	}
+	return nil
+}
+
+func (p *processor) extractOne(rn *RouteNode, entry *dwarf.Entry, st *dwarf.StructType, ex *Extractor, chain []int64) error {
+	if ex.inspect != nil {
+		return ex.inspect(p.composite(entry, st))
+	}
 
-			field, ok := fields[ex.Source]
-			if !ok {
-				return fmt.Errorf("field %s not found in %s", ex.Source, rn.Type)
+	if ex.Op == OpSizeOf && ex.Source == rn.Type {
+		if err := ex.Set(int64(st.Size())); err != nil {
+			return fmt.Errorf("failed to set size: %w", err)
+		}
+		return nil
+	}
+
+	if ex.Op == OpOffsetOf && ex.Static {
+		// Static members are not always defined, the field is reported as missing instead.
+		if err := p.extractStatic(entry, st, ex); err != nil {
+			if ex.optional() {
+				return err
 			}
-			if err := ex.Set(int64(field.Type.Size())); err != nil {
-				return fmt.Errorf("failed to set size: %w", err)
+			ex.fail(err)
+		}
+		return nil
+	}
+
+	if ex.Op == OpEnumValue {
+		// Enumerations can be nested in C++ classes.
+		val, err := p.nestedEnumValue(entry, ex.Source)
+		if err != nil {
+			return fmt.Errorf("failed to find enumerator %s in %s: %w", ex.Source, rn.Type, err)
+		}
+		if err := ex.Set(val); err != nil {
+			return fmt.Errorf("failed to set enumerator value: %w", err)
+		}
+		return nil
+	}
+
+	m, err := p.findMember(entry, st, ex.Source, 0)
+	if err != nil {
+		return fmt.Errorf("failed to look up field %s in %s: %w", ex.Source, rn.Type, err)
+	}
+	if m == nil {
+		return fmt.Errorf("field %s not found in %s", ex.Source, rn.Type)
+	}
+	field := *m.field
+	field.ByteOffset = m.offset()
+	return extractField(ex, &field, chain, func(*dwarf.StructField) (int64, error) {
+		fieldEntry, err := m.entry()
+		if err != nil {
+			return 0, err
+		}
+		return bitOffset(fieldEntry, m.field, p.ef.ByteOrder) + m.base*8, nil
+	})
+}
+
+// extractField applies the extractor to the given member of a struct.
+// The bit offset of the member, bitfields included, is read with the given function.
+func extractField(ex *Extractor, field *dwarf.StructField, chain []int64, bitOffsetOf func(*dwarf.StructField) (int64, error)) error {
+	typ, indexOffset, err := indexArray(field.Type, ex.Index)
+	if err != nil {
+		return fmt.Errorf("failed to index field (%s): %w", field.Name, err)
+	}
+
+	switch ex.Op {
+	case OpOffsetOf:
+		if err := ex.SetChain(withOffset(chain, field.ByteOffset+indexOffset)); err != nil {
+			return fmt.Errorf("failed to set offset: %w", err)
+		}
+	case OpSizeOf:
+		if err := ex.Set(sizeOf(typ)); err != nil {
+			return fmt.Errorf("failed to set size: %w", err)
+		}
+	case OpLengthOf, OpStrideOf:
+		at, ok := typ.(*dwarf.ArrayType)
+		if !ok {
+			return fmt.Errorf("field %s is not an array, type: %s", field.Name, typeString(typ))
+		}
+		val := at.Count
+		if ex.Op == OpStrideOf {
+			val = arrayStride(at)
+		}
+		if err := ex.Set(val); err != nil {
+			return fmt.Errorf("failed to set %s: %w", ex.Op, err)
+		}
+	case OpBitOffsetOf:
+		// The last step of the chain is in bits.
+		bits := withOffset(chain, 0)
+		if len(ex.Index) > 0 {
+			bits[len(bits)-1] = (bits[len(bits)-1] + field.ByteOffset + indexOffset) * 8
+		} else {
+			off, err := bitOffsetOf(field)
+			if err != nil {
+				return err
 			}
+			bits[len(bits)-1] = bits[len(bits)-1]*8 + off
+		}
+		if err := ex.SetChain(bits); err != nil {
+			return fmt.Errorf("failed to set bit offset: %w", err)
+		}
+	case OpBitSizeOf:
+		size := bitSize(field)
+		if len(ex.Index) > 0 {
+			size = sizeOf(typ) * 8
+		}
+		if err := ex.Set(size); err != nil {
+			return fmt.Errorf("failed to set bit size: %w", err)
 		}
+	}
+	return nil
+}
 
-		if ex.Op == OpOffsetOf {
-			if ex.Static {
-				_ = p.extractStatic(entry, st, ex)
-				continue
+// indexArray applies the given indexes to the array type,
+// and returns the type of the element and its offset in the array.
+func indexArray(typ dwarf.Type, index []int) (dwarf.Type, int64, error) {
+	var offset int64
+	for _, i := range index {
+		at, ok := underlyingType(typ).(*dwarf.ArrayType)
+		if !ok {
+			return nil, 0, fmt.Errorf("not an array, type: %s", typeString(typ))
+		}
+		// Flexible array members have no upper bound.
+		if at.Count > 0 && int64(i) >= at.Count {
+			return nil, 0, fmt.Errorf("index %d out of bounds, array has %d elements", i, at.Count)
+		}
+		offset += int64(i) * arrayStride(at)
+		typ = at.Type
+	}
+	return underlyingType(typ), offset, nil
+}
+
+// arrayStride returns the distance between two elements of the array in bytes.
+func arrayStride(at *dwarf.ArrayType) int64 {
+	if at.StrideBitSize > 0 {
+		return at.StrideBitSize / 8
+	}
+	return sizeOf(at.Type)
+}
+
+// maxTypeDepth bounds the number of typedefs, qualifiers and array dimensions followed through,
+// malformed DWARF data can describe types that refer to themselves.
+const maxTypeDepth = 64
+
+// underlyingType follows the given type through typedefs and qualifiers.
+// A chain that is too long, or a cycle, is not followed to its end,
+// the returned type is then a typedef or a qualified type.
+func underlyingType(typ dwarf.Type) dwarf.Type {
+	for i := 0; i < maxTypeDepth; i++ {
+		switch t := typ.(type) {
+		case *dwarf.TypedefType:
+			typ = t.Type
+		case *dwarf.QualType:
+			typ = t.Type
+		default:
+			return typ
+		}
+	}
+	return typ
+}
+
+// sizeOf returns the size of the given type in bytes, like its Size method,
+// without following cycles. The size of a type that is part of a cycle is 0.
+func sizeOf(typ dwarf.Type) int64 {
+	count := int64(1)
+	for i := 0; i < maxTypeDepth; i++ {
+		switch t := typ.(type) {
+		case nil:
+			return 0
+		case *dwarf.TypedefType:
+			typ = t.Type
+		case *dwarf.QualType:
+			typ = t.Type
+		case *dwarf.ArrayType:
+			if t.Count < 0 {
+				return 0
 			}
+			count *= t.Count
+			typ = t.Type
+		default:
+			return count * typ.Size()
+		}
+	}
+	return 0
+}
+
+// typeString describes the given type in error messages, like its String method,
+// without following cycles or listing the members of anonymous structs.
+func typeString(typ dwarf.Type) string {
+	var (
+		prefix, suffix string
+	)
+	for i := 0; i < maxTypeDepth; i++ {
+		switch t := typ.(type) {
+		case nil:
+			return prefix + "<nil>" + suffix
+		case *dwarf.TypedefType:
+			return prefix + t.Name + suffix
+		case *dwarf.QualType:
+			prefix += t.Qual + " "
+			typ = t.Type
+		case *dwarf.PtrType:
+			suffix = " *" + suffix
+			typ = t.Type
+		case *dwarf.ArrayType:
+			suffix += fmt.Sprintf("[%d]", t.Count)
+			typ = t.Type
+		case *dwarf.StructType:
+			if t.StructName == "" {
+				return prefix + t.Kind + " {...}" + suffix
+			}
+			return prefix + t.Kind + " " + t.StructName + suffix
+		case *dwarf.EnumType:
+			if t.EnumName == "" {
+				return prefix + "enum {...}" + suffix
+			}
+			return prefix + "enum " + t.EnumName + suffix
+		case *dwarf.FuncType:
+			return prefix + "func" + suffix
+		default:
+			return prefix + typ.String() + suffix
+		}
+	}
+	return prefix + "..." + suffix
+}
+
+func hasOnlyOptionalExtractors(rn *RouteNode) bool {
+	for _, ex := range rn.Extractors {
+		if !ex.optional() {
+			return false
+		}
+	}
+	return true
+}
+
+func hasOnlyEnumExtractors(rn *RouteNode) bool {
+	for _, ex := range rn.Extractors {
+		if ex.Op != OpEnumValue {
+			return false
+		}
+	}
+	return len(rn.Extractors) > 0
+}
 
-			field, ok := fields[ex.Source]
-			if !ok {
-				return fmt.Errorf("field %s not found in %s", ex.Source, rn.Type)
+// findEnumType finds the enumeration type in the given entries, following typedefs.
+func (p *processor) findEnumType(entries []*dwarf.Entry) (*dwarf.Entry, *dwarf.EnumType, bool) {
+	for _, entry := range entries {
+		q := p
+		if entry.Tag == dwarf.TagTypedef {
+			var err error
+			entry, q, err = p.underlyingTypeEntry(entry)
+			if err != nil {
+				continue
 			}
+		}
+		if entry.Tag != dwarf.TagEnumerationType || !entry.Children || isDeclaration(entry) {
+			continue
+		}
+		typ, err := q.index.typeAt(entry.Offset)
+		if err != nil {
+			continue
+		}
+		if enum, ok := typ.(*dwarf.EnumType); ok {
+			return entry, enum, true
+		}
+	}
+	return nil, nil, false
+}
 
-			if err := ex.Set(int64(offset + field.ByteOffset)); err != nil {
-				return fmt.Errorf("failed to set offset: %w", err)
+func (p *processor) extractEnumerators(rn *RouteNode, entry *dwarf.Entry, enum *dwarf.EnumType) error {
+	for _, ex := range rn.Extractors {
+		val, ok := enumValue(enum, ex.Source)
+		if !ok {
+			err := fmt.Errorf("enumerator %s not found in %s", ex.Source, rn.Type)
+			if ex.optional() {
+				ex.fail(err)
+				continue
 			}
+			return err
+		}
+		if err := ex.Set(val); err != nil {
+			return fmt.Errorf("failed to set enumerator value: %w", err)
 		}
+		ex.resolvedAt(entry.Offset)
 	}
 	return nil
 }
 
+// nestedEnumValue looks up the enumerator in the enumerations that are direct children of the given entry.
+func (p *processor) nestedEnumValue(entry *dwarf.Entry, name string) (int64, error) {
+	r := p.index.reader()
+	r.Seek(entry.Offset)
+	if _, err := r.Next(); err != nil {
+		return 0, err
+	}
+	for {
+		child, err := r.Next()
+		if err != nil {
+			return 0, err
+		}
+		if child == nil || child.Tag == 0 {
+			break
+		}
+		if child.Children {
+			r.SkipChildren()
+		}
+		if child.Tag != dwarf.TagEnumerationType {
+			continue
+		}
+		typ, err := p.index.typeAt(child.Offset)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get type: %w", err)
+		}
+		enum, ok := typ.(*dwarf.EnumType)
+		if !ok {
+			continue
+		}
+		if val, ok := enumValue(enum, name); ok {
+			return val, nil
+		}
+	}
+	return 0, errors.New("not found")
+}
+
+func enumValue(enum *dwarf.EnumType, name string) (int64, bool) {
+	for _, v := range enum.Val {
+		if v.Name == name {
+			return v.Val, true
+		}
+	}
+	return 0, false
+}
+
+// bitOffset returns the offset of the given member from the start of its struct in bits.
+func bitOffset(member *dwarf.Entry, field *dwarf.StructField, order binary.ByteOrder) int64 {
+	if dataBitOffset, ok := member.Val(dwarf.AttrDataBitOffset).(int64); ok {
+		// DWARF 4 and later: the offset is relative to the start of the struct.
+		return dataBitOffset
+	}
+	if bitOffset, ok := member.Val(dwarf.AttrBitOffset).(int64); ok {
+		// DWARF 2 and 3: the offset is relative to the most significant bit
+		// of the storage unit that contains the bitfield.
+		storageSize := field.ByteSize
+		if storageSize == 0 {
+			storageSize = sizeOf(field.Type)
+		}
+		if order == binary.BigEndian {
+			return field.ByteOffset*8 + bitOffset
+		}
+		return field.ByteOffset*8 + storageSize*8 - bitOffset - field.BitSize
+	}
+	return field.ByteOffset * 8
+}
+
+// bitSize returns the size of the given member in bits.
+func bitSize(field *dwarf.StructField) int64 {
+	if field.BitSize != 0 {
+		return field.BitSize
+	}
+	return sizeOf(field.Type) * 8
+}
+
+// withOffset returns a copy of the chain with the given offset added to its last step.
+func withOffset(chain []int64, offset int64) []int64 {
+	next := make([]int64, len(chain))
+	copy(next, chain)
+	next[len(next)-1] += offset
+	return next
+}
+
 func (p *processor) extractStatic(entry *dwarf.Entry, st *dwarf.StructType, ex *Extractor) error {
 	name := ex.Source
 	fieldEntry, err := p.findFieldEntry(entry, name)
 	if err != nil {
 		return fmt.Errorf("failed to find field (%s.%s) entry: %w", st.StructName, name, err)
 	}
-	attributes := attrs(fieldEntry)
-	linkageNameAttr, ok := attributes[dwarf.AttrLinkageName]
+	linkageName, ok := p.index.stringAttr(fieldEntry, dwarf.AttrLinkageName)
 	if !ok {
 		return fmt.Errorf("no linkage name attribute for %s", name)
 	}
 
-	linkageName := linkageNameAttr.(string)
-	sym, err := symbols.FindSymbol(p.ef, linkageName)
+	sym, err := symbols.FindSymbolContext(p.index.budget.ctx, p.ef, linkageName, symbols.WithBudget(p.index.budget))
 	if err != nil {
 		return fmt.Errorf("failed to find symbol (%s): %w", linkageName, err)
 	}
@@ -142,92 +718,200 @@ func (p *processor) extractStatic(entry *dwarf.Entry, st *dwarf.StructType, ex *
 }
 
 func isCompositeType(entry *dwarf.Entry) bool {
-	return entry.Tag == dwarf.TagStructType || entry.Tag == dwarf.TagClassType
+	return entry.Tag == dwarf.TagStructType || entry.Tag == dwarf.TagClassType || entry.Tag == dwarf.TagUnionType
 }
 
 func isDeclaration(entry *dwarf.Entry) bool {
-	attributes := attrs(entry)
-	_, ok := attributes[dwarf.AttrDeclaration]
-	return ok
+	return entry.AttrField(dwarf.AttrDeclaration) != nil
 }
 
 type processor struct {
 	ef        *elf.File
 	dwarfData *dwarf.Data
+	index     *TypeIndex
+	// pin is the pattern the compilation units or the source files of the definitions must match, if any.
+	pin string
+	// conflict records the types that have different definitions, if set.
+	conflict func(Conflict)
 }
 
-// findCompositeTypeEntries finds the entries with the given name in the DWARF data.
-func (p *processor) findCompositeTypeEntries(name string) ([]*dwarf.Entry, error) {
-	entries := []*dwarf.Entry{}
-	entryReader := p.dwarfData.Reader()
-	for {
-		entry, err := entryReader.Next()
-		if err == io.EOF || entry == nil {
-			break
-		}
+// supplementary returns the processor of the supplementary file of the index, if any.
+// Symbols are still looked up in the ELF file.
+func (p *processor) supplementary() *processor {
+	if p.index.alt == nil {
+		return nil
+	}
+	return &processor{
+		ef:        p.ef,
+		dwarfData: p.index.alt.dwarfData,
+		index:     p.index.alt,
+		pin:       p.pin,
+		conflict:  p.conflict,
+	}
+}
 
-		if err != nil {
-			return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
-		}
+// pick returns the definition of the type with the given name among the given entries,
+// along with the processor of the file it is in, as described by choose.
+func (p *processor) pick(name string, entries []*dwarf.Entry) (*dwarf.Entry, *processor, error) {
+	defs, err := p.candidates(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.choose(name, defs)
+}
 
-		if !isCompositeType(entry) && entry.Tag != dwarf.TagTypedef {
-			continue
+// choose returns the first of the given definitions of the type with the given name,
+// along with the processor of the file it is in, and records the ones with a different layout as a conflict.
+func (p *processor) choose(name string, defs []candidate) (*dwarf.Entry, *processor, error) {
+	if len(defs) == 0 {
+		if p.pin != "" {
+			return nil, nil, fmt.Errorf("no composite(struct|class|union) type found in units or files matching %s", p.pin)
 		}
-
-		attributes := attrs(entry)
-		val, ok := attributes[dwarf.AttrName]
-		if !ok {
-			continue
+		return nil, nil, errors.New("no composite(struct|class|union) type found")
+	}
+	if p.conflict != nil {
+		c, err := conflicts(name, defs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to compare definitions of %s: %w", name, err)
 		}
-
-		if val.(string) != name {
-			continue
+		if c != nil {
+			p.conflict(*c)
 		}
-
-		entries = append(entries, entry)
 	}
-	return entries, nil
+	return defs[0].entry, defs[0].p, nil
 }
 
-// findActionableEntry finds the composite type in the given entries.
-func (p *processor) findActionableEntry(entries []*dwarf.Entry) (*dwarf.Entry, error) {
+// candidates returns the definitions of composite types among the given entries, following typedefs.
+func (p *processor) candidates(entries []*dwarf.Entry) ([]candidate, error) {
+	defs := []candidate{}
 	for _, entry := range entries {
 		if isCompositeType(entry) {
-			// fast path.
-			if !entry.Children {
-				continue
-			}
-			if isDeclaration(entry) {
+			if !entry.Children || isDeclaration(entry) {
 				continue
 			}
-			return entry, nil
+			defs = append(defs, candidate{entry: entry, p: p})
+			continue
 		}
 
-		typeEntry, err := typeOf(p.dwarfData, entry)
+		// Typedefs can refer to other typedefs, or to qualified types.
+		typeEntry, q, err := p.underlyingTypeEntry(entry)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get type: %w", err)
 		}
-
-		if !isCompositeType(typeEntry) {
+		if !isCompositeType(typeEntry) || !typeEntry.Children || isDeclaration(typeEntry) {
 			continue
 		}
+		defs = append(defs, candidate{entry: typeEntry, p: q})
+	}
+	return defs, nil
+}
 
-		if !typeEntry.Children {
-			continue
+// underlyingTypeEntry follows the type of the given entry through typedefs and qualifiers.
+// It returns the processor of the file the type is in.
+func (p *processor) underlyingTypeEntry(entry *dwarf.Entry) (*dwarf.Entry, *processor, error) {
+	typeEntry, q, err := p.typeOf(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := 0; i < maxTypeDepth; i++ {
+		switch typeEntry.Tag {
+		case dwarf.TagTypedef, dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType, dwarf.TagAtomicType:
+			typeEntry, q, err = q.typeOf(typeEntry)
+			if err != nil {
+				return nil, nil, err
+			}
+		default:
+			return typeEntry, q, nil
 		}
+	}
+	return nil, nil, fmt.Errorf("too many typedefs and qualifiers in the type of (%s)", p.index.nameOf(entry))
+}
 
-		if isDeclaration(typeEntry) {
-			continue
+// pointee follows the given pointer type entry to the definition of the struct it points to.
+// It returns the processor of the file the definition is in.
+func (p *processor) pointee(ptrEntry *dwarf.Entry) (*dwarf.Entry, dwarf.Type, *processor, error) {
+	if ptrEntry.Tag != dwarf.TagPointerType {
+		return nil, nil, nil, fmt.Errorf("not a pointer, tag: %s", ptrEntry.Tag)
+	}
+	entry, q, err := p.underlyingTypeEntry(ptrEntry)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !isCompositeType(entry) {
+		return nil, nil, nil, fmt.Errorf("pointer to a non-composite type, tag: %s", entry.Tag)
+	}
+	if isDeclaration(entry) || !entry.Children {
+		// The struct is only declared in this compilation unit, look up its definition.
+		if entry, q, err = q.definition(entry); err != nil {
+			return nil, nil, nil, err
 		}
+	}
+	typ, err := q.index.typeAt(entry.Offset)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get type: %w", err)
+	}
+	return entry, typ, q, nil
+}
 
-		return typeEntry, nil
+// definition looks up the definition of the given declared struct,
+// in the supplementary file as well when it has not been found.
+func (p *processor) definition(decl *dwarf.Entry) (*dwarf.Entry, *processor, error) {
+	// Same-named structs in other namespaces are not candidates.
+	name, err := p.index.qualifiedNameOf(decl)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := p.index.lookup(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		// The definition is out of the scope of the declaration, e.g. declared in a function.
+		name = p.index.nameOf(decl)
+		if entries, err = p.index.lookup(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if entries, err = p.inSources(entries, p.pin); err != nil {
+		return nil, nil, err
+	}
+	entry, q, err := p.pick(name, entries)
+	if err == nil {
+		return entry, q, nil
+	}
+	if p.index.skeleton != nil {
+		// Only declared in this split unit, defined in another one.
+		defs, err := p.splitCandidates(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry, q, err = p.choose(name, defs); err != nil {
+			return nil, nil, fmt.Errorf("failed to find composite type (%s): %w", name, err)
+		}
+		return entry, q, nil
+	}
+	alt := p.supplementary()
+	if alt == nil {
+		return nil, nil, fmt.Errorf("failed to find composite type (%s): %w", name, err)
+	}
+	if entries, err = alt.index.lookup(name); err != nil {
+		return nil, nil, err
+	}
+	if entries, err = alt.inSources(entries, alt.pin); err != nil {
+		return nil, nil, err
 	}
-	return nil, errors.New("no composite(struct|class) type found")
+	if entry, q, err = alt.pick(name, entries); err != nil {
+		return nil, nil, fmt.Errorf("failed to find composite type (%s): %w", name, err)
+	}
+	return entry, q, nil
 }
 
 func (p *processor) findFieldEntry(entry *dwarf.Entry, name string) (*dwarf.Entry, error) {
-	entryReader := p.dwarfData.Reader()
+	entryReader := p.index.reader()
 	entryReader.Seek(entry.Offset)
+	if _, err := entryReader.Next(); err != nil {
+		return nil, err
+	}
 	for {
 		entry, err := entryReader.Next()
 		if err != nil {
@@ -243,13 +927,12 @@ func (p *processor) findFieldEntry(entry *dwarf.Entry, name string) (*dwarf.Entr
 			break
 		}
 
-		attributes := attrs(entry)
-		nameAttr, ok := attributes[dwarf.AttrName]
-		if !ok {
-			continue
+		if entry.Children {
+			// Nested type definitions have their own members.
+			entryReader.SkipChildren()
 		}
 
-		fieldName := nameAttr.(string)
+		fieldName := p.index.nameOf(entry)
 		if len(fieldName) == 0 {
 			continue
 		}
@@ -263,38 +946,41 @@ func (p *processor) findFieldEntry(entry *dwarf.Entry, name string) (*dwarf.Entr
 	return nil, errors.New("not found")
 }
 
-// Helpers:
-
-func attrs(entry *dwarf.Entry) map[dwarf.Attr]any {
-	attrs := map[dwarf.Attr]any{}
-	for f := range entry.Field {
-		if _, ok := attrs[entry.Field[f].Attr]; ok {
-			panic(fmt.Sprintf("duplicate attribute: %s", entry.Field[f].Attr))
-		}
-		attrs[entry.Field[f].Attr] = entry.Field[f].Val
+// typeOf reads the entry of the type of the given entry.
+// It returns the processor of the file the type is in,
+// which is the supplementary file when the type has been moved there.
+func (p *processor) typeOf(entry *dwarf.Entry) (*dwarf.Entry, *processor, error) {
+	field := entry.AttrField(dwarf.AttrType)
+	if field == nil {
+		return nil, nil, fmt.Errorf("no type attribute found for (%s)", p.index.nameOf(entry))
 	}
-	return attrs
-}
-
-func nameAttr(attrs map[dwarf.Attr]any) string {
-	nameAttr, ok := attrs[dwarf.AttrName]
-	if !ok {
-		return ""
-	}
-	return nameAttr.(string)
-}
-
-func typeOf(dwarfData *dwarf.Data, entry *dwarf.Entry) (*dwarf.Entry, error) {
-	attrs := attrs(entry)
-	typeAttr, ok := attrs[dwarf.AttrType]
-	if !ok {
-		return nil, fmt.Errorf("no type attribute found for (%s)", nameAttr(attrs))
+	q := p
+	var off dwarf.Offset
+	switch ref := field.Val.(type) {
+	case dwarf.Offset:
+		off = ref
+	case int64:
+		if field.Class != dwarf.ClassReferenceAlt {
+			return nil, nil, fmt.Errorf("%w: unexpected type attribute class for (%s): %s", ErrMalformed, p.index.nameOf(entry), field.Class)
+		}
+		if q = p.supplementary(); q == nil {
+			if p.index.altErr != nil {
+				return nil, nil, fmt.Errorf("type of (%s) is in the supplementary file: %w", p.index.nameOf(entry), p.index.altErr)
+			}
+			return nil, nil, fmt.Errorf("type of (%s) is in the supplementary file, which is not loaded", p.index.nameOf(entry))
+		}
+		off = dwarf.Offset(ref)
+	default:
+		return nil, nil, fmt.Errorf("%w: unexpected type attribute for (%s): %v", ErrMalformed, p.index.nameOf(entry), field.Val)
 	}
-	typeReader := dwarfData.Reader()
-	typeReader.Seek(typeAttr.(dwarf.Offset))
+	typeReader := q.index.reader()
+	typeReader.Seek(off)
 	typeEntry, err := typeReader.Next()
 	if err != nil {
-		return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		return nil, nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	if typeEntry == nil {
+		return nil, nil, fmt.Errorf("%w: type of (%s) at %#x not found", ErrMalformed, p.index.nameOf(entry), off)
 	}
-	return typeEntry, nil
+	return typeEntry, q, nil
 }
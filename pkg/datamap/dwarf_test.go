@@ -1,12 +1,25 @@
 package datamap
 
 import (
+	"bytes"
+	"context"
+	"debug/dwarf"
 	"debug/elf"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/parca-dev/runtime-data/pkg/symbols"
 )
 
 func arch() string {
@@ -93,3 +106,1671 @@ func TestDataMap_ReadFromDWARF(t *testing.T) {
 		})
 	}
 }
+
+type chainMap struct {
+	MainThreadCFP []int64 `offsetof:"vm.ractor.main_thread*.ec*.cfp"`
+	ThreadState   [2]int  `offsetof:"vm.threads*.state"`
+	ThreadEC      int64   `offsetof:"thread.ec"`
+	ECSize        int64   `sizeof:"vm.threads*.ec"`
+}
+
+type bitfieldMap struct {
+	KindOffset    int64   `bitoffsetof:"ascii_object.state.kind"`
+	KindSize      int64   `bitsizeof:"ascii_object.state.kind"`
+	CompactOffset int64   `bitoffsetof:"ascii_object.state.compact"`
+	ModeOffset    int64   `bitoffsetof:"ascii_object.mode"`
+	ModeSize      int64   `bitsizeof:"ascii_object.mode"`
+	HashOffset    int64   `bitoffsetof:"ascii_object.hash"`
+	HashSize      int64   `bitsizeof:"ascii_object.hash"`
+	ThreadState   []int64 `bitoffsetof:"vm.threads*.state"`
+}
+
+var wantBitfieldMap = &bitfieldMap{
+	KindOffset:    258,
+	KindSize:      3,
+	CompactOffset: 261,
+	ModeOffset:    292,
+	ModeSize:      7,
+	HashOffset:    192,
+	HashSize:      64,
+	ThreadState:   []int64{24, 64},
+}
+
+type enumMap struct {
+	OwnedByThread int64  `enumval:"frame_owner.FRAME_OWNED_BY_THREAD"`
+	OwnedByCStack int64  `enumval:"frame_owner.FRAME_OWNED_BY_CSTACK"`
+	MagicBlock    uint32 `enumval:"vm_frame_magic.VM_FRAME_MAGIC_BLOCK"`
+}
+
+// The enumerators of lock_state and object_id are signed, the ones of frame_flags are not.
+type signedEnumMap struct {
+	LockReleased int64  `enumval:"lock_state.LOCK_RELEASED"`
+	FlagFinish   int64  `enumval:"frame_flags.FRAME_FLAG_FINISH"`
+	FlagMask     uint32 `enumval:"frame_flags.FRAME_FLAG_MASK"`
+	ObjectIDMin  int64  `enumval:"object_id.OBJECT_ID_MIN"`
+	ObjectIDMax  int64  `enumval:"object_id.OBJECT_ID_MAX"`
+}
+
+var wantSignedEnumMap = &signedEnumMap{
+	LockReleased: -1,
+	FlagFinish:   0x80000000,
+	FlagMask:     0xffffffff,
+	ObjectIDMin:  -0x100000000,
+	ObjectIDMax:  0x100000000,
+}
+
+type arrayMap struct {
+	SpecificData   int64   `offsetof:"runtime.specific_1stblock[2].data"`
+	SpecificLength int64   `lengthof:"runtime.specific_1stblock"`
+	SpecificStride int64   `strideof:"runtime.specific_1stblock"`
+	BlockSeq       int64   `offsetof:"runtime.blocks[1][2].seq"`
+	BlockLength    int64   `lengthof:"runtime.blocks[1]"`
+	FrameSlot      int64   `offsetof:"runtime.frames[2]"`
+	FramePrev      []int64 `offsetof:"runtime.frames[1]*.prev"`
+	ContextCFP     int64   `offsetof:"runtime.contexts[1].cfp"`
+	ContextsSize   int64   `sizeof:"runtime.contexts"`
+	ContextSize    int64   `sizeof:"runtime.contexts[1]"`
+	NameLength     int64   `lengthof:"runtime.name"`
+}
+
+type nestedEnumMap struct {
+	SenderSP int64 `enumval:"frame.interpreter_frame_sender_sp_offset"`
+	LastSP   int64 `enumval:"frame.interpreter_frame_last_sp_offset"`
+	Walkable int64 `enumval:"frame_state.walkable"`
+	SP       int64 `offsetof:"frame._sp"`
+}
+
+// nestedMap is shaped like a public layout, with nested structs and arrays of structs.
+type nestedMap struct {
+	ExecutionContext struct {
+		Stack     int64 `offsetof:"execution_context.stack"`
+		StackSize int64 `offsetof:"execution_context.stack_size"`
+		Size      int64 `sizeof:"execution_context"`
+	}
+	Contexts [2]struct {
+		CFP int64 `offsetof:"runtime.contexts[#].cfp"`
+	}
+	Frames [3]struct {
+		Prev []int64 `offsetof:"runtime.frames[#]*.prev"`
+	}
+}
+
+var wantNestedMap = func() *nestedMap {
+	want := &nestedMap{}
+	want.ExecutionContext.StackSize = 8
+	want.ExecutionContext.Size = 24
+	want.Contexts[0].CFP = 688
+	want.Contexts[1].CFP = 712
+	want.Frames[0].Prev = []int64{648, 8}
+	want.Frames[1].Prev = []int64{656, 8}
+	want.Frames[2].Prev = []int64{664, 8}
+	return want
+}()
+
+func TestDataMap_ReadFromDWARFRoutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputPath string
+		lm        any
+		want      any
+		wantErr   bool
+	}{
+		{
+			name: "pointer dereference",
+			lm:   &chainMap{},
+			want: &chainMap{
+				MainThreadCFP: []int64{8, 16, 16},
+				ThreadState:   [2]int{24, 8},
+				ThreadEC:      16,
+				ECSize:        8,
+			},
+		},
+		{
+			name: "bitfields",
+			lm:   &bitfieldMap{},
+			want: wantBitfieldMap,
+		},
+		{
+			name: "nested structs and arrays of structs",
+			lm:   &nestedMap{},
+			want: wantNestedMap,
+		},
+		{
+			name:      "bitfields with DW_AT_bit_offset",
+			inputPath: "testdata/x86_64/routes-dwarf2",
+			lm:        &bitfieldMap{},
+			want:      wantBitfieldMap,
+		},
+		{
+			name: "enumerators",
+			lm:   &enumMap{},
+			want: &enumMap{
+				OwnedByThread: 0,
+				OwnedByCStack: 3,
+				MagicBlock:    0x22220001,
+			},
+		},
+		{
+			name:      "signed and unsigned enumerators",
+			inputPath: "testdata/x86_64/routes",
+			lm:        &signedEnumMap{},
+			want:      wantSignedEnumMap,
+		},
+		{
+			name:      "enumerators nested in a class",
+			inputPath: "testdata/x86_64/classes",
+			lm:        &nestedEnumMap{},
+			want: &nestedEnumMap{
+				SenderSP: -1,
+				LastSP:   -2,
+				Walkable: 1,
+				SP:       0,
+			},
+		},
+		{
+			name: "arrays",
+			lm:   &arrayMap{},
+			want: &arrayMap{
+				SpecificData:   48,
+				SpecificLength: 32,
+				SpecificStride: 16,
+				BlockSeq:       616,
+				BlockLength:    4,
+				FrameSlot:      664,
+				FramePrev:      []int64{656, 8},
+				ContextCFP:     712,
+				ContextsSize:   48,
+				ContextSize:    24,
+				NameLength:     0,
+			},
+		},
+		{
+			name: "anonymous members",
+			lm:   &anonymousMap{},
+			want: wantAnonymousMap,
+		},
+		{
+			name:      "anonymous members with DW_AT_bit_offset",
+			inputPath: "testdata/x86_64/routes-dwarf2",
+			lm:        &anonymousMap{},
+			want:      wantAnonymousMap,
+		},
+		{
+			name: "member of a scalar",
+			lm: &struct {
+				A int64 `offsetof:"interpreter.id.value"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "index out of bounds",
+			lm: &struct {
+				A int64 `offsetof:"runtime.frames[3]"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "length of a non-array",
+			lm: &struct {
+				A int64 `lengthof:"runtime.flags"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "missing enumerator",
+			lm: &struct {
+				A int64 `enumval:"frame_owner.FRAME_OWNED_BY_INTERPRETER"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "dereference a non-pointer",
+			lm: &struct {
+				A []int64 `offsetof:"vm.ractor*.count"`
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := New(tt.lm)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+
+			input := tt.inputPath
+			if input == "" {
+				input = "testdata/x86_64/routes"
+			}
+			ef, err := elf.Open(input)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+
+			err = dm.ReadFromDWARF(ef)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFromDWARF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, tt.lm); diff != "" {
+				t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// anonymousMap addresses members of anonymous structs and unions,
+// through typedef and qualified intermediates.
+type anonymousMap struct {
+	State         int64   `offsetof:"interpreter.state"`
+	Daemon        int64   `bitoffsetof:"interpreter.daemon"`
+	DaemonSize    int64   `bitsizeof:"interpreter.daemon"`
+	PaddingSize   int64   `sizeof:"interpreter.padding"`
+	CevalSize     int64   `offsetof:"interpreter.ceval.stack_size"`
+	CurrentCFP    []int64 `offsetof:"interpreter.current.ec*.cfp"`
+	TopFramePrev  []int64 `offsetof:"interpreter.top_frame*.prev"`
+	ThreadsCount  int64   `offsetof:"interpreter.threads.count"`
+	Size          int64   `sizeof:"interpreter_alias_t"`
+	SlotFrame     int64   `offsetof:"slot.frame"`
+	SlotSize      int64   `sizeof:"slot"`
+	AliasThreadID int64   `offsetof:"interpreter_alias_t.current.id"`
+}
+
+var wantAnonymousMap = &anonymousMap{
+	State:         8,
+	Daemon:        97,
+	DaemonSize:    1,
+	PaddingSize:   16,
+	CevalSize:     32,
+	CurrentCFP:    []int64{64, 16},
+	TopFramePrev:  []int64{72, 8},
+	ThreadsCount:  80,
+	Size:          88,
+	SlotFrame:     0,
+	SlotSize:      8,
+	AliasThreadID: 48,
+}
+
+type alternativeMap struct {
+	Count       int64   `offsetof:"vm.ractors.count|vm.ractor.count"`
+	ID          int64   `offsetof:"thread.id|thread.tid"`
+	MainEC      []int64 `offsetof:"vm.ractor*.count|vm.ractor.main_thread*.ec"`
+	ThreadsHead int64   `offsetof:"PyInterpreterState.threads.head|vm.threads"`
+}
+
+func TestDataMap_ReadFromDWARFAlternatives(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	m := &alternativeMap{}
+	dm, err := New(m)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromDWARF(ef); err != nil {
+		t.Fatalf("ReadFromDWARF() error = %v", err)
+	}
+
+	want := &alternativeMap{
+		Count:       16,
+		ID:          0,
+		MainEC:      []int64{8, 16},
+		ThreadsHead: 24,
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+	}
+
+	wantMatches := []Match{
+		{Field: "Count", Alternatives: []string{"vm.ractors.count", "vm.ractor.count"}, Route: "vm.ractor.count"},
+		{Field: "ID", Alternatives: []string{"thread.id", "thread.tid"}, Route: "thread.id"},
+		{Field: "MainEC", Alternatives: []string{"vm.ractor*.count", "vm.ractor.main_thread*.ec"}, Route: "vm.ractor.main_thread*.ec"},
+		{Field: "ThreadsHead", Alternatives: []string{"PyInterpreterState.threads.head", "vm.threads"}, Route: "vm.threads"},
+	}
+	if diff := cmp.Diff(wantMatches, dm.Matches()); diff != "" {
+		t.Errorf("Matches() mismatch (-want +got):\n%s", diff)
+	}
+
+	none := &struct {
+		A int64 `offsetof:"vm.ractors.count|vm.ractor.size"`
+	}{}
+	dm, err = New(none)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromDWARF(ef); err == nil {
+		t.Error("ReadFromDWARF() with no resolvable alternative, want error")
+	}
+}
+
+type reportMap struct {
+	Threads  int64 `offsetof:"vm.threads"`
+	Owner    int64 `enumval:"frame_owner.FRAME_OWNED_BY_CSTACK"`
+	Self     int64 `offsetof:"vm.self" static:"true"`
+	Defaults int64 `offsetof:"vm.ractor" static:"true" default:"42"`
+}
+
+func TestDataMap_Extract(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	idx, err := NewTypeIndex(ef)
+	if err != nil {
+		t.Fatalf("failed to build index: %v", err)
+	}
+	entryOf := func(name string) dwarf.Offset {
+		entries, err := idx.lookup(name)
+		if err != nil || len(entries) == 0 {
+			t.Fatalf("failed to look up %s: %v", name, err)
+		}
+		return entries[0].Offset
+	}
+
+	m := &reportMap{}
+	dm, err := New(m)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	report, err := dm.Extract(idx)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	want := []FieldReport{
+		{Field: "Threads", Op: OpOffsetOf, Route: "vm.threads", Status: StatusResolved, Value: []int64{24}, Entry: entryOf("vm")},
+		{Field: "Owner", Op: OpEnumValue, Route: "frame_owner.FRAME_OWNED_BY_CSTACK", Status: StatusResolved, Value: []int64{3}, Entry: entryOf("frame_owner")},
+		{Field: "Self", Op: OpOffsetOf, Route: "vm.self", Status: StatusMissing, Value: []int64{0}},
+		{Field: "Defaults", Op: OpOffsetOf, Route: "vm.ractor", Status: StatusDefaulted, Value: []int64{42}},
+	}
+	if diff := cmp.Diff(want, report.Fields, cmpopts.IgnoreFields(FieldReport{}, "Err")); diff != "" {
+		t.Errorf("Extract() report mismatch (-want +got):\n%s", diff)
+	}
+	if got := report.Fields[2].Err; got == nil {
+		t.Error("Extract() report of a missing field has no error")
+	}
+	if gaps := report.Gaps(); len(gaps) != 1 || gaps[0].Field != "Self" {
+		t.Errorf("Gaps() = %v, want Self only", gaps)
+	}
+
+	if _, err := dm.Extract(idx, WithStrict()); err == nil {
+		t.Error("Extract() in strict mode with a missing field, want error")
+	}
+}
+
+func TestDataMap_ExtractTwice(t *testing.T) {
+	m := &struct {
+		VM       int64 `addressof:"the_vm"`
+		Defaults int64 `offsetof:"vm.ractor" default:"-1"`
+	}{}
+	dm, err := New(m)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+
+	routes, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer routes.Close()
+	if _, err := dm.Extract(mustTypeIndex(t, routes), WithStrict()); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if m.VM == 0 || m.Defaults != 8 {
+		t.Fatalf("Extract() = %+v, want all resolved", m)
+	}
+
+	// Neither the symbol nor the type are in the other file, the fields are allowed to fail,
+	// but the values read from the first one must not be reported again.
+	units, err := elf.Open("testdata/x86_64/units")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer units.Close()
+	report, err := dm.Extract(mustTypeIndex(t, units))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if m.VM != 0 || m.Defaults != -1 {
+		t.Errorf("Extract() = %+v, want values of the previous extraction cleared", m)
+	}
+	wantStatus := []Status{StatusMissing, StatusDefaulted}
+	for i, f := range report.Fields {
+		if f.Status != wantStatus[i] {
+			t.Errorf("Extract() status of %s = %s, want %s", f.Field, f.Status, wantStatus[i])
+		}
+	}
+	if _, err := dm.Extract(mustTypeIndex(t, units), WithStrict()); err == nil {
+		t.Error("Extract() in strict mode of a file without the symbol, want error")
+	}
+}
+
+func TestDataMap_ReadFromDWARFLimits(t *testing.T) {
+	ef, err := elf.Open(fmt.Sprintf("testdata/%s/test", arch()))
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		opts    []Option
+		wantErr error
+	}{
+		{
+			name: "within limits",
+			ctx:  context.Background(),
+			opts: []Option{WithMaxEntries(1 << 20), WithMaxBytes(1 << 30), WithTimeout(time.Minute)},
+		},
+		{
+			name:    "too many entries",
+			ctx:     context.Background(),
+			opts:    []Option{WithMaxEntries(10)},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "too many bytes",
+			ctx:     context.Background(),
+			opts:    []Option{WithMaxBytes(100)},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "cancelled",
+			ctx:     cancelled,
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := New(&testMap{})
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			err = dm.ReadFromDWARFContext(tt.ctx, ef, tt.opts...)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ReadFromDWARFContext() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadFromDWARFContext() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type exprMap struct {
+	Threads    int64  `offsetof:"vm.threads"`
+	ContextCFP int64  `expr:"offsetof(runtime.contexts) + strideof(runtime.contexts) + offsetof(execution_context.cfp)"`
+	Padding    uint8  `expr:"sizeof(execution_context) - 0x10"`
+	Constant   int64  `expr:"8"`
+	Negative   int64  `expr:"-offsetof(execution_context.cfp)"`
+	Missing    uint64 `expr:"offsetof(vm.self) + 8" static:"true"`
+}
+
+func TestDataMap_ReadFromDWARFExpressions(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	m := &exprMap{}
+	dm, err := New(m)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	report, err := dm.Extract(mustTypeIndex(t, ef))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	want := &exprMap{
+		Threads:    24,
+		ContextCFP: 712,
+		Padding:    8,
+		Constant:   8,
+		Negative:   -16,
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("Extract() mismatch (-want +got):\n%s", diff)
+	}
+
+	wantFields := []FieldReport{
+		{Field: "Threads", Op: OpOffsetOf, Route: "vm.threads", Status: StatusResolved, Value: []int64{24}},
+		{Field: "ContextCFP", Op: OpExpr, Route: "offsetof(runtime.contexts) + strideof(runtime.contexts) + offsetof(execution_context.cfp)", Status: StatusResolved, Value: []int64{712}},
+		{Field: "Padding", Op: OpExpr, Route: "sizeof(execution_context) - 0x10", Status: StatusResolved, Value: []int64{8}},
+		{Field: "Constant", Op: OpExpr, Route: "8", Status: StatusResolved, Value: []int64{8}},
+		{Field: "Negative", Op: OpExpr, Route: "-offsetof(execution_context.cfp)", Status: StatusResolved, Value: []int64{-16}},
+		{Field: "Missing", Op: OpExpr, Route: "offsetof(vm.self) + 8", Status: StatusMissing, Value: []int64{0}},
+	}
+	if diff := cmp.Diff(wantFields, report.Fields, cmpopts.IgnoreFields(FieldReport{}, "Err", "Entry", "Unit")); diff != "" {
+		t.Errorf("Extract() report mismatch (-want +got):\n%s", diff)
+	}
+	if report.Fields[5].Err == nil {
+		t.Error("Extract() report of an expression with a missing term has no error")
+	}
+
+	wantExprs := []Expression{
+		{Field: "ContextCFP", Source: "offsetof(runtime.contexts) + strideof(runtime.contexts) + offsetof(execution_context.cfp)"},
+		{Field: "Padding", Source: "sizeof(execution_context) - 0x10"},
+		{Field: "Constant", Source: "8"},
+		{Field: "Negative", Source: "-offsetof(execution_context.cfp)"},
+		{Field: "Missing", Source: "offsetof(vm.self) + 8"},
+	}
+	if diff := cmp.Diff(wantExprs, dm.Expressions()); diff != "" {
+		t.Errorf("Expressions() mismatch (-want +got):\n%s", diff)
+	}
+
+	negative := &struct {
+		A uint64 `expr:"8 - sizeof(execution_context)"`
+	}{}
+	dm, err = New(negative)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromDWARF(ef); err == nil {
+		t.Error("ReadFromDWARF() of a negative expression into an unsigned field, want error")
+	}
+}
+
+type versionMap struct {
+	Threads    int64 `offsetof:"vm.threads" since:"3.11"`
+	Old        int64 `offsetof:"vm.threads" until:"3.11" default:"-1"`
+	Prerelease int64 `offsetof:"vm.threads" since:"3.13"`
+	Missing    int64 `offsetof:"vm.nothing|vm.none" default:"-1"`
+	Size       int64 `expr:"offsetof(coroutine.pc) | sizeof(execution_context)"`
+	Fallback   int64 `expr:"offsetof(coroutine.pc) + 8" default:"-1"`
+}
+
+func TestDataMap_ReadFromDWARFVersions(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+	idx := mustTypeIndex(t, ef)
+
+	tests := []struct {
+		version string
+		want    *versionMap
+		// wantSkipped are the fields reported as skipped for the version.
+		wantSkipped []string
+	}{
+		{
+			version:     "3.10.4",
+			want:        &versionMap{Old: 24, Missing: -1, Size: 24, Fallback: -1},
+			wantSkipped: []string{"Threads", "Prerelease"},
+		},
+		{
+			version:     "3.11.0",
+			want:        &versionMap{Threads: 24, Old: -1, Missing: -1, Size: 24, Fallback: -1},
+			wantSkipped: []string{"Old", "Prerelease"},
+		},
+		{
+			version:     "3.13.0-rc1",
+			want:        &versionMap{Threads: 24, Old: -1, Prerelease: 24, Missing: -1, Size: 24, Fallback: -1},
+			wantSkipped: []string{"Old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			m := &versionMap{}
+			dm, err := New(m, WithVersion(tt.version))
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			report, err := dm.Extract(idx, WithStrict())
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, m); diff != "" {
+				t.Errorf("Extract() mismatch (-want +got):\n%s", diff)
+			}
+			if got := len(report.Fields); got != 6 {
+				t.Errorf("Extract() reported %d fields, want 6", got)
+			}
+			skipped := []string{}
+			for _, f := range report.Fields {
+				if f.Field == "Missing" && f.Status != StatusDefaulted {
+					t.Errorf("Extract() status of Missing = %s, want defaulted", f.Status)
+				}
+				if f.Status != StatusSkipped {
+					continue
+				}
+				skipped = append(skipped, f.Field)
+				if f.Err == nil {
+					t.Errorf("Extract() report of skipped field %s has no reason", f.Field)
+				}
+			}
+			if diff := cmp.Diff(tt.wantSkipped, skipped); diff != "" {
+				t.Errorf("Extract() skipped fields mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	invalid := []any{
+		// No version.
+		&versionMap{},
+		&struct {
+			A int64 `offsetof:"vm.threads" default:"none"`
+		}{},
+		&struct {
+			A uint64 `offsetof:"vm.threads" default:"-1"`
+		}{},
+		&struct {
+			A int64 `offsetof:"vm.threads" since:"three"`
+		}{},
+	}
+	for _, lm := range invalid {
+		opts := []Option{}
+		if _, ok := lm.(*versionMap); !ok {
+			opts = append(opts, WithVersion("3.11"))
+		}
+		if _, err := New(lm, opts...); err == nil {
+			t.Errorf("New(%T) error = nil, want error", lm)
+		}
+	}
+}
+
+func TestBitOffsetBigEndian(t *testing.T) {
+	// unsigned int kind : 3; after a 2 bit field in a big-endian storage unit.
+	member := &dwarf.Entry{
+		Tag:   dwarf.TagMember,
+		Field: []dwarf.Field{{Attr: dwarf.AttrBitOffset, Val: int64(2), Class: dwarf.ClassConstant}},
+	}
+	field := &dwarf.StructField{
+		Name:       "kind",
+		Type:       &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4}}},
+		ByteOffset: 32,
+		ByteSize:   4,
+		BitOffset:  2,
+		BitSize:    3,
+	}
+	if got := bitOffset(member, field, binary.BigEndian); got != 258 {
+		t.Errorf("bitOffset() = %d, want 258", got)
+	}
+	if got := bitOffset(member, field, binary.LittleEndian); got != 283 {
+		t.Errorf("bitOffset() = %d, want 283", got)
+	}
+}
+
+func TestCyclicTypes(t *testing.T) {
+	// Malformed DWARF data can describe types that refer to themselves.
+	typedef := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "loop_t"}}
+	qual := &dwarf.QualType{Qual: "const", Type: typedef}
+	typedef.Type = qual
+	ptr := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8}}
+	ptr.Type = ptr
+	array := &dwarf.ArrayType{Count: 2}
+	array.Type = array
+
+	if got := underlyingType(typedef); got != typedef && got != qual {
+		t.Errorf("underlyingType() = %T, want the typedef or the qualified type", got)
+	}
+	if got := sizeOf(typedef); got != 0 {
+		t.Errorf("sizeOf(typedef) = %d, want 0", got)
+	}
+	if got := sizeOf(array); got != 0 {
+		t.Errorf("sizeOf(array) = %d, want 0", got)
+	}
+	if got := sizeOf(&dwarf.ArrayType{Count: 3, Type: ptr}); got != 24 {
+		t.Errorf("sizeOf(pointers) = %d, want 24", got)
+	}
+	if got, want := typeString(qual), "const loop_t"; got != want {
+		t.Errorf("typeString(qual) = %q, want %q", got, want)
+	}
+	if got := typeString(ptr); !strings.HasSuffix(got, "* *") {
+		t.Errorf("typeString(ptr) = %q, want a pointer", got)
+	}
+	if _, _, err := indexArray(typedef, []int{0}); err == nil {
+		t.Error("indexArray() on a cyclic typedef, want error")
+	}
+
+	st := &dwarf.StructType{StructName: "self", Kind: "struct"}
+	st.Field = []*dwarf.StructField{{Type: st}}
+	if _, ok := flattenedField(st, "missing", 0); ok {
+		t.Error("flattenedField() on a struct that contains itself, want not found")
+	}
+}
+
+type supplementaryMap struct {
+	Flags         int64   `offsetof:"holder.flags"`
+	EmbeddedValue int64   `offsetof:"holder.embedded.value"`
+	EmbeddedSize  int64   `sizeof:"holder.embedded"`
+	PtrValue      []int64 `offsetof:"holder.ptr*.value"`
+	Counters      int64   `offsetof:"holder.counters"`
+	CountersLen   int64   `lengthof:"holder.counters"`
+	CounterStride int64   `strideof:"holder.counters"`
+	HolderSize    int64   `sizeof:"holder"`
+	SharedSize    int64   `sizeof:"shared"`
+	SharedTValue  int64   `offsetof:"shared_t.value"`
+}
+
+func TestDataMap_ReadFromDWARFSupplementary(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/dwz")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	want := &supplementaryMap{
+		Flags:         0,
+		EmbeddedValue: 16,
+		EmbeddedSize:  16,
+		PtrValue:      []int64{24, 8},
+		Counters:      32,
+		CountersLen:   4,
+		CounterStride: 4,
+		HolderSize:    48,
+		SharedSize:    16,
+		SharedTValue:  8,
+	}
+
+	t.Run("debug dirs", func(t *testing.T) {
+		m := &supplementaryMap{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if err := dm.ReadFromDWARF(ef, WithDebugDirs("testdata/x86_64"), WithStrict()); err != nil {
+			t.Fatalf("ReadFromDWARF() error = %v", err)
+		}
+		if diff := cmp.Diff(want, m); diff != "" {
+			t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("supplementary file", func(t *testing.T) {
+		alt, err := elf.Open("testdata/x86_64/usr/lib/debug/.dwz/dwz.debug")
+		if err != nil {
+			t.Fatalf("failed to open supplementary file: %v", err)
+		}
+		defer alt.Close()
+
+		m := &supplementaryMap{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if err := dm.ReadFromDWARF(ef, WithSupplementaryFile(alt), WithStrict()); err != nil {
+			t.Fatalf("ReadFromDWARF() error = %v", err)
+		}
+		if diff := cmp.Diff(want, m); diff != "" {
+			t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("relative path", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/x86_64/dwz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The path is resolved against the directory of the program, not the working directory.
+		data = bytes.Replace(data, []byte("/usr/lib/debug/.dwz/"), []byte("usr//lib/debug/.dwz/"), 1)
+		rel, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to read ELF file: %v", err)
+		}
+		m := &supplementaryMap{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if err := dm.ReadFromDWARF(rel, WithELFPath("testdata/x86_64/dwz"), WithStrict()); err != nil {
+			t.Fatalf("ReadFromDWARF() error = %v", err)
+		}
+		if diff := cmp.Diff(want, m); diff != "" {
+			t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		// A directory at the path of the supplementary file is skipped.
+		dir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(dir, "usr/lib/debug/.dwz/dwz.debug"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// The index is built, the types that refer to the supplementary file fail to resolve.
+		idx, err := NewTypeIndex(ef, WithDebugDirs(dir))
+		if err != nil {
+			t.Fatalf("NewTypeIndex() without the supplementary file error = %v", err)
+		}
+		defer idx.Close()
+		dm, err := New(&struct {
+			Flags int64 `offsetof:"holder.flags"`
+		}{})
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if err := dm.ReadFromIndex(idx, WithStrict()); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadFromIndex() without the supplementary file error = %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+}
+
+func TestDataMap_ReadFromDWARFAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputPath string
+		m         any
+		want      []FieldReport
+	}{
+		{
+			name:      "C",
+			inputPath: "testdata/x86_64/routes",
+			m: &struct {
+				VM      uint64 `addressof:"the_vm"`
+				Main    uint64 `addressof:"main"`
+				Runtime uint64 `addressof:"no_such_runtime|the_runtime"`
+				Missing uint64 `addressof:"no_such_symbol"`
+			}{},
+			want: []FieldReport{
+				{Field: "VM", Op: OpAddressOf, Route: "the_vm", Status: StatusResolved},
+				// Functions are not variables, their address is read from the symbol table.
+				{Field: "Main", Op: OpAddressOf, Route: "main", Status: StatusResolved},
+				{Field: "Runtime", Op: OpAddressOf, Route: "the_runtime", Status: StatusResolved},
+				{Field: "Missing", Op: OpAddressOf, Route: "no_such_symbol", Status: StatusMissing},
+			},
+		},
+		{
+			name:      "C++ static member",
+			inputPath: "testdata/x86_64/classes",
+			m: &struct {
+				Heaps uint64 `addressof:"_ZN9CodeCache6_heapsE"`
+			}{},
+			want: []FieldReport{
+				{Field: "Heaps", Op: OpAddressOf, Route: "_ZN9CodeCache6_heapsE", Status: StatusResolved},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ef, err := elf.Open(tt.inputPath)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+
+			idx, err := NewTypeIndex(ef)
+			if err != nil {
+				t.Fatalf("NewTypeIndex() error = %v", err)
+			}
+			dm, err := New(tt.m)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			report, err := dm.Extract(idx)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			for i := range tt.want {
+				want := &tt.want[i]
+				if want.Status != StatusResolved {
+					want.Value = []int64{0}
+					continue
+				}
+				sym, err := symbols.FindSymbol(ef, want.Route)
+				if err != nil {
+					t.Fatalf("failed to find symbol %s: %v", want.Route, err)
+				}
+				want.Value = []int64{int64(sym.Value)}
+			}
+			if diff := cmp.Diff(tt.want, report.Fields, cmpopts.IgnoreFields(FieldReport{}, "Unit", "Entry", "Err")); diff != "" {
+				t.Errorf("Extract() mismatch (-want +got):\n%s", diff)
+			}
+			// Variables are read from their DWARF entries.
+			if report.Fields[0].Entry == 0 {
+				t.Errorf("Extract() entry of %s = 0, want the entry of the variable", report.Fields[0].Field)
+			}
+		})
+	}
+}
+
+type tlsMap struct {
+	CounterOffset int64 `tlsoffsetof:"tls_counter"`
+	ECOffset      int64 `tlsoffsetof:"current_ec"`
+	ECAlign       int64 `tlsalignof:"current_ec"`
+	ECSize        int64 `tlssizeof:"current_ec"`
+}
+
+func TestDataMap_ReadFromDWARFTLS(t *testing.T) {
+	want := &tlsMap{
+		CounterOffset: 0,
+		ECOffset:      8,
+		ECAlign:       8,
+		ECSize:        16,
+	}
+	for _, input := range []string{"testdata/x86_64/routes", "testdata/x86_64/routes-dwarf2"} {
+		t.Run(input, func(t *testing.T) {
+			ef, err := elf.Open(input)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+
+			m := &tlsMap{}
+			dm, err := New(m)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			if err := dm.ReadFromDWARF(ef, WithStrict()); err != nil {
+				t.Fatalf("ReadFromDWARF() error = %v", err)
+			}
+			if diff := cmp.Diff(want, m); diff != "" {
+				t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("not thread-local", func(t *testing.T) {
+		ef, err := elf.Open("testdata/x86_64/routes")
+		if err != nil {
+			t.Fatalf("failed to open ELF file: %v", err)
+		}
+		defer ef.Close()
+
+		dm, err := New(&struct {
+			A int64 `tlsoffsetof:"the_vm"`
+		}{})
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if err := dm.ReadFromDWARF(ef, WithStrict()); err == nil {
+			t.Error("ReadFromDWARF() with a global variable, want error")
+		}
+	})
+}
+
+type locationMap struct {
+	TState    []Location `locationof:"eval_frame.tstate"`
+	Frame     []Location `locationof:"eval_frame.frame"`
+	ThrowFlag []Location `locationof:"eval_frame.throwflag"`
+	// Declared in a lexical block of the function.
+	F []Location `locationof:"eval_frame.f"`
+}
+
+func TestDataMap_ReadFromDWARFLocations(t *testing.T) {
+	// The registers are numbered as in the x86-64 psABI: rdx is 1, rcx 2, rsi 4, rdi 5 and r8 8.
+	optimized := &locationMap{
+		TState: []Location{
+			{LowPC: 0x11c0, HighPC: 0x11e3, Kind: LocationRegister, Register: 5},
+			{LowPC: 0x11e3, HighPC: 0x120e, Kind: LocationRegister, Register: 2},
+		},
+		Frame: []Location{
+			{LowPC: 0x11c0, HighPC: 0x11c9, Kind: LocationRegister, Register: 4},
+			{LowPC: 0x11c9, HighPC: 0x120e, Kind: LocationRegister, Register: 8},
+		},
+		ThrowFlag: []Location{
+			{LowPC: 0x11c0, HighPC: 0x11d2, Kind: LocationRegister, Register: 1},
+			{LowPC: 0x11d2, HighPC: 0x11dd, Kind: LocationRegister, Register: 4},
+			{LowPC: 0x11dd, HighPC: 0x120e, Kind: LocationEntryValue, Register: 1},
+		},
+		F: []Location{
+			{LowPC: 0x11d5, HighPC: 0x11dd, Kind: LocationRegister, Register: 8},
+			{LowPC: 0x11dd, HighPC: 0x11f3, Kind: LocationRegister, Register: 1},
+			{LowPC: 0x11f6, HighPC: 0x1201, Kind: LocationRegister, Register: 1},
+		},
+	}
+	tests := []struct {
+		name      string
+		inputPath string
+		want      *locationMap
+	}{
+		{
+			name:      "DWARF 5 location lists",
+			inputPath: "testdata/x86_64/locations",
+			want:      optimized,
+		},
+		{
+			name:      "DWARF 4 location lists",
+			inputPath: "testdata/x86_64/locations-dwarf4",
+			want:      optimized,
+		},
+		{
+			name:      "unoptimized",
+			inputPath: "testdata/x86_64/locations-O0",
+			// Spilled to the stack, relative to the frame base, the CFA.
+			want: &locationMap{
+				TState:    []Location{{LowPC: 0x115f, HighPC: 0x11fb, Kind: LocationCFAOffset, Offset: -40}},
+				Frame:     []Location{{LowPC: 0x115f, HighPC: 0x11fb, Kind: LocationCFAOffset, Offset: -48}},
+				ThrowFlag: []Location{{LowPC: 0x115f, HighPC: 0x11fb, Kind: LocationCFAOffset, Offset: -52}},
+				F:         []Location{{LowPC: 0x1197, HighPC: 0x11d6, Kind: LocationCFAOffset, Offset: -32}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ef, err := elf.Open(tt.inputPath)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+
+			idx, err := NewTypeIndex(ef)
+			if err != nil {
+				t.Fatalf("NewTypeIndex() error = %v", err)
+			}
+			m := &locationMap{}
+			dm, err := New(m)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			report, err := dm.Extract(idx, WithStrict())
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, m); diff != "" {
+				t.Errorf("Extract() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want.Frame, report.Fields[1].Locations); diff != "" {
+				t.Errorf("Extract() report mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		ef, err := elf.Open("testdata/x86_64/locations")
+		if err != nil {
+			t.Fatalf("failed to open ELF file: %v", err)
+		}
+		defer ef.Close()
+
+		idx, err := NewTypeIndex(ef)
+		if err != nil {
+			t.Fatalf("NewTypeIndex() error = %v", err)
+		}
+		dm, err := New(&struct {
+			Function []Location `locationof:"no_such_function.frame"`
+			Variable []Location `locationof:"eval_frame.no_such_variable"`
+			// Only the first alternative that resolves is read.
+			Alternative []Location `locationof:"no_such_function.frame|eval_frame.acc"`
+		}{})
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		report, err := dm.Extract(idx)
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		got := []Status{}
+		for _, f := range report.Fields {
+			got = append(got, f.Status)
+		}
+		if diff := cmp.Diff([]Status{StatusMissing, StatusMissing, StatusResolved}, got); diff != "" {
+			t.Errorf("Extract() status mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+type inheritanceMap struct {
+	ScopesDataBegin int64 `offsetof:"nmethod._scopes_data_begin"`
+	Name            int64 `offsetof:"nmethod._name"`
+	Relocations     int64 `offsetof:"nmethod._relocations"`
+	EntryBCI        int64 `offsetof:"nmethod._entry_bci"`
+	FrameState      int64 `offsetof:"nmethod._frame_info._state"`
+	WideVectors     int64 `bitoffsetof:"nmethod._has_wide_vectors"`
+	WideVectorsSize int64 `bitsizeof:"nmethod._has_wide_vectors"`
+	NameSize        int64 `sizeof:"nmethod._name"`
+	BaseScopes      int64 `offsetof:"CompiledMethod._scopes_data_begin"`
+}
+
+func TestDataMap_ReadFromDWARFInheritance(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/classes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	m := &inheritanceMap{}
+	dm, err := New(m)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromDWARF(ef, WithStrict()); err != nil {
+		t.Fatalf("ReadFromDWARF() error = %v", err)
+	}
+
+	// The polymorphic Relocatable comes first, CompiledMethod starts at 16,
+	// and _entry_bci is placed in its tail padding.
+	want := &inheritanceMap{
+		ScopesDataBegin: 40,
+		Name:            16,
+		Relocations:     8,
+		EntryBCI:        52,
+		FrameState:      32,
+		WideVectors:     385,
+		WideVectorsSize: 1,
+		NameSize:        8,
+		BaseScopes:      24,
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type qualifiedMap struct {
+	InternalIsolateSize int64   `sizeof:"v8::internal::Isolate"`
+	IsolateSize         int64   `sizeof:"v8::Isolate"`
+	ThreadID            int64   `offsetof:"v8::internal::Isolate._thread_id"`
+	ImplThreadID        []int64 `offsetof:"v8::Isolate._impl*._thread_id"`
+	EntrySize           int64   `offsetof:"hotspot::CodeCache::Entry._size"`
+	Count               int64   `offsetof:"hotspot::CodeCache._count"`
+	HeapsData           int64   `offsetof:"GrowableArray<CodeHeap*>._data"`
+	HeapsSize           int64   `sizeof:"'GrowableArray<CodeHeap*>'"`
+	IntsMax             int64   `offsetof:"GrowableArray<int>._max|'GrowableArray<long>'._max"`
+	Segments            int64   `offsetof:"CodeHeap._segments"`
+}
+
+func TestDataMap_ReadFromDWARFQualifiedNames(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/classes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	m := &qualifiedMap{}
+	dm, err := New(m)
+	if err != nil {
+		t.Fatalf("failed to generate query: %v", err)
+	}
+	if err := dm.ReadFromDWARF(ef, WithStrict()); err != nil {
+		t.Fatalf("ReadFromDWARF() error = %v", err)
+	}
+
+	want := &qualifiedMap{
+		InternalIsolateSize: 16,
+		IsolateSize:         8,
+		ThreadID:            8,
+		ImplThreadID:        []int64{0, 8},
+		EntrySize:           8,
+		Count:               0,
+		HeapsData:           8,
+		HeapsSize:           16,
+		IntsMax:             4,
+		Segments:            0,
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("other namespace", func(t *testing.T) {
+		m := &struct {
+			Heap int64 `offsetof:"v8::Isolate._heap"`
+		}{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if err := dm.ReadFromDWARF(ef, WithStrict()); err == nil {
+			t.Errorf("ReadFromDWARF() error = nil, want field not found")
+		}
+	})
+}
+
+type unitMap struct {
+	CancelHandling     int64 `offsetof:"pthread.cancelhandling" cu:"nptl/*"`
+	Size               int64 `sizeof:"pthread" cu:"nptl/*"`
+	MainCancelHandling int64 `offsetof:"pthread.cancelhandling" cu:"main.c"`
+	BlockSize          int64 `sizeof:"tls_block" cu:"nptl/tls.h"`
+	ListPrev           int64 `offsetof:"list_head.prev"`
+}
+
+func TestDataMap_ReadFromDWARFUnits(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/units")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	t.Run("pinned", func(t *testing.T) {
+		m := &unitMap{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		report, err := dm.Extract(mustTypeIndex(t, ef), WithStrict())
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		want := &unitMap{
+			CancelHandling:     40,
+			Size:               64,
+			MainCancelHandling: 8,
+			BlockSize:          8,
+			ListPrev:           8,
+		}
+		if diff := cmp.Diff(want, m); diff != "" {
+			t.Errorf("Extract() mismatch (-want +got):\n%s", diff)
+		}
+		if conflicts := report.Conflicts(); len(conflicts) != 0 {
+			t.Errorf("Extract() conflicts = %v, want none", conflicts)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		m := &struct {
+			CancelHandling int64 `offsetof:"pthread.cancelhandling"`
+		}{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		report, err := dm.Extract(mustTypeIndex(t, ef))
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if m.CancelHandling != 8 {
+			t.Errorf("Extract() CancelHandling = %d, want the first definition", m.CancelHandling)
+		}
+		want := []Conflict{{Type: "pthread", Units: []string{"units/main.c", "units/nptl/pthread_create.c"}}}
+		if diff := cmp.Diff(want, report.Fields[0].Conflicts); diff != "" {
+			t.Errorf("Extract() conflicts mismatch (-want +got):\n%s", diff)
+		}
+
+		if _, err := dm.Extract(mustTypeIndex(t, ef), WithStrict()); err == nil {
+			t.Error("Extract() in strict mode error = nil, want conflicting definitions")
+		}
+	})
+
+	t.Run("no matching unit", func(t *testing.T) {
+		m := &struct {
+			CancelHandling int64 `offsetof:"pthread.cancelhandling" cu:"sysdeps/*"`
+		}{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		if _, err := dm.Extract(mustTypeIndex(t, ef)); err == nil {
+			t.Error("Extract() error = nil, want no composite type found")
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if _, err := New(&struct {
+			CancelHandling int64 `offsetof:"pthread.cancelhandling" cu:"["`
+		}{}); err == nil {
+			t.Error("New() error = nil, want invalid pattern")
+		}
+	})
+}
+
+func mustTypeIndex(t *testing.T, ef *elf.File) *TypeIndex {
+	t.Helper()
+	idx, err := NewTypeIndex(ef)
+	if err != nil {
+		t.Fatalf("NewTypeIndex() error = %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+type splitMap struct {
+	Flags      int64   `offsetof:"thread.flags"`
+	StackSize  []int64 `offsetof:"thread.stack*.size"`
+	Workers    int64   `offsetof:"config.workers" cu:"split/start.c"`
+	ThreadSize int64   `sizeof:"thread"`
+	Stack      int64   `sizeof:"stack"`
+}
+
+func TestDataMap_ReadFromDWARFSplit(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/split")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+
+	want := &splitMap{
+		Flags:      16,
+		StackSize:  []int64{8, 8},
+		Workers:    8,
+		ThreadSize: 24,
+		Stack:      16,
+	}
+
+	for _, tt := range []struct {
+		name string
+		dir  string
+	}{
+		{name: "dwo files", dir: "testdata/x86_64"},
+		{name: "dwp package", dir: "testdata/x86_64/dwp"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &splitMap{}
+			dm, err := New(m)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			if err := dm.ReadFromDWARF(ef, WithSplitDWARFDirs(tt.dir), WithStrict()); err != nil {
+				t.Fatalf("ReadFromDWARF() error = %v", err)
+			}
+			if diff := cmp.Diff(want, m); diff != "" {
+				t.Errorf("ReadFromDWARF() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		m := &struct {
+			Workers int64 `offsetof:"config.workers"`
+		}{}
+		dm, err := New(m)
+		if err != nil {
+			t.Fatalf("failed to generate query: %v", err)
+		}
+		idx, err := NewTypeIndex(ef, WithSplitDWARFDirs("testdata/x86_64"))
+		if err != nil {
+			t.Fatalf("NewTypeIndex() error = %v", err)
+		}
+		defer idx.Close()
+		report, err := dm.Extract(idx)
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if m.Workers != 4 {
+			t.Errorf("Extract() Workers = %d, want the first definition", m.Workers)
+		}
+		want := []Conflict{{Type: "config", Units: []string{"split/main.c", "split/start.c"}}}
+		if diff := cmp.Diff(want, report.Fields[0].Conflicts); diff != "" {
+			t.Errorf("Extract() conflicts mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := NewTypeIndex(ef, WithSplitDWARFDirs(t.TempDir())); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("NewTypeIndex() without the split units error = %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+}
+
+func TestFieldAt(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputPath string
+		route     string
+		offset    int64
+		want      string
+		wantPath  []FieldStep
+		wantErr   bool
+	}{
+		{
+			name:   "member",
+			route:  "runtime",
+			offset: 2,
+			want:   "runtime.flags+2",
+			wantPath: []FieldStep{
+				{Name: "flags", Offset: 0, Size: 4, Type: "int"},
+			},
+		},
+		{
+			name:   "hole",
+			route:  "runtime",
+			offset: 5,
+			want:   "runtime+5 (padding)",
+		},
+		{
+			name:   "element of a two-dimensional array",
+			route:  "runtime",
+			offset: 610,
+			want:   "runtime.blocks[1][1].data+2",
+			wantPath: []FieldStep{
+				{Name: "blocks", Index: []int{1, 1}, Offset: 600, Size: 16, Type: "struct key_data"},
+				{Name: "data", Offset: 8, Size: 8, Type: "void *"},
+			},
+		},
+		{
+			name:   "bitfield in an anonymous struct of an anonymous union",
+			route:  "interpreter",
+			offset: 12,
+			want:   "interpreter.finalizing",
+			wantPath: []FieldStep{
+				{Offset: 8, Size: 16, Type: "union {...}"},
+				{Offset: 0, Size: 8, Type: "struct {...}"},
+				{Name: "finalizing", Offset: 4, Size: 1, Type: "unsigned int", BitOffset: 32, BitSize: 1},
+			},
+		},
+		{
+			name:   "padding of a member of a union",
+			route:  "interpreter",
+			offset: 13,
+			want:   "interpreter.padding[0]+5",
+			wantPath: []FieldStep{
+				{Offset: 8, Size: 16, Type: "union {...}"},
+				{Name: "padding", Index: []int{0}, Offset: 0, Size: 8, Type: "long int"},
+			},
+		},
+		{
+			name:   "dereferenced route",
+			route:  "vm.threads*.ec*",
+			offset: 8,
+			want:   "vm.threads*.ec*.stack_size",
+			wantPath: []FieldStep{
+				{Name: "stack_size", Offset: 8, Size: 8, Type: "long int"},
+			},
+		},
+		{
+			name:      "inherited member",
+			inputPath: "testdata/x86_64/classes",
+			route:     "nmethod",
+			offset:    32,
+			want:      "nmethod._frame_info._state",
+			wantPath: []FieldStep{
+				{Name: "CompiledMethod", Base: true, Offset: 16, Size: 40, Type: "CompiledMethod"},
+				{Name: "CodeBlob", Base: true, Offset: 0, Size: 24, Type: "CodeBlob"},
+				{Name: "_frame_info", Offset: 8, Size: 16, Type: "class frame"},
+				{Name: "_state", Offset: 8, Size: 4, Type: "enum frame_state"},
+			},
+		},
+		{
+			name:      "member after the base classes",
+			inputPath: "testdata/x86_64/classes",
+			route:     "nmethod",
+			offset:    53,
+			want:      "nmethod._entry_bci+1",
+			wantPath: []FieldStep{
+				{Name: "_entry_bci", Offset: 52, Size: 4, Type: "int"},
+			},
+		},
+		{
+			name:    "out of the struct",
+			route:   "interpreter",
+			offset:  88,
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			route:   "nope",
+			offset:  0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.inputPath == "" {
+				tt.inputPath = "testdata/x86_64/routes"
+			}
+			ef, err := elf.Open(tt.inputPath)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+			idx, err := NewTypeIndex(ef)
+			if err != nil {
+				t.Fatalf("NewTypeIndex() error = %v", err)
+			}
+			defer idx.Close()
+
+			loc, err := FieldAt(idx, tt.route, tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FieldAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := loc.String(); got != tt.want {
+				t.Errorf("FieldAt() = %s, want %s", got, tt.want)
+			}
+			if diff := cmp.Diff(tt.wantPath, loc.Path); diff != "" {
+				t.Errorf("FieldAt() path mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/routes")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+	idx, err := NewTypeIndex(ef)
+	if err != nil {
+		t.Fatalf("NewTypeIndex() error = %v", err)
+	}
+	defer idx.Close()
+
+	got, err := Describe(idx, "vm.threads*", 0)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+	want := &TypeLayout{
+		Name: "thread",
+		Kind: "struct",
+		Size: 24,
+		Members: []MemberLayout{
+			{Name: "id", Offset: 0, Size: 8, Type: "long int"},
+			{Name: "state", Offset: 8, Size: 4, Type: "int", Hole: 4},
+			{Name: "ec", Offset: 16, Size: 8, Type: "struct execution_context *", Pointee: "struct execution_context"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Describe() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Anonymous members are expanded whatever the depth, the bitfields leave the end of their struct unused.
+	got, err = Describe(idx, "interpreter", 0)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+	union := got.Members[1].Layout
+	if union == nil || union.Kind != "union" || union.Members[0].Layout == nil {
+		t.Fatalf("Describe() anonymous union not expanded: %+v", got.Members[1])
+	}
+	wantBits := &TypeLayout{
+		Kind: "struct",
+		Size: 8,
+		Members: []MemberLayout{
+			{Name: "state", Offset: 0, Size: 4, Type: "int"},
+			{Name: "finalizing", Offset: 4, Size: 4, Type: "unsigned int", BitOffset: 32, BitSize: 1},
+			{Name: "daemon", Offset: 4, Size: 4, Type: "unsigned int", BitOffset: 33, BitSize: 1},
+		},
+		Padding: 3,
+	}
+	if diff := cmp.Diff(wantBits, union.Members[0].Layout); diff != "" {
+		t.Errorf("Describe() anonymous struct mismatch (-want +got):\n%s", diff)
+	}
+	if ceval := got.Members[2]; ceval.Name != "ceval" || ceval.Layout != nil {
+		t.Errorf("Describe() expanded %s at depth 0", ceval.Name)
+	}
+
+	got, err = Describe(idx, "runtime", -1)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+	blocks := got.Members[2]
+	if diff := cmp.Diff([]int64{2, 4}, blocks.Count); diff != "" {
+		t.Errorf("Describe() blocks count mismatch (-want +got):\n%s", diff)
+	}
+	if blocks.Layout == nil || blocks.Layout.Name != "key_data" {
+		t.Errorf("Describe() elements of blocks not expanded: %+v", blocks)
+	}
+}
+
+func TestDiffLayouts(t *testing.T) {
+	describe := func(path, route string) *TypeLayout {
+		t.Helper()
+		ef, err := elf.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open ELF file: %v", err)
+		}
+		defer ef.Close()
+		idx, err := NewTypeIndex(ef)
+		if err != nil {
+			t.Fatalf("NewTypeIndex() error = %v", err)
+		}
+		defer idx.Close()
+		l, err := Describe(idx, route, -1)
+		if err != nil {
+			t.Fatalf("Describe() error = %v", err)
+		}
+		return l
+	}
+
+	if changes := DiffLayouts(describe("testdata/x86_64/routes", "interpreter"), describe("testdata/x86_64/routes-dwarf2", "interpreter")); len(changes) != 0 {
+		t.Errorf("DiffLayouts() of the same type = %+v, want none", changes)
+	}
+
+	got := DiffLayouts(describe("testdata/x86_64/routes", "frame"), describe("testdata/x86_64/classes", "frame"))
+	want := []LayoutChange{
+		{
+			Old: &MemberPosition{Size: 16, Type: "struct frame"},
+			New: &MemberPosition{Size: 16, Type: "class frame"},
+		},
+		{Member: "pc", Old: &MemberPosition{Offset: 0, Size: 8, Type: "void *"}},
+		{Member: "prev", Old: &MemberPosition{Offset: 8, Size: 8, Type: "struct frame *"}},
+		{Member: "_sp", New: &MemberPosition{Offset: 0, Size: 8, Type: "long int *"}},
+		{Member: "_state", New: &MemberPosition{Offset: 8, Size: 4, Type: "enum frame_state"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffLayouts() mismatch (-want +got):\n%s", diff)
+	}
+
+	before := &TypeLayout{Name: "thread", Kind: "struct", Size: 16, Members: []MemberLayout{
+		{Name: "id", Offset: 0, Size: 8, Type: "long int"},
+		{Name: "ctx", Offset: 8, Size: 8, Type: "struct context", Layout: &TypeLayout{Name: "context", Kind: "struct", Size: 8, Members: []MemberLayout{
+			{Name: "sp", Offset: 0, Size: 8, Type: "void *"},
+		}}},
+	}}
+	after := &TypeLayout{Name: "thread", Kind: "struct", Size: 24, Members: []MemberLayout{
+		{Name: "id", Offset: 0, Size: 8, Type: "long int"},
+		{Name: "flags", Offset: 8, Size: 8, Type: "long int"},
+		{Name: "ctx", Offset: 16, Size: 8, Type: "struct context", Layout: &TypeLayout{Name: "context", Kind: "struct", Size: 8, Members: []MemberLayout{
+			{Name: "sp", Offset: 0, Size: 8, Type: "void *"},
+		}}},
+	}}
+	want = []LayoutChange{
+		{
+			Old: &MemberPosition{Size: 16, Type: "struct thread"},
+			New: &MemberPosition{Size: 24, Type: "struct thread"},
+		},
+		{
+			Member: "ctx",
+			Old:    &MemberPosition{Offset: 8, Size: 8, Type: "struct context"},
+			New:    &MemberPosition{Offset: 16, Size: 8, Type: "struct context"},
+		},
+		{
+			Member: "ctx.sp",
+			Old:    &MemberPosition{Offset: 8, Size: 8, Type: "void *"},
+			New:    &MemberPosition{Offset: 16, Size: 8, Type: "void *"},
+		},
+		{Member: "flags", New: &MemberPosition{Offset: 8, Size: 8, Type: "long int"}},
+	}
+	if diff := cmp.Diff(want, DiffLayouts(before, after)); diff != "" {
+		t.Errorf("DiffLayouts() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,214 @@
+package datamap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A field tagged with `expr` is computed from constants and from the values of other tags,
+// e.g. the offset of a member of a struct that is itself a member:
+//
+//	expr(offsetof(rb_iseq_constant_body.insns_info) + offsetof(iseq_insn_info.size))
+//	expr(sizeof(PyASCIIObject) - 8)
+//	expr(8)
+//
+// Terms are added or subtracted, they are either integer constants, in any base Go accepts,
+// or tags applied to a route, which can list alternatives.
+// Whole expressions can be alternatives too, the first one whose terms all resolve is used, e.g.:
+//
+//	expr(offsetof(PyStringObject.ob_sval) | sizeof(PyASCIIObject))
+//
+// The `cu` and `static` tags of the field apply to all of its terms.
+
+// Expression is the tag value of a field computed with the `expr` tag.
+type Expression struct {
+	Field  string
+	Source string
+}
+
+// expression is a field of the map struct whose value is computed from its terms.
+type expression struct {
+	name   string
+	order  int
+	source string
+	// alternatives are the terms of each alternative expression, in priority order.
+	alternatives [][]term
+	value        reflect.Value
+	// def is the value of the field when no alternative resolves, if hasDefault.
+	def        int64
+	hasDefault bool
+	// resolved reports whether all the terms of an alternative were resolved by the last extraction.
+	resolved bool
+}
+
+// term is an operand of an expression, either a constant or the value of a target.
+type term struct {
+	negative bool
+	constant int64
+	op       Operation
+	route    string
+	// target holds the value read for the route, nil for constants.
+	target *target
+}
+
+// parseExpression splits the given expression into its terms, the routes are not parsed.
+func parseExpression(s string) ([]term, error) {
+	var (
+		terms []term
+		rest  = strings.TrimSpace(s)
+	)
+	if rest == "" {
+		return nil, errors.New("empty expression")
+	}
+	for rest != "" {
+		var t term
+		if len(terms) > 0 || rest[0] == '-' || rest[0] == '+' {
+			switch rest[0] {
+			case '+':
+			case '-':
+				t.negative = true
+			default:
+				return nil, fmt.Errorf("expected + or - in expression %q, got %q", s, rest)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+		i := strings.IndexAny(rest, "(+- ")
+		if i < 0 {
+			i = len(rest)
+		}
+		if i < len(rest) && rest[i] == '(' {
+			op, ok := opOfTag(rest[:i])
+			if !ok {
+				return nil, fmt.Errorf("unknown operation %q in expression %q", rest[:i], s)
+			}
+			end, err := closingParen(rest, i)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression %q: %w", s, err)
+			}
+			t.op = op
+			t.route = strings.TrimSpace(rest[i+1 : end])
+			if t.route == "" {
+				return nil, fmt.Errorf("missing route of %s in expression %q", rest[:i], s)
+			}
+			rest = rest[end+1:]
+		} else {
+			c, err := strconv.ParseInt(rest[:i], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constant %q in expression %q", rest[:i], s)
+			}
+			t.constant = c
+			rest = rest[i:]
+		}
+		terms = append(terms, t)
+		rest = strings.TrimSpace(rest)
+	}
+	return terms, nil
+}
+
+// opOfTag returns the operation of the given tag.
+func opOfTag(tag string) (Operation, bool) {
+	for _, ot := range opTags {
+		if ot.tag == tag {
+			return ot.op, true
+		}
+	}
+	return 0, false
+}
+
+// closingParen returns the position of the parenthesis that closes the one at the given position,
+// outside of quotes.
+func closingParen(s string, open int) (int, error) {
+	var (
+		depth  int
+		quoted bool
+	)
+	for i := open; i < len(s); i++ {
+		switch {
+		case s[i] == quote[0]:
+			quoted = !quoted
+		case quoted:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.New("unterminated parenthesis")
+}
+
+// reset clears the outcome of a previous extraction.
+func (e *expression) reset() {
+	e.resolved = false
+	if e.hasDefault {
+		// Checked by New.
+		_ = setInt(e.value, e.def)
+		return
+	}
+	if e.value.CanSet() {
+		e.value.Set(reflect.Zero(e.value.Type()))
+	}
+}
+
+// evaluate sets the value of the field to the first alternative whose terms were all resolved.
+func (e *expression) evaluate() error {
+	e.resolved = false
+	for _, terms := range e.alternatives {
+		sum, ok := evaluate(terms)
+		if !ok {
+			continue
+		}
+		e.resolved = true
+		if err := setInt(e.value, sum); err != nil {
+			return fmt.Errorf("field %s: expression %s: %w", e.name, e.source, err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// evaluate returns the sum of the given terms, if they were all resolved.
+func evaluate(terms []term) (int64, bool) {
+	var sum int64
+	for _, t := range terms {
+		v := t.constant
+		if t.target != nil {
+			if t.target.matched == -1 {
+				return 0, false
+			}
+			v = t.target.value.Int()
+		}
+		if t.negative {
+			v = -v
+		}
+		sum += v
+	}
+	return sum, true
+}
+
+// targets returns the targets of the terms of the expression.
+func (e *expression) targets() []*target {
+	targets := []*target{}
+	for _, terms := range e.alternatives {
+		for _, t := range terms {
+			if t.target != nil {
+				targets = append(targets, t.target)
+			}
+		}
+	}
+	return targets
+}
+
+// Expressions returns the fields computed with the `expr` tag, in the order they are declared.
+func (dm *DataMap) Expressions() []Expression {
+	exprs := []Expression{}
+	for _, e := range dm.expressions {
+		exprs = append(exprs, Expression{Field: e.name, Source: e.source})
+	}
+	return exprs
+}
@@ -0,0 +1,407 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldLocation is the member of a struct that contains a byte offset, as found by FieldAt.
+type FieldLocation struct {
+	// Route is the route of the struct the offset is relative to, as given to FieldAt.
+	Route string `yaml:"route" json:"route"`
+	// Type is the name of the struct at the end of the route.
+	Type string `yaml:"type" json:"type"`
+	// Size is the size of the struct at the end of the route.
+	Size int64 `yaml:"size" json:"size"`
+	// Path lists the members that contain the offset, from the outermost to the innermost one.
+	Path []FieldStep `yaml:"path,omitempty" json:"path,omitempty"`
+	// Offset is the remaining offset in the innermost member,
+	// or in the struct at the end of the route when the path is empty.
+	Offset int64 `yaml:"offset" json:"offset"`
+	// Padding reports whether the offset is in a hole or in the tail padding of the innermost struct,
+	// rather than in one of its members.
+	Padding bool `yaml:"padding,omitempty" json:"padding,omitempty"`
+}
+
+// FieldStep is one of the members on the path to a byte offset.
+type FieldStep struct {
+	// Name is the name of the member, empty for an anonymous struct or union,
+	// the name of the class for a base class.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Base reports whether the member is a base class.
+	Base bool `yaml:"base,omitempty" json:"base,omitempty"`
+	// Index lists the indexes of the array element that contains the offset, if the member is an array.
+	Index []int `yaml:"index,omitempty" json:"index,omitempty"`
+	// Offset is the offset of the member, or of its element, in the struct that declares it.
+	Offset int64 `yaml:"offset" json:"offset"`
+	// Size is the size of the member, or of its element.
+	Size int64 `yaml:"size" json:"size"`
+	// Type is the type of the member, or of its element.
+	Type string `yaml:"type" json:"type"`
+	// BitOffset and BitSize locate a bitfield in bits, from the start of the struct that declares it.
+	// BitSize is 0 when the member is not a bitfield.
+	BitOffset int64 `yaml:"bit_offset,omitempty" json:"bit_offset,omitempty"`
+	BitSize   int64 `yaml:"bit_size,omitempty" json:"bit_size,omitempty"`
+}
+
+// Anonymous reports whether the member is an anonymous struct or union.
+func (s FieldStep) Anonymous() bool {
+	return s.Name == "" && !s.Base
+}
+
+// Member returns the route to the innermost member that contains the offset,
+// e.g. "runtime.contexts[1].cfp", anonymous members and base classes being looked up through as in routes.
+func (l *FieldLocation) Member() string {
+	var b strings.Builder
+	b.WriteString(l.Route)
+	for _, s := range l.Path {
+		if s.Name != "" && !s.Base {
+			b.WriteString(routeSeparator)
+			b.WriteString(memberName(s.Name))
+		}
+		for _, i := range s.Index {
+			fmt.Fprintf(&b, "[%d]", i)
+		}
+	}
+	return b.String()
+}
+
+// String returns the route to the member followed by the remaining offset in it, if any,
+// e.g. "runtime.contexts[1].stack_size+4".
+func (l *FieldLocation) String() string {
+	// The remaining offset is relative to the last member of the route,
+	// the anonymous members and base classes after it are not part of the route.
+	off := l.Offset
+	for i := len(l.Path) - 1; i >= 0 && (l.Path[i].Anonymous() || l.Path[i].Base); i-- {
+		off += l.Path[i].Offset
+	}
+	s := l.Member()
+	if off != 0 {
+		s += fmt.Sprintf("+%d", off)
+	}
+	if l.Padding {
+		s += " (padding)"
+	}
+	return s
+}
+
+// FieldAt returns the member of a struct that contains the given byte offset.
+// The struct is the one at the end of the given route, which is either the name of a type,
+// e.g. "rb_vm_struct", or a route as written in the tags of a map struct,
+// e.g. "rb_vm_struct.ractor*" for the struct the ractor member points to.
+// Nested structs, elements of arrays, anonymous members and base classes are looked into,
+// the first member of a union that contains the offset is returned.
+func FieldAt(src Source, route string, offset int64) (*FieldLocation, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+	var loc *FieldLocation
+	err := inspect(src, route, func(c *composite) error {
+		var err error
+		loc, err = locate(c, route, offset)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return nil, fmt.Errorf("failed to find %s", route)
+	}
+	return loc, nil
+}
+
+// inspect resolves the given route and applies the given function to the struct at its end,
+// in place of the extractors of a map struct.
+func inspect(src Source, route string, fn func(*composite) error) error {
+	rn, err := newRouteFromTagValue(route)
+	if err != nil {
+		return fmt.Errorf("invalid route %s: %w", route, err)
+	}
+	// The target collects the errors of the lookups that are not fatal to the route.
+	field := &target{name: route, routes: []string{route}, matched: -1}
+	rn.Leaf().Extractors = []*Extractor{{inspect: fn, field: field}}
+	if err := src.route(rn); err != nil {
+		return err
+	}
+	if len(field.errs) > 0 {
+		return errors.Join(field.errs...)
+	}
+	return nil
+}
+
+// composite is a struct walked by FieldAt and Describe.
+// DWARF and BTF describe the structs the members are, and the base classes, differently.
+type composite struct {
+	st *dwarf.StructType
+	// member returns the struct the i-th member is, or is an array of, nil if it is not a struct.
+	member func(i int) (*composite, error)
+	// bitOffset returns the offset of the i-th member in bits.
+	bitOffset func(i int) (int64, error)
+	// bases returns the base classes at constant offsets, if any.
+	bases func() ([]baseClass, error)
+}
+
+type baseClass struct {
+	offset int64
+	c      *composite
+}
+
+// locate looks up the offset in the given struct, the one at the end of the given route.
+func locate(c *composite, route string, offset int64) (*FieldLocation, error) {
+	if offset >= c.st.ByteSize && !hasFlexibleArray(c.st) {
+		return nil, fmt.Errorf("offset %d is out of %s, which is %d bytes", offset, typeString(c.st), c.st.ByteSize)
+	}
+	path, rem, padding, err := locateIn(c, offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate offset %d in %s: %w", offset, typeString(c.st), err)
+	}
+	return &FieldLocation{
+		Route:   route,
+		Type:    c.st.StructName,
+		Size:    c.st.ByteSize,
+		Path:    path,
+		Offset:  rem,
+		Padding: padding,
+	}, nil
+}
+
+// locateIn returns the path to the member of the given struct that contains the offset,
+// and the remaining offset in it.
+// The members are looked up before the base classes, which can be empty and share their offset with a member.
+// A member whose padding contains the offset is only returned if no other member of a union contains it.
+// The depth is the number of structs looked through to reach the given one,
+// malformed DWARF data can describe a struct that contains itself.
+func locateIn(c *composite, offset int64, depth int) ([]FieldStep, int64, bool, error) {
+	if depth > maxTypeDepth {
+		return nil, 0, false, fmt.Errorf("too many nested members in %s", c.st.StructName)
+	}
+	var (
+		padded    []FieldStep
+		paddedRem int64
+	)
+	for i, f := range c.st.Field {
+		step := FieldStep{Name: f.Name, Offset: f.ByteOffset, Size: sizeOf(f.Type), Type: typeString(f.Type)}
+		if f.BitSize != 0 {
+			bits, err := c.bitOffset(i)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			step.BitOffset, step.BitSize = bits, f.BitSize
+			step.Offset = bits / 8
+			step.Size = (bits+f.BitSize+7)/8 - step.Offset
+		}
+		if offset < step.Offset || (offset >= step.Offset+step.Size && !isFlexibleArray(f.Type)) {
+			continue
+		}
+		rem := offset - step.Offset
+		if step.BitSize != 0 {
+			return []FieldStep{step}, rem, false, nil
+		}
+
+		typ := underlyingType(f.Type)
+		for j := 0; j < maxTypeDepth; j++ {
+			at, ok := typ.(*dwarf.ArrayType)
+			if !ok {
+				break
+			}
+			stride := arrayStride(at)
+			if stride <= 0 || (at.Count >= 0 && rem/stride >= at.Count) {
+				break
+			}
+			n := rem / stride
+			step.Index = append(step.Index, int(n))
+			step.Offset += n * stride
+			step.Size = stride
+			step.Type = typeString(at.Type)
+			rem -= n * stride
+			typ = underlyingType(at.Type)
+		}
+		if _, ok := typ.(*dwarf.StructType); !ok {
+			return []FieldStep{step}, rem, false, nil
+		}
+		inner, err := c.member(i)
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("failed to read the type of %s: %w", f.Name, err)
+		}
+		if inner == nil {
+			return []FieldStep{step}, rem, false, nil
+		}
+		path, rem, padding, err := locateIn(inner, rem, depth+1)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		path = append([]FieldStep{step}, path...)
+		if !padding {
+			return path, rem, false, nil
+		}
+		if padded == nil {
+			padded, paddedRem = path, rem
+		}
+	}
+	if padded != nil {
+		return padded, paddedRem, true, nil
+	}
+
+	if c.bases != nil {
+		bases, err := c.bases()
+		if err != nil {
+			return nil, 0, false, err
+		}
+		for _, b := range bases {
+			if offset < b.offset || offset >= b.offset+b.c.st.ByteSize {
+				continue
+			}
+			step := FieldStep{Name: b.c.st.StructName, Base: true, Offset: b.offset, Size: b.c.st.ByteSize, Type: b.c.st.StructName}
+			path, rem, padding, err := locateIn(b.c, offset-b.offset, depth+1)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			return append([]FieldStep{step}, path...), rem, padding, nil
+		}
+	}
+	return nil, offset, true, nil
+}
+
+// isFlexibleArray reports whether the given type is an array without an upper bound,
+// which extends past the end of the struct it ends.
+func isFlexibleArray(typ dwarf.Type) bool {
+	at, ok := underlyingType(typ).(*dwarf.ArrayType)
+	return ok && at.Count < 0
+}
+
+// hasFlexibleArray reports whether the last member of the given struct is a flexible array.
+func hasFlexibleArray(st *dwarf.StructType) bool {
+	return len(st.Field) > 0 && isFlexibleArray(st.Field[len(st.Field)-1].Type)
+}
+
+// composite returns the given struct, read from the given entry, as walked by FieldAt and Describe.
+func (p *processor) composite(entry *dwarf.Entry, st *dwarf.StructType) *composite {
+	var members []*dwarf.Entry
+	memberEntry := func(i int) (*dwarf.Entry, error) {
+		if members == nil {
+			var err error
+			if members, err = children(p.index.reader(), entry, dwarf.TagMember); err != nil {
+				return nil, err
+			}
+			if len(members) != len(st.Field) {
+				return nil, fmt.Errorf("unexpected number of members in %s", st.StructName)
+			}
+		}
+		return members[i], nil
+	}
+	return &composite{
+		st: st,
+		member: func(i int) (*composite, error) {
+			member, err := memberEntry(i)
+			if err != nil {
+				return nil, err
+			}
+			typeEntry, q, err := p.underlyingTypeEntry(member)
+			if err != nil {
+				return nil, err
+			}
+			// The dimensions of an array share the same element type entry.
+			for j := 0; typeEntry.Tag == dwarf.TagArrayType; j++ {
+				if j == maxTypeDepth {
+					return nil, errors.New("too many dimensions")
+				}
+				if typeEntry, q, err = q.underlyingTypeEntry(typeEntry); err != nil {
+					return nil, err
+				}
+			}
+			if !isCompositeType(typeEntry) {
+				return nil, nil
+			}
+			return q.compositeAt(typeEntry)
+		},
+		bitOffset: func(i int) (int64, error) {
+			member, err := memberEntry(i)
+			if err != nil {
+				return 0, err
+			}
+			return bitOffset(member, st.Field[i], p.ef.ByteOrder), nil
+		},
+		bases: func() ([]baseClass, error) {
+			if entry.Tag != dwarf.TagClassType && entry.Tag != dwarf.TagStructType {
+				return nil, nil
+			}
+			inherited, err := children(p.index.reader(), entry, dwarf.TagInheritance)
+			if err != nil {
+				return nil, err
+			}
+			var bases []baseClass
+			for _, inh := range inherited {
+				off, ok := memberLocation(inh)
+				if !ok {
+					// The offset of a virtual base class is only known at run time.
+					continue
+				}
+				baseEntry, q, err := p.underlyingTypeEntry(inh)
+				if err != nil {
+					return nil, fmt.Errorf("failed to find base class: %w", err)
+				}
+				base, err := q.compositeAt(baseEntry)
+				if err != nil {
+					return nil, err
+				}
+				if base == nil {
+					return nil, fmt.Errorf("base class is not a struct, tag: %s", baseEntry.Tag)
+				}
+				bases = append(bases, baseClass{offset: off, c: base})
+			}
+			return bases, nil
+		},
+	}
+}
+
+// compositeAt returns the struct of the given composite type entry, its definition if it is only declared.
+func (p *processor) compositeAt(entry *dwarf.Entry) (*composite, error) {
+	q := p
+	if isDeclaration(entry) || !entry.Children {
+		var err error
+		if entry, q, err = p.definition(entry); err != nil {
+			return nil, err
+		}
+	}
+	typ, err := q.index.typeAt(entry.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get type: %w", err)
+	}
+	st, ok := underlyingType(typ).(*dwarf.StructType)
+	if !ok {
+		return nil, nil
+	}
+	return q.composite(entry, st), nil
+}
+
+// composite returns the given struct as walked by FieldAt and Describe, BTF and C have no base classes.
+func (ts *typeSet) composite(st *dwarf.StructType) *composite {
+	return &composite{
+		st: st,
+		member: func(i int) (*composite, error) {
+			typ := underlyingType(st.Field[i].Type)
+			for j := 0; j < maxTypeDepth; j++ {
+				at, ok := typ.(*dwarf.ArrayType)
+				if !ok {
+					break
+				}
+				typ = underlyingType(at.Type)
+			}
+			inner, ok := typ.(*dwarf.StructType)
+			if !ok {
+				return nil, nil
+			}
+			if inner.Incomplete {
+				if inner, ok = ts.definition(inner.StructName).(*dwarf.StructType); !ok || inner.Incomplete {
+					return nil, nil
+				}
+			}
+			return ts.composite(inner), nil
+		},
+		bitOffset: func(i int) (int64, error) {
+			return st.Field[i].DataBitOffset, nil
+		},
+	}
+}
@@ -0,0 +1,213 @@
+package datamap
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzMaps returns the map structs the fuzzed files are read with, covering all the operations.
+func fuzzMaps() []any {
+	return []any{
+		&testMap{},
+		&nestedMap{},
+		&supplementaryMap{},
+		&inheritanceMap{},
+		&unitMap{},
+		&splitMap{},
+		&tlsMap{},
+		&exprMap{},
+		&locationMap{},
+		&struct {
+			Address  int64 `addressof:"counter"`
+			Enum     int64 `enumval:"color.GREEN"`
+			Bits     int64 `bitsizeof:"flags.mode"`
+			BitsOff  int64 `bitoffsetof:"flags.mode"`
+			Length   int64 `lengthof:"holder.counters"`
+			Stride   int64 `strideof:"holder.counters"`
+			Elements int64 `offsetof:"holder.items[1].value"`
+		}{},
+	}
+}
+
+// checkMalformed fails the test when reading a fuzzed input failed for another reason than it being malformed,
+// of a version that is not supported, or referring to a file that does not exist.
+func checkMalformed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil && !errors.Is(err, ErrMalformed) && !errors.Is(err, errors.ErrUnsupported) && !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("error = %v, want %v", err, ErrMalformed)
+	}
+}
+
+// addFuzzFiles adds the ELF files of the given pattern in testdata to the seed corpus.
+func addFuzzFiles(f *testing.F, pattern string) {
+	f.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", pattern))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzReadFromDWARF(f *testing.F) {
+	addFuzzFiles(f, "x86_64/*")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ef, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// The supplementary files are looked up in testdata, whatever their paths.
+		idx, err := NewTypeIndex(ef, WithDebugDirs("testdata"))
+		if err != nil {
+			checkMalformed(t, err)
+			return
+		}
+		defer idx.Close()
+		for _, m := range fuzzMaps() {
+			dm, err := New(m, WithVersion("3.11.0"))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			// Only panics matter.
+			_, _ = dm.Extract(idx)
+		}
+	})
+}
+
+func FuzzReadFromBTF(f *testing.F) {
+	addFuzzFiles(f, "x86_64/routes-btf")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ef, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil || ef.Section(".BTF") == nil {
+			return
+		}
+		idx, err := NewBTFIndex(ef)
+		if err != nil {
+			checkMalformed(t, err)
+			return
+		}
+		for _, m := range fuzzMaps() {
+			dm, err := New(m, WithVersion("3.11.0"))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			_, _ = dm.Extract(idx)
+		}
+	})
+}
+
+func FuzzReadDWP(f *testing.F) {
+	addFuzzFiles(f, "x86_64/dwp/*.dwp")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ef, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// A file without the sections of a package is not one.
+		for _, name := range []string{".debug_cu_index", ".debug_info.dwo", ".debug_abbrev.dwo", ".debug_str.dwo", ".debug_str_offsets.dwo"} {
+			if ef.Section(name) == nil {
+				return
+			}
+		}
+		b := newBudget(context.Background(), &options{})
+		units, err := readDWP(ef, b)
+		if err != nil {
+			checkMalformed(t, err)
+			return
+		}
+		for _, sections := range units {
+			if idx, err := sections.index(ef, b); err == nil {
+				_, _ = idx.lookup("thread")
+			}
+		}
+	})
+}
+
+func FuzzParseDebugNames(f *testing.F) {
+	f.Add([]byte{}, []byte{})
+	f.Fuzz(func(t *testing.T, data, str []byte) {
+		_, _, err := parseDebugNames(data, str, binary.LittleEndian)
+		checkMalformed(t, err)
+	})
+}
+
+func FuzzParseGDBIndex(f *testing.F) {
+	f.Add([]byte{})
+	ef, err := elf.Open("testdata/x86_64/test-gdb-index")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer ef.Close()
+	data, err := ef.Section(".gdb_index").Data()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	// A CU list that is not a whole number of entries.
+	header := make([]byte, 24)
+	for i, v := range []uint32{8, 24, 28, 28, 28, 28} {
+		binary.LittleEndian.PutUint32(header[i*4:], v)
+	}
+	f.Add(append(header, make([]byte, 4)...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := parseGDBIndex(data)
+		checkMalformed(t, err)
+	})
+}
+
+func FuzzReadUnitHeaders(f *testing.F) {
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := readUnitHeaders(bytes.NewReader(data), int64(len(data)), binary.LittleEndian)
+		checkMalformed(t, err)
+	})
+}
+
+func FuzzNewRoute(f *testing.F) {
+	for _, seed := range []string{
+		"test_t.nested.deeply_nested",
+		"holder.ptr*.value",
+		"holder.items[1].value",
+		"'struct foo'.bar|baz.qux",
+		"vm.frames[#].prev",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, route string) {
+		routes, err := splitRoute(route, "|")
+		if err != nil {
+			return
+		}
+		for _, r := range routes {
+			_, _ = newRouteFromTagValue(r)
+		}
+	})
+}
+
+func FuzzParseExpression(f *testing.F) {
+	for _, seed := range []string{
+		"offsetof(rb_iseq_constant_body.insns_info) + offsetof(iseq_insn_info.size)",
+		"sizeof(PyASCIIObject) - 8",
+		"-0x10",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		_, _ = parseExpression(expr)
+	})
+}
@@ -0,0 +1,124 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+
+	"github.com/parca-dev/runtime-data/pkg/cheader"
+)
+
+// The layouts of the types can be computed from the C headers of a runtime,
+// when no build of it has debug information, e.g. for a vendor patch or an unreleased branch.
+// The types are converted to their debug/dwarf counterparts, as GCC would describe them,
+// so routes are resolved with the same rules as for DWARF and BTF.
+
+// WithIncludeDirs sets the directories the headers included by the headers a HeaderIndex is built from
+// are looked up in, like the -I flags of a compiler.
+func WithIncludeDirs(dirs ...string) Option {
+	return func(o *options) {
+		o.includeDirs = append(o.includeDirs, dirs...)
+	}
+}
+
+// WithDefines defines macros before the headers a HeaderIndex is built from are preprocessed,
+// as NAME or NAME=VALUE like the -D flags of a compiler, e.g. Py_GIL_DISABLED.
+func WithDefines(defines ...string) Option {
+	return func(o *options) {
+		o.defines = append(o.defines, defines...)
+	}
+}
+
+// WithABI sets the ABI the types of a HeaderIndex are laid out for, e.g. x86_64 or aarch64,
+// x86_64 by default.
+func WithABI(name string) Option {
+	return func(o *options) {
+		o.abi = name
+	}
+}
+
+// HeaderIndex maps names to the types declared by a set of C headers, laid out for an ABI.
+// It is the header counterpart of TypeIndex, the routes of variables cannot be resolved from it.
+type HeaderIndex struct {
+	typeSet
+	// errs are the reasons the layouts of some types could not be computed, by name.
+	errs     map[string]error
+	warnings []error
+}
+
+// NewHeaderIndex builds a HeaderIndex from the given headers, preprocessed in order
+// as if they were included by a single source file.
+// The include directories, the macros and the ABI are set with WithIncludeDirs, WithDefines and WithABI.
+func NewHeaderIndex(headers []string, opts ...Option) (*HeaderIndex, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	cfg := cheader.Config{
+		IncludeDirs: o.includeDirs,
+		Defines:     o.defines,
+	}
+	if o.abi != "" {
+		abi, err := cheader.LookupABI(o.abi)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ABI = abi
+	}
+	types, err := cheader.Parse(headers, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse headers: %w", err)
+	}
+
+	idx := &HeaderIndex{
+		typeSet:  newTypeSet("C headers"),
+		errs:     types.Errors,
+		warnings: types.Warnings,
+	}
+	names := make([]string, 0, len(types.Names))
+	for name := range types.Names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// The types have no offsets, they are numbered in the order of their names,
+	// 0 being no entry.
+	var id dwarf.Offset
+	for _, name := range names {
+		for _, typ := range types.Names[name] {
+			id++
+			idx.names[name] = append(idx.names[name], typeEntry{id: id, typ: typ})
+		}
+	}
+	return idx, nil
+}
+
+// Warnings returns the problems that did not stop the headers from being parsed,
+// e.g. the system headers that were not found and the declarations that were skipped.
+func (idx *HeaderIndex) Warnings() []error {
+	return idx.warnings
+}
+
+// Headers have no compilation units.
+func (idx *HeaderIndex) unitOf(dwarf.Offset) dwarf.Offset {
+	return 0
+}
+
+// route resolves the given route and sets the values of its extractors.
+// The entries of the report are numbers given to the types in the order of their names.
+func (idx *HeaderIndex) route(rn *RouteNode) error {
+	if err, ok := idx.errs[rn.Type]; ok && len(idx.names[rn.Type]) == 0 {
+		return fmt.Errorf("failed to lay out %s: %w", rn.Type, err)
+	}
+	return idx.typeSet.route(rn)
+}
+
+// ReadFromHeaders computes the layouts of the types declared by the given C headers
+// and sets the values of the map struct.
+func (dataMap *DataMap) ReadFromHeaders(headers []string, opts ...Option) error {
+	idx, err := NewHeaderIndex(headers, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = dataMap.Extract(idx, opts...)
+	return err
+}
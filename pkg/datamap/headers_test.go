@@ -0,0 +1,324 @@
+package datamap
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestDescribeHeaders checks the layouts computed from the sources of the test programs
+// against the ones GCC, or Zig for the cross-compiled programs, describes in their DWARF data.
+// Every struct and union declared by the sources that the DWARF data describes is compared.
+func TestDescribeHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		binary  string
+		headers []string
+		opts    []Option
+		// unit pins the DWARF definitions to a compilation unit, when the program defines types differently in its units.
+		unit string
+		// routes are compared on top of the names, e.g. to follow pointers.
+		routes []string
+		// skip are the types whose layouts are not expected to be computed, with the reason.
+		skip map[string]string
+		// want are the names whose layouts are compared.
+		want []string
+	}{
+		{
+			name:    "routes",
+			binary:  "testdata/x86_64/routes",
+			headers: []string{"testdata/routes.c"},
+			routes:  []string{"vm.threads*"},
+			want: []string{
+				"ascii_object", "const_frame_t", "execution_context", "frame", "interpreter", "interpreter_alias_t",
+				"interpreter_t", "key_data", "runtime", "slot", "thread", "thread_t", "vm",
+			},
+		},
+		{
+			name:    "locations",
+			binary:  "testdata/x86_64/locations",
+			headers: []string{"testdata/locations.c"},
+			want:    []string{"frame", "thread_state"},
+		},
+		{
+			name:    "x86_64",
+			binary:  "testdata/x86_64/test",
+			headers: []string{"testdata/test.c"},
+			skip:    map[string]string{"FILE": "the built-in stdio.h only declares it"},
+			want:    []string{"__va_list_tag", "test_t"},
+		},
+		{
+			name:    "aarch64",
+			binary:  "testdata/aarch64/test",
+			headers: []string{"testdata/test.c"},
+			opts:    []Option{WithABI("aarch64")},
+			skip:    map[string]string{"FILE": "the built-in stdio.h only declares it"},
+			want:    []string{"__builtin_va_list", "__va_list", "test_t", "va_list"},
+		},
+		{
+			name:    "main unit",
+			binary:  "testdata/x86_64/units",
+			headers: []string{"testdata/units/main.c"},
+			unit:    "units/main.c",
+			want:    []string{"list_head", "pthread", "tls_block"},
+		},
+		{
+			name:    "pthread_create unit",
+			binary:  "testdata/x86_64/units",
+			headers: []string{"testdata/units/nptl/pthread_create.c"},
+			unit:    "units/nptl/pthread_create.c",
+			want:    []string{"list_head", "pthread", "tls_block"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ef, err := elf.Open(tt.binary)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+			dwarfIdx, err := NewTypeIndex(ef)
+			if err != nil {
+				t.Fatalf("NewTypeIndex() error = %v", err)
+			}
+			defer dwarfIdx.Close()
+
+			// The program the DWARF data is read from is built from the same source.
+			idx, err := NewHeaderIndex(tt.headers, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewHeaderIndex() error = %v", err)
+			}
+			if w := idx.Warnings(); len(w) != 0 {
+				t.Errorf("NewHeaderIndex() warnings = %v, want none", w)
+			}
+
+			names := make([]string, 0, len(idx.names))
+			for name := range idx.names {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var compared []string
+			for _, route := range append(names, tt.routes...) {
+				if _, ok := tt.skip[route]; ok {
+					continue
+				}
+				want, err := describeUnit(dwarfIdx, route, tt.unit)
+				if err != nil {
+					// The type is not a struct or a union, or the program does not use it.
+					continue
+				}
+				got, err := describeUnit(idx, route, "")
+				if err != nil {
+					t.Errorf("Describe(%s) error = %v", route, err)
+					continue
+				}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("Describe(%s) mismatch (-DWARF +headers):\n%s", route, diff)
+				}
+				if !strings.HasSuffix(route, "*") {
+					compared = append(compared, route)
+				}
+			}
+			if diff := cmp.Diff(tt.want, compared); diff != "" {
+				t.Errorf("compared types mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// describeUnit is Describe with the definitions of the types pinned to the given compilation unit, if any,
+// as the cu tag of a map struct does.
+func describeUnit(src Source, route, unit string) (*TypeLayout, error) {
+	rn, err := newRouteFromTagValue(route)
+	if err != nil {
+		return nil, err
+	}
+	rn.Unit = unit
+	var l *TypeLayout
+	field := &target{name: route, routes: []string{route}, matched: -1}
+	rn.Leaf().Extractors = []*Extractor{{
+		inspect: func(c *composite) error {
+			var err error
+			l, err = describe(c, -1, 0)
+			return err
+		},
+		field: field,
+	}}
+	if err := src.route(rn); err != nil {
+		return nil, err
+	}
+	if len(field.errs) > 0 {
+		return nil, errors.Join(field.errs...)
+	}
+	if l == nil {
+		return nil, fmt.Errorf("failed to find %s", route)
+	}
+	return l, nil
+}
+
+func TestDataMap_ReadFromHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		lm      any
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "pointer dereference",
+			lm:   &chainMap{},
+			want: &chainMap{
+				MainThreadCFP: []int64{8, 16, 16},
+				ThreadState:   [2]int{24, 8},
+				ThreadEC:      16,
+				ECSize:        8,
+			},
+		},
+		{
+			name: "bitfields",
+			lm:   &bitfieldMap{},
+			want: wantBitfieldMap,
+		},
+		{
+			name: "enumerators",
+			lm:   &enumMap{},
+			want: &enumMap{
+				OwnedByThread: 0,
+				OwnedByCStack: 3,
+				MagicBlock:    0x22220001,
+			},
+		},
+		{
+			name: "signed and unsigned enumerators",
+			lm:   &signedEnumMap{},
+			want: wantSignedEnumMap,
+		},
+		{
+			name: "arrays",
+			lm:   &btfArrayMap{},
+			want: &btfArrayMap{
+				SpecificData:   48,
+				SpecificLength: 32,
+				SpecificStride: 16,
+				FramePrev:      []int64{656, 8},
+				ContextCFP:     712,
+				NameLength:     0,
+			},
+		},
+		{
+			name: "nested structs and arrays of structs",
+			lm:   &nestedMap{},
+			want: wantNestedMap,
+		},
+		{
+			name: "anonymous members",
+			lm:   &anonymousMap{},
+			want: wantAnonymousMap,
+		},
+		{
+			name: "alternatives",
+			lm:   &alternativeMap{},
+			want: &alternativeMap{
+				Count:       16,
+				ID:          0,
+				MainEC:      []int64{8, 16},
+				ThreadsHead: 24,
+			},
+		},
+		{
+			name: "missing type",
+			lm: &struct {
+				A int64 `offsetof:"pthread.specific"`
+			}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := New(tt.lm)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+
+			err = dm.ReadFromHeaders([]string{"testdata/routes.c"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFromHeaders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, tt.lm); diff != "" {
+				t.Errorf("ReadFromHeaders() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewHeaderIndex(t *testing.T) {
+	type pthreadMap struct {
+		CancelHandling int64 `offsetof:"pthread.cancelhandling"`
+		Size           int64 `sizeof:"pthread"`
+		BlockSize      int64 `sizeof:"tls_block"`
+	}
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want *pthreadMap
+	}{
+		{
+			name: "default",
+			want: &pthreadMap{CancelHandling: 8, Size: 32, BlockSize: 8},
+		},
+		{
+			name: "defines",
+			opts: []Option{WithDefines("WITH_HEADER")},
+			want: &pthreadMap{CancelHandling: 40, Size: 64, BlockSize: 8},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &pthreadMap{}
+			dm, err := New(m)
+			if err != nil {
+				t.Fatalf("failed to generate query: %v", err)
+			}
+			if err := dm.ReadFromHeaders([]string{"testdata/units/descr.h", "testdata/units/nptl/tls.h"}, append(tt.opts, WithStrict())...); err != nil {
+				t.Fatalf("ReadFromHeaders() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, m); diff != "" {
+				t.Errorf("ReadFromHeaders() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := NewHeaderIndex([]string{"testdata/routes.c"}, WithABI("sparc")); err == nil {
+		t.Error("NewHeaderIndex() with an unsupported ABI, want error")
+	}
+	if _, err := NewHeaderIndex([]string{"testdata/missing.h"}); err == nil {
+		t.Error("NewHeaderIndex() of a missing header, want error")
+	}
+
+	// The layout of a struct with a member of an unknown type cannot be computed,
+	// the structs that only point to it can.
+	dir := t.TempDir()
+	header := filepath.Join(dir, "unknown.h")
+	src := "#include <stddef.h>\nstruct a { size_t n; unknown_t u; };\nstruct b { struct a *a; long n; };\n"
+	if err := os.WriteFile(header, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := NewHeaderIndex([]string{header})
+	if err != nil {
+		t.Fatalf("NewHeaderIndex() error = %v", err)
+	}
+	if _, err := Describe(idx, "a", 0); err == nil || !strings.Contains(err.Error(), "unknown type unknown_t") {
+		t.Errorf("Describe(a) error = %v, want unknown type unknown_t", err)
+	}
+	if _, err := Describe(idx, "b", 0); err != nil {
+		t.Errorf("Describe(b) error = %v", err)
+	}
+}
@@ -0,0 +1,767 @@
+package datamap
+
+import (
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// indexedTags are the DWARF tags that are recorded in the TypeIndex.
+var indexedTags = map[dwarf.Tag]bool{
+	dwarf.TagStructType:      true,
+	dwarf.TagClassType:       true,
+	dwarf.TagUnionType:       true,
+	dwarf.TagTypedef:         true,
+	dwarf.TagEnumerationType: true,
+}
+
+// TypeIndex maps names to the DWARF entries of the types they refer to.
+//
+// The index is built once per ELF file and can be shared by multiple DataMaps,
+// so .debug_info does not have to be rescanned for every route.
+// When the file carries a .debug_names or a .gdb_index accelerator table,
+// the index is built from it instead of walking every entry.
+// When the file links to a supplementary file written by dwz, through .gnu_debugaltlink,
+// the types that have been moved there are resolved from it as well.
+// When the file has been built with split DWARF, the types are resolved from its split units,
+// read from the .dwo files or the .dwp package of the program.
+// A TypeIndex is safe for concurrent use.
+type TypeIndex struct {
+	ef        *elf.File
+	dwarfData *dwarf.Data
+
+	// alt indexes the supplementary file, if any.
+	alt *TypeIndex
+	// altStr is the .debug_str section of the supplementary file.
+	altStr []byte
+	// closeAlt closes the supplementary file when it has been opened by the index.
+	closeAlt func() error
+	// altErr is the reason the supplementary file the program links to has not been found,
+	// reported when a type refers to it.
+	altErr error
+
+	// split indexes the split units of the program, if it has been built with split DWARF.
+	split []*TypeIndex
+	// skeleton is the index of the program, for the index of a split unit.
+	skeleton *TypeIndex
+	// info is the .debug_info data of a split unit, which is only part of a section in a .dwp package.
+	info []byte
+	// closeSplit closes the .dwo files and the .dwp packages opened by the index.
+	closeSplit []func() error
+
+	mu sync.Mutex
+	// names maps entry names to their offsets in .debug_info.
+	names map[string][]dwarf.Offset
+	// variables maps the names and the linkage names of global variables to their offsets in .debug_info.
+	variables map[string][]dwarf.Offset
+	// functions maps the names and the linkage names of the functions that have code
+	// to the offsets of their entries in .debug_info.
+	functions map[string][]dwarf.Offset
+	// units maps unqualified names to the offsets of the compilation units that define them.
+	// It is only populated from .gdb_index, which does not point at the entries directly.
+	units map[string][]dwarf.Offset
+	// scanned keeps track of the compilation units that have already been added to names.
+	scanned map[dwarf.Offset]bool
+	// unitHeaders are the compilation units in .debug_info, read on demand.
+	unitHeaders []unitHeader
+	// linked keeps track of the types whose references to the supplementary file have been resolved.
+	linked map[dwarf.Type]bool
+	// qualified maps the offsets of the named entries to their names qualified by their enclosing
+	// namespaces and classes, e.g. "v8::internal::Isolate", read on demand per compilation unit.
+	qualified map[dwarf.Offset]string
+	// qualifiedUnits keeps track of the compilation units that have already been added to qualified.
+	qualifiedUnits map[dwarf.Offset]bool
+	// unitNames and unitFiles are the names and the file name tables of the compilation units, read on demand.
+	unitNames map[dwarf.Offset]string
+	unitFiles map[dwarf.Offset][]*dwarf.LineFile
+	// sections are the contents of the sections read on demand, nil for the missing ones.
+	sections map[string][]byte
+
+	// budget bounds the reads of the index, shared with its supplementary file and its split units.
+	budget *budget
+}
+
+// NewTypeIndex builds a TypeIndex for the given ELF file.
+// The supplementary file the ELF file links to is looked up as described by WithSupplementaryFile,
+// WithELFPath and WithDebugDirs, the split units as described by WithSplitDWARFDirs,
+// the index must be closed to release them.
+func NewTypeIndex(ef *elf.File, opts ...Option) (*TypeIndex, error) {
+	return NewTypeIndexContext(context.Background(), ef, opts...)
+}
+
+// NewTypeIndexContext is like NewTypeIndex, the given context cancels the reads of the index,
+// while it is built and afterwards. The limits set with WithMaxEntries and WithMaxBytes
+// apply to the lifetime of the index, the timeout set with WithTimeout to building it.
+func NewTypeIndexContext(ctx context.Context, ef *elf.File, opts ...Option) (*TypeIndex, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	b := newBudget(ctx, o)
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		b.ctx, cancel = o.withTimeout(ctx)
+		defer cancel()
+		// The index outlives the timeout.
+		defer func() { b.ctx = ctx }()
+	}
+
+	idx, err := newTypeIndex(ef, b)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.openSplitUnits(o.splitDirs); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	if ef.Section(".gnu_debugaltlink") == nil {
+		return idx, nil
+	}
+
+	idx.linked = map[dwarf.Type]bool{}
+	alt := o.supplementary
+	if alt == nil {
+		alt, err = openSupplementary(ef, o.elfPath, o.debugDirs)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The types that do not refer to the supplementary file can still be resolved.
+			idx.altErr = err
+			return idx, nil
+		}
+		if err != nil {
+			idx.Close()
+			return nil, err
+		}
+		idx.closeAlt = alt.Close
+	}
+	if idx.alt, err = newTypeIndex(alt, b); err != nil {
+		idx.Close()
+		return nil, fmt.Errorf("failed to index supplementary file: %w", err)
+	}
+	if sec := alt.Section(".debug_str"); sec != nil {
+		if idx.altStr, err = b.data(sec); err != nil {
+			idx.Close()
+			return nil, fmt.Errorf("failed to read .debug_str of supplementary file: %w", err)
+		}
+	}
+	return idx, nil
+}
+
+// Close releases the supplementary file and the split units opened by the index, if any.
+func (idx *TypeIndex) Close() error {
+	errs := []error{}
+	for _, closeSplit := range idx.closeSplit {
+		errs = append(errs, closeSplit())
+	}
+	if idx.closeAlt != nil {
+		errs = append(errs, idx.closeAlt())
+	}
+	return errors.Join(errs...)
+}
+
+func newTypeIndex(ef *elf.File, b *budget) (*TypeIndex, error) {
+	dwarfData, err := b.dwarf(ef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DWARF info: %w", err)
+	}
+	return indexDWARF(ef, dwarfData, b)
+}
+
+// indexDWARF builds a TypeIndex for the given DWARF data of the given ELF file,
+// whose reads are accounted for in the given budget.
+func indexDWARF(ef *elf.File, dwarfData *dwarf.Data, b *budget) (*TypeIndex, error) {
+	idx := &TypeIndex{
+		ef:             ef,
+		dwarfData:      dwarfData,
+		names:          map[string][]dwarf.Offset{},
+		variables:      map[string][]dwarf.Offset{},
+		functions:      map[string][]dwarf.Offset{},
+		scanned:        map[dwarf.Offset]bool{},
+		qualified:      map[dwarf.Offset]string{},
+		qualifiedUnits: map[dwarf.Offset]bool{},
+		unitNames:      map[dwarf.Offset]string{},
+		unitFiles:      map[dwarf.Offset][]*dwarf.LineFile{},
+		sections:       map[string][]byte{},
+		budget:         b,
+	}
+
+	if sec := ef.Section(".debug_names"); sec != nil {
+		if err := idx.readDebugNames(sec); err == nil {
+			return idx, nil
+		}
+		// Fall back to the next available source.
+		idx.names = map[string][]dwarf.Offset{}
+		idx.variables = map[string][]dwarf.Offset{}
+		idx.functions = map[string][]dwarf.Offset{}
+		idx.scanned = map[dwarf.Offset]bool{}
+	}
+
+	if sec := ef.Section(".gdb_index"); sec != nil {
+		if err := idx.readGDBIndex(sec); err == nil {
+			return idx, nil
+		}
+		idx.units = nil
+	}
+
+	if err := idx.scanAll(); err != nil {
+		return nil, fmt.Errorf("failed to index DWARF data: %w", err)
+	}
+	return idx, nil
+}
+
+// readDebugNames populates the index from the DWARF 5 name index.
+// The units it does not list, e.g. the ones of objects built without -gpubnames
+// linked with ones built with it, and the type units, are scanned.
+func (idx *TypeIndex) readDebugNames(sec *elf.Section) error {
+	data, err := idx.budget.data(sec)
+	if err != nil {
+		return fmt.Errorf("failed to read .debug_names: %w", err)
+	}
+	strSec := idx.ef.Section(".debug_str")
+	if strSec == nil {
+		return fmt.Errorf("%w: .debug_names without a .debug_str section", ErrMalformed)
+	}
+	str, err := idx.budget.data(strSec)
+	if err != nil {
+		return fmt.Errorf("failed to read .debug_str: %w", err)
+	}
+
+	entries, listed, err := parseDebugNames(data, str, idx.ef.ByteOrder)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.tag == dwarf.TagVariable {
+			idx.variables[e.name] = append(idx.variables[e.name], e.offset)
+			continue
+		}
+		if e.tag == dwarf.TagSubprogram {
+			idx.functions[e.name] = append(idx.functions[e.name], e.offset)
+			continue
+		}
+		if !indexedTags[e.tag] {
+			continue
+		}
+		idx.names[e.name] = append(idx.names[e.name], e.offset)
+	}
+	return idx.scanUnlisted(listed)
+}
+
+// scanUnlisted records the indexed entries of the units of .debug_info whose headers are not at the given offsets.
+func (idx *TypeIndex) scanUnlisted(listed []dwarf.Offset) error {
+	units, err := idx.readUnitHeaders()
+	if err != nil {
+		return fmt.Errorf("failed to read unit headers: %w", err)
+	}
+	idx.unitHeaders = units
+	for _, off := range listed {
+		idx.scanned[off] = true
+	}
+	for _, unit := range units {
+		if err := idx.scanUnit(unit.offset); err != nil {
+			return fmt.Errorf("failed to scan unit at %#x: %w", unit.offset, err)
+		}
+	}
+	return nil
+}
+
+// readGDBIndex populates the index from the index section written by gdb, gold and lld.
+func (idx *TypeIndex) readGDBIndex(sec *elf.Section) error {
+	data, err := idx.budget.data(sec)
+	if err != nil {
+		return fmt.Errorf("failed to read .gdb_index: %w", err)
+	}
+
+	symbols, err := parseGDBIndex(data)
+	if err != nil {
+		return err
+	}
+	idx.units = map[string][]dwarf.Offset{}
+	for _, s := range symbols {
+		name := unqualifiedName(s.name)
+		idx.units[name] = append(idx.units[name], s.units...)
+	}
+	return nil
+}
+
+// scanAll walks all the entries in .debug_info once and records the indexed ones.
+func (idx *TypeIndex) scanAll() error {
+	r := idx.reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if entry == nil {
+			break
+		}
+		idx.record(entry)
+	}
+	return nil
+}
+
+// scanUnit records the indexed entries of the unit whose header is at the given offset.
+func (idx *TypeIndex) scanUnit(off dwarf.Offset) error {
+	if idx.scanned[off] {
+		return nil
+	}
+	idx.scanned[off] = true
+
+	// The reader seeks to entries, the unit entry follows the header.
+	unit := idx.unitAt(off)
+	if unit.offset != off {
+		return fmt.Errorf("%w: no unit at %#x", ErrMalformed, off)
+	}
+	r := idx.reader()
+	r.Seek(unit.entry)
+	entry, err := r.Next()
+	if err != nil {
+		return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	if entry == nil || !entry.Children {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		entry, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			depth--
+			continue
+		}
+		if entry.Children {
+			depth++
+		}
+		idx.record(entry)
+	}
+	return nil
+}
+
+func (idx *TypeIndex) record(entry *dwarf.Entry) {
+	if entry.Tag == dwarf.TagVariable {
+		idx.recordVariable(entry)
+		return
+	}
+	if entry.Tag == dwarf.TagSubprogram {
+		idx.recordFunction(entry)
+		return
+	}
+	if !indexedTags[entry.Tag] {
+		return
+	}
+	name := idx.nameOf(entry)
+	if name == "" {
+		return
+	}
+	idx.names[name] = append(idx.names[name], entry.Offset)
+}
+
+// recordVariable records the definitions of global variables,
+// by the names of their declarations when they are defined out of them, e.g. C++ static members.
+func (idx *TypeIndex) recordVariable(entry *dwarf.Entry) {
+	if entry.AttrField(dwarf.AttrLocation) == nil {
+		return
+	}
+	decl := entry
+	if spec, ok := entry.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+		r := idx.reader()
+		r.Seek(spec)
+		if e, err := r.Next(); err == nil && e != nil {
+			decl = e
+		}
+	}
+	for _, attr := range []dwarf.Attr{dwarf.AttrName, dwarf.AttrLinkageName} {
+		name, ok := idx.stringAttr(decl, attr)
+		if !ok || name == "" {
+			name, ok = idx.stringAttr(entry, attr)
+		}
+		if !ok || name == "" {
+			continue
+		}
+		idx.variables[name] = append(idx.variables[name], entry.Offset)
+	}
+}
+
+// recordFunction records the functions that have code, by the names of their declarations
+// or of their abstract instances when they are defined out of them, e.g. C++ methods and inlined functions.
+func (idx *TypeIndex) recordFunction(entry *dwarf.Entry) {
+	if entry.AttrField(dwarf.AttrLowpc) == nil && entry.AttrField(dwarf.AttrRanges) == nil {
+		return
+	}
+	decl := idx.origin(entry)
+	for _, attr := range []dwarf.Attr{dwarf.AttrName, dwarf.AttrLinkageName} {
+		name, ok := idx.stringAttr(decl, attr)
+		if !ok || name == "" {
+			name, ok = idx.stringAttr(entry, attr)
+		}
+		if !ok || name == "" {
+			continue
+		}
+		idx.functions[name] = append(idx.functions[name], entry.Offset)
+	}
+}
+
+// origin returns the entry the given one is a concrete instance or the definition of, the entry itself if none.
+// The abstract instance of a C++ method can itself refer to the declaration of the method.
+func (idx *TypeIndex) origin(entry *dwarf.Entry) *dwarf.Entry {
+	r := idx.reader()
+	for i := 0; i < 2; i++ {
+		off, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if off, ok = entry.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				break
+			}
+		}
+		r.Seek(off)
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		entry = e
+	}
+	return entry
+}
+
+// lookup returns the indexed entries with the given name.
+// A name qualified by its namespaces and enclosing classes, e.g. "v8::internal::Isolate",
+// only matches the entries declared in them, an unqualified name matches all of them.
+func (idx *TypeIndex) lookup(name string) ([]*dwarf.Entry, error) {
+	return idx.lookupIn(idx.names, name, func(entry *dwarf.Entry) bool {
+		return indexedTags[entry.Tag]
+	})
+}
+
+// lookupVariable returns the definitions of the global variables with the given name or linkage name.
+func (idx *TypeIndex) lookupVariable(name string) ([]*dwarf.Entry, error) {
+	return idx.lookupIn(idx.variables, name, func(entry *dwarf.Entry) bool {
+		return entry.Tag == dwarf.TagVariable
+	})
+}
+
+// lookupFunction returns the entries of the functions that have code with the given name or linkage name,
+// out-of-line instances of inlined functions included.
+func (idx *TypeIndex) lookupFunction(name string) ([]*dwarf.Entry, error) {
+	return idx.lookupIn(idx.functions, name, func(entry *dwarf.Entry) bool {
+		return entry.Tag == dwarf.TagSubprogram
+	})
+}
+
+func (idx *TypeIndex) lookupIn(offsets map[string][]dwarf.Offset, name string, keep func(*dwarf.Entry) bool) ([]*dwarf.Entry, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	bare := unqualifiedName(name)
+	for _, unit := range idx.units[bare] {
+		if err := idx.scanUnit(unit); err != nil {
+			return nil, fmt.Errorf("failed to scan compilation unit at %#x: %w", unit, err)
+		}
+	}
+
+	var (
+		entries = []*dwarf.Entry{}
+		r       = idx.reader()
+	)
+	for _, off := range offsets[bare] {
+		r.Seek(off)
+		entry, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if entry == nil || entry.Offset != off {
+			return nil, fmt.Errorf("no entry at offset %#x", off)
+		}
+		if !keep(entry) {
+			continue
+		}
+		if bare != name {
+			qualified, err := idx.qualifiedName(entry)
+			if err != nil {
+				return nil, err
+			}
+			if qualified != name {
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// qualifiedNameOf returns the name of the given entry qualified by its namespaces and enclosing classes.
+func (idx *TypeIndex) qualifiedNameOf(entry *dwarf.Entry) (string, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.qualifiedName(entry)
+}
+
+// qualifiedName returns the name of the given entry qualified by its namespaces and enclosing classes.
+// The caller must hold idx.mu.
+func (idx *TypeIndex) qualifiedName(entry *dwarf.Entry) (string, error) {
+	unit := idx.unitAt(entry.Offset)
+	if !idx.qualifiedUnits[unit.offset] {
+		idx.qualifiedUnits[unit.offset] = true
+		if err := idx.qualifyUnit(unit.entry); err != nil {
+			return "", fmt.Errorf("failed to read scopes of compilation unit at %#x: %w", unit.offset, err)
+		}
+	}
+	if name, ok := idx.qualified[entry.Offset]; ok {
+		return name, nil
+	}
+	return idx.nameOf(entry), nil
+}
+
+// scopeTags are the DWARF tags whose children are qualified by their name.
+var scopeTags = map[dwarf.Tag]bool{
+	dwarf.TagNamespace:  true,
+	dwarf.TagClassType:  true,
+	dwarf.TagStructType: true,
+	dwarf.TagUnionType:  true,
+}
+
+// qualifyUnit records the qualified names of the named entries of the compilation unit
+// whose unit entry is at the given offset.
+// The entries declared in functions are left out, their names are not qualified.
+// The caller must hold idx.mu.
+func (idx *TypeIndex) qualifyUnit(off dwarf.Offset) error {
+	r := idx.reader()
+	r.Seek(off)
+	unit, err := r.Next()
+	if err != nil {
+		return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	if unit == nil || !unit.Children {
+		return nil
+	}
+
+	// scopes are the enclosing entries, innermost last.
+	type scope struct {
+		name string
+		// local is set in functions, whose entries are not qualified.
+		local bool
+	}
+	scopes := []scope{{}}
+	for len(scopes) > 0 {
+		entry, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			scopes = scopes[:len(scopes)-1]
+			continue
+		}
+
+		var (
+			parent    = scopes[len(scopes)-1]
+			qualified string
+		)
+		if !parent.local {
+			qualified = idx.nameOf(entry)
+			if qualified == "" && entry.Tag == dwarf.TagNamespace {
+				qualified = "(anonymous namespace)"
+			}
+			if spec, ok := entry.Val(dwarf.AttrSpecification).(dwarf.Offset); ok && idx.qualified[spec] != "" {
+				// Defined out of the scope it is declared in, e.g. "class Outer::Inner {}".
+				qualified = idx.qualified[spec]
+			} else if qualified != "" && parent.name != "" {
+				qualified = parent.name + "::" + qualified
+			}
+			if qualified != "" {
+				idx.qualified[entry.Offset] = qualified
+			}
+		}
+		if entry.Children {
+			scopes = append(scopes, scope{name: qualified, local: parent.local || !scopeTags[entry.Tag]})
+		}
+	}
+	return nil
+}
+
+// typeAt reads the type at the given offset.
+// dwarf.Data caches the types it reads, which is not safe for concurrent use.
+func (idx *TypeIndex) typeAt(off dwarf.Offset) (dwarf.Type, error) {
+	if err := idx.budget.visit(); err != nil {
+		return nil, err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	typ, err := idx.dwarfData.Type(off)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if idx.alt != nil || idx.altErr != nil {
+		if err := idx.link(typ, off); err != nil {
+			return nil, fmt.Errorf("failed to resolve supplementary file references: %w", err)
+		}
+	}
+	return typ, nil
+}
+
+// unitOf returns the offset of the compilation unit that contains the given entry.
+// It returns 0 when the units cannot be read, or when they are split,
+// the entries being in the split units.
+func (idx *TypeIndex) unitOf(off dwarf.Offset) dwarf.Offset {
+	if len(idx.split) > 0 {
+		return 0
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.unitAt(off).offset
+}
+
+// unitHeader locates a compilation unit in .debug_info.
+type unitHeader struct {
+	// offset is the offset of the header of the unit.
+	offset dwarf.Offset
+	// entry is the offset of the unit entry, which follows the header.
+	entry dwarf.Offset
+	// version is the DWARF version of the unit.
+	version uint16
+	// offsetSize is the size of the section offsets of the unit, 8 in the 64-bit DWARF format.
+	offsetSize int
+	// typ is the DWARF 5 unit type, 0 before DWARF 5.
+	typ uint8
+	// id links skeleton units to their split units.
+	id uint64
+}
+
+// unitAt returns the compilation unit that contains the given entry.
+// The caller must hold idx.mu.
+func (idx *TypeIndex) unitAt(off dwarf.Offset) unitHeader {
+	if idx.unitHeaders == nil {
+		idx.unitHeaders = []unitHeader{}
+		if units, err := idx.readUnitHeaders(); err == nil && units != nil {
+			idx.unitHeaders = units
+		}
+	}
+	i := sort.Search(len(idx.unitHeaders), func(i int) bool {
+		return idx.unitHeaders[i].offset > off
+	})
+	if i == 0 {
+		return unitHeader{}
+	}
+	return idx.unitHeaders[i-1]
+}
+
+// readUnitHeaders reads the headers of the units of the index.
+func (idx *TypeIndex) readUnitHeaders() ([]unitHeader, error) {
+	if idx.info != nil {
+		return readUnitHeaders(bytes.NewReader(idx.info), int64(len(idx.info)), idx.ef.ByteOrder)
+	}
+	sec := idx.ef.Section(".debug_info")
+	if sec == nil {
+		return nil, nil
+	}
+	return readUnitHeaders(sec.Open(), int64(sec.Size), idx.ef.ByteOrder)
+}
+
+// DWARF 5 unit types whose headers have extra fields.
+const (
+	utType         = 0x02
+	utSkeleton     = 0x04
+	utSplitCompile = 0x05
+	utSplitType    = 0x06
+)
+
+// readUnitHeaders reads the unit headers in the given .debug_info data of the given size, without decoding the entries.
+func readUnitHeaders(r io.ReadSeeker, sectionSize int64, order binary.ByteOrder) ([]unitHeader, error) {
+	var (
+		units = []unitHeader{}
+		hdr   = make([]byte, 8)
+		off   int64
+	)
+	for {
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, hdr[:4]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return units, nil
+			}
+			return nil, malformed(err)
+		}
+		size := int64(4)
+		offsetSize := int64(4)
+		length := uint64(order.Uint32(hdr))
+		if length == 0xffffffff {
+			if _, err := io.ReadFull(r, hdr); err != nil {
+				return nil, malformed(err)
+			}
+			size += 8
+			offsetSize = 8
+			length = order.Uint64(hdr)
+		}
+		if length == 0 || length > uint64(sectionSize) {
+			return nil, fmt.Errorf("%w: invalid unit length at %#x", ErrMalformed, off)
+		}
+		if _, err := io.ReadFull(r, hdr[:3]); err != nil {
+			return nil, malformed(err)
+		}
+		// The version, then the abbreviation offset and the address size, in this order before DWARF 5.
+		var (
+			header = 2 + offsetSize + 1
+			unit   = unitHeader{offset: dwarf.Offset(off), version: order.Uint16(hdr), offsetSize: int(offsetSize)}
+		)
+		if unit.version >= 5 {
+			// The unit type comes first.
+			header++
+			unit.typ = hdr[2]
+			switch unit.typ {
+			case utSkeleton, utSplitCompile:
+				// The ID of the split unit, after the address size and the abbreviation offset.
+				if _, err := r.Seek(off+size+4+offsetSize, io.SeekStart); err != nil {
+					return nil, err
+				}
+				if _, err := io.ReadFull(r, hdr); err != nil {
+					return nil, malformed(err)
+				}
+				unit.id = order.Uint64(hdr)
+				header += 8
+			case utType, utSplitType:
+				// The type signature and the offset of the type.
+				header += 8 + offsetSize
+			}
+		}
+		unit.entry = dwarf.Offset(off + size + header)
+		units = append(units, unit)
+		off += size + int64(length)
+	}
+}
+
+// unqualifiedName strips the C++ scope qualifiers from the given name,
+// e.g. "ns::Outer::Inner<ns::T>" becomes "Inner<ns::T>".
+func unqualifiedName(name string) string {
+	depth := 0
+	last := 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ':':
+			if depth == 0 && strings.HasPrefix(name[i:], "::") {
+				last = i + 2
+				i++
+			}
+		}
+	}
+	return name[last:]
+}
@@ -0,0 +1,154 @@
+package datamap
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTypeIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputPath string
+		wantUnits bool
+	}{
+		{
+			name:      "full scan",
+			inputPath: fmt.Sprintf("testdata/%s/test", arch()),
+		},
+		{
+			name:      "gdb index",
+			inputPath: "testdata/x86_64/test-gdb-index",
+			wantUnits: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ef, err := elf.Open(tt.inputPath)
+			if err != nil {
+				t.Fatalf("failed to open ELF file: %v", err)
+			}
+			defer ef.Close()
+
+			idx, err := NewTypeIndex(ef)
+			if err != nil {
+				t.Fatalf("failed to build index: %v", err)
+			}
+			if got := idx.units != nil; got != tt.wantUnits {
+				t.Errorf("accelerated index = %v, want %v", got, tt.wantUnits)
+			}
+
+			entries, err := idx.lookup("test_t")
+			if err != nil {
+				t.Fatalf("failed to look up test_t: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Tag != dwarf.TagTypedef {
+				t.Fatalf("lookup(test_t) = %v, want a single typedef", entries)
+			}
+
+			// The same index is shared by several maps.
+			for i := 0; i < 2; i++ {
+				m := &testMap{}
+				dm, err := New(m)
+				if err != nil {
+					t.Fatalf("failed to generate query: %v", err)
+				}
+				if err := dm.ReadFromIndex(idx); err != nil {
+					t.Fatalf("failed to read DWARF data: %v", err)
+				}
+				if m.Size != 24 || m.DeeplyNestedB != 20 {
+					t.Errorf("ReadFromIndex() = %+v", m)
+				}
+			}
+		})
+	}
+}
+
+func TestScanUnlisted(t *testing.T) {
+	ef, err := elf.Open("testdata/x86_64/units")
+	if err != nil {
+		t.Fatalf("failed to open ELF file: %v", err)
+	}
+	defer ef.Close()
+	idx, err := NewTypeIndex(ef)
+	if err != nil {
+		t.Fatalf("failed to build index: %v", err)
+	}
+	defer idx.Close()
+	units, err := idx.readUnitHeaders()
+	if err != nil || len(units) != 2 {
+		t.Fatalf("readUnitHeaders() = %v, %v, want 2 units", units, err)
+	}
+
+	// The name index only lists the unit of main.c, the one of pthread_create.c is scanned.
+	idx.names = map[string][]dwarf.Offset{}
+	idx.variables = map[string][]dwarf.Offset{}
+	idx.functions = map[string][]dwarf.Offset{}
+	idx.scanned = map[dwarf.Offset]bool{}
+	if err := idx.scanUnlisted([]dwarf.Offset{units[0].offset}); err != nil {
+		t.Fatalf("scanUnlisted() error = %v", err)
+	}
+	if _, ok := idx.variables["main_thread"]; ok {
+		t.Error("scanUnlisted() recorded main_thread of the listed unit")
+	}
+	if got := idx.variables["created_thread"]; len(got) != 1 || idx.unitOf(got[0]) != units[1].offset {
+		t.Errorf("scanUnlisted() created_thread = %v, want an entry of the unit at %#x", got, units[1].offset)
+	}
+}
+
+func TestParseDebugNames(t *testing.T) {
+	var (
+		order = binary.LittleEndian
+		str   = []byte("\x00test_t\x00")
+		body  = new(bytes.Buffer)
+		w     = func(v any) { _ = binary.Write(body, order, v) }
+	)
+	abbrevs := []byte{
+		1, byte(dwarf.TagTypedef), idxCompileUnit, formData1, idxDIEOffset, formRef4, 0, 0,
+		2, byte(dwarf.TagStructType), idxTypeUnit, formData1, idxDIEOffset, formRef4, 0, 0,
+		0,
+	}
+	w(uint16(5))                   // version
+	w(uint16(0))                   // padding
+	w(uint32(2))                   // comp_unit_count
+	w(uint32(1))                   // local_type_unit_count
+	w(uint32(0))                   // foreign_type_unit_count
+	w(uint32(0))                   // bucket_count
+	w(uint32(1))                   // name_count
+	w(uint32(len(abbrevs)))        // abbrev_table_size
+	w(uint32(0))                   // augmentation_string_size
+	w([]uint32{0x0, 0x100})        // CU list
+	w(uint32(0x200))               // TU list
+	w(uint32(1))                   // string offsets
+	w(uint32(0))                   // entry offsets
+	w(abbrevs)                     // abbreviation table
+	w([]byte{1, 1, 0x2a, 0, 0, 0}) // typedef in the second CU
+	w([]byte{2, 0, 0x10, 0, 0, 0}) // struct in the type unit
+	w(uint8(0))
+
+	data := new(bytes.Buffer)
+	_ = binary.Write(data, order, uint32(body.Len()))
+	data.Write(body.Bytes())
+
+	got, units, err := parseDebugNames(data.Bytes(), str, order)
+	if err != nil {
+		t.Fatalf("parseDebugNames() error = %v", err)
+	}
+	want := []namedEntry{{name: "test_t", tag: dwarf.TagTypedef, offset: 0x12a}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(namedEntry{})); diff != "" {
+		t.Errorf("parseDebugNames() mismatch (-want +got):\n%s", diff)
+	}
+	// The type unit is not listed, it is scanned.
+	if diff := cmp.Diff([]dwarf.Offset{0x0, 0x100}, units); diff != "" {
+		t.Errorf("parseDebugNames() units mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, _, err := parseDebugNames(data.Bytes()[:20], str, order); err == nil {
+		t.Error("parseDebugNames() on a truncated section, want error")
+	}
+}
@@ -0,0 +1,169 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// opPlusUconst is DW_OP_plus_uconst, the operation used by older compilers
+// to describe the location of a member or a base class.
+const opPlusUconst = 0x23
+
+// member is a member of a struct, declared by the struct itself or inherited from one of its base classes.
+type member struct {
+	field *dwarf.StructField
+	// base is the offset of the base class that declares the member, 0 for the struct itself.
+	base int64
+	// owner is the entry of the struct that declares the member.
+	owner *dwarf.Entry
+	// p reads the file the owner is in.
+	p *processor
+}
+
+// offset returns the offset of the member in the struct it was looked up from.
+func (m *member) offset() int64 {
+	return m.base + m.field.ByteOffset
+}
+
+// entry reads the DWARF entry of the member.
+func (m *member) entry() (*dwarf.Entry, error) {
+	entry, err := m.p.findFieldEntry(m.owner, m.field.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find field (%s) entry: %w", m.field.Name, err)
+	}
+	return entry, nil
+}
+
+// findMember looks up the member with the given name in the given struct,
+// then in its anonymous members and in its base classes, depth-first in declaration order.
+// It returns nil when the member is not found.
+// The depth is the number of anonymous members and base classes looked up through to reach the struct,
+// malformed DWARF data can describe a struct that contains or derives from itself.
+func (p *processor) findMember(entry *dwarf.Entry, st *dwarf.StructType, name string, depth int) (*member, error) {
+	if depth > maxTypeDepth {
+		return nil, fmt.Errorf("too many nested anonymous members or base classes in %s", st.StructName)
+	}
+	for _, f := range st.Field {
+		if f.Name == name {
+			return &member{field: f, owner: entry, p: p}, nil
+		}
+	}
+	if m, err := p.findAnonymousMember(entry, st, name, depth); err != nil || m != nil {
+		return m, err
+	}
+	if entry.Tag != dwarf.TagClassType && entry.Tag != dwarf.TagStructType {
+		return nil, nil
+	}
+
+	inherited, err := children(p.index.reader(), entry, dwarf.TagInheritance)
+	if err != nil {
+		return nil, err
+	}
+	for _, inh := range inherited {
+		off, ok := memberLocation(inh)
+		if !ok {
+			// The offset of a virtual base class is only known at run time.
+			continue
+		}
+		baseEntry, q, err := p.underlyingTypeEntry(inh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find base class: %w", err)
+		}
+		if isDeclaration(baseEntry) || !baseEntry.Children {
+			if baseEntry, q, err = q.definition(baseEntry); err != nil {
+				return nil, err
+			}
+		}
+		typ, err := q.index.typeAt(baseEntry.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get type: %w", err)
+		}
+		base, ok := typ.(*dwarf.StructType)
+		if !ok {
+			return nil, fmt.Errorf("base class is not a struct, type: %s", typeString(typ))
+		}
+		m, err := q.findMember(baseEntry, base, name, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s in base class %s: %w", name, base.StructName, err)
+		}
+		if m != nil {
+			m.base += off
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// findAnonymousMember looks up the member with the given name in the anonymous structs and unions
+// the given struct contains, whose members are accessed as members of the struct, like in C.
+func (p *processor) findAnonymousMember(entry *dwarf.Entry, st *dwarf.StructType, name string, depth int) (*member, error) {
+	var members []*dwarf.Entry
+	for i, f := range st.Field {
+		inner, ok := underlyingType(f.Type).(*dwarf.StructType)
+		if f.Name != "" || !ok {
+			continue
+		}
+		if members == nil {
+			var err error
+			if members, err = children(p.index.reader(), entry, dwarf.TagMember); err != nil {
+				return nil, err
+			}
+			if len(members) != len(st.Field) {
+				return nil, fmt.Errorf("unexpected number of members in %s", st.StructName)
+			}
+		}
+		typeEntry, q, err := p.underlyingTypeEntry(members[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to find type of anonymous member: %w", err)
+		}
+		m, err := q.findMember(typeEntry, inner, name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			m.base += f.ByteOffset
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// memberLocation returns the offset of a member or a base class, when it is a constant.
+func memberLocation(entry *dwarf.Entry) (int64, bool) {
+	switch loc := entry.Val(dwarf.AttrDataMemberLoc).(type) {
+	case int64:
+		return loc, true
+	case []byte:
+		if len(loc) < 2 || loc[0] != opPlusUconst {
+			return 0, false
+		}
+		off, err := uleb128(loc[1:])
+		if err != nil {
+			return 0, false
+		}
+		return int64(off), true
+	case nil:
+		// A base class at the start of the class.
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func uleb128(b []byte) (uint64, error) {
+	var (
+		val   uint64
+		shift uint
+	)
+	for _, c := range b {
+		if shift >= 64 {
+			return 0, fmt.Errorf("%w: uleb128 overflow", ErrMalformed)
+		}
+		val |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return val, nil
+		}
+		shift += 7
+	}
+	return 0, fmt.Errorf("%w: truncated uleb128", ErrMalformed)
+}
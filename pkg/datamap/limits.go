@@ -0,0 +1,165 @@
+package datamap
+
+import (
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Reading untrusted binaries can be bounded.
+// The context given to NewTypeIndexContext, or to ReadFromDWARFContext, cancels the reads of the index:
+// building it, and the lookups of every extraction that uses it, which can scan compilation units on demand.
+// The limits set with WithMaxEntries and WithMaxBytes apply to the lifetime of the index,
+// its supplementary file and its split units included, and the one set with WithTimeout to each call.
+// ExtractContext checks its context between the routes, in addition to the one of the index.
+
+// ErrLimitExceeded is returned when reading a file exceeds one of the limits set with
+// WithMaxEntries or WithMaxBytes.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// ctxCheckInterval is the number of entries read between two checks of the context.
+const ctxCheckInterval = 256
+
+// WithMaxEntries limits the number of DWARF entries and ELF symbols read by the index, 0 means no limit.
+// It is an option of NewTypeIndex, NewBTFIndex and ReadFromDWARF.
+func WithMaxEntries(n int64) Option {
+	return func(o *options) {
+		o.maxEntries = n
+	}
+}
+
+// WithMaxBytes limits the number of bytes of the sections read into memory by the index,
+// and of the symbol tables it searches, 0 means no limit. The sections are checked before they are read.
+// It is an option of NewTypeIndex, NewBTFIndex and ReadFromDWARF.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithTimeout limits the time a call takes, 0 means no limit.
+// The time to build an index is limited when it is given to NewTypeIndexContext,
+// the time to extract the values of a DataMap when it is given to ExtractContext,
+// and both when it is given to ReadFromDWARFContext.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// withTimeout returns the context bounded by the timeout of the options, if any.
+func (o *options) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
+
+// budget accounts for the entries and the bytes read by an index and the indexes it is made of.
+type budget struct {
+	ctx        context.Context
+	maxEntries int64
+	maxBytes   int64
+	entries    atomic.Int64
+	bytes      atomic.Int64
+}
+
+func newBudget(ctx context.Context, o *options) *budget {
+	return &budget{ctx: ctx, maxEntries: o.maxEntries, maxBytes: o.maxBytes}
+}
+
+// visit accounts for a DWARF entry about to be read.
+func (b *budget) visit() error {
+	n := b.entries.Add(1)
+	if b.maxEntries > 0 && n > b.maxEntries {
+		return b.err()
+	}
+	if n%ctxCheckInterval == 0 {
+		return b.ctx.Err()
+	}
+	return nil
+}
+
+// Read and Visit account for the reads of the symbol tables, see symbols.Budget.
+func (b *budget) Read(n uint64) error { return b.read(n) }
+func (b *budget) Visit() error        { return b.visit() }
+
+// read accounts for the given number of bytes about to be read into memory.
+func (b *budget) read(n uint64) error {
+	if b.maxBytes > 0 && n > uint64(b.maxBytes) {
+		n = uint64(b.maxBytes) + 1
+	}
+	b.bytes.Add(int64(n))
+	return b.err()
+}
+
+// err returns why the reads stopped, nil if they can go on.
+// Once exceeded, a limit stays exceeded.
+func (b *budget) err() error {
+	if b.maxEntries > 0 && b.entries.Load() > b.maxEntries {
+		return fmt.Errorf("%w: more than %d entries read", ErrLimitExceeded, b.maxEntries)
+	}
+	if b.maxBytes > 0 && b.bytes.Load() > b.maxBytes {
+		return fmt.Errorf("%w: more than %d bytes read", ErrLimitExceeded, b.maxBytes)
+	}
+	return b.ctx.Err()
+}
+
+// isStopped reports whether the error is a limit exceeded or a cancellation,
+// which stops the extraction rather than failing a single route.
+func isStopped(err error) bool {
+	return errors.Is(err, ErrLimitExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// data returns the contents of the given section, once accounted for.
+func (b *budget) data(sec *elf.Section) ([]byte, error) {
+	if err := b.read(sec.Size); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sec.Name, err)
+	}
+	data, err := sec.Data()
+	if err != nil {
+		// The section header does not match the file, e.g. it is truncated or compressed with an unknown algorithm.
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return data, nil
+}
+
+// dwarf reads the DWARF data of the given ELF file, once its debug sections are accounted for.
+func (b *budget) dwarf(ef *elf.File) (*dwarf.Data, error) {
+	var size uint64
+	for _, sec := range ef.Sections {
+		if strings.HasPrefix(sec.Name, ".debug_") || strings.HasPrefix(sec.Name, ".zdebug_") {
+			size += sec.Size
+		}
+	}
+	if err := b.read(size); err != nil {
+		return nil, fmt.Errorf("failed to read DWARF info: %w", err)
+	}
+	data, err := ef.DWARF()
+	return data, malformed(err)
+}
+
+// entryReader reads the entries of an index, accounting for them in its budget.
+// Skipped children are not accounted for.
+type entryReader struct {
+	*dwarf.Reader
+	budget *budget
+}
+
+// reader returns a reader of the entries of the index.
+func (idx *TypeIndex) reader() *entryReader {
+	return &entryReader{Reader: idx.dwarfData.Reader(), budget: idx.budget}
+}
+
+func (r *entryReader) Next() (*dwarf.Entry, error) {
+	if err := r.budget.visit(); err != nil {
+		return nil, err
+	}
+	entry, err := r.Reader.Next()
+	return entry, malformed(err)
+}
@@ -0,0 +1,554 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Location is where the value of a parameter or of a local variable of a function is,
+// while the program counter is in [LowPC, HighPC), as read with the locationof tag.
+// The program counters are the addresses assigned by the linker,
+// the load bias of the object has to be added to them at run time.
+type Location struct {
+	LowPC  uint64       `yaml:"low_pc" json:"low_pc"`
+	HighPC uint64       `yaml:"high_pc" json:"high_pc"`
+	Kind   LocationKind `yaml:"kind" json:"kind"`
+	// Register is the DWARF number of the register the location refers to, if any,
+	// e.g. 5 for rdi on x86-64, 0 for x0 on arm64.
+	Register int   `yaml:"register" json:"register"`
+	Offset   int64 `yaml:"offset,omitempty" json:"offset,omitempty"`
+}
+
+// LocationKind describes how the value of a variable is found at a Location.
+type LocationKind int
+
+const (
+	// LocationRegister is a value held in Register.
+	LocationRegister LocationKind = iota + 1
+	// LocationRegisterOffset is a value in memory, at the address held in Register plus Offset.
+	LocationRegisterOffset
+	// LocationCFAOffset is a value in memory, at the canonical frame address of the function plus Offset,
+	// the CFA being the value of the stack pointer before the call, as described by the call frame information.
+	LocationCFAOffset
+	// LocationEntryValue is the value Register held when the function was entered,
+	// which has to be recovered from the caller, e.g. from a callee-saved register.
+	LocationEntryValue
+)
+
+func (k LocationKind) String() string {
+	switch k {
+	case LocationRegister:
+		return "register"
+	case LocationRegisterOffset:
+		return "register+offset"
+	case LocationCFAOffset:
+		return "cfa+offset"
+	case LocationEntryValue:
+		return "entry value"
+	default:
+		return "unknown"
+	}
+}
+
+var locationsType = reflect.TypeOf([]Location(nil))
+
+// DWARF expression operations used in the locations of parameters and local variables.
+const (
+	opReg0          = 0x50
+	opReg31         = 0x6f
+	opBreg0         = 0x70
+	opBreg31        = 0x8f
+	opRegx          = 0x90
+	opFbreg         = 0x91
+	opBregx         = 0x92
+	opCallFrameCFA  = 0x9c
+	opStackValue    = 0x9f
+	opEntryValue    = 0xa3
+	opGNUEntryValue = 0xf3
+)
+
+// DWARF 5 location list entry kinds (DWARF 5 §7.7.3), and the view pairs written by GCC.
+const (
+	lleEndOfList       = 0x00
+	lleBaseAddressx    = 0x01
+	lleStartxEndx      = 0x02
+	lleStartxLength    = 0x03
+	lleOffsetPair      = 0x04
+	lleDefaultLocation = 0x05
+	lleBaseAddress     = 0x06
+	lleStartEnd        = 0x07
+	lleStartLength     = 0x08
+	lleGNUViewPair     = 0x09
+)
+
+// maxLocationEntries bounds the number of entries read from a location list,
+// malformed DWARF data can describe lists that do not end.
+const maxLocationEntries = 1 << 16
+
+func isFunctionRoute(rn *RouteNode) bool {
+	if !rn.IsLeaf() || len(rn.Extractors) == 0 {
+		return false
+	}
+	for _, ex := range rn.Extractors {
+		if !ex.Op.isFunction() {
+			return false
+		}
+	}
+	return true
+}
+
+// extractLocations sets the locations of the variables of the function the given route names.
+// Every definition of the function is read, e.g. its out-of-line copies, the locations of all of them are listed.
+// Functions and variables that cannot be found are reported as missing.
+func (p *processor) extractLocations(rn *RouteNode) error {
+	if len(p.index.split) > 0 {
+		for _, ex := range rn.Extractors {
+			ex.fail(fmt.Errorf("the locations of the variables of %s are not read from split DWARF", rn.Type))
+		}
+		return nil
+	}
+	functions, err := p.index.lookupFunction(rn.Type)
+	if err == nil {
+		functions, err = p.inSources(functions, p.pin)
+	}
+	if err != nil {
+		for _, ex := range rn.Extractors {
+			ex.fail(fmt.Errorf("failed to look up function %s: %w", rn.Type, err))
+		}
+		return nil
+	}
+	if len(functions) == 0 {
+		for _, ex := range rn.Extractors {
+			ex.fail(fmt.Errorf("function %s not found", rn.Type))
+		}
+		return nil
+	}
+
+	for _, ex := range rn.Extractors {
+		var (
+			locs  = []Location{}
+			entry dwarf.Offset
+			errs  []error
+		)
+		for _, fn := range functions {
+			vars, err := p.functionVariables(fn, ex.Source)
+			if err != nil {
+				if isStopped(err) {
+					return err
+				}
+				errs = append(errs, err)
+				continue
+			}
+			for _, v := range vars {
+				l, err := p.variableLocations(fn, v)
+				if err != nil {
+					if isStopped(err) {
+						return err
+					}
+					errs = append(errs, fmt.Errorf("failed to read the location of %s in %s: %w", ex.Source, rn.Type, err))
+					continue
+				}
+				if entry == 0 && len(l) > 0 {
+					entry = v.entry.Offset
+				}
+				locs = append(locs, l...)
+			}
+		}
+		if len(locs) == 0 {
+			errs = append(errs, fmt.Errorf("no supported location of %s in %s", ex.Source, rn.Type))
+			ex.fail(errors.Join(errs...))
+			continue
+		}
+		sort.SliceStable(locs, func(i, j int) bool {
+			return locs[i].LowPC < locs[j].LowPC
+		})
+		if err := ex.SetLocations(locs); err != nil {
+			return fmt.Errorf("failed to set %s of (%s.%s): %w", ex.Op, rn.Type, ex.Source, err)
+		}
+		ex.resolvedAt(entry)
+	}
+	return nil
+}
+
+// scopedVariable is a parameter or a local variable, along with the innermost scope it is declared in.
+type scopedVariable struct {
+	entry *dwarf.Entry
+	scope *dwarf.Entry
+}
+
+// functionVariables returns the parameters and the local variables of the given function with the given name,
+// those of its lexical blocks included, but not those of the functions inlined into it.
+func (p *processor) functionVariables(fn *dwarf.Entry, name string) ([]scopedVariable, error) {
+	if !fn.Children {
+		return nil, nil
+	}
+	r := p.index.reader()
+	r.Seek(fn.Offset)
+	if _, err := r.Next(); err != nil {
+		return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	var (
+		vars   []scopedVariable
+		scopes = []*dwarf.Entry{fn}
+	)
+	for len(scopes) > 0 {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if entry == nil {
+			break
+		}
+		if len(scopes) > maxTypeDepth {
+			return nil, fmt.Errorf("too many nested scopes in %s", p.index.nameOf(fn))
+		}
+		switch entry.Tag {
+		case 0:
+			scopes = scopes[:len(scopes)-1]
+			continue
+		case dwarf.TagFormalParameter, dwarf.TagVariable:
+			if p.index.nameOf(p.index.origin(entry)) == name || p.index.nameOf(entry) == name {
+				vars = append(vars, scopedVariable{entry: entry, scope: scopes[len(scopes)-1]})
+			}
+		case dwarf.TagLexDwarfBlock:
+			if entry.Children {
+				scopes = append(scopes, entry)
+			}
+			continue
+		}
+		if entry.Children {
+			r.SkipChildren()
+		}
+	}
+	return vars, nil
+}
+
+// variableLocations returns the locations of the given variable of the given function.
+// The locations that cannot be described by a Location, e.g. values computed from several registers
+// or split in pieces, are left out.
+func (p *processor) variableLocations(fn *dwarf.Entry, v scopedVariable) ([]Location, error) {
+	field := v.entry.AttrField(dwarf.AttrLocation)
+	if field == nil {
+		// Optimized out.
+		return nil, nil
+	}
+	frameBase, _ := fn.Val(dwarf.AttrFrameBase).([]byte)
+
+	var ranges []locationRange
+	switch field.Class {
+	case dwarf.ClassExprLoc, dwarf.ClassBlock:
+		expr, _ := field.Val.([]byte)
+		// Valid in the whole scope of the variable.
+		pcs, err := p.dwarfData.Ranges(v.scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the ranges of the scope: %w", err)
+		}
+		for _, pc := range pcs {
+			ranges = append(ranges, locationRange{low: pc[0], high: pc[1], expr: expr})
+		}
+	case dwarf.ClassLocListPtr, dwarf.ClassLocList:
+		off, ok := field.Val.(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected location list reference %v", field.Val)
+		}
+		var err error
+		if ranges, err = p.locationList(v.entry.Offset, off, field.Class == dwarf.ClassLocList); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected location class %s", field.Class)
+	}
+
+	locs := []Location{}
+	for _, r := range ranges {
+		if r.low >= r.high {
+			continue
+		}
+		loc, ok := decodeLocation(r.expr, frameBase)
+		if !ok {
+			continue
+		}
+		loc.LowPC, loc.HighPC = r.low, r.high
+		locs = append(locs, loc)
+	}
+	return locs, nil
+}
+
+// decodeLocation decodes a location expression, made of a single operation, or of an entry value.
+// The operations relative to the frame base are decoded with the given frame base expression, if any.
+func decodeLocation(expr, frameBase []byte) (Location, bool) {
+	var (
+		b   = &buf{data: expr}
+		loc Location
+	)
+	switch op := b.uint8(); {
+	case op >= opReg0 && op <= opReg31:
+		loc = Location{Kind: LocationRegister, Register: int(op - opReg0)}
+	case op == opRegx:
+		loc = Location{Kind: LocationRegister, Register: int(b.uleb())}
+	case op >= opBreg0 && op <= opBreg31:
+		loc = Location{Kind: LocationRegisterOffset, Register: int(op - opBreg0), Offset: b.sleb()}
+	case op == opBregx:
+		reg := b.uleb()
+		loc = Location{Kind: LocationRegisterOffset, Register: int(reg), Offset: b.sleb()}
+	case op == opCallFrameCFA:
+		loc = Location{Kind: LocationCFAOffset}
+	case op == opFbreg:
+		off := b.sleb()
+		if frameBase == nil {
+			return Location{}, false
+		}
+		// The frame base is an address, the variable is in memory at an offset from it.
+		base, ok := decodeLocation(frameBase, nil)
+		if !ok {
+			return Location{}, false
+		}
+		switch base.Kind {
+		case LocationRegister, LocationRegisterOffset:
+			loc = Location{Kind: LocationRegisterOffset, Register: base.Register, Offset: base.Offset + off}
+		case LocationCFAOffset:
+			loc = Location{Kind: LocationCFAOffset, Offset: base.Offset + off}
+		default:
+			return Location{}, false
+		}
+	case op == opEntryValue || op == opGNUEntryValue:
+		n := b.uleb()
+		if n > uint64(len(expr)) {
+			return Location{}, false
+		}
+		reg, ok := decodeLocation(b.bytes(int(n)), nil)
+		if !ok || reg.Kind != LocationRegister || b.uint8() != opStackValue {
+			return Location{}, false
+		}
+		loc = Location{Kind: LocationEntryValue, Register: reg.Register}
+	default:
+		return Location{}, false
+	}
+	if b.err != nil || b.off != len(b.data) {
+		return Location{}, false
+	}
+	return loc, true
+}
+
+// locationRange is an entry of a location list, with its addresses resolved.
+type locationRange struct {
+	low, high uint64
+	expr      []byte
+}
+
+// locationUnit is what is needed from the compilation unit of a variable to read its location list.
+type locationUnit struct {
+	header   unitHeader
+	addrSize int
+	// base is the base address of the unit, the addresses of the lists are relative to.
+	base         uint64
+	addrBase     uint64
+	loclistsBase uint64
+	hasListsBase bool
+}
+
+// locationList reads the location list of the given entry, at the given offset
+// in .debug_loc before DWARF 5, in .debug_loclists afterwards, or at the given index
+// in the offsets table of the unit in .debug_loclists.
+func (p *processor) locationList(entry dwarf.Offset, off int64, indexed bool) ([]locationRange, error) {
+	u, err := p.locationUnit(entry)
+	if err != nil {
+		return nil, err
+	}
+	if u.header.version < 5 {
+		data, err := p.index.section(".debug_loc")
+		if err != nil {
+			return nil, err
+		}
+		return readLocList(data, off, u, p.ef.ByteOrder)
+	}
+
+	data, err := p.index.section(".debug_loclists")
+	if err != nil {
+		return nil, err
+	}
+	if indexed {
+		if !u.hasListsBase {
+			return nil, fmt.Errorf("%w: location list index without DW_AT_loclists_base", ErrMalformed)
+		}
+		b := &buf{data: data, off: int(u.loclistsBase) + int(off)*u.header.offsetSize, order: p.ef.ByteOrder}
+		off = int64(u.loclistsBase) + int64(b.offset(u.header.offsetSize))
+		if b.err != nil {
+			return nil, fmt.Errorf("invalid location list index %d: %w", off, b.err)
+		}
+	}
+	var addr []byte
+	if p.ef.Section(".debug_addr") != nil {
+		if addr, err = p.index.section(".debug_addr"); err != nil {
+			return nil, err
+		}
+	}
+	return readLocLists(data, addr, off, u, p.ef.ByteOrder)
+}
+
+// locationUnit reads the compilation unit of the given entry.
+func (p *processor) locationUnit(entry dwarf.Offset) (locationUnit, error) {
+	p.index.mu.Lock()
+	header := p.index.unitAt(entry)
+	p.index.mu.Unlock()
+	if header.version == 0 {
+		return locationUnit{}, fmt.Errorf("no compilation unit for entry at %#x", entry)
+	}
+
+	r := p.index.reader()
+	r.Seek(header.entry)
+	cu, err := r.Next()
+	if err != nil {
+		return locationUnit{}, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	if cu == nil {
+		return locationUnit{}, fmt.Errorf("no compilation unit at %#x", header.entry)
+	}
+	u := locationUnit{header: header, addrSize: 8}
+	if p.ef.Class == elf.ELFCLASS32 {
+		u.addrSize = 4
+	}
+	u.base, _ = cu.Val(dwarf.AttrLowpc).(uint64)
+	if base, ok := cu.Val(dwarf.AttrAddrBase).(int64); ok {
+		u.addrBase = uint64(base)
+	}
+	if base, ok := cu.Val(dwarf.AttrLoclistsBase).(int64); ok {
+		u.loclistsBase, u.hasListsBase = uint64(base), true
+	}
+	return u, nil
+}
+
+// section returns the contents of the given section, read once.
+func (idx *TypeIndex) section(name string) ([]byte, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if data, ok := idx.sections[name]; ok {
+		return data, nil
+	}
+	data, err := sectionData(idx.budget, idx.ef, name)
+	if err != nil {
+		return nil, err
+	}
+	idx.sections[name] = data
+	return data, nil
+}
+
+// readLocList reads the location list at the given offset of the given .debug_loc data (DWARF 4 §2.6.2).
+func readLocList(data []byte, off int64, u locationUnit, order binary.ByteOrder) ([]locationRange, error) {
+	var (
+		b      = &buf{data: data, off: int(off), order: order}
+		base   = u.base
+		ranges []locationRange
+		// The largest address selects a new base address.
+		selection = uint64(1)<<(8*u.addrSize) - 1
+	)
+	if off < 0 || off >= int64(len(data)) {
+		return nil, fmt.Errorf("%w: invalid location list offset %#x", ErrMalformed, off)
+	}
+	for i := 0; i < maxLocationEntries; i++ {
+		low, high := b.addr(u.addrSize), b.addr(u.addrSize)
+		if b.err != nil {
+			return nil, fmt.Errorf("invalid location list at %#x: %w", off, b.err)
+		}
+		switch {
+		case low == 0 && high == 0:
+			return ranges, nil
+		case low == selection:
+			base = high
+			continue
+		}
+		n := b.uint16()
+		expr := b.bytes(int(n))
+		if b.err != nil {
+			return nil, fmt.Errorf("invalid location list at %#x: %w", off, b.err)
+		}
+		ranges = append(ranges, locationRange{low: base + low, high: base + high, expr: expr})
+	}
+	return nil, fmt.Errorf("location list at %#x has too many entries", off)
+}
+
+// readLocLists reads the location list at the given offset of the given .debug_loclists data (DWARF 5 §2.6.2),
+// the indexed addresses are read from the given .debug_addr data.
+func readLocLists(data, addr []byte, off int64, u locationUnit, order binary.ByteOrder) ([]locationRange, error) {
+	var (
+		b      = &buf{data: data, off: int(off), order: order}
+		base   = u.base
+		ranges []locationRange
+	)
+	if off < 0 || off >= int64(len(data)) {
+		return nil, fmt.Errorf("%w: invalid location list offset %#x", ErrMalformed, off)
+	}
+	address := func(i uint64) uint64 {
+		a := &buf{data: addr, off: int(u.addrBase) + int(i)*u.addrSize, order: order}
+		v := a.addr(u.addrSize)
+		if a.err != nil && b.err == nil {
+			b.err = fmt.Errorf("invalid address index %d: %w", i, a.err)
+		}
+		return v
+	}
+	for i := 0; i < maxLocationEntries; i++ {
+		var (
+			low, high uint64
+			kind      = b.uint8()
+		)
+		switch kind {
+		case lleEndOfList:
+			if b.err != nil {
+				return nil, fmt.Errorf("invalid location list at %#x: %w", off, b.err)
+			}
+			return ranges, nil
+		case lleBaseAddressx:
+			base = address(b.uleb())
+			continue
+		case lleBaseAddress:
+			base = b.addr(u.addrSize)
+			continue
+		case lleGNUViewPair:
+			b.uleb()
+			b.uleb()
+			continue
+		case lleStartxEndx:
+			low = address(b.uleb())
+			high = address(b.uleb())
+		case lleStartxLength:
+			low = address(b.uleb())
+			high = low + b.uleb()
+		case lleOffsetPair:
+			low = base + b.uleb()
+			high = base + b.uleb()
+		case lleDefaultLocation:
+			// Applies to the addresses no other entry covers, which are not listed.
+		case lleStartEnd:
+			low = b.addr(u.addrSize)
+			high = b.addr(u.addrSize)
+		case lleStartLength:
+			low = b.addr(u.addrSize)
+			high = low + b.uleb()
+		default:
+			return nil, fmt.Errorf("%w: invalid location list at %#x: unknown entry kind %#x", ErrMalformed, off, kind)
+		}
+		n := b.uleb()
+		if n > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid location list at %#x: %w", off, errShortBuffer)
+		}
+		expr := b.bytes(int(n))
+		if b.err != nil {
+			return nil, fmt.Errorf("invalid location list at %#x: %w", off, b.err)
+		}
+		if kind != lleDefaultLocation {
+			ranges = append(ranges, locationRange{low: low, high: high, expr: expr})
+		}
+	}
+	return nil, fmt.Errorf("location list at %#x has too many entries", off)
+}
+
+// addr reads an address of the given size.
+func (b *buf) addr(size int) uint64 {
+	return b.offset(size)
+}
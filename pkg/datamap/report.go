@@ -0,0 +1,206 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Status describes how the value of a field of the map struct was obtained.
+type Status int
+
+const (
+	// StatusMissing means none of the routes of the field could be resolved.
+	StatusMissing Status = iota
+	// StatusResolved means the value was read from the debug information.
+	StatusResolved
+	// StatusDefaulted means the field could not be resolved,
+	// and it holds the value of its `default` tag.
+	StatusDefaulted
+	// StatusSkipped means the field does not apply to the version given to New,
+	// its routes are not resolved and it holds the value of its `default` tag, if any.
+	StatusSkipped
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusMissing:
+		return "missing"
+	case StatusResolved:
+		return "resolved"
+	case StatusDefaulted:
+		return "defaulted"
+	case StatusSkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// FieldReport describes the outcome of the extraction of a single field of the map struct.
+type FieldReport struct {
+	Field string
+	Op    Operation
+	// Route is the resolved route,
+	// or all the alternatives separated by `|` when none was resolved.
+	Route  string
+	Status Status
+	// Value is the value of the field, a single element unless the field holds a chain.
+	Value []int64
+	// Locations is the value of a field tagged with `locationof`.
+	Locations []Location
+	// Unit is the offset of the compilation unit the value was read from.
+	Unit dwarf.Offset
+	// Entry is the offset of the DWARF entry the value was read from.
+	Entry dwarf.Offset
+	// Err is the reason why the field could not be resolved, or why it was skipped, if any.
+	Err error
+	// Conflicts are the types of the routes of the field that have different definitions,
+	// the value was read from the first definition of each.
+	Conflicts []Conflict
+}
+
+// ExtractionReport lists every field of the map struct with the outcome of its extraction.
+type ExtractionReport struct {
+	Fields []FieldReport
+}
+
+// Gaps returns the fields that could not be resolved.
+func (r *ExtractionReport) Gaps() []FieldReport {
+	gaps := []FieldReport{}
+	for _, f := range r.Fields {
+		if f.Status == StatusMissing {
+			gaps = append(gaps, f)
+		}
+	}
+	return gaps
+}
+
+// Conflicts returns the fields whose routes lead to types that have different definitions.
+func (r *ExtractionReport) Conflicts() []FieldReport {
+	conflicts := []FieldReport{}
+	for _, f := range r.Fields {
+		if len(f.Conflicts) > 0 {
+			conflicts = append(conflicts, f)
+		}
+	}
+	return conflicts
+}
+
+// report builds the report of the last extraction.
+// The unit of an entry is looked up with the given function.
+func (dm *DataMap) report(unitOf func(dwarf.Offset) dwarf.Offset) *ExtractionReport {
+	var (
+		report = &ExtractionReport{}
+		orders []int
+	)
+	for _, t := range dm.targets() {
+		if t.term {
+			// Reported with their expression.
+			continue
+		}
+		fr := FieldReport{
+			Field: t.name,
+			Op:    t.op,
+			Value: intValues(t.value),
+			// Copied, the targets are reset by the next extraction.
+			Conflicts: append([]Conflict(nil), t.conflicts...),
+		}
+		if t.value.Type() == locationsType && t.value.CanInterface() {
+			fr.Locations = t.value.Interface().([]Location)
+		}
+		switch {
+		case t.matched != -1:
+			fr.Status = StatusResolved
+			fr.Route = t.route()
+			fr.Entry = t.entry
+			fr.Unit = unitOf(t.entry)
+		case t.hasDefault:
+			fr.Status = StatusDefaulted
+			fr.Route = strings.Join(t.routes, alternativeSeparator)
+		default:
+			fr.Status = StatusMissing
+			fr.Route = strings.Join(t.routes, alternativeSeparator)
+		}
+		if fr.Status != StatusResolved {
+			fr.Err = errors.Join(t.errs...)
+		}
+		report.Fields = append(report.Fields, fr)
+		orders = append(orders, t.order)
+	}
+	for _, e := range dm.expressions {
+		fr := FieldReport{
+			Field: e.name,
+			Op:    OpExpr,
+			Route: e.source,
+			Value: intValues(e.value),
+		}
+		var errs []error
+		for _, t := range e.targets() {
+			fr.Conflicts = append(fr.Conflicts, t.conflicts...)
+			if t.matched == -1 {
+				errs = append(errs, t.errs...)
+			}
+		}
+		switch {
+		case e.resolved:
+			fr.Status = StatusResolved
+		case e.hasDefault:
+			fr.Status = StatusDefaulted
+		default:
+			fr.Status = StatusMissing
+		}
+		if fr.Status != StatusResolved {
+			fr.Err = errors.Join(errs...)
+		}
+		report.Fields = append(report.Fields, fr)
+		orders = append(orders, e.order)
+	}
+	for _, s := range dm.skipped {
+		report.Fields = append(report.Fields, FieldReport{
+			Field:  s.name,
+			Op:     s.op,
+			Route:  s.route,
+			Status: StatusSkipped,
+			Value:  intValues(s.value),
+			Err:    s.reason,
+		})
+		orders = append(orders, s.order)
+	}
+	// The expressions and the skipped fields are interleaved with the other fields, in the order they are declared.
+	sort.Sort(byOrder{report.Fields, orders})
+	return report
+}
+
+// byOrder sorts field reports by the order of their fields in the map struct.
+type byOrder struct {
+	fields []FieldReport
+	orders []int
+}
+
+func (b byOrder) Len() int           { return len(b.fields) }
+func (b byOrder) Less(i, j int) bool { return b.orders[i] < b.orders[j] }
+func (b byOrder) Swap(i, j int) {
+	b.fields[i], b.fields[j] = b.fields[j], b.fields[i]
+	b.orders[i], b.orders[j] = b.orders[j], b.orders[i]
+}
+
+// intValues returns the value of an int field, or the elements of a slice or an array of ints.
+func intValues(v reflect.Value) []int64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []int64{v.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []int64{int64(v.Uint())}
+	case reflect.Slice, reflect.Array:
+		values := make([]int64, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, intValues(v.Index(i))...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
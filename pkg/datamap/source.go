@@ -0,0 +1,13 @@
+package datamap
+
+import "debug/dwarf"
+
+// Source is the type information the values of a DataMap are read from,
+// e.g. a TypeIndex built from DWARF, a BTFIndex or a HeaderIndex.
+type Source interface {
+	// route resolves the given route and sets the values of its extractors.
+	route(rn *RouteNode) error
+	// unitOf returns the offset of the compilation unit that contains the given entry,
+	// 0 if the source has no compilation units.
+	unitOf(off dwarf.Offset) dwarf.Offset
+}
@@ -0,0 +1,445 @@
+package datamap
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Programs built with -gsplit-dwarf only keep skeleton units in .debug_info.
+// The entries of each compilation unit are written to a split unit, in the .dwo file named by
+// the DW_AT_dwo_name of its skeleton, relative to its DW_AT_comp_dir,
+// and the .dwo files can be packed by dwp into a single .dwp package.
+// Only DWARF 5 split units are read, debug/dwarf does not decode the forms of the GNU extension to DWARF 4.
+
+// attrGNUDwoName is the DW_AT_GNU_dwo_name attribute of DWARF 4 skeleton units.
+const attrGNUDwoName dwarf.Attr = 0x2130
+
+// skeletonUnit is a skeleton unit of the program, which names the .dwo file of its split unit.
+type skeletonUnit struct {
+	id      uint64
+	dwoName string
+	compDir string
+	// addrBase is the offset of the addresses of the unit in the .debug_addr section of the program.
+	addrBase int64
+}
+
+// splitSections are the sections of a split unit,
+// either the ones of a .dwo file or its contributions to the sections of a .dwp package.
+type splitSections struct {
+	info, abbrev, strOffsets, str []byte
+	// addr are the addresses of the unit, which stay in the program.
+	addr []byte
+}
+
+// dwpUnits are the split units of a .dwp package, by ID.
+type dwpUnits map[uint64]splitSections
+
+// WithSplitDWARFDirs sets the directories the .dwo files and the .dwp packages of a program
+// built with split DWARF are looked up in, usually the directory of the program.
+// The .dwo files are looked up at the path their skeleton units name first,
+// then by that path and by their base name in each of the directories,
+// all the .dwp packages in the directories are tried before them.
+func WithSplitDWARFDirs(dirs ...string) Option {
+	return func(o *options) {
+		o.splitDirs = append(o.splitDirs, dirs...)
+	}
+}
+
+// skeletonUnits returns the skeleton units of the index, if any.
+func (idx *TypeIndex) skeletonUnits() ([]skeletonUnit, error) {
+	headers, err := idx.readUnitHeaders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unit headers: %w", err)
+	}
+	var (
+		skeletons = []skeletonUnit{}
+		r         = idx.reader()
+	)
+	for _, h := range headers {
+		r.Seek(h.entry)
+		entry, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if entry == nil {
+			continue
+		}
+		if h.typ != utSkeleton {
+			if entry.AttrField(attrGNUDwoName) != nil {
+				return nil, fmt.Errorf("%w: split units of DWARF 4, build with -gdwarf-5", errors.ErrUnsupported)
+			}
+			continue
+		}
+		name, _ := idx.stringAttr(entry, dwarf.AttrDwoName)
+		if name == "" {
+			return nil, fmt.Errorf("%w: skeleton unit at %#x has no DW_AT_dwo_name", ErrMalformed, h.offset)
+		}
+		compDir, _ := idx.stringAttr(entry, dwarf.AttrCompDir)
+		addrBase, _ := entry.Val(dwarf.AttrAddrBase).(int64)
+		skeletons = append(skeletons, skeletonUnit{id: h.id, dwoName: name, compDir: compDir, addrBase: addrBase})
+	}
+	return skeletons, nil
+}
+
+// openSplitUnits indexes the split units of the program, if it has been built with split DWARF.
+// The split units are looked up in the .dwp packages and the .dwo files found in the given directories.
+func (idx *TypeIndex) openSplitUnits(dirs []string) error {
+	skeletons, err := idx.skeletonUnits()
+	if err != nil {
+		return err
+	}
+	if len(skeletons) == 0 {
+		return nil
+	}
+
+	var addr []byte
+	if idx.ef.Section(".debug_addr") != nil {
+		if addr, err = sectionData(idx.budget, idx.ef, ".debug_addr"); err != nil {
+			return err
+		}
+	}
+
+	packages := []dwpUnits{}
+	for _, dir := range dirs {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.dwp"))
+		if err != nil {
+			return fmt.Errorf("failed to look up .dwp packages: %w", err)
+		}
+		for _, path := range paths {
+			ef, err := elf.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to open .dwp package (%s): %w", path, err)
+			}
+			idx.closeSplit = append(idx.closeSplit, ef.Close)
+			units, err := readDWP(ef, idx.budget)
+			if err != nil {
+				return fmt.Errorf("failed to read .dwp package (%s): %w", path, err)
+			}
+			packages = append(packages, units)
+		}
+	}
+
+	missing := []string{}
+	for _, s := range skeletons {
+		if s.addrBase < 0 || s.addrBase > int64(len(addr)) {
+			return fmt.Errorf("%w: invalid address base of split unit %s", ErrMalformed, s.dwoName)
+		}
+		split, err := idx.openSplitUnit(s, addr[s.addrBase:], packages, dirs)
+		if err != nil {
+			return fmt.Errorf("failed to read split unit %s: %w", s.dwoName, err)
+		}
+		if split == nil {
+			missing = append(missing, s.dwoName)
+			continue
+		}
+		split.skeleton = idx
+		idx.split = append(idx.split, split)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("split units %s: %w, set the directories they are in with WithSplitDWARFDirs", strings.Join(missing, ", "), fs.ErrNotExist)
+	}
+	return nil
+}
+
+// openSplitUnit indexes the split unit of the given skeleton unit, nil when it is not found.
+// The given addresses are the ones of the unit.
+func (idx *TypeIndex) openSplitUnit(s skeletonUnit, addr []byte, packages []dwpUnits, dirs []string) (*TypeIndex, error) {
+	for _, units := range packages {
+		if sections, ok := units[s.id]; ok {
+			sections.addr = addr
+			return sections.index(idx.ef, idx.budget)
+		}
+	}
+
+	candidates := []string{s.dwoName}
+	if !filepath.IsAbs(s.dwoName) {
+		candidates[0] = filepath.Join(s.compDir, s.dwoName)
+	}
+	for _, dir := range dirs {
+		candidates = append(candidates, filepath.Join(dir, s.dwoName), filepath.Join(dir, filepath.Base(s.dwoName)))
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		ef, err := elf.Open(candidate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open .dwo file (%s): %w", candidate, err)
+		}
+		sections, err := readDWO(ef, idx.budget)
+		if err != nil {
+			ef.Close()
+			return nil, fmt.Errorf("failed to read .dwo file (%s): %w", candidate, err)
+		}
+		if id, err := sections.id(ef.ByteOrder); err != nil || id != s.id {
+			// Left by another build of the program.
+			ef.Close()
+			continue
+		}
+		idx.closeSplit = append(idx.closeSplit, ef.Close)
+		sections.addr = addr
+		return sections.index(ef, idx.budget)
+	}
+	return nil, nil
+}
+
+// readDWO reads the sections of the split unit of the given .dwo file.
+func readDWO(ef *elf.File, b *budget) (splitSections, error) {
+	var (
+		s   splitSections
+		err error
+	)
+	if s.info, err = sectionData(b, ef, ".debug_info.dwo"); err != nil {
+		return s, err
+	}
+	if s.abbrev, err = sectionData(b, ef, ".debug_abbrev.dwo"); err != nil {
+		return s, err
+	}
+	if s.strOffsets, err = sectionData(b, ef, ".debug_str_offsets.dwo"); err != nil {
+		return s, err
+	}
+	if s.str, err = sectionData(b, ef, ".debug_str.dwo"); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// DWARF 5 identifiers of the sections in the unit index of a .dwp package.
+const (
+	dwSectInfo       = 1
+	dwSectAbbrev     = 3
+	dwSectStrOffsets = 6
+)
+
+// readDWP reads the split units of the given .dwp package,
+// using its unit index to slice their contributions out of the sections of the package.
+func readDWP(ef *elf.File, b *budget) (dwpUnits, error) {
+	index, err := sectionData(b, ef, ".debug_cu_index")
+	if err != nil {
+		return nil, err
+	}
+	var all splitSections
+	if all, err = readDWO(ef, b); err != nil {
+		return nil, err
+	}
+
+	order := ef.ByteOrder
+	if len(index) < 16 {
+		return nil, fmt.Errorf("%w: invalid .debug_cu_index", ErrMalformed)
+	}
+	if version := order.Uint16(index); version != 5 {
+		return nil, fmt.Errorf("%w: .debug_cu_index version %d", errors.ErrUnsupported, version)
+	}
+	var (
+		columns = uint64(order.Uint32(index[4:]))
+		rows    = uint64(order.Uint32(index[8:]))
+		slots   = uint64(order.Uint32(index[12:]))
+		// The hash table, the parallel table of rows, then the section identifiers, the offsets and the sizes.
+		hashes  = uint64(16)
+		indexes = hashes + slots*8
+		ids     = indexes + slots*4
+		offsets = ids + columns*4
+		sizes   = offsets + rows*columns*4
+		end     = sizes + rows*columns*4
+	)
+	if slots > uint64(len(index)) || rows > slots || columns > uint64(len(index)) || end > uint64(len(index)) {
+		return nil, fmt.Errorf("%w: invalid .debug_cu_index", ErrMalformed)
+	}
+
+	units := dwpUnits{}
+	for slot := uint64(0); slot < slots; slot++ {
+		row := uint64(order.Uint32(index[indexes+slot*4:]))
+		if row == 0 {
+			continue
+		}
+		if row > rows {
+			return nil, fmt.Errorf("%w: invalid row %d in .debug_cu_index", ErrMalformed, row)
+		}
+		var (
+			id       = order.Uint64(index[hashes+slot*8:])
+			sections = splitSections{str: all.str}
+		)
+		for col := uint64(0); col < columns; col++ {
+			var (
+				cell = ((row-1)*columns + col) * 4
+				off  = uint64(order.Uint32(index[offsets+cell:]))
+				size = uint64(order.Uint32(index[sizes+cell:]))
+			)
+			// contribution slices the contribution of the unit out of the given section.
+			contribution := func(section []byte) ([]byte, error) {
+				if off+size > uint64(len(section)) {
+					return nil, fmt.Errorf("%w: invalid contribution of unit %#x in .debug_cu_index", ErrMalformed, id)
+				}
+				return section[off : off+size], nil
+			}
+			var err error
+			switch order.Uint32(index[ids+col*4:]) {
+			case dwSectInfo:
+				sections.info, err = contribution(all.info)
+			case dwSectAbbrev:
+				sections.abbrev, err = contribution(all.abbrev)
+			case dwSectStrOffsets:
+				sections.strOffsets, err = contribution(all.strOffsets)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		units[id] = sections
+	}
+	return units, nil
+}
+
+// id returns the ID of the split unit, which matches the one of its skeleton unit.
+func (s splitSections) id(order binary.ByteOrder) (uint64, error) {
+	headers, err := readUnitHeaders(bytes.NewReader(s.info), int64(len(s.info)), order)
+	if err != nil {
+		return 0, err
+	}
+	for _, h := range headers {
+		if h.typ == utSplitCompile {
+			return h.id, nil
+		}
+	}
+	return 0, errors.New("no split compilation unit")
+}
+
+// index builds the TypeIndex of the split unit, the given ELF file is the one its sections are in.
+// The index shares the given budget with the one of the program.
+func (s splitSections) index(ef *elf.File, b *budget) (*TypeIndex, error) {
+	dwarfData, err := dwarf.New(s.abbrev, nil, nil, s.info, nil, nil, nil, s.str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DWARF info: %w", malformed(err))
+	}
+	// Split units have no DW_AT_str_offsets_base, their string offsets follow the header of their contribution.
+	strOffsets, err := skipStrOffsetsHeader(s.strOffsets, ef.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+	if err := dwarfData.AddSection(".debug_str_offsets", strOffsets); err != nil {
+		return nil, fmt.Errorf("failed to add .debug_str_offsets: %w", err)
+	}
+	// Nor DW_AT_addr_base, the one of their skeleton unit applies.
+	if err := dwarfData.AddSection(".debug_addr", s.addr); err != nil {
+		return nil, fmt.Errorf("failed to add .debug_addr: %w", err)
+	}
+	idx, err := indexDWARF(ef, dwarfData, b)
+	if err != nil {
+		return nil, err
+	}
+	idx.info = s.info
+	return idx, nil
+}
+
+// skipStrOffsetsHeader returns the string offsets of the given DWARF 5 .debug_str_offsets contribution.
+func skipStrOffsetsHeader(data []byte, order binary.ByteOrder) ([]byte, error) {
+	// The unit length, then the version and padding.
+	header := 8
+	if len(data) >= 4 && order.Uint32(data) == 0xffffffff {
+		header = 16
+	}
+	if len(data) < header {
+		return nil, fmt.Errorf("%w: invalid .debug_str_offsets.dwo", ErrMalformed)
+	}
+	return data[header:], nil
+}
+
+// sectionData returns the contents of the given section of the given ELF file, accounted for in the given budget.
+func sectionData(b *budget, ef *elf.File, name string) ([]byte, error) {
+	sec := ef.Section(name)
+	if sec == nil {
+		return nil, fmt.Errorf("no %s section", name)
+	}
+	data, err := b.data(sec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// splitUnits returns the processors of the split units of the program, if it has been built with split DWARF.
+// Symbols are still looked up in the ELF file.
+func (p *processor) splitUnits() []*processor {
+	idx := p.index
+	if idx.skeleton != nil {
+		idx = idx.skeleton
+	}
+	units := make([]*processor, 0, len(idx.split))
+	for _, split := range idx.split {
+		units = append(units, &processor{
+			ef:        p.ef,
+			dwarfData: split.dwarfData,
+			index:     split,
+			pin:       p.pin,
+			conflict:  p.conflict,
+		})
+	}
+	return units
+}
+
+// splitCandidates returns the definitions of the type with the given name in all the split units,
+// in the order of the units.
+func (p *processor) splitCandidates(name string) ([]candidate, error) {
+	defs := []candidate{}
+	for _, q := range p.splitUnits() {
+		entries, err := q.index.lookup(name)
+		if err == nil {
+			entries, err = q.inSources(entries, q.pin)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %w", name, err)
+		}
+		cands, err := q.candidates(entries)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, cands...)
+	}
+	return defs, nil
+}
+
+// routeSplit resolves the given route in the split units of the program.
+// The definitions of the split units are compared as the ones of the units of a single file.
+func (p *processor) routeSplit(rn *RouteNode) error {
+	if rn.IsLeaf() && hasOnlyEnumExtractors(rn) {
+		for _, q := range p.splitUnits() {
+			entries, err := q.index.lookup(rn.Type)
+			if err != nil {
+				return fmt.Errorf("failed to look up %s: %w", rn.Type, err)
+			}
+			if entry, enum, ok := q.findEnumType(entries); ok {
+				if err := q.extractEnumerators(rn, entry, enum); err != nil {
+					return fmt.Errorf("failed to extract: %w", err)
+				}
+				return nil
+			}
+		}
+	}
+
+	defs, err := p.splitCandidates(rn.Type)
+	if err != nil {
+		return err
+	}
+	entry, q, err := p.choose(rn.Type, defs)
+	if err != nil {
+		return fmt.Errorf("failed to find composite type (%s): %w", rn.Type, err)
+	}
+
+	typ, err := q.index.typeAt(entry.Offset)
+	if err != nil {
+		return fmt.Errorf("failed to get type: %w", err)
+	}
+
+	if err := q.process(rn, entry, typ, []int64{0}); err != nil {
+		return fmt.Errorf("failed to process: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package datamap
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Supplementary files are written by dwz, which moves the entries shared by the programs of a package
+// to a separate file, named in the .gnu_debugaltlink section.
+// The entries left in the program refer to them with DW_FORM_GNU_ref_alt and DW_FORM_GNU_strp_alt,
+// which debug/dwarf decodes but does not follow.
+
+// parseDebugAltLink parses the contents of the .gnu_debugaltlink section,
+// the path of the supplementary file followed by its build ID.
+func parseDebugAltLink(data []byte) (string, []byte, error) {
+	i := bytes.IndexByte(data, 0)
+	if i <= 0 {
+		return "", nil, fmt.Errorf("%w: invalid .gnu_debugaltlink section", ErrMalformed)
+	}
+	return string(data[:i]), data[i+1:], nil
+}
+
+// openSupplementary opens the supplementary file the given ELF file links to, if any.
+// The path is looked up in each of the given directories, a relative one is resolved
+// against the directory of the ELF file first, when its path is known.
+// Absolute paths are never opened as they are, the file they name on this host may belong to another build.
+func openSupplementary(ef *elf.File, elfPath string, dirs []string) (*elf.File, error) {
+	sec := ef.Section(".gnu_debugaltlink")
+	if sec == nil {
+		return nil, nil
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gnu_debugaltlink: %w: %w", ErrMalformed, err)
+	}
+	path, id, err := parseDebugAltLink(data)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{}
+	if !filepath.IsAbs(path) && elfPath != "" {
+		candidates = append(candidates, filepath.Join(filepath.Dir(elfPath), path))
+	}
+	for _, dir := range dirs {
+		candidates = append(candidates, filepath.Join(dir, path))
+	}
+	errs := []error{}
+	for _, candidate := range candidates {
+		// Directories and devices cannot be supplementary files, and opening a FIFO blocks.
+		if fi, err := os.Stat(candidate); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		alt, err := elf.Open(candidate)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to open supplementary file (%s): %w", candidate, malformed(err)))
+			continue
+		}
+		if !bytes.Equal(buildID(alt), id) {
+			// A different version of the package.
+			alt.Close()
+			continue
+		}
+		return alt, nil
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("supplementary file (%s) with build ID %x: %w: %w", path, id, fs.ErrNotExist, errors.Join(errs...))
+	}
+	return nil, fmt.Errorf("supplementary file (%s) with build ID %x: %w", path, id, fs.ErrNotExist)
+}
+
+// buildID returns the GNU build ID note of the given ELF file.
+func buildID(ef *elf.File) []byte {
+	sec := ef.Section(".note.gnu.build-id")
+	if sec == nil {
+		return nil
+	}
+	data, err := sec.Data()
+	if err != nil || len(data) < 16 {
+		return nil
+	}
+	nameSize := ef.ByteOrder.Uint32(data[0:4])
+	descSize := ef.ByteOrder.Uint32(data[4:8])
+	start := 12 + (uint64(nameSize)+3)&^3
+	if start+uint64(descSize) > uint64(len(data)) {
+		return nil
+	}
+	return data[start : start+uint64(descSize)]
+}
+
+// stringAttr returns the value of the given string attribute of an entry of the index,
+// reading it from the supplementary file when it has been moved there.
+func (idx *TypeIndex) stringAttr(entry *dwarf.Entry, attr dwarf.Attr) (string, bool) {
+	field := entry.AttrField(attr)
+	if field == nil {
+		return "", false
+	}
+	switch field.Class {
+	case dwarf.ClassString:
+		s, ok := field.Val.(string)
+		return s, ok
+	case dwarf.ClassStringAlt:
+		off, ok := field.Val.(int64)
+		if !ok || idx.altStr == nil || off < 0 || off >= int64(len(idx.altStr)) {
+			return "", false
+		}
+		str := idx.altStr[off:]
+		if i := bytes.IndexByte(str, 0); i >= 0 {
+			str = str[:i]
+		}
+		return string(str), true
+	default:
+		return "", false
+	}
+}
+
+// nameOf returns the name of the given entry of the index.
+func (idx *TypeIndex) nameOf(entry *dwarf.Entry) string {
+	name, _ := idx.stringAttr(entry, dwarf.AttrName)
+	return name
+}
+
+// link replaces the types debug/dwarf read as void in place of references to the supplementary file,
+// and fills in the names that have been moved there.
+// The given offset is the one of the entry of the type.
+// The caller must hold idx.mu.
+func (idx *TypeIndex) link(typ dwarf.Type, off dwarf.Offset) error {
+	if idx.linked[typ] {
+		return nil
+	}
+	idx.linked[typ] = true
+
+	r := idx.reader()
+	r.Seek(off)
+	entry, err := r.Next()
+	if err != nil {
+		return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	if entry == nil || entry.Offset != off {
+		return fmt.Errorf("no entry at offset %#x", off)
+	}
+
+	// resolve returns the type referred to by the given entry.
+	resolve := func(entry *dwarf.Entry, typ dwarf.Type) (dwarf.Type, error) {
+		field := entry.AttrField(dwarf.AttrType)
+		if field == nil {
+			return typ, nil
+		}
+		switch ref := field.Val.(type) {
+		case dwarf.Offset:
+			return typ, idx.link(typ, ref)
+		case int64:
+			if field.Class != dwarf.ClassReferenceAlt {
+				return typ, nil
+			}
+			if idx.alt == nil {
+				return nil, fmt.Errorf("type is in the supplementary file: %w", idx.altErr)
+			}
+			alt, err := idx.alt.typeAt(dwarf.Offset(ref))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read type in supplementary file: %w", err)
+			}
+			return alt, nil
+		default:
+			return typ, nil
+		}
+	}
+
+	switch t := typ.(type) {
+	case *dwarf.StructType:
+		if t.StructName == "" {
+			t.StructName = idx.nameOf(entry)
+		}
+		members, err := children(r, entry, dwarf.TagMember)
+		if err != nil {
+			return err
+		}
+		if len(members) != len(t.Field) {
+			return fmt.Errorf("unexpected number of members in %s", t.StructName)
+		}
+		for i, f := range t.Field {
+			if f.Name == "" {
+				f.Name = idx.nameOf(members[i])
+			}
+			if f.Type, err = resolve(members[i], f.Type); err != nil {
+				return fmt.Errorf("failed to resolve type of %s.%s: %w", t.StructName, f.Name, err)
+			}
+		}
+	case *dwarf.ArrayType:
+		// The dimensions after the first one are not entries of their own.
+		dims, err := children(r, entry, dwarf.TagSubrangeType)
+		if err != nil {
+			return err
+		}
+		inner := t
+		for i := 1; i < len(dims); i++ {
+			next, ok := inner.Type.(*dwarf.ArrayType)
+			if !ok {
+				break
+			}
+			inner = next
+		}
+		if inner.Type, err = resolve(entry, inner.Type); err != nil {
+			return err
+		}
+	case *dwarf.PtrType:
+		if t.Type, err = resolve(entry, t.Type); err != nil {
+			return err
+		}
+	case *dwarf.QualType:
+		if t.Type, err = resolve(entry, t.Type); err != nil {
+			return err
+		}
+	case *dwarf.TypedefType:
+		if t.Name == "" {
+			t.Name = idx.nameOf(entry)
+		}
+		if t.Type, err = resolve(entry, t.Type); err != nil {
+			return err
+		}
+	case *dwarf.EnumType:
+		if t.EnumName == "" {
+			t.EnumName = idx.nameOf(entry)
+		}
+		enumerators, err := children(r, entry, dwarf.TagEnumerator)
+		if err != nil {
+			return err
+		}
+		for i, v := range t.Val {
+			if v.Name == "" && i < len(enumerators) {
+				v.Name = idx.nameOf(enumerators[i])
+			}
+		}
+	}
+	return nil
+}
+
+// children returns the direct children of the given entry with the given tag.
+func children(r *entryReader, entry *dwarf.Entry, tag dwarf.Tag) ([]*dwarf.Entry, error) {
+	if !entry.Children {
+		return nil, nil
+	}
+	r.Seek(entry.Offset)
+	if _, err := r.Next(); err != nil {
+		return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	children := []*dwarf.Entry{}
+	for {
+		child, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+		}
+		if child == nil || child.Tag == 0 {
+			return children, nil
+		}
+		if child.Children {
+			r.SkipChildren()
+		}
+		if child.Tag == tag {
+			children = append(children, child)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+//go:build ignore
+
+// btfenums rewrites the enums of routes.c in the .BTF section of a program built by gcc 12
+// the way gcc 13 and pahole write them: the kind flag is set on the signed enums,
+// and the enumerators that do not fit in 32 bits are kept, in an ENUM64.
+// gcc 12 sets the kind flag on no enum and drops these enumerators.
+//
+//	go run btfenums.go x86_64/routes-btf
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	btfKindInt       = 1
+	btfKindArray     = 3
+	btfKindStruct    = 4
+	btfKindUnion     = 5
+	btfKindEnum      = 6
+	btfKindFuncProto = 13
+	btfKindVar       = 14
+	btfKindDatasec   = 15
+	btfKindDeclTag   = 17
+	btfKindEnum64    = 19
+)
+
+type enumerator struct {
+	name  string
+	value int64
+}
+
+// enums are the enums of routes.c that gcc 12 does not describe correctly.
+var enums = map[string]struct {
+	signed      bool
+	enumerators []enumerator
+}{
+	"lock_state": {signed: true, enumerators: []enumerator{
+		{"LOCK_RELEASED", -1}, {"LOCK_FREE", 0}, {"LOCK_HELD", 1},
+	}},
+	"frame_flags": {signed: false, enumerators: []enumerator{
+		{"FRAME_FLAG_FINISH", 0x80000000}, {"FRAME_FLAG_MASK", 0xffffffff},
+	}},
+	"object_id": {signed: true, enumerators: []enumerator{
+		{"OBJECT_ID_MIN", -0x100000000}, {"OBJECT_ID_MAX", 0x100000000},
+	}},
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: btfenums program")
+	}
+	path := os.Args[1]
+	ef, err := elf.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sec := ef.Section(".BTF")
+	if sec == nil {
+		log.Fatalf("%s: no .BTF section", path)
+	}
+	data, err := sec.Data()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ef.Close()
+
+	le := binary.LittleEndian
+	if len(data) < 24 || le.Uint16(data) != 0xeb9f {
+		log.Fatalf("%s: not a little-endian BTF blob", path)
+	}
+	var (
+		hdrLen  = le.Uint32(data[4:])
+		typeOff = le.Uint32(data[8:])
+		typeLen = le.Uint32(data[12:])
+		strOff  = le.Uint32(data[16:])
+		strLen  = le.Uint32(data[20:])
+		types   = data[hdrLen+typeOff : hdrLen+typeOff+typeLen]
+		str     = append([]byte{}, data[hdrLen+strOff:hdrLen+strOff+strLen]...)
+	)
+	name := func(off uint32) string {
+		end := off
+		for str[end] != 0 {
+			end++
+		}
+		return string(str[off:end])
+	}
+	addString := func(s string) uint32 {
+		off := uint32(len(str))
+		str = append(append(str, s...), 0)
+		return off
+	}
+
+	var out []byte
+	for off := uint32(0); off < uint32(len(types)); {
+		nameOff, info := le.Uint32(types[off:]), le.Uint32(types[off+4:])
+		kind, vlen := (info>>24)&0x1f, info&0xffff
+		n := 12 + extraLen(kind, vlen)
+		enum, ok := enums[name(nameOff)]
+		if kind != btfKindEnum || !ok {
+			out = append(out, types[off:off+n]...)
+			off += n
+			continue
+		}
+
+		size := le.Uint32(types[off+8:])
+		kind = btfKindEnum
+		if size == 8 {
+			kind = btfKindEnum64
+		}
+		info = kind<<24 | uint32(len(enum.enumerators))
+		if enum.signed {
+			info |= 1 << 31
+		}
+		out = le.AppendUint32(out, nameOff)
+		out = le.AppendUint32(out, info)
+		out = le.AppendUint32(out, size)
+		for _, e := range enum.enumerators {
+			out = le.AppendUint32(out, addString(e.name))
+			out = le.AppendUint32(out, uint32(e.value))
+			if kind == btfKindEnum64 {
+				out = le.AppendUint32(out, uint32(uint64(e.value)>>32))
+			}
+		}
+		off += n
+	}
+
+	// The header is kept, the strings follow the types.
+	blob := append([]byte{}, data[:hdrLen]...)
+	le.PutUint32(blob[8:], 0)
+	le.PutUint32(blob[12:], uint32(len(out)))
+	le.PutUint32(blob[16:], uint32(len(out)))
+	le.PutUint32(blob[20:], uint32(len(str)))
+	blob = append(append(blob, out...), str...)
+
+	dir, err := os.MkdirTemp("", "btfenums")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "btf")
+	if err := os.WriteFile(file, blob, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	if output, err := exec.Command("objcopy", "--update-section", ".BTF="+file, path).CombinedOutput(); err != nil {
+		log.Fatalf("objcopy: %v: %s", err, output)
+	}
+}
+
+// extraLen returns the length of the data that follows a type of the given kind.
+func extraLen(kind, vlen uint32) uint32 {
+	switch kind {
+	case btfKindInt, btfKindVar, btfKindDeclTag:
+		return 4
+	case btfKindArray:
+		return 12
+	case btfKindStruct, btfKindUnion, btfKindDatasec:
+		return vlen * 12
+	case btfKindEnum, btfKindFuncProto:
+		return vlen * 8
+	case btfKindEnum64:
+		return vlen * 12
+	}
+	return 0
+}
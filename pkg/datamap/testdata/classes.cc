@@ -0,0 +1,100 @@
+// Test program for the C++ specific parts of the data maps.
+
+class frame {
+public:
+  enum {
+    interpreter_frame_sender_sp_offset = -1,
+    interpreter_frame_last_sp_offset = -2,
+  };
+  enum frame_state { unknown = 0, walkable = 1 };
+
+  long *_sp;
+  frame_state _state;
+};
+
+frame the_frame;
+
+class CodeCache {
+public:
+  static frame *_heaps;
+};
+
+frame *CodeCache::_heaps = &the_frame;
+
+class CodeBlob {
+public:
+  const char *_name;
+  frame _frame_info;
+};
+
+class CompiledMethod : public CodeBlob {
+public:
+  unsigned char *_scopes_data_begin;
+  unsigned int _has_flushed_dependencies : 1;
+  unsigned int _has_wide_vectors : 1;
+};
+
+class Relocatable {
+public:
+  virtual ~Relocatable() {}
+  long _relocations;
+};
+
+class nmethod : public CompiledMethod, public Relocatable {
+public:
+  int _entry_bci;
+};
+
+nmethod the_nmethod;
+
+class CodeHeap {
+public:
+  long _segments;
+};
+
+template <typename E> class GrowableArray {
+public:
+  int _len;
+  int _max;
+  E *_data;
+};
+
+GrowableArray<CodeHeap *> the_heaps;
+GrowableArray<int> the_ints;
+
+namespace hotspot {
+class CodeCache {
+public:
+  class Entry;
+  long _count;
+};
+
+class CodeCache::Entry {
+public:
+  int _id;
+  long _size;
+};
+} // namespace hotspot
+
+hotspot::CodeCache the_hotspot_code_cache;
+hotspot::CodeCache::Entry the_entry;
+
+namespace v8 {
+namespace internal {
+class Isolate {
+public:
+  void *_heap;
+  long _thread_id;
+};
+} // namespace internal
+
+class Isolate {
+public:
+  internal::Isolate *_impl;
+};
+} // namespace v8
+
+v8::Isolate the_isolate;
+v8::internal::Isolate the_internal_isolate;
+
+int main() { return the_frame._state; }
@@ -0,0 +1,164 @@
+//go:build ignore
+
+// dwp packs DWARF 5 .dwo files into a .dwp package, with a version 5 .debug_cu_index.
+// llvm-dwp 14 hangs on the .dwo files written by gcc 12, and GNU dwp drops their units.
+//
+//	go run dwp.go -o out.dwp a.dwo b.dwo
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// DWARF 5 section identifiers of the unit index.
+const (
+	dwSectInfo       = 1
+	dwSectAbbrev     = 3
+	dwSectLine       = 4
+	dwSectStrOffsets = 6
+)
+
+var sections = []struct {
+	id   uint32
+	name string
+}{
+	{dwSectInfo, ".debug_info.dwo"},
+	{dwSectAbbrev, ".debug_abbrev.dwo"},
+	{dwSectLine, ".debug_line.dwo"},
+	{dwSectStrOffsets, ".debug_str_offsets.dwo"},
+}
+
+func main() {
+	out := flag.String("o", "", "output file")
+	flag.Parse()
+	if *out == "" || flag.NArg() == 0 {
+		log.Fatal("usage: dwp -o out.dwp file.dwo...")
+	}
+
+	var (
+		contents = make([][]byte, len(sections))
+		str      []byte
+		ids      []uint64
+		offsets  [][]uint32
+		sizes    [][]uint32
+	)
+	for _, path := range flag.Args() {
+		ef, err := elf.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data := map[string][]byte{}
+		for _, name := range []string{".debug_info.dwo", ".debug_abbrev.dwo", ".debug_line.dwo", ".debug_str_offsets.dwo", ".debug_str.dwo"} {
+			sec := ef.Section(name)
+			if sec == nil {
+				log.Fatalf("%s: no %s section", path, name)
+			}
+			if data[name], err = sec.Data(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		ef.Close()
+
+		info := data[".debug_info.dwo"]
+		if len(info) < 20 || binary.LittleEndian.Uint16(info[4:]) != 5 || info[6] != 0x05 {
+			log.Fatalf("%s: not a DWARF 5 split compilation unit", path)
+		}
+		ids = append(ids, binary.LittleEndian.Uint64(info[12:]))
+
+		// The strings are concatenated, the offsets to them are moved accordingly.
+		strOffsets := data[".debug_str_offsets.dwo"]
+		for i := 8; i+4 <= len(strOffsets); i += 4 {
+			off := binary.LittleEndian.Uint32(strOffsets[i:])
+			binary.LittleEndian.PutUint32(strOffsets[i:], off+uint32(len(str)))
+		}
+		str = append(str, data[".debug_str.dwo"]...)
+
+		row := make([]uint32, len(sections))
+		size := make([]uint32, len(sections))
+		for i, s := range sections {
+			row[i] = uint32(len(contents[i]))
+			size[i] = uint32(len(data[s.name]))
+			contents[i] = append(contents[i], data[s.name]...)
+		}
+		offsets = append(offsets, row)
+		sizes = append(sizes, size)
+	}
+
+	dir, err := os.MkdirTemp("", "dwp")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{}
+	for i, s := range sections {
+		args = append(args, "--update-section", s.name+"="+write(dir, s.name, contents[i]))
+	}
+	args = append(args,
+		"--update-section", ".debug_str.dwo="+write(dir, ".debug_str.dwo", str),
+		"--add-section", ".debug_cu_index="+write(dir, ".debug_cu_index", cuIndex(ids, offsets, sizes)),
+		flag.Arg(0), *out)
+	if output, err := exec.Command("objcopy", args...).CombinedOutput(); err != nil {
+		log.Fatalf("objcopy: %v: %s", err, output)
+	}
+}
+
+// cuIndex builds the unit index of the given units.
+func cuIndex(ids []uint64, offsets, sizes [][]uint32) []byte {
+	slots := uint32(1)
+	for slots*2 < uint32(len(ids))*3 {
+		slots *= 2
+	}
+	var (
+		hashes  = make([]uint64, slots)
+		indexes = make([]uint32, slots)
+	)
+	for row, id := range ids {
+		mask := uint64(slots - 1)
+		h := id & mask
+		step := ((id >> 32) & mask) | 1
+		for indexes[h] != 0 {
+			h = (h + step) & mask
+		}
+		hashes[h] = id
+		indexes[h] = uint32(row + 1)
+	}
+
+	b := binary.LittleEndian.AppendUint16(nil, 5)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(sections)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(ids)))
+	b = binary.LittleEndian.AppendUint32(b, slots)
+	for _, h := range hashes {
+		b = binary.LittleEndian.AppendUint64(b, h)
+	}
+	for _, i := range indexes {
+		b = binary.LittleEndian.AppendUint32(b, i)
+	}
+	for _, s := range sections {
+		b = binary.LittleEndian.AppendUint32(b, s.id)
+	}
+	for _, table := range [][][]uint32{offsets, sizes} {
+		for _, row := range table {
+			for _, v := range row {
+				b = binary.LittleEndian.AppendUint32(b, v)
+			}
+		}
+	}
+	return b
+}
+
+func write(dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		log.Fatal(fmt.Errorf("failed to write %s: %w", name, err))
+	}
+	return path
+}
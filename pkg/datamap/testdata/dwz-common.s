@@ -0,0 +1,83 @@
+# Supplementary file in the layout written by dwz -m, with the types shared
+# by the programs of a package moved into a partial unit.
+# dwz is not available everywhere, so the DWARF data is written by hand.
+
+	.section .debug_abbrev,"",@progbits
+.Labbrev:
+	.uleb128 1		# partial unit
+	.uleb128 0x3c		# DW_TAG_partial_unit
+	.byte 1			# DW_CHILDREN_yes
+	.byte 0, 0
+	.uleb128 2		# base type
+	.uleb128 0x24		# DW_TAG_base_type
+	.byte 0
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0xb, 0xb	# DW_AT_byte_size, DW_FORM_data1
+	.uleb128 0x3e, 0xb	# DW_AT_encoding, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 3		# struct
+	.uleb128 0x13		# DW_TAG_structure_type
+	.byte 1
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0xb, 0xb	# DW_AT_byte_size, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 4		# member
+	.uleb128 0xd		# DW_TAG_member
+	.byte 0
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0x49, 0x13	# DW_AT_type, DW_FORM_ref4
+	.uleb128 0x38, 0xb	# DW_AT_data_member_location, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 5		# typedef
+	.uleb128 0x16		# DW_TAG_typedef
+	.byte 0
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0x49, 0x13	# DW_AT_type, DW_FORM_ref4
+	.byte 0, 0
+	.byte 0
+
+	.section .debug_info,"",@progbits
+.Lcu:
+	.long .Lcu_end - .Lcu_version
+.Lcu_version:
+	.value 4
+	.long 0			# .debug_abbrev offset
+	.byte 8
+	.uleb128 1		# 0x0b: partial unit
+.Lint:
+	.uleb128 2		# 0x0c: int
+	.string "int"
+	.byte 4, 5
+.Llong:
+	.uleb128 2		# 0x13: long int
+	.string "long int"
+	.byte 8, 5
+.Lshared:
+	.uleb128 3		# 0x1f: struct shared
+	.string "shared"
+	.byte 16
+	.uleb128 4
+	.string "id"
+	.long .Lint - .Lcu
+	.byte 0
+	.uleb128 4
+	.string "value"
+	.long .Llong - .Lcu
+	.byte 8
+	.byte 0
+	.uleb128 5		# 0x3e: shared_t
+	.string "shared_t"
+	.long .Lshared - .Lcu
+	.byte 0
+.Lcu_end:
+
+	.section .debug_str,"MS",@progbits,1
+	.string "counters"	# 0x00
+
+	.section .note.gnu.build-id,"a",@note
+	.long 4
+	.long 20
+	.long 3			# NT_GNU_BUILD_ID
+	.string "GNU"
+	.byte 0xd7, 0x2a, 0x0b, 0x5e, 0x11, 0x3c, 0x9f, 0x40, 0x6b, 0x8e
+	.byte 0x21, 0x47, 0xc5, 0x03, 0x9a, 0x7d, 0x62, 0xf0, 0x18, 0xb4
@@ -0,0 +1,141 @@
+# Program whose DWARF data refers to the supplementary file in dwz-common.s,
+# through DW_FORM_GNU_ref_alt and DW_FORM_GNU_strp_alt, as dwz -m leaves it.
+#
+#	struct holder {
+#		int flags;
+#		struct shared embedded;
+#		struct shared *ptr;
+#		int counters[4];
+#	};
+
+	.text
+	.globl main
+	.type main, @function
+main:
+	xorl %eax, %eax
+	ret
+	.size main, .-main
+
+	.section .gnu_debugaltlink,"",@progbits
+	.string "/usr/lib/debug/.dwz/dwz.debug"
+	.byte 0xd7, 0x2a, 0x0b, 0x5e, 0x11, 0x3c, 0x9f, 0x40, 0x6b, 0x8e
+	.byte 0x21, 0x47, 0xc5, 0x03, 0x9a, 0x7d, 0x62, 0xf0, 0x18, 0xb4
+
+	# Offsets of the entries in the supplementary file.
+	.set alt_partial_unit, 0x0b
+	.set alt_int, 0x0c
+	.set alt_shared, 0x1f
+	.set alt_counters_str, 0x00
+
+	.section .debug_abbrev,"",@progbits
+.Labbrev:
+	.uleb128 1		# compile unit
+	.uleb128 0x11		# DW_TAG_compile_unit
+	.byte 1
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0x13, 0xb	# DW_AT_language, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 2		# imported unit
+	.uleb128 0x3d		# DW_TAG_imported_unit
+	.byte 0
+	.uleb128 0x18, 0x1f20	# DW_AT_import, DW_FORM_GNU_ref_alt
+	.byte 0, 0
+	.uleb128 3		# struct
+	.uleb128 0x13		# DW_TAG_structure_type
+	.byte 1
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0xb, 0xb	# DW_AT_byte_size, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 4		# member of a shared type
+	.uleb128 0xd		# DW_TAG_member
+	.byte 0
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0x49, 0x1f20	# DW_AT_type, DW_FORM_GNU_ref_alt
+	.uleb128 0x38, 0xb	# DW_AT_data_member_location, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 5		# member of a local type
+	.uleb128 0xd		# DW_TAG_member
+	.byte 0
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0x49, 0x13	# DW_AT_type, DW_FORM_ref4
+	.uleb128 0x38, 0xb	# DW_AT_data_member_location, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 6		# member with a shared name
+	.uleb128 0xd		# DW_TAG_member
+	.byte 0
+	.uleb128 0x3, 0x1f21	# DW_AT_name, DW_FORM_GNU_strp_alt
+	.uleb128 0x49, 0x13	# DW_AT_type, DW_FORM_ref4
+	.uleb128 0x38, 0xb	# DW_AT_data_member_location, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 7		# pointer to a shared type
+	.uleb128 0xf		# DW_TAG_pointer_type
+	.byte 0
+	.uleb128 0xb, 0xb	# DW_AT_byte_size, DW_FORM_data1
+	.uleb128 0x49, 0x1f20	# DW_AT_type, DW_FORM_GNU_ref_alt
+	.byte 0, 0
+	.uleb128 8		# array of a shared type
+	.uleb128 0x1		# DW_TAG_array_type
+	.byte 1
+	.uleb128 0x49, 0x1f20	# DW_AT_type, DW_FORM_GNU_ref_alt
+	.byte 0, 0
+	.uleb128 9		# subrange
+	.uleb128 0x21		# DW_TAG_subrange_type
+	.byte 0
+	.uleb128 0x2f, 0xb	# DW_AT_upper_bound, DW_FORM_data1
+	.byte 0, 0
+	.uleb128 10		# struct declaration
+	.uleb128 0x13		# DW_TAG_structure_type
+	.byte 0
+	.uleb128 0x3, 0x8	# DW_AT_name, DW_FORM_string
+	.uleb128 0x3c, 0x19	# DW_AT_declaration, DW_FORM_flag_present
+	.byte 0, 0
+	.byte 0
+
+	.section .debug_info,"",@progbits
+.Lcu:
+	.long .Lcu_end - .Lcu_version
+.Lcu_version:
+	.value 4
+	.long .Labbrev
+	.byte 8
+	.uleb128 1
+	.string "dwz.c"
+	.byte 0x1d		# DW_LANG_C11
+	.uleb128 2
+	.long alt_partial_unit
+	.uleb128 3
+	.string "holder"
+	.byte 48
+	.uleb128 4
+	.string "flags"
+	.long alt_int
+	.byte 0
+	.uleb128 4
+	.string "embedded"
+	.long alt_shared
+	.byte 8
+	.uleb128 5
+	.string "ptr"
+	.long .Lptr - .Lcu
+	.byte 24
+	.uleb128 6
+	.long alt_counters_str
+	.long .Larray - .Lcu
+	.byte 32
+	.byte 0
+.Lptr:
+	.uleb128 7
+	.byte 8
+	.long alt_shared
+.Larray:
+	.uleb128 8
+	.long alt_int
+	.uleb128 9
+	.byte 3
+	.byte 0
+	.uleb128 10
+	.string "shared"
+	.byte 0
+.Lcu_end:
+
+	.section .note.GNU-stack,"",@progbits
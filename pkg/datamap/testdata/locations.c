@@ -0,0 +1,43 @@
+// Test program for the locations of the parameters and the local variables of functions.
+
+struct frame {
+  struct frame *previous;
+  const unsigned char *instr;
+  long stack[4];
+};
+
+struct thread_state {
+  struct frame *current;
+  int depth;
+};
+
+__attribute__((noinline)) static long step(struct frame *frame, long acc) {
+  __asm__ volatile("" : : "r"(frame) : "memory");
+  return acc + *frame->instr;
+}
+
+__attribute__((noinline)) static void trace(struct thread_state *tstate) {
+  __asm__ volatile("" : : "r"(tstate) : "memory");
+}
+
+// The interpreter loop, its frame moves between registers and the stack as it runs.
+__attribute__((noinline)) long eval_frame(struct thread_state *tstate, struct frame *frame, int throwflag) {
+  long acc = throwflag;
+  tstate->current = frame;
+  tstate->depth++;
+  for (struct frame *f = frame; f != 0; f = f->previous) {
+    acc = step(f, acc);
+    trace(tstate);
+  }
+  tstate->current = frame->previous;
+  tstate->depth--;
+  return acc;
+}
+
+int main(void) {
+  static const unsigned char code[] = {1, 2, 3};
+  struct frame outer = {0, code, {0}};
+  struct frame inner = {&outer, code + 1, {0}};
+  struct thread_state tstate = {0, 0};
+  return (int)eval_frame(&tstate, &inner, 0);
+}
@@ -0,0 +1,141 @@
+// Test program for the route syntax of the data maps.
+
+struct frame;
+
+struct execution_context {
+  void *stack;
+  long stack_size;
+  struct frame *cfp;
+};
+
+typedef struct thread {
+  long id;
+  int state;
+  struct execution_context *ec;
+} thread_t;
+
+struct vm {
+  void *self;
+  struct {
+    thread_t *main_thread;
+    int count;
+  } ractor;
+  struct thread *threads;
+};
+
+struct frame {
+  void *pc;
+  struct frame *prev;
+};
+
+struct ascii_object {
+  long refcnt;
+  void *type;
+  long length;
+  long hash;
+  struct {
+    unsigned int interned : 2;
+    unsigned int kind : 3;
+    unsigned int compact : 1;
+    unsigned int ascii : 1;
+    unsigned int ready : 1;
+  } state;
+  unsigned short flags : 4;
+  unsigned short mode : 7;
+};
+
+enum frame_owner {
+  FRAME_OWNED_BY_THREAD = 0,
+  FRAME_OWNED_BY_GENERATOR = 1,
+  FRAME_OWNED_BY_FRAME_OBJECT = 2,
+  FRAME_OWNED_BY_CSTACK = 3,
+};
+
+typedef enum {
+  VM_FRAME_MAGIC_METHOD = 0x11110001,
+  VM_FRAME_MAGIC_BLOCK = 0x22220001,
+} vm_frame_magic;
+
+// The enumerators of an enum whose values are all positive are unsigned,
+// the others are signed.
+enum lock_state {
+  LOCK_RELEASED = -1,
+  LOCK_FREE = 0,
+  LOCK_HELD = 1,
+};
+
+enum frame_flags {
+  FRAME_FLAG_FINISH = 0x80000000,
+  FRAME_FLAG_MASK = 0xffffffff,
+};
+
+enum object_id {
+  OBJECT_ID_MIN = -0x100000000,
+  OBJECT_ID_MAX = 0x100000000,
+};
+
+struct key_data {
+  unsigned long seq;
+  void *data;
+};
+
+typedef struct key_data key_block[4];
+
+struct runtime {
+  int flags;
+  struct key_data specific_1stblock[32];
+  key_block blocks[2];
+  struct frame *frames[3];
+  struct execution_context contexts[2];
+  char name[];
+};
+
+// Anonymous members, and typedef or qualified intermediates, as in CPython and glibc.
+typedef const struct frame const_frame_t;
+
+struct interpreter {
+  long id;
+  union {
+    struct {
+      int state;
+      unsigned int finalizing : 1;
+      unsigned int daemon : 1;
+    };
+    long padding[2];
+  };
+  const struct execution_context ceval;
+  volatile thread_t current;
+  const_frame_t *const top_frame;
+  struct {
+    union {
+      void *head;
+      long count;
+    };
+  } threads;
+};
+
+typedef struct interpreter interpreter_t;
+typedef interpreter_t interpreter_alias_t;
+
+union slot {
+  long word;
+  struct frame *frame;
+};
+
+struct vm the_vm;
+enum frame_owner the_owner;
+vm_frame_magic the_magic;
+enum lock_state the_lock;
+enum frame_flags the_flags;
+enum object_id the_object_id;
+struct ascii_object the_string;
+struct frame the_frame;
+struct runtime the_runtime;
+interpreter_alias_t the_interpreter;
+union slot the_slot;
+
+// Thread-local variables, in the PT_TLS segment.
+__thread long tls_counter = 1;
+__thread struct execution_context *current_ec;
+
+int main() { return the_vm.ractor.count; }
@@ -0,0 +1,13 @@
+// Test program built with split DWARF, its types are spread over its compilation units.
+
+#include "thread.h"
+
+struct config {
+  int verbose;
+  int workers;
+};
+
+struct thread main_thread;
+struct config main_config;
+
+int main() { return start(&main_thread) + main_config.workers; }
@@ -0,0 +1,19 @@
+#include "thread.h"
+
+struct stack {
+  void *base;
+  unsigned long size;
+};
+
+struct config {
+  long verbose;
+  int workers;
+};
+
+struct config start_config;
+
+int start(struct thread *t) {
+  static struct stack s;
+  t->stack = &s;
+  return t->flags + start_config.workers;
+}
@@ -0,0 +1,11 @@
+// The thread descriptor, whose stack is only defined in start.c.
+
+struct stack;
+
+struct thread {
+  long tid;
+  struct stack *stack;
+  int flags;
+};
+
+int start(struct thread *t);
@@ -0,0 +1,15 @@
+// The thread descriptor, with optional members like glibc's struct pthread.
+
+struct list_head {
+  struct list_head *next;
+  struct list_head *prev;
+};
+
+struct pthread {
+  long tid;
+#ifdef WITH_HEADER
+  void *header[4];
+#endif
+  int cancelhandling;
+  struct list_head list;
+};
@@ -0,0 +1,14 @@
+// Test program whose types are defined differently in its compilation units.
+
+#include "descr.h"
+
+struct tls_block {
+  int dtv;
+  int generation;
+  long slots[2];
+};
+
+struct pthread main_thread;
+struct tls_block main_block;
+
+int main() { return main_thread.cancelhandling; }
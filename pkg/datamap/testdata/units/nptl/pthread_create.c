@@ -0,0 +1,6 @@
+#define WITH_HEADER
+#include "../descr.h"
+#include "tls.h"
+
+struct pthread created_thread;
+struct tls_block created_block;
@@ -0,0 +1,3 @@
+struct tls_block {
+  long dtv;
+};
@@ -0,0 +1,192 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// typeSet maps names to types that are converted to their debug/dwarf counterparts,
+// e.g. from BTF or from C headers, and resolves the routes that start from them
+// with the same rules as for DWARF.
+type typeSet struct {
+	names map[string][]typeEntry
+	// format names the type information in errors, e.g. BTF.
+	format string
+}
+
+type typeEntry struct {
+	id  dwarf.Offset
+	typ dwarf.Type
+}
+
+func newTypeSet(format string) typeSet {
+	return typeSet{names: map[string][]typeEntry{}, format: format}
+}
+
+// route resolves the given route and sets the values of its extractors.
+// The set has no variables, the routes of symbols and functions fail.
+func (ts *typeSet) route(rn *RouteNode) error {
+	if isSymbolRoute(rn) || isFunctionRoute(rn) {
+		err := fmt.Errorf("%s does not describe the variables of %s", ts.format, rn.Type)
+		if isFunctionRoute(rn) {
+			err = fmt.Errorf("%s does not describe the locations of the variables of %s", ts.format, rn.Type)
+		}
+		for _, ex := range rn.Extractors {
+			ex.fail(err)
+		}
+		return nil
+	}
+
+	entries := ts.names[rn.Type]
+
+	if rn.IsLeaf() && hasOnlyEnumExtractors(rn) {
+		for _, e := range entries {
+			enum, ok := underlyingType(e.typ).(*dwarf.EnumType)
+			if !ok {
+				continue
+			}
+			for _, ex := range rn.Extractors {
+				val, ok := enumValue(enum, ex.Source)
+				if !ok {
+					err := fmt.Errorf("enumerator %s not found in %s", ex.Source, rn.Type)
+					if ex.optional() {
+						ex.fail(err)
+						continue
+					}
+					return fmt.Errorf("failed to extract: %w", err)
+				}
+				if err := ex.Set(val); err != nil {
+					return fmt.Errorf("failed to extract: failed to set enumerator value: %w", err)
+				}
+				ex.resolvedAt(e.id)
+			}
+			return nil
+		}
+	}
+
+	for _, e := range entries {
+		st, ok := underlyingType(e.typ).(*dwarf.StructType)
+		if !ok || st.Incomplete {
+			continue
+		}
+		if err := ts.process(rn, e.id, st, []int64{0}); err != nil {
+			return fmt.Errorf("failed to process: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to find composite type (%s): no composite(struct|union) type found", rn.Type)
+}
+
+// process walks the route starting from the given struct, like processor.process does for DWARF.
+func (ts *typeSet) process(rn *RouteNode, id dwarf.Offset, st *dwarf.StructType, chain []int64) error {
+	if rn.IsLeaf() {
+		for _, ex := range rn.Extractors {
+			if err := ts.extract(rn, st, ex, chain); err != nil {
+				if ex.optional() {
+					ex.fail(err)
+					continue
+				}
+				return fmt.Errorf("failed to extract: %w", err)
+			}
+			ex.resolvedAt(id)
+		}
+		return nil
+	}
+
+	field, ok := flattenedField(st, rn.Next.Type, 0)
+	if !ok {
+		return fmt.Errorf("field %s not found in %s", rn.Next.Type, rn.Type)
+	}
+	fieldType, indexOffset, err := indexArray(field.Type, rn.Next.Index)
+	if err != nil {
+		return fmt.Errorf("failed to index field (%s): %w", field.Name, err)
+	}
+	next := withOffset(chain, field.ByteOffset+indexOffset)
+	if rn.Next.Deref {
+		ptr, ok := fieldType.(*dwarf.PtrType)
+		if !ok {
+			return fmt.Errorf("failed to dereference field (%s): not a pointer, type: %s", field.Name, typeString(fieldType))
+		}
+		fieldType = underlyingType(ptr.Type)
+		if pointee, ok := fieldType.(*dwarf.StructType); ok && pointee.Incomplete {
+			fieldType = ts.definition(pointee.StructName)
+		}
+		next = append(next, 0)
+	}
+	nextStruct, ok := fieldType.(*dwarf.StructType)
+	if !ok || nextStruct.Incomplete {
+		return fmt.Errorf("%s is not a struct, type: %s", rn.Next.Type, typeString(fieldType))
+	}
+	return ts.process(rn.Next, id, nextStruct, next)
+}
+
+func (ts *typeSet) extract(rn *RouteNode, st *dwarf.StructType, ex *Extractor, chain []int64) error {
+	switch {
+	case ex.inspect != nil:
+		return ex.inspect(ts.composite(st))
+	case ex.Op == OpSizeOf && ex.Source == rn.Type:
+		if err := ex.Set(st.Size()); err != nil {
+			return fmt.Errorf("failed to set size: %w", err)
+		}
+		return nil
+	case ex.Op == OpOffsetOf && ex.Static:
+		// Like a static member that is not defined, the field is reported as missing.
+		err := fmt.Errorf("static member %s.%s is not described by %s", rn.Type, ex.Source, ts.format)
+		if ex.optional() {
+			return err
+		}
+		ex.fail(err)
+		return nil
+	case ex.Op == OpEnumValue:
+		return fmt.Errorf("enumerator %s not found in %s, %s does not describe nested enumerations", ex.Source, rn.Type, ts.format)
+	}
+
+	field, ok := flattenedField(st, ex.Source, 0)
+	if !ok {
+		return fmt.Errorf("field %s not found in %s", ex.Source, rn.Type)
+	}
+	return extractField(ex, field, chain, func(field *dwarf.StructField) (int64, error) {
+		return field.DataBitOffset, nil
+	})
+}
+
+// flattenedField looks up the member with the given name in the given struct,
+// then in the anonymous structs and unions it contains, like C does.
+// The offsets of the member are relative to the given struct.
+// The depth is the number of anonymous members looked up through to reach the struct,
+// BTF can describe a struct that contains itself.
+func flattenedField(st *dwarf.StructType, name string, depth int) (*dwarf.StructField, bool) {
+	if depth > maxTypeDepth {
+		return nil, false
+	}
+	for _, f := range st.Field {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	for _, f := range st.Field {
+		inner, ok := underlyingType(f.Type).(*dwarf.StructType)
+		if f.Name != "" || !ok {
+			continue
+		}
+		found, ok := flattenedField(inner, name, depth+1)
+		if !ok {
+			continue
+		}
+		field := *found
+		field.ByteOffset += f.ByteOffset
+		field.DataBitOffset += f.ByteOffset * 8
+		return &field, true
+	}
+	return nil, false
+}
+
+// definition returns the complete struct with the given name, if any.
+func (ts *typeSet) definition(name string) dwarf.Type {
+	for _, e := range ts.names[name] {
+		if st, ok := underlyingType(e.typ).(*dwarf.StructType); ok && !st.Incomplete {
+			return st
+		}
+	}
+	return &dwarf.StructType{StructName: name, Incomplete: true}
+}
@@ -0,0 +1,174 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Large programs can define the same type differently in several compilation units,
+// e.g. glibc's struct pthread in the dynamic loader and in libc, built with different configurations.
+// The definitions are compared by their layout, and a route can be pinned to the units
+// or the source files that match a pattern with the `cu` tag.
+
+// Conflict describes a type that has different definitions in several compilation units.
+type Conflict struct {
+	Type string
+	// Units are the names of the compilation units of the definitions, one per distinct layout,
+	// the one that was used first.
+	Units []string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s is defined differently in %s", c.Type, strings.Join(c.Units, ", "))
+}
+
+// matchSource reports whether the given pattern matches the name of a compilation unit or of a source file.
+// Patterns are matched against the whole name and each of its trailing paths,
+// so "nptl/*" matches "/build/glibc/nptl/pthread_create.c".
+func matchSource(pattern, name string) bool {
+	for name != "" {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		i := strings.IndexByte(name, '/')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+	return false
+}
+
+// source returns the name of the compilation unit of the given entry,
+// and the name of the source file it is declared in, if any.
+func (idx *TypeIndex) source(entry *dwarf.Entry) (string, string, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	unit := idx.unitAt(entry.Offset)
+	if _, ok := idx.unitNames[unit.offset]; !ok {
+		if err := idx.readUnitSources(unit); err != nil {
+			return "", "", fmt.Errorf("failed to read sources of compilation unit at %#x: %w", unit.offset, err)
+		}
+	}
+	var (
+		file  string
+		files = idx.unitFiles[unit.offset]
+	)
+	if i, ok := entry.Val(dwarf.AttrDeclFile).(int64); ok && i >= 0 && i < int64(len(files)) && files[i] != nil {
+		file = files[i].Name
+	}
+	return idx.unitNames[unit.offset], file, nil
+}
+
+// readUnitSources reads the name and the file name table of the given compilation unit.
+// The caller must hold idx.mu.
+func (idx *TypeIndex) readUnitSources(header unitHeader) error {
+	off := header.offset
+	r := idx.reader()
+	r.Seek(header.entry)
+	unit, err := r.Next()
+	if err != nil {
+		return fmt.Errorf("unexpected error while reading DWARF data: %w", err)
+	}
+	if unit == nil || unit.Offset != header.entry {
+		return fmt.Errorf("no compilation unit at %#x", off)
+	}
+	idx.unitNames[off] = idx.nameOf(unit)
+
+	lr, err := idx.dwarfData.LineReader(unit)
+	if err != nil || lr == nil {
+		// Partial units have no line table.
+		return nil
+	}
+	// The file name table is only complete at the end of the line program.
+	var line dwarf.LineEntry
+	for lr.Next(&line) == nil {
+	}
+	idx.unitFiles[off] = lr.Files()
+	return nil
+}
+
+// candidate is a definition of a type, along with the processor of the file it is in.
+type candidate struct {
+	entry *dwarf.Entry
+	p     *processor
+}
+
+// inSources keeps the entries whose compilation unit or source file matches the given pattern.
+func (p *processor) inSources(entries []*dwarf.Entry, pattern string) ([]*dwarf.Entry, error) {
+	if pattern == "" {
+		return entries, nil
+	}
+	kept := []*dwarf.Entry{}
+	for _, entry := range entries {
+		unit, file, err := p.index.source(entry)
+		if err != nil {
+			return nil, err
+		}
+		if matchSource(pattern, unit) || (file != "" && matchSource(pattern, file)) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// layout describes the layout of a struct, two definitions with the same layout are interchangeable.
+func layout(typ dwarf.Type) string {
+	st, ok := underlyingType(typ).(*dwarf.StructType)
+	if !ok {
+		return typeString(typ)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d {", st.Kind, st.ByteSize)
+	for _, f := range st.Field {
+		fmt.Fprintf(&b, "%s@%d:%d/%d %d;", f.Name, f.ByteOffset, f.DataBitOffset+f.BitOffset, f.BitSize, sizeOf(f.Type))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// conflicts compares the layouts of the definitions of the given type, the first one being the one in use.
+// Types with the same name in other namespaces are not compared.
+// It returns nil when they all have the same layout.
+func conflicts(name string, defs []candidate) (*Conflict, error) {
+	if len(defs) < 2 {
+		return nil, nil
+	}
+	qualified, err := defs[0].p.index.qualifiedNameOf(defs[0].entry)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		seen  = map[string]bool{}
+		units []string
+	)
+	for _, def := range defs {
+		if q, err := def.p.index.qualifiedNameOf(def.entry); err != nil || q != qualified {
+			continue
+		}
+		typ, err := def.p.index.typeAt(def.entry.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get type: %w", err)
+		}
+		l := layout(typ)
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		unit, _, err := def.p.index.source(def.entry)
+		if err != nil {
+			return nil, err
+		}
+		if unit == "" {
+			unit = fmt.Sprintf("%#x", def.p.index.unitOf(def.entry.Offset))
+		}
+		units = append(units, unit)
+	}
+	if len(units) < 2 {
+		return nil, nil
+	}
+	return &Conflict{Type: name, Units: units}, nil
+}
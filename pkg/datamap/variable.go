@@ -0,0 +1,202 @@
+package datamap
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+
+	"github.com/parca-dev/runtime-data/pkg/symbols"
+)
+
+// DWARF expression operations used in the locations of global variables.
+const (
+	opAddr              = 0x03
+	opConst4u           = 0x0c
+	opConst8u           = 0x0e
+	opFormTLSAddress    = 0x9b
+	opGNUPushTLSAddress = 0xe0
+)
+
+func isSymbolRoute(rn *RouteNode) bool {
+	if !rn.IsLeaf() || len(rn.Extractors) == 0 {
+		return false
+	}
+	for _, ex := range rn.Extractors {
+		if !ex.Op.isSymbol() {
+			return false
+		}
+	}
+	return true
+}
+
+// symbolResolver reads the values of the tags that refer to global variables by their symbol.
+type symbolResolver struct {
+	// budget bounds the search of the symbol tables.
+	budget *budget
+	ef     *elf.File
+	// variables looks up the definitions of the global variables in the debug information,
+	// the symbol table is used when it is nil or they are not described there.
+	variables func(name string) ([]*dwarf.Entry, error)
+}
+
+// extract sets the values of the extractors of the given route, the symbol is the type of the route.
+// Symbols that cannot be resolved are reported as missing,
+// the extraction stops when the search of the symbol tables exceeds the budget.
+func (r symbolResolver) extract(rn *RouteNode) error {
+	for _, ex := range rn.Extractors {
+		var (
+			val   uint64
+			entry dwarf.Offset
+			err   error
+		)
+		switch ex.Op {
+		case OpAddressOf:
+			val, entry, err = r.address(rn.Type)
+		case OpTLSOffsetOf:
+			val, entry, err = r.tlsOffset(rn.Type)
+		case OpTLSAlignOf, OpTLSSizeOf:
+			if _, entry, err = r.tlsOffset(rn.Type); err != nil {
+				break
+			}
+			var tls *elf.Prog
+			if tls, err = tlsSegment(r.ef); err != nil {
+				break
+			}
+			val = tls.Memsz
+			if ex.Op == OpTLSAlignOf {
+				val = tls.Align
+			}
+		default:
+			return fmt.Errorf("unexpected operation for symbol (%s): %s", rn.Type, ex.Op)
+		}
+		if isStopped(err) {
+			return fmt.Errorf("failed to resolve %s of (%s): %w", ex.Op, rn.Type, err)
+		}
+		if err != nil {
+			ex.fail(err)
+			continue
+		}
+		if err := ex.Set(int64(val)); err != nil {
+			return fmt.Errorf("failed to set %s of (%s): %w", ex.Op, rn.Type, err)
+		}
+		ex.resolvedAt(entry)
+	}
+	return nil
+}
+
+// address looks up the address of the global variable with the given symbol name.
+// It returns the offset of the entry of the variable, 0 when it is read from the symbol table.
+func (r symbolResolver) address(symbol string) (uint64, dwarf.Offset, error) {
+	entries, err := r.lookup(symbol)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if addr, ok := locationAddress(entry, r.ef); ok {
+			return addr, entry.Offset, nil
+		}
+	}
+	sym, err := r.symbol(symbol)
+	if err != nil {
+		return 0, 0, err
+	}
+	return sym.Value, 0, nil
+}
+
+// tlsOffset looks up the offset of the thread-local variable with the given symbol name
+// in the TLS block of the module.
+// It returns the offset of the entry of the variable, 0 when it is read from the symbol table.
+func (r symbolResolver) tlsOffset(symbol string) (uint64, dwarf.Offset, error) {
+	entries, err := r.lookup(symbol)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if off, ok := locationTLSOffset(entry, r.ef); ok {
+			return off, entry.Offset, nil
+		}
+	}
+	sym, err := r.symbol(symbol)
+	if err != nil {
+		return 0, 0, err
+	}
+	// The value of a TLS symbol is its offset in the TLS initialization image,
+	// in executables and shared objects.
+	if elf.ST_TYPE(sym.Info) != elf.STT_TLS {
+		return 0, 0, fmt.Errorf("symbol (%s) is not thread-local, type: %s", symbol, elf.ST_TYPE(sym.Info))
+	}
+	return sym.Value, 0, nil
+}
+
+func (r symbolResolver) lookup(symbol string) ([]*dwarf.Entry, error) {
+	if r.variables == nil {
+		return nil, nil
+	}
+	entries, err := r.variables(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up variable %s: %w", symbol, err)
+	}
+	return entries, nil
+}
+
+func (r symbolResolver) symbol(symbol string) (*elf.Symbol, error) {
+	if r.ef == nil {
+		return nil, errors.New("no symbol table")
+	}
+	sym, err := symbols.FindSymbolContext(r.budget.ctx, r.ef, symbol, symbols.WithBudget(r.budget))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find symbol (%s): %w", symbol, err)
+	}
+	return sym, nil
+}
+
+// locationAddress returns the address of the given variable when its location is a plain address.
+func locationAddress(entry *dwarf.Entry, ef *elf.File) (uint64, bool) {
+	loc, ok := entry.Val(dwarf.AttrLocation).([]byte)
+	if !ok || len(loc) == 0 || loc[0] != opAddr {
+		return 0, false
+	}
+	switch {
+	case ef.Class == elf.ELFCLASS64 && len(loc) == 9:
+		return ef.ByteOrder.Uint64(loc[1:]), true
+	case ef.Class == elf.ELFCLASS32 && len(loc) == 5:
+		return uint64(ef.ByteOrder.Uint32(loc[1:])), true
+	default:
+		return 0, false
+	}
+}
+
+// locationTLSOffset returns the offset of the given thread-local variable in the TLS block of the module,
+// when its location is a constant followed by DW_OP_form_tls_address, or its GNU predecessor.
+func locationTLSOffset(entry *dwarf.Entry, ef *elf.File) (uint64, bool) {
+	loc, ok := entry.Val(dwarf.AttrLocation).([]byte)
+	if !ok || len(loc) == 0 {
+		return 0, false
+	}
+	last := loc[len(loc)-1]
+	if last != opFormTLSAddress && last != opGNUPushTLSAddress {
+		return 0, false
+	}
+	switch {
+	case loc[0] == opConst8u && len(loc) == 10:
+		return ef.ByteOrder.Uint64(loc[1:9]), true
+	case loc[0] == opConst4u && len(loc) == 6:
+		return uint64(ef.ByteOrder.Uint32(loc[1:5])), true
+	default:
+		return 0, false
+	}
+}
+
+// tlsSegment returns the PT_TLS program header of the given ELF file.
+func tlsSegment(ef *elf.File) (*elf.Prog, error) {
+	if ef == nil {
+		return nil, errors.New("no program headers")
+	}
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_TLS {
+			return prog, nil
+		}
+	}
+	return nil, errors.New("no PT_TLS segment")
+}
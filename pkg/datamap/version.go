@@ -0,0 +1,120 @@
+package datamap
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// A single map struct can describe every version of a runtime.
+// The `since` and `until` tags restrict a field to the versions in [since, until),
+// pre-releases being compared as the release they precede, e.g.:
+//
+//	offsetof(PyThreadState.cframe) since(3.11) until(3.13)
+//
+// The `default` tag is the value of the field for the other versions,
+// and when none of its routes resolve, in which case they are allowed to fail, e.g.:
+//
+//	offsetof(PyThreadState.frame|PyThreadState.current_frame) default(-1)
+
+const (
+	tagSince   = "since"
+	tagUntil   = "until"
+	tagDefault = "default"
+)
+
+// WithVersion sets the version of the runtime the map struct is read for,
+// the fields tagged with `since` or `until` that do not apply to it are set to their default
+// and reported as skipped.
+// It is an option of New.
+func WithVersion(version string) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+// condition is the outcome of the `since`, `until` and `default` tags of a field.
+type condition struct {
+	// applies reports whether the field applies to the version.
+	applies bool
+	// skip is why the field does not apply to the version, if it does not.
+	skip       error
+	hasDefault bool
+	def        int64
+}
+
+// condition reads the `since`, `until` and `default` tags of the given field.
+func (m *mapStruct) condition(name string, field reflect.StructField) (condition, error) {
+	c := condition{applies: true}
+	if s, ok := field.Tag.Lookup(tagDefault); ok {
+		if !isIntType(field.Type) {
+			return c, fmt.Errorf("field %s: default requires a field of type int or uint, type: %s", name, field.Type.Kind())
+		}
+		def, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return c, fmt.Errorf("field %s: invalid default %q: %w", name, s, err)
+		}
+		c.hasDefault = true
+		c.def = def
+	}
+	since, hasSince := field.Tag.Lookup(tagSince)
+	until, hasUntil := field.Tag.Lookup(tagUntil)
+	if !hasSince && !hasUntil {
+		return c, nil
+	}
+	if m.version == nil {
+		return c, fmt.Errorf("field %s depends on the version, set it with WithVersion", name)
+	}
+	if hasSince {
+		v, err := semver.NewVersion(since)
+		if err != nil {
+			return c, fmt.Errorf("field %s: invalid since version %q: %w", name, since, err)
+		}
+		if m.version.LessThan(v) {
+			c.applies = false
+			c.skip = fmt.Errorf("version %s is before %s", m.version, since)
+		}
+	}
+	if hasUntil {
+		v, err := semver.NewVersion(until)
+		if err != nil {
+			return c, fmt.Errorf("field %s: invalid until version %q: %w", name, until, err)
+		}
+		if !m.version.LessThan(v) {
+			c.applies = false
+			c.skip = fmt.Errorf("version %s is not before %s", m.version, until)
+		}
+	}
+	return c, nil
+}
+
+// parseVersion parses the version of the runtime, pre-releases are compared as the release they precede.
+func parseVersion(s string) (*semver.Version, error) {
+	v, err := semver.NewVersion(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version %q: %w", s, err)
+	}
+	release := semver.New(v.Major(), v.Minor(), v.Patch(), "", "")
+	return release, nil
+}
+
+// setInt sets the value of an int or uint field.
+func setInt(v reflect.Value, x int64) error {
+	if !v.CanSet() {
+		return fmt.Errorf("field from struct %s is not settable", v.Type().Name())
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if x < 0 {
+			return fmt.Errorf("negative value %d for an unsigned field", x)
+		}
+		v.SetUint(uint64(x))
+	default:
+		return fmt.Errorf("field from struct %s is not of type int or uint, type: %s", v.Type().Name(), v.Kind())
+	}
+	return nil
+}
@@ -37,8 +37,8 @@ func DataMapForLayout(v string) runtimedata.LayoutMap {
 type openjdk struct {
 	CollectedHeapReserve uint64 `offsetof:"CollectedHeap._reserved"`
 
-	MemRegionStart    uint64 `offsetof:"MemRegion._start"`
-	MemRegionWordSize uint64 `offsetof:"MemRegion._word_size"`
+	MemRegionStart uint64 `offsetof:"MemRegion._start"`
+	MemRegionEnd   uint64 `expr:"offsetof(MemRegion._start) + offsetof(MemRegion._word_size)"`
 	// HeapWordSize   uint64 `sizeof:"HeapWord"`
 
 	VMStructEntryTypeName  uint64 `offsetof:"VMStructEntry.typeName"`
@@ -93,10 +93,10 @@ type openjdk struct {
 	NMethodEntryPoint         uint64 `offsetof:"nmethod._entry_point"`
 	NMethodDependenciesOffset uint64 `offsetof:"nmethod._dependencies_offset"`
 	NMethodMetadataOffset     uint64 `offsetof:"nmethod._metadata_offset"`
-	NMethodScopesDataBegin    uint64 `offsetof:"CompiledMethod._scopes_data_begin"`
+	NMethodScopesDataBegin    uint64 `offsetof:"nmethod._scopes_data_begin"`
 	NMethodScopesPCsOffset    uint64 `offsetof:"nmethod._scopes_pcs_offset"`
 	NMethodHandlerTableOffset uint64 `offsetof:"nmethod._handler_table_offset"`
-	NMethodDeoptHandlerBegin  uint64 `offsetof:"CompiledMethod._deopt_handler_begin"`
+	NMethodDeoptHandlerBegin  uint64 `offsetof:"nmethod._deopt_handler_begin"`
 	NMethodOrigPCOffset       uint64 `offsetof:"nmethod._orig_pc_offset"`
 	// NMethodCompileID          uint64 `offsetof:"nmethod._compile_id"`
 	NMethodSize uint64 `sizeof:"nmethod"`
@@ -116,17 +116,21 @@ type openjdk struct {
 	CodeCacheStart uint64 `offsetof:"CodeCache._low_bound" static:"true"`
 	CodeCacheEnd   uint64 `offsetof:"CodeCache._high_bound" static:"true"`
 
-	CompiledMethodDeoptHandlerBegin uint64 `offsetof:"CompiledMethod._deopt_handler_begin"`
+	CompiledMethodDeoptHandlerBegin uint64 `offsetof:"nmethod._deopt_handler_begin"`
 
 	HeapBlockSize uint64 `sizeof:"HeapBlock"`
 	SegmentShift  uint64 `offsetof:"ZLiveMap._segment_shift"`
+
+	// Not part of the layout, the addresses go to the symbols file of the build.
+	CodeCacheHeaps uint64 `addressof:"_ZN9CodeCache7_heapsE"`
+	VMStructs      uint64 `addressof:"gHotSpotVMStructs"`
 }
 
 func (oj openjdk) Layout() runtimedata.RuntimeData {
 	return &java.Layout{
 		CollectedHeapReserve: oj.CollectedHeapReserve,
 		MemRegionStart:       oj.MemRegionStart,
-		MemRegionEnd:         oj.MemRegionStart + oj.MemRegionWordSize,
+		MemRegionEnd:         oj.MemRegionEnd,
 		// HeapWordSize:         oj.HeapWordSize,
 
 		VMStructEntryTypeName:  oj.VMStructEntryTypeName,
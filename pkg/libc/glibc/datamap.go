@@ -9,7 +9,7 @@ type glibc struct {
 	PThreadSpecific1stblock int64 `offsetof:"pthread.specific_1stblock" yaml:"pthread_specific_1stblock"`
 	PThreadSize             int64 `sizeof:"pthread" yaml:"pthread_size"`
 	PThreadKeyData          int64 `offsetof:"pthread_key_data.data" yaml:"pthread_key_data"`
-	PThreadKeyDataSize      int64 `sizeof:"pthread_key_data" yaml:"pthread_key_data_size"`
+	PThreadKeyDataSize      int64 `strideof:"pthread.specific_1stblock" yaml:"pthread_key_data_size"`
 }
 
 func (g *glibc) Layout() runtimedata.RuntimeData {
@@ -8,6 +8,8 @@ import (
 type musl struct {
 	PThreadSize int64 `sizeof:"__pthread"`
 	PThreadTSD  int64 `offsetof:"__pthread.tsd"`
+	// The keys index tsd, an array of pointers.
+	PThreadKeyDataSize int64 `expr:"8"`
 }
 
 func (m *musl) Layout() runtimedata.RuntimeData {
@@ -15,8 +17,7 @@ func (m *musl) Layout() runtimedata.RuntimeData {
 		PThreadSize:             m.PThreadSize,
 		PThreadSpecific1stblock: m.PThreadTSD,
 		PThreadKeyData:          0, // unused.
-		// pthread_key_t: TYPEDEF unsigned pthread_key_t;
-		PThreadKeyDataSize: 8,
+		PThreadKeyDataSize:      m.PThreadKeyDataSize,
 	}
 }
 
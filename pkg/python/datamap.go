@@ -12,454 +12,81 @@ const doesNotExist = -1
 func DataMapForLayout(v string) runtimedata.LayoutMap {
 	// Keys are version constraints defined in semver format,
 	// check github.com/Masterminds/semver for more details.
-	pythonVersions := map[*semver.Constraints]runtimedata.LayoutMap{
-		version.MustParseConstraints("2.7.x"):         &python27{},
-		version.MustParseConstraints("3.3.x - 3.9.x"): &python33_39{},
-		version.MustParseConstraints("3.10.x"):        &python310{},
-		version.MustParseConstraints("3.11.x"):        &python311{},
-		version.MustParseConstraints("3.12.x"):        &python312{},
-		version.MustParseConstraints(">=3.13.x-0"):    &python313{},
+	supported := version.MustParseConstraints("2.7.x || 3.3.x - 3.12.x || >=3.13.x-0")
+	if !supported.Check(semver.MustParse(v)) {
+		return nil
 	}
-
-	lookupVersion := semver.MustParse(v)
-	for c, mapper := range pythonVersions {
-		if c.Check(lookupVersion) {
-			return mapper
-		}
-	}
-	return nil
-}
-
-type python27 struct {
-	PyObjectObType               int64 `offsetof:"PyObject.ob_type"`
-	PyStringData                 int64 `offsetof:"PyStringObject.ob_sval"`
-	PyStringSize                 int64 `offsetof:"PyStringObject.ob_size"`
-	PyTypeObjectTpName           int64 `offsetof:"PyTypeObject.tp_name"`
-	PyThreadStateInterp          int64 `offsetof:"PyThreadState.interp"`
-	PyThreadStateNext            int64 `offsetof:"PyThreadState.next"`
-	PyThreadStateFrame           int64 `offsetof:"PyThreadState.frame"`
-	PyThreadStateThreadID        int64 `offsetof:"PyThreadState.thread_id"`
-	PyInterpreterStateTstateHead int64 `offsetof:"PyInterpreterState.tstate_head"`
-	PyFrameObjectFBack           int64 `offsetof:"PyFrameObject.f_back"`
-	PyFrameObjectFCode           int64 `offsetof:"PyFrameObject.f_code"`
-	PyFrameObjectFLineNo         int64 `offsetof:"PyFrameObject.f_lineno"`
-	PyFrameObjectFLocalsplus     int64 `offsetof:"PyFrameObject.f_localsplus"`
-	PyCodeObjectCoFilename       int64 `offsetof:"PyCodeObject.co_filename"`
-	PyCodeObjectCoName           int64 `offsetof:"PyCodeObject.co_name"`
-	PyCodeObjectCoVarNames       int64 `offsetof:"PyCodeObject.co_varnames"`
-	PyCodeObjectCoFirstlineno    int64 `offsetof:"PyCodeObject.co_firstlineno"`
-	PyTupleObjectObItem          int64 `offsetof:"PyTupleObject.ob_item"`
+	return &python{}
 }
 
-func (p python27) Layout() runtimedata.RuntimeData {
-	return &Layout{
-		PyObject: PyObject{
-			ObType: p.PyObjectObType,
-		},
-		PyString: PyString{
-			Data: p.PyStringData,
-			Size: p.PyStringSize,
-		},
-		PyTypeObject: PyTypeObject{
-			TPName: p.PyTypeObjectTpName,
-		},
-		PyThreadState: PyThreadState{
-			Interp:         p.PyThreadStateInterp,
-			Next:           p.PyThreadStateNext,
-			Frame:          p.PyThreadStateFrame,
-			ThreadID:       p.PyThreadStateThreadID,
-			NativeThreadID: doesNotExist,
-			CFrame:         doesNotExist,
-		},
-		PyCFrame: PyCFrame{
-			CurrentFrame: 0,
-		},
-		PyInterpreterState: PyInterpreterState{
-			TStateHead: p.PyInterpreterStateTstateHead,
-		},
-		PyRuntimeState: PyRuntimeState{
-			InterpMain: doesNotExist,
-		},
-		PyFrameObject: PyFrameObject{
-			FBack:       p.PyFrameObjectFBack,
-			FCode:       p.PyFrameObjectFCode,
-			FLineno:     p.PyFrameObjectFLineNo,
-			FLocalsplus: p.PyFrameObjectFLocalsplus,
-		},
-		PyCodeObject: PyCodeObject{
-			CoFilename:    p.PyCodeObjectCoFilename,
-			CoName:        p.PyCodeObjectCoName,
-			CoVarnames:    p.PyCodeObjectCoVarNames,
-			CoFirstlineno: p.PyCodeObjectCoFirstlineno,
-		},
-		PyTupleObject: PyTupleObject{
-			ObItem: p.PyTupleObjectObItem,
-		},
-		PyInterpreterFrame: PyInterpreterFrame{
-			Owner: doesNotExist,
-		},
+// python describes the layout of every supported version,
+// the routes and the defaults of the fields are selected by the version given to datamap.New.
+type python struct {
+	PyObject struct {
+		ObType int64 `offsetof:"PyObject.ob_type"`
 	}
-}
-
-type python33_39 struct {
-	PyObjectObType               int64 `offsetof:"PyObject.ob_type"`
-	PyStringData                 int64 `sizeof:"PyASCIIObject"`
-	PyStringSize                 int64 `offsetof:"PyVarObject.ob_size"`
-	PyTypeObjectTpName           int64 `offsetof:"PyTypeObject.tp_name"`
-	PyThreadStateInterp          int64 `offsetof:"PyThreadState.interp"`
-	PyThreadStateNext            int64 `offsetof:"PyThreadState.next"`
-	PyThreadStateFrame           int64 `offsetof:"PyThreadState.frame"`
-	PyThreadStateThreadID        int64 `offsetof:"PyThreadState.thread_id"`
-	PyInterpreterStateTstateHead int64 `offsetof:"PyInterpreterState.tstate_head"`
-	PyFrameObjectFBack           int64 `offsetof:"PyFrameObject.f_back"`
-	PyFrameObjectFCode           int64 `offsetof:"PyFrameObject.f_code"`
-	PyFrameObjectFLineNo         int64 `offsetof:"PyFrameObject.f_lineno"`
-	PyFrameObjectFLocalsplus     int64 `offsetof:"PyFrameObject.f_localsplus"`
-	PyCodeObjectCoFilename       int64 `offsetof:"PyCodeObject.co_filename"`
-	PyCodeObjectCoName           int64 `offsetof:"PyCodeObject.co_name"`
-	PyCodeObjectCoVarNames       int64 `offsetof:"PyCodeObject.co_varnames"`
-	PyCodeObjectCoFirstlineno    int64 `offsetof:"PyCodeObject.co_firstlineno"`
-	PyTupleObjectObItem          int64 `offsetof:"PyTupleObject.ob_item"`
-}
-
-func (p python33_39) Layout() runtimedata.RuntimeData {
-	return &Layout{
-		PyObject: PyObject{
-			ObType: p.PyObjectObType,
-		},
-		PyString: PyString{
-			Data: p.PyStringData,
-			Size: p.PyStringSize,
-		},
-		PyTypeObject: PyTypeObject{
-			TPName: p.PyTypeObjectTpName,
-		},
-		PyThreadState: PyThreadState{
-			Interp:         p.PyThreadStateInterp,
-			Next:           p.PyThreadStateNext,
-			Frame:          p.PyThreadStateFrame,
-			ThreadID:       p.PyThreadStateThreadID,
-			NativeThreadID: doesNotExist,
-			CFrame:         doesNotExist,
-		},
-		PyCFrame: PyCFrame{
-			CurrentFrame: 0,
-		},
-		PyInterpreterState: PyInterpreterState{
-			TStateHead: p.PyInterpreterStateTstateHead,
-		},
-		PyRuntimeState: PyRuntimeState{
-			InterpMain: doesNotExist,
-		},
-		PyFrameObject: PyFrameObject{
-			FBack:       p.PyFrameObjectFBack,
-			FCode:       p.PyFrameObjectFCode,
-			FLineno:     p.PyFrameObjectFLineNo,
-			FLocalsplus: p.PyFrameObjectFLocalsplus,
-		},
-		PyCodeObject: PyCodeObject{
-			CoFilename:    p.PyCodeObjectCoFilename,
-			CoName:        p.PyCodeObjectCoName,
-			CoVarnames:    p.PyCodeObjectCoVarNames,
-			CoFirstlineno: p.PyCodeObjectCoFirstlineno,
-		},
-		PyTupleObject: PyTupleObject{
-			ObItem: p.PyTupleObjectObItem,
-		},
-		PyInterpreterFrame: PyInterpreterFrame{
-			Owner: doesNotExist,
-		},
+	PyString struct {
+		Data int64 `expr:"offsetof(PyStringObject.ob_sval) | sizeof(PyASCIIObject)"`
+		Size int64 `offsetof:"PyStringObject.ob_size|PyVarObject.ob_size" until:"3.10" default:"-1"`
 	}
-}
-
-// TODO(kakkoyun): https://github.com/python/cpython/blob/3.10/Include/cpython/unicodeobject.h#L82-L84
-type python310 struct {
-	PyObjectObType               int64 `offsetof:"PyObject.ob_type"`
-	PyStringData                 int64 `sizeof:"PyASCIIObject"`
-	PyTypeObjectTpName           int64 `offsetof:"PyTypeObject.tp_name"`
-	PyThreadStateInterp          int64 `offsetof:"PyThreadState.interp"`
-	PyThreadStateNext            int64 `offsetof:"PyThreadState.next"`
-	PyThreadStateFrame           int64 `offsetof:"PyThreadState.frame"`
-	PyThreadStateThreadID        int64 `offsetof:"PyThreadState.thread_id"`
-	PyInterpreterStateTstateHead int64 `offsetof:"PyInterpreterState.tstate_head"`
-	PyFrameObjectFBack           int64 `offsetof:"PyFrameObject.f_back"`
-	PyFrameObjectFCode           int64 `offsetof:"PyFrameObject.f_code"`
-	PyFrameObjectFLineNo         int64 `offsetof:"PyFrameObject.f_lineno"`
-	PyFrameObjectFLocalsplus     int64 `offsetof:"PyFrameObject.f_localsplus"`
-	PyCodeObjectCoFilename       int64 `offsetof:"PyCodeObject.co_filename"`
-	PyCodeObjectCoName           int64 `offsetof:"PyCodeObject.co_name"`
-	PyCodeObjectCoVarNames       int64 `offsetof:"PyCodeObject.co_varnames"`
-	PyCodeObjectCoFirstlineno    int64 `offsetof:"PyCodeObject.co_firstlineno"`
-	PyTupleObjectObItem          int64 `offsetof:"PyTupleObject.ob_item"`
-}
-
-func (p python310) Layout() runtimedata.RuntimeData {
-	return &Layout{
-		PyObject: PyObject{
-			ObType: p.PyObjectObType,
-		},
-		PyString: PyString{
-			Data: p.PyStringData,
-			Size: doesNotExist,
-		},
-		PyTypeObject: PyTypeObject{
-			TPName: p.PyTypeObjectTpName,
-		},
-		PyThreadState: PyThreadState{
-			Interp:         p.PyThreadStateInterp,
-			Next:           p.PyThreadStateNext,
-			Frame:          p.PyThreadStateFrame,
-			ThreadID:       p.PyThreadStateThreadID,
-			NativeThreadID: doesNotExist,
-			CFrame:         doesNotExist,
-		},
-		PyCFrame: PyCFrame{
-			CurrentFrame: 0,
-		},
-		PyInterpreterState: PyInterpreterState{
-			TStateHead: p.PyInterpreterStateTstateHead,
-		},
-		PyRuntimeState: PyRuntimeState{
-			InterpMain: doesNotExist,
-		},
-		PyFrameObject: PyFrameObject{
-			FBack:       p.PyFrameObjectFBack,
-			FCode:       p.PyFrameObjectFCode,
-			FLineno:     p.PyFrameObjectFLineNo,
-			FLocalsplus: p.PyFrameObjectFLocalsplus,
-		},
-		PyCodeObject: PyCodeObject{
-			CoFilename:    p.PyCodeObjectCoFilename,
-			CoName:        p.PyCodeObjectCoName,
-			CoVarnames:    p.PyCodeObjectCoVarNames,
-			CoFirstlineno: p.PyCodeObjectCoFirstlineno,
-		},
-		PyTupleObject: PyTupleObject{
-			ObItem: p.PyTupleObjectObItem,
-		},
-		PyInterpreterFrame: PyInterpreterFrame{
-			Owner: doesNotExist,
-		},
+	PyTypeObject struct {
+		TPName int64 `offsetof:"PyTypeObject.tp_name"`
 	}
-}
-
-type python311 struct {
-	PyObjectObType                    int64 `offsetof:"PyObject.ob_type"`
-	PyStringData                      int64 `sizeof:"PyASCIIObject"`
-	PyTypeObjectTpName                int64 `offsetof:"PyTypeObject.tp_name"`
-	PyThreadStateInterp               int64 `offsetof:"PyThreadState.interp"`
-	PyThreadStateNext                 int64 `offsetof:"PyThreadState.next"`
-	PyThreadStateThreadID             int64 `offsetof:"PyThreadState.thread_id"`
-	PyThreadStateNativeThreadID       int64 `offsetof:"PyThreadState.native_thread_id"`
-	PyThreadStateCFrame               int64 `offsetof:"PyThreadState.cframe"`
-	PyCFrameCurrentFrame              int64 `offsetof:"_PyCFrame.current_frame"`
-	PyInterpreterStateTstateHead      int64 `offsetof:"PyInterpreterState.threads"`
-	PyInterpreterStateIsPythreadsHead int64 `offsetof:"pythreads.head"`
-	PyRuntimeStateInterpreters        int64 `offsetof:"pyruntimestate.interpreters"`
-	PyRuntimeStatePyInterpretersMain  int64 `offsetof:"pyinterpreters.main"`
-	PyFrameObjectFBack                int64 `offsetof:"_PyInterpreterFrame.previous"`
-	PyFrameObjectFCode                int64 `offsetof:"_PyInterpreterFrame.f_code"`
-	PyFrameObjectFLocalsplus          int64 `offsetof:"_PyInterpreterFrame.localsplus"`
-	PyInterpreterFrameOwner           int64 `offsetof:"_PyInterpreterFrame.owner"`
-	PyCodeObjectCoFilename            int64 `offsetof:"PyCodeObject.co_filename"`
-	PyCodeObjectCoName                int64 `offsetof:"PyCodeObject.co_name"`
-	PyCodeObjectCoVarNames            int64 `offsetof:"PyCodeObject.co_localsplusnames"`
-	PyCodeObjectCoFirstlineno         int64 `offsetof:"PyCodeObject.co_firstlineno"`
-	PyTupleObjectObItem               int64 `offsetof:"PyTupleObject.ob_item"`
-}
-
-func (p python311) Layout() runtimedata.RuntimeData {
-	return &Layout{
-		PyObject: PyObject{
-			ObType: p.PyObjectObType,
-		},
-		PyString: PyString{
-			Data: p.PyStringData,
-			Size: doesNotExist,
-		},
-		PyTypeObject: PyTypeObject{
-			TPName: p.PyTypeObjectTpName,
-		},
-		PyThreadState: PyThreadState{
-			Interp:         p.PyThreadStateInterp,
-			Next:           p.PyThreadStateNext,
-			Frame:          doesNotExist,
-			ThreadID:       p.PyThreadStateThreadID,
-			NativeThreadID: p.PyThreadStateNativeThreadID,
-			CFrame:         p.PyThreadStateCFrame,
-		},
-		PyCFrame: PyCFrame{
-			CurrentFrame: p.PyCFrameCurrentFrame,
-		},
-		PyInterpreterState: PyInterpreterState{
-			TStateHead: p.PyInterpreterStateTstateHead + p.PyInterpreterStateIsPythreadsHead,
-		},
-		PyRuntimeState: PyRuntimeState{
-			InterpMain: p.PyRuntimeStateInterpreters + p.PyRuntimeStatePyInterpretersMain,
-		},
-		PyFrameObject: PyFrameObject{
-			FBack:       p.PyFrameObjectFBack,
-			FCode:       p.PyFrameObjectFCode,
-			FLineno:     doesNotExist,
-			FLocalsplus: p.PyFrameObjectFLocalsplus,
-		},
-		PyCodeObject: PyCodeObject{
-			CoFilename:    p.PyCodeObjectCoFilename,
-			CoName:        p.PyCodeObjectCoName,
-			CoVarnames:    p.PyCodeObjectCoVarNames,
-			CoFirstlineno: p.PyCodeObjectCoFirstlineno,
-		},
-		PyTupleObject: PyTupleObject{
-			ObItem: p.PyTupleObjectObItem,
-		},
-		PyInterpreterFrame: PyInterpreterFrame{
-			Owner: p.PyInterpreterFrameOwner,
-		},
+	PyThreadState struct {
+		Next   int64 `offsetof:"PyThreadState.next"`
+		Interp int64 `offsetof:"PyThreadState.interp"`
+		// Neither exists in 3.11 and 3.12, the frames are reached through cframe.
+		Frame          int64 `offsetof:"PyThreadState.frame|PyThreadState.current_frame" default:"-1"`
+		ThreadID       int64 `offsetof:"PyThreadState.thread_id"`
+		NativeThreadID int64 `offsetof:"PyThreadState.native_thread_id" since:"3.11" default:"-1"`
+		CFrame         int64 `offsetof:"PyThreadState.cframe" since:"3.11" until:"3.13" default:"-1"`
 	}
-}
-
-type python312 struct {
-	PyObjectObType                    int64 `offsetof:"PyObject.ob_type"`
-	PyStringData                      int64 `sizeof:"PyASCIIObject"`
-	PyTypeObjectTpName                int64 `offsetof:"PyTypeObject.tp_name"`
-	PyThreadStateInterp               int64 `offsetof:"PyThreadState.interp"`
-	PyThreadStateNext                 int64 `offsetof:"PyThreadState.next"`
-	PyThreadStateThreadID             int64 `offsetof:"PyThreadState.thread_id"`
-	PyThreadStateNativeThreadID       int64 `offsetof:"PyThreadState.native_thread_id"`
-	PyThreadStateCFrame               int64 `offsetof:"PyThreadState.cframe"`
-	PyInterpreterStateTstateHead      int64 `offsetof:"PyInterpreterState.threads"`
-	PyInterpreterStateIsPythreadsHead int64 `offsetof:"pythreads.head"`
-	PyRuntimeStateInterpreters        int64 `offsetof:"pyruntimestate.interpreters"`
-	PyRuntimeStatePyInterpretersMain  int64 `offsetof:"pyinterpreters.main"`
-	PyFrameObjectFBack                int64 `offsetof:"_PyInterpreterFrame.previous"`
-	PyFrameObjectFCode                int64 `offsetof:"_PyInterpreterFrame.f_code"`
-	PyFrameObjectFLocalsplus          int64 `offsetof:"_PyInterpreterFrame.localsplus"`
-	PyInterpreterFrameOwner           int64 `offsetof:"_PyInterpreterFrame.owner"`
-	PyCodeObjectCoFilename            int64 `offsetof:"PyCodeObject.co_filename"`
-	PyCodeObjectCoName                int64 `offsetof:"PyCodeObject.co_name"`
-	PyCodeObjectCoFirstlineno         int64 `offsetof:"PyCodeObject.co_firstlineno"`
-	PyTupleObjectObItem               int64 `offsetof:"PyTupleObject.ob_item"`
-}
-
-func (p python312) Layout() runtimedata.RuntimeData {
-	return &Layout{
-		PyObject: PyObject{
-			ObType: p.PyObjectObType,
-		},
-		PyString: PyString{
-			Data: p.PyStringData,
-			Size: doesNotExist,
-		},
-		PyTypeObject: PyTypeObject{
-			TPName: p.PyTypeObjectTpName,
-		},
-		PyThreadState: PyThreadState{
-			Interp:         p.PyThreadStateInterp,
-			Next:           p.PyThreadStateNext,
-			Frame:          doesNotExist,
-			ThreadID:       p.PyThreadStateThreadID,
-			NativeThreadID: p.PyThreadStateNativeThreadID,
-			CFrame:         p.PyThreadStateCFrame,
-		},
-		PyCFrame: PyCFrame{
-			CurrentFrame: 0,
-		},
-		PyInterpreterState: PyInterpreterState{
-			TStateHead: p.PyInterpreterStateTstateHead + p.PyInterpreterStateIsPythreadsHead,
-		},
-		PyRuntimeState: PyRuntimeState{
-			InterpMain: p.PyRuntimeStateInterpreters + p.PyRuntimeStatePyInterpretersMain,
-		},
-		PyFrameObject: PyFrameObject{
-			FBack:       p.PyFrameObjectFBack,
-			FCode:       p.PyFrameObjectFCode,
-			FLineno:     doesNotExist,
-			FLocalsplus: p.PyFrameObjectFLocalsplus,
-		},
-		PyCodeObject: PyCodeObject{
-			CoFilename:    p.PyCodeObjectCoFilename,
-			CoName:        p.PyCodeObjectCoName,
-			CoVarnames:    0,
-			CoFirstlineno: p.PyCodeObjectCoFirstlineno,
-		},
-		PyTupleObject: PyTupleObject{
-			ObItem: p.PyTupleObjectObItem,
-		},
-		PyInterpreterFrame: PyInterpreterFrame{
-			Owner: p.PyInterpreterFrameOwner,
-		},
+	PyCFrame struct {
+		CurrentFrame int64 `expr:"offsetof(_PyCFrame.current_frame) | 0" until:"3.13" default:"-1"`
+	}
+	PyInterpreterState struct {
+		TStateHead int64 `offsetof:"PyInterpreterState.tstate_head|PyInterpreterState.threads.head"`
+	}
+	PyRuntimeState struct {
+		InterpMain int64 `offsetof:"pyruntimestate.interpreters.main" since:"3.11" default:"-1"`
+	}
+	PyFrameObject struct {
+		FBack       int64 `offsetof:"_PyInterpreterFrame.previous|PyFrameObject.f_back"`
+		FCode       int64 `offsetof:"_PyInterpreterFrame.f_executable|_PyInterpreterFrame.f_code|PyFrameObject.f_code"`
+		FLineno     int64 `offsetof:"PyFrameObject.f_lineno" until:"3.11" default:"-1"`
+		FLocalsplus int64 `offsetof:"_PyInterpreterFrame.localsplus|PyFrameObject.f_localsplus"`
+	}
+	PyCodeObject struct {
+		CoFilename    int64 `offsetof:"PyCodeObject.co_filename"`
+		CoName        int64 `offsetof:"PyCodeObject.co_name"`
+		CoVarnames    int64 `offsetof:"PyCodeObject.co_varnames|PyCodeObject.co_localsplusnames" until:"3.12" default:"0"`
+		CoFirstlineno int64 `offsetof:"PyCodeObject.co_firstlineno"`
+	}
+	PyTupleObject struct {
+		ObItem int64 `offsetof:"PyTupleObject.ob_item"`
+	}
+	PyInterpreterFrame struct {
+		Owner int64 `offsetof:"_PyInterpreterFrame.owner" since:"3.11" default:"-1"`
 	}
-}
 
-type python313 struct {
-	PyObjectObType                    int64 `offsetof:"PyObject.ob_type"`
-	PyStringData                      int64 `sizeof:"PyASCIIObject"`
-	PyTypeObjectTpName                int64 `offsetof:"PyTypeObject.tp_name"`
-	PyThreadStateInterp               int64 `offsetof:"PyThreadState.interp"`
-	PyThreadStateNext                 int64 `offsetof:"PyThreadState.next"`
-	PyThreadStateThreadID             int64 `offsetof:"PyThreadState.thread_id"`
-	PyThreadStateNativeThreadID       int64 `offsetof:"PyThreadState.native_thread_id"`
-	PyThreadStateCurrentFrame         int64 `offsetof:"PyThreadState.current_frame"`
-	PyInterpreterStateTstateHead      int64 `offsetof:"PyInterpreterState.threads"`
-	PyInterpreterStateIsPythreadsHead int64 `offsetof:"pythreads.head"`
-	PyRuntimeStateInterpreters        int64 `offsetof:"pyruntimestate.interpreters"`
-	PyRuntimeStatePyInterpretersMain  int64 `offsetof:"pyinterpreters.main"`
-	PyFrameObjectFBack                int64 `offsetof:"_PyInterpreterFrame.previous"`
-	PyFrameObjectFExecutable          int64 `offsetof:"_PyInterpreterFrame.f_executable"`
-	PyFrameObjectFLocalsplus          int64 `offsetof:"_PyInterpreterFrame.localsplus"`
-	PyInterpreterFrameOwner           int64 `offsetof:"_PyInterpreterFrame.owner"`
-	PyCodeObjectCoFilename            int64 `offsetof:"PyCodeObject.co_filename"`
-	PyCodeObjectCoName                int64 `offsetof:"PyCodeObject.co_name"`
-	PyCodeObjectCoFirstlineno         int64 `offsetof:"PyCodeObject.co_firstlineno"`
-	PyTupleObjectObItem               int64 `offsetof:"PyTupleObject.ob_item"`
+	// The address differs per build, structlayout writes it to the symbols file of the build
+	// instead of the layout. _PyRuntime is exported since 3.7, -1 tells it is missing
+	// apart from an address.
+	PyRuntime int64 `addressof:"_PyRuntime" since:"3.7" default:"-1"`
 }
 
-func (p python313) Layout() runtimedata.RuntimeData {
+func (p python) Layout() runtimedata.RuntimeData {
 	return &Layout{
-		PyObject: PyObject{
-			ObType: p.PyObjectObType,
-		},
-		PyString: PyString{
-			Data: p.PyStringData,
-			Size: doesNotExist,
-		},
-		PyTypeObject: PyTypeObject{
-			TPName: p.PyTypeObjectTpName,
-		},
-		PyThreadState: PyThreadState{
-			Interp:         p.PyThreadStateInterp,
-			Next:           p.PyThreadStateNext,
-			Frame:          p.PyThreadStateCurrentFrame,
-			ThreadID:       p.PyThreadStateThreadID,
-			NativeThreadID: p.PyThreadStateNativeThreadID,
-			CFrame:         doesNotExist,
-		},
-		PyCFrame: PyCFrame{
-			CurrentFrame: doesNotExist,
-		},
-		PyInterpreterState: PyInterpreterState{
-			TStateHead: p.PyInterpreterStateTstateHead + p.PyInterpreterStateIsPythreadsHead,
-		},
-		PyRuntimeState: PyRuntimeState{
-			InterpMain: p.PyRuntimeStateInterpreters + p.PyRuntimeStatePyInterpretersMain,
-		},
-		PyFrameObject: PyFrameObject{
-			FBack:       p.PyFrameObjectFBack,
-			FCode:       p.PyFrameObjectFExecutable,
-			FLineno:     doesNotExist,
-			FLocalsplus: p.PyFrameObjectFLocalsplus,
-		},
-		PyCodeObject: PyCodeObject{
-			CoFilename:    p.PyCodeObjectCoFilename,
-			CoName:        p.PyCodeObjectCoName,
-			CoVarnames:    0,
-			CoFirstlineno: p.PyCodeObjectCoFirstlineno,
-		},
-		PyTupleObject: PyTupleObject{
-			ObItem: p.PyTupleObjectObItem,
-		},
-		PyInterpreterFrame: PyInterpreterFrame{
-			Owner: p.PyInterpreterFrameOwner,
-		},
+		PyObject:           PyObject(p.PyObject),
+		PyString:           PyString(p.PyString),
+		PyTypeObject:       PyTypeObject(p.PyTypeObject),
+		PyThreadState:      PyThreadState(p.PyThreadState),
+		PyCFrame:           PyCFrame(p.PyCFrame),
+		PyInterpreterState: PyInterpreterState(p.PyInterpreterState),
+		PyRuntimeState:     PyRuntimeState(p.PyRuntimeState),
+		PyFrameObject:      PyFrameObject(p.PyFrameObject),
+		PyCodeObject:       PyCodeObject(p.PyCodeObject),
+		PyTupleObject:      PyTupleObject(p.PyTupleObject),
+		PyInterpreterFrame: PyInterpreterFrame(p.PyInterpreterFrame),
 	}
 }
@@ -60,6 +60,8 @@ type InitialState struct {
 	ThreadStateCurrent int64    `yaml:"tstate_current"`
 	AutoTSSKey         int64    `yaml:"auto_tss_key"`
 	PyTSS              PyTSSKey `yaml:"tss"`
+	// ThreadStateTLS locates _Py_tss_tstate, which holds the current thread state since Python 3.12.
+	ThreadStateTLS TLSVariable `yaml:"tstate_tls"`
 }
 
 type PyTSSKey struct {
@@ -67,11 +69,43 @@ type PyTSSKey struct {
 	Size int64 `yaml:"size"`
 }
 
+// TLSVariable locates a thread-local variable in the TLS block (PT_TLS) of the module that defines it.
+type TLSVariable struct {
+	Offset     int64 `yaml:"offset"`
+	BlockAlign int64 `yaml:"block_align"`
+	BlockSize  int64 `yaml:"block_size"`
+}
+
+// Data encodes the state as the agent reads it, the fields before ThreadStateTLS in order as 64-bit integers.
+// ThreadStateTLS is encoded on its own by TLSVariable.Data, for a separate map.
 func (i InitialState) Data() ([]byte, error) {
+	state := struct {
+		InterpreterHead    int64
+		ThreadStateCurrent int64
+		AutoTSSKey         int64
+		PyTSS              PyTSSKey
+	}{
+		InterpreterHead:    i.InterpreterHead,
+		ThreadStateCurrent: i.ThreadStateCurrent,
+		AutoTSSKey:         i.AutoTSSKey,
+		PyTSS:              i.PyTSS,
+	}
+	buf := new(bytes.Buffer)
+	buf.Grow(int(unsafe.Sizeof(state)))
+
+	if err := binary.Write(buf, byteorder.GetHostByteOrder(), &state); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Data encodes the variable as the agent reads it, the fields in order as 64-bit integers.
+func (v TLSVariable) Data() ([]byte, error) {
 	buf := new(bytes.Buffer)
-	buf.Grow(int(unsafe.Sizeof(&i)))
+	buf.Grow(int(unsafe.Sizeof(v)))
 
-	if err := binary.Write(buf, byteorder.GetHostByteOrder(), &i); err != nil {
+	if err := binary.Write(buf, byteorder.GetHostByteOrder(), &v); err != nil {
 		return nil, err
 	}
 
@@ -83,6 +117,9 @@ type initialState312 struct {
 	AutoTSSKey      int64 `offsetof:"_PyRuntimeState.autoTSSkey"`
 	PyTSSKey        int64 `offsetof:"_Py_tss_t._key"`
 	PyTSSSize       int64 `sizeof:"_Py_tss_t"`
+	TStateOffset    int64 `tlsoffsetof:"_Py_tss_tstate" default:"-1"`
+	TLSBlockAlign   int64 `tlsalignof:"_Py_tss_tstate" default:"-1"`
+	TLSBlockSize    int64 `tlssizeof:"_Py_tss_tstate" default:"-1"`
 }
 
 func (i initialState312) InitialState() runtimedata.RuntimeData {
@@ -95,6 +132,11 @@ func (i initialState312) InitialState() runtimedata.RuntimeData {
 			Key:  i.PyTSSKey,
 			Size: i.PyTSSSize,
 		},
+		ThreadStateTLS: TLSVariable{
+			Offset:     i.TStateOffset,
+			BlockAlign: i.TLSBlockAlign,
+			BlockSize:  i.TLSBlockSize,
+		},
 	}
 }
 
@@ -118,5 +160,10 @@ func (i initialState38) InitialState() runtimedata.RuntimeData {
 			Key:  i.PyTSSKey,
 			Size: i.PyTSSSize,
 		},
+		ThreadStateTLS: TLSVariable{
+			Offset:     doesNotExist,
+			BlockAlign: doesNotExist,
+			BlockSize:  doesNotExist,
+		},
 	}
 }
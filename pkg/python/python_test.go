@@ -19,6 +19,8 @@ import (
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/parca-dev/runtime-data/pkg/datamap"
 )
 
 func TestGetLayouts(t *testing.T) {
@@ -267,6 +269,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -279,6 +282,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -291,6 +295,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -303,6 +308,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -315,6 +321,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -327,10 +334,12 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
 			version: "3.12.0",
+			arch:    "amd64",
 			want: &InitialState{
 				InterpreterHead:    40,
 				ThreadStateCurrent: -1,
@@ -339,6 +348,21 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: 8, BlockAlign: 8, BlockSize: 16},
+			},
+		},
+		{
+			version: "3.13.0",
+			arch:    "amd64",
+			want: &InitialState{
+				InterpreterHead:    632,
+				ThreadStateCurrent: -1,
+				AutoTSSKey:         2160,
+				PyTSS: PyTSSKey{
+					Key:  4,
+					Size: 8,
+				},
+				ThreadStateTLS: TLSVariable{Offset: 24, BlockAlign: 8, BlockSize: 32},
 			},
 		},
 		// arm64
@@ -371,6 +395,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -384,6 +409,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -397,6 +423,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -410,6 +437,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -423,6 +451,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -436,6 +465,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 		{
@@ -449,6 +479,7 @@ func TestGetInitialState(t *testing.T) {
 					Key:  4,
 					Size: 8,
 				},
+				ThreadStateTLS: TLSVariable{Offset: -1, BlockAlign: -1, BlockSize: -1},
 			},
 		},
 	}
@@ -479,3 +510,43 @@ func TestGetInitialState(t *testing.T) {
 		})
 	}
 }
+
+func TestInitialStateData(t *testing.T) {
+	is := InitialState{
+		InterpreterHead:    40,
+		ThreadStateCurrent: -1,
+		AutoTSSKey:         1544,
+		PyTSS:              PyTSSKey{Key: 4, Size: 8},
+		ThreadStateTLS:     TLSVariable{Offset: 8, BlockAlign: 8, BlockSize: 16},
+	}
+	// The encoding the agents read does not change with ThreadStateTLS, which is encoded on its own.
+	data, err := is.Data()
+	if err != nil {
+		t.Fatalf("Data() error = %v", err)
+	}
+	if len(data) != 40 {
+		t.Errorf("len(Data()) = %d, want 40", len(data))
+	}
+	data, err = is.ThreadStateTLS.Data()
+	if err != nil {
+		t.Fatalf("TLSVariable.Data() error = %v", err)
+	}
+	if len(data) != 24 {
+		t.Errorf("len(TLSVariable.Data()) = %d, want 24", len(data))
+	}
+}
+
+func TestDataMapForLayout(t *testing.T) {
+	if lm := DataMapForLayout("3.2.0"); lm != nil {
+		t.Errorf("DataMapForLayout(3.2.0) = %v, want nil", lm)
+	}
+	for _, v := range []string{"2.7.15", "3.6.6", "3.10.0", "3.11.0", "3.12.0", "3.13.0-rc1"} {
+		lm := DataMapForLayout(v)
+		if lm == nil {
+			t.Fatalf("DataMapForLayout(%s) = nil", v)
+		}
+		if _, err := datamap.New(lm, datamap.WithVersion(v)); err != nil {
+			t.Errorf("datamap.New() for %s error = %v", v, err)
+		}
+	}
+}
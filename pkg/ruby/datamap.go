@@ -24,15 +24,19 @@ func DataMapForLayout(v string) runtimedata.LayoutMap {
 }
 
 type ruby26_27 struct {
-	VMOffset                   int64 `offsetof:"rb_execution_context_struct.vm_stack"`
-	VMSizeOffset               int64 `offsetof:"rb_execution_context_struct.vm_stack_size"`
-	ControlFrameSizeof         int64 `sizeof:"rb_control_frame_struct"`
-	CFPOffset                  int64 `offsetof:"rb_execution_context_struct.cfp"`
-	LabelOffset                int64 `offsetof:"rb_iseq_location_struct.label"`
-	LineInfoTableOffset        int64 `offsetof:"rb_iseq_constant_body.insns_info"`
-	LineInfoIseqInfoSizeOffset int64 `offsetof:"iseq_insn_info.size"`
-	MainThreadOffset           int64 `offsetof:"rb_vm_struct.main_thread"`
-	EcOffset                   int64 `offsetof:"rb_thread_struct.ec"`
+	VMOffset            int64 `offsetof:"rb_execution_context_struct.vm_stack"`
+	VMSizeOffset        int64 `offsetof:"rb_execution_context_struct.vm_stack_size"`
+	ControlFrameSizeof  int64 `sizeof:"rb_control_frame_struct"`
+	CFPOffset           int64 `offsetof:"rb_execution_context_struct.cfp"`
+	LabelOffset         int64 `offsetof:"rb_iseq_location_struct.label"`
+	PathFlavour         int64 `expr:"1"`
+	LineInfoSizeOffset  int64 `expr:"offsetof(rb_iseq_constant_body.insns_info) + offsetof(iseq_insn_info.size)"`
+	LineInfoTableOffset int64 `offsetof:"rb_iseq_constant_body.insns_info"`
+	MainThreadOffset    int64 `offsetof:"rb_vm_struct.main_thread"`
+	EcOffset            int64 `offsetof:"rb_thread_struct.ec"`
+
+	// Written to the symbols file of the build, not to the layout.
+	CurrentVMPtr int64 `addressof:"ruby_current_vm_ptr"`
 }
 
 func (r ruby26_27) Layout() runtimedata.RuntimeData {
@@ -42,24 +46,28 @@ func (r ruby26_27) Layout() runtimedata.RuntimeData {
 		ControlFrameSizeof:  r.ControlFrameSizeof,
 		CfpOffset:           r.CFPOffset,
 		LabelOffset:         r.LabelOffset,
-		PathFlavour:         1,
+		PathFlavour:         r.PathFlavour,
 		LineInfoTableOffset: r.LineInfoTableOffset,
-		LineInfoSizeOffset:  r.LineInfoTableOffset + r.LineInfoIseqInfoSizeOffset,
+		LineInfoSizeOffset:  r.LineInfoSizeOffset,
 		MainThreadOffset:    r.MainThreadOffset,
 		EcOffset:            r.EcOffset,
 	}
 }
 
 type ruby30 struct {
-	VMOffset                   int64 `offsetof:"rb_execution_context_struct.vm_stack"`
-	VMSizeOffset               int64 `offsetof:"rb_execution_context_struct.vm_stack_size"`
-	ControlFrameSizeof         int64 `sizeof:"rb_control_frame_struct"`
-	CFPOffset                  int64 `offsetof:"rb_execution_context_struct.cfp"`
-	LabelOffset                int64 `offsetof:"rb_iseq_location_struct.label"`
-	LineInfoTableOffset        int64 `offsetof:"rb_iseq_constant_body.insns_info"`
-	LineInfoIseqInfoSizeOffset int64 `offsetof:"iseq_insn_info.size"`
-	MainThreadOffset           int64 `offsetof:"rb_vm_struct.ractor.main_thread"`
-	EcOffset                   int64 `offsetof:"rb_ractor_struct.threads.running_ec"`
+	VMOffset            int64 `offsetof:"rb_execution_context_struct.vm_stack"`
+	VMSizeOffset        int64 `offsetof:"rb_execution_context_struct.vm_stack_size"`
+	ControlFrameSizeof  int64 `sizeof:"rb_control_frame_struct"`
+	CFPOffset           int64 `offsetof:"rb_execution_context_struct.cfp"`
+	LabelOffset         int64 `offsetof:"rb_iseq_location_struct.label"`
+	PathFlavour         int64 `expr:"1"`
+	LineInfoSizeOffset  int64 `expr:"offsetof(rb_iseq_constant_body.insns_info) + offsetof(iseq_insn_info.size)"`
+	LineInfoTableOffset int64 `offsetof:"rb_iseq_constant_body.insns_info"`
+	// ruby_current_vm_ptr->ractor.main_ractor->threads.running_ec
+	MainRactorRunningEC [2]int64 `offsetof:"rb_vm_struct.ractor.main_ractor*.threads.running_ec"`
+
+	// Written to the symbols file of the build, not to the layout.
+	CurrentVMPtr int64 `addressof:"ruby_current_vm_ptr"`
 }
 
 func (r ruby30) Layout() runtimedata.RuntimeData {
@@ -69,12 +77,10 @@ func (r ruby30) Layout() runtimedata.RuntimeData {
 		ControlFrameSizeof:  r.ControlFrameSizeof,
 		CfpOffset:           r.CFPOffset,
 		LabelOffset:         r.LabelOffset,
-		PathFlavour:         1,
+		PathFlavour:         r.PathFlavour,
 		LineInfoTableOffset: r.LineInfoTableOffset,
-		LineInfoSizeOffset:  r.LineInfoTableOffset + r.LineInfoIseqInfoSizeOffset,
-		// TODO(kakkoyun): This is a temporary fix, we need to find a better way to get the main thread.
-		// - https://github.com/javierhonduco/rbperf/issues/78
-		MainThreadOffset: r.MainThreadOffset - 8, // ruby_current_vm_ptr->ractor->main_thread
-		EcOffset:         r.EcOffset,             // ruby_current_vm_ptr->ractor->main_thread->ractor(->threads)->running_ec
+		LineInfoSizeOffset:  r.LineInfoSizeOffset,
+		MainThreadOffset:    r.MainRactorRunningEC[0], // ruby_current_vm_ptr->ractor.main_ractor
+		EcOffset:            r.MainRactorRunningEC[1], // main_ractor->threads.running_ec
 	}
 }
@@ -34,6 +34,18 @@ type DataWithVersion struct {
 	Data    map[string]any `yaml:"data"`
 }
 
+// DataWithBuildID is the data that is only valid for the binary it was generated from,
+// it changes with every build of the same version, so it is kept out of DataWithVersion.
+type DataWithBuildID struct {
+	Version Version `yaml:"version"`
+	BuildID string  `yaml:"build_id"`
+	// Symbols maps the names of global variables to their addresses.
+	Symbols map[string]uint64 `yaml:"symbols,omitempty"`
+	// Locations maps the parameters and the local variables of functions, e.g. "eval_frame.frame",
+	// to where they are per range of program counters.
+	Locations map[string]any `yaml:"locations,omitempty"`
+}
+
 func WithVersion(version string, data map[string]any) (DataWithVersion, error) {
 	sm, err := semver.NewVersion(version)
 	if err != nil {
@@ -0,0 +1,48 @@
+// Copyright 2023-2024 The Parca Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package symbols
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func FuzzFindSymbol(f *testing.F) {
+	// The test programs of datamap have symbol tables.
+	paths, err := filepath.Glob(filepath.Join("..", "datamap", "testdata", "x86_64", "*"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data, "counter")
+	}
+	f.Fuzz(func(t *testing.T, data []byte, symbol string) {
+		ef, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Only panics matter.
+		_, _ = FindSymbol(ef, symbol)
+	})
+}
@@ -16,6 +16,7 @@ package symbols
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"debug/elf"
 	"encoding/binary"
 	"errors"
@@ -42,12 +43,20 @@ func scanNullTerminated(data []byte, atEOF bool) (int, []byte, error) {
 	return 0, nil, nil
 }
 
-func firstIndexOfMatchingSymbol(r io.Reader, matches [][]byte) (int, error) {
+// ctxCheckInterval is the number of strings or symbols read between two checks of the context.
+const ctxCheckInterval = 1024
+
+func firstIndexOfMatchingSymbol(ctx context.Context, r io.Reader, matches [][]byte) (int, error) {
 	scanner := bufio.NewScanner(r)
 	scanner.Split(scanNullTerminated)
 
 	bytesRead := 0
-	for scanner.Scan() {
+	for n := 1; scanner.Scan(); n++ {
+		if n%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return -1, err
+			}
+		}
 		for _, match := range matches {
 			b := scanner.Bytes()
 			if len(b) == len(match) && bytes.Equal(b, match) {
@@ -62,9 +71,48 @@ func firstIndexOfMatchingSymbol(r io.Reader, matches [][]byte) (int, error) {
 	return -1, nil
 }
 
+// Budget bounds the reads of the symbol tables of untrusted binaries.
+type Budget interface {
+	// Read accounts for the given number of bytes of a section about to be read.
+	Read(n uint64) error
+	// Visit accounts for a symbol about to be read.
+	Visit() error
+}
+
+// Option configures a search of the symbol tables.
+type Option func(*options)
+
+type options struct {
+	budget Budget
+}
+
+// WithBudget accounts for the bytes and the symbols read by the search in the given budget,
+// the search stops with its error once it is exceeded.
+func WithBudget(b Budget) Option {
+	return func(o *options) {
+		o.budget = b
+	}
+}
+
+// unlimited is the budget of the searches without one.
+type unlimited struct{}
+
+func (unlimited) Read(uint64) error { return nil }
+func (unlimited) Visit() error      { return nil }
+
 // FindSymbol finds symbol by name in the given elf file.
-func FindSymbol(ef *elf.File, symbol string) (*elf.Symbol, error) {
-	sym, err := getSymbol(ef, elf.SHT_SYMTAB, symbol)
+func FindSymbol(ef *elf.File, symbol string, opts ...Option) (*elf.Symbol, error) {
+	return FindSymbolContext(context.Background(), ef, symbol, opts...)
+}
+
+// FindSymbolContext is like FindSymbol, the given context cancels the search.
+// The symbol tables are streamed rather than read into memory.
+func FindSymbolContext(ctx context.Context, ef *elf.File, symbol string, opts ...Option) (*elf.Symbol, error) {
+	o := &options{budget: unlimited{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	sym, err := getSymbol(ctx, ef, elf.SHT_SYMTAB, symbol, o.budget)
 	// If there are no symbols, try dynamic symbols.
 	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
 		return nil, fmt.Errorf("error getting ELF symbols: %w", err)
@@ -73,7 +121,7 @@ func FindSymbol(ef *elf.File, symbol string) (*elf.Symbol, error) {
 		return sym, nil
 	}
 
-	sym, err = getSymbol(ef, elf.SHT_DYNSYM, symbol)
+	sym, err = getSymbol(ctx, ef, elf.SHT_DYNSYM, symbol, o.budget)
 	if err != nil {
 		return nil, fmt.Errorf("error reading ELF dynamic symbols: %w", err)
 	}
@@ -84,13 +132,13 @@ func FindSymbol(ef *elf.File, symbol string) (*elf.Symbol, error) {
 	return nil, fmt.Errorf("symbol %q not found", symbol)
 }
 
-func getSymbol(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol, error) {
+func getSymbol(ctx context.Context, ef *elf.File, typ elf.SectionType, symbol string, b Budget) (*elf.Symbol, error) {
 	switch ef.Class {
 	case elf.ELFCLASS64:
-		return getSymbol64(ef, typ, symbol)
+		return getSymbol64(ctx, ef, typ, symbol, b)
 
 	case elf.ELFCLASS32:
-		return getSymbol32(ef, typ, symbol)
+		return getSymbol32(ctx, ef, typ, symbol, b)
 
 	case elf.ELFCLASSNONE:
 		fallthrough
@@ -100,18 +148,18 @@ func getSymbol(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol, e
 	}
 }
 
-func getSymbol32(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol, error) {
+func getSymbol32(ctx context.Context, ef *elf.File, typ elf.SectionType, symbol string, b Budget) (*elf.Symbol, error) {
 	symtabSection := ef.SectionByType(typ)
 	if symtabSection == nil {
 		return nil, elf.ErrNoSymbols
 	}
 
-	strdataReader, err := stringTableReader(ef, symtabSection.Link)
+	strdataReader, err := stringTableReader(ef, symtabSection.Link, b)
 	if err != nil {
 		return nil, fmt.Errorf("cannot load string table section: %w", err)
 	}
 
-	match, err := firstIndexOfMatchingSymbol(strdataReader, [][]byte{[]byte(symbol)})
+	match, err := firstIndexOfMatchingSymbol(ctx, strdataReader, [][]byte{[]byte(symbol)})
 	if err != nil {
 		return nil, fmt.Errorf("cannot find symbol: %w", err)
 	}
@@ -119,25 +167,30 @@ func getSymbol32(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol,
 		return nil, fmt.Errorf("symbol not found, %q", symbol)
 	}
 
-	data, err := symtabSection.Data()
-	if err != nil {
-		return nil, fmt.Errorf("cannot load symbol section: %w", err)
+	if symtabSection.Size%elf.Sym32Size != 0 {
+		return nil, errors.New("length of symbol section is not a multiple of Sym32Size")
 	}
-
-	symtab := bytes.NewReader(data)
-	if symtab.Len()%elf.Sym64Size != 0 {
-		return nil, errors.New("length of symbol section is not a multiple of Sym64Size")
+	if err := b.Read(symtabSection.Size); err != nil {
+		return nil, fmt.Errorf("cannot read symbol section: %w", err)
 	}
+	symtab := bufio.NewReader(symtabSection.Open())
 
 	// The first entry is all zeros.
 	var skip [elf.Sym32Size]byte
-	_, err = symtab.Read(skip[:])
-	if err != nil {
+	if _, err := io.ReadFull(symtab, skip[:]); err != nil {
 		return nil, fmt.Errorf("cannot read first entry: %w", err)
 	}
 
 	var sym elf.Sym32
-	for symtab.Len() > 0 {
+	for i := uint64(1); i < symtabSection.Size/elf.Sym32Size; i++ {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if err := b.Visit(); err != nil {
+			return nil, err
+		}
 		if err := binary.Read(symtab, ef.ByteOrder, &sym); err != nil {
 			return nil, fmt.Errorf("cannot read symbol: %w", err)
 		}
@@ -164,18 +217,18 @@ func getSymbol32(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol,
 	return nil, fmt.Errorf("symbol not found, %q", symbol)
 }
 
-func getSymbol64(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol, error) {
+func getSymbol64(ctx context.Context, ef *elf.File, typ elf.SectionType, symbol string, b Budget) (*elf.Symbol, error) {
 	symtabSection := ef.SectionByType(typ)
 	if symtabSection == nil {
 		return nil, elf.ErrNoSymbols
 	}
 
-	strdataReader, err := stringTableReader(ef, symtabSection.Link)
+	strdataReader, err := stringTableReader(ef, symtabSection.Link, b)
 	if err != nil {
 		return nil, fmt.Errorf("cannot load string table section: %w", err)
 	}
 
-	match, err := firstIndexOfMatchingSymbol(strdataReader, [][]byte{[]byte(symbol)})
+	match, err := firstIndexOfMatchingSymbol(ctx, strdataReader, [][]byte{[]byte(symbol)})
 	if err != nil {
 		return nil, fmt.Errorf("cannot find symbol: %w", err)
 	}
@@ -183,25 +236,30 @@ func getSymbol64(ef *elf.File, typ elf.SectionType, symbol string) (*elf.Symbol,
 		return nil, fmt.Errorf("symbol not found, %q", symbol)
 	}
 
-	data, err := symtabSection.Data()
-	if err != nil {
-		return nil, fmt.Errorf("cannot load symbol section: %w", err)
-	}
-
-	symtab := bytes.NewReader(data)
-	if symtab.Len()%elf.Sym64Size != 0 {
+	if symtabSection.Size%elf.Sym64Size != 0 {
 		return nil, errors.New("length of symbol section is not a multiple of Sym64Size")
 	}
+	if err := b.Read(symtabSection.Size); err != nil {
+		return nil, fmt.Errorf("cannot read symbol section: %w", err)
+	}
+	symtab := bufio.NewReader(symtabSection.Open())
 
 	// The first entry is all zeros.
 	var skip [elf.Sym64Size]byte
-	_, err = symtab.Read(skip[:])
-	if err != nil {
+	if _, err := io.ReadFull(symtab, skip[:]); err != nil {
 		return nil, fmt.Errorf("cannot read first entry: %w", err)
 	}
 
 	var sym elf.Sym64
-	for symtab.Len() > 0 {
+	for i := uint64(1); i < symtabSection.Size/elf.Sym64Size; i++ {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if err := b.Visit(); err != nil {
+			return nil, err
+		}
 		if err := binary.Read(symtab, ef.ByteOrder, &sym); err != nil {
 			return nil, fmt.Errorf("cannot read symbol: %w", err)
 		}
@@ -251,10 +309,13 @@ func readStringFromReaderSeeker(rs io.ReadSeeker, start int) (string, error) {
 }
 
 // stringTable reads and returns the string table given by the
-// specified link value.
-func stringTableReader(ef *elf.File, link uint32) (io.ReadSeeker, error) {
+// specified link value, once accounted for in the given budget.
+func stringTableReader(ef *elf.File, link uint32, b Budget) (io.ReadSeeker, error) {
 	if link <= 0 || link >= uint32(len(ef.Sections)) {
 		return nil, errors.New("section has invalid string table link")
 	}
+	if err := b.Read(ef.Sections[link].Size); err != nil {
+		return nil, err
+	}
 	return ef.Sections[link].Open(), nil
 }
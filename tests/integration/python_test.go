@@ -49,7 +49,7 @@ func TestPythonIntegration(t *testing.T) {
 				t.Fatalf("python.DataMapForLayout(%s) = nil", version)
 			}
 
-			dm, err := datamap.New(layoutMap)
+			dm, err := datamap.New(layoutMap, datamap.WithVersion(version))
 			if err != nil {
 				t.Fatalf("python.GenerateDataMap(%s) = %v", version, err)
 			}
@@ -47,7 +47,7 @@ func TestRubyIntegration(t *testing.T) {
 				t.Fatalf("ruby.DataMapForLayout(%s) = nil", version)
 			}
 
-			dm, err := datamap.New(layoutMap)
+			dm, err := datamap.New(layoutMap, datamap.WithVersion(version))
 			if err != nil {
 				t.Fatalf("ruby.GenerateDataMap(%s) = %v", version, err)
 			}